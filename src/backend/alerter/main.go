@@ -8,8 +8,12 @@ package main
 
 import (
 	dynamoSub "Notifier/src/dynamo"
+	"Notifier/src/logging"
 	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -19,11 +23,14 @@ import (
 
 type Event struct {
 	Response string `json:"response"`
+	// Records are set when the events topic invokes the alerter
+	Records []events.SNSEventRecord `json:"Records"`
 }
 
 func HandleRequest(ctx context.Context, event *Event) (string, error) {
 	/*
-		Call the alerting service
+		Call the alerting service, or alert of the failed payments
+		of the events the events topic delivers
 	*/
 
 	region := os.Getenv("region")
@@ -39,11 +46,45 @@ func HandleRequest(ctx context.Context, event *Event) (string, error) {
 	dynamoCli := dynamodb.New(sess)
 	snsCli := sns.New(sess)
 
-	dynamoSub.SendAlert(dynamoCli, snsCli, snsArn)
+	lambdaRequestId := ""
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		lambdaRequestId = lc.AwsRequestID
+	}
+
+	if len(event.Records) > 0 {
+		for _, record := range event.Records {
+			// each event is followed by the correlation id it was published
+			// with, else by the id of its SNS message
+			var envelope struct {
+				CorrelationId string `json:"correlation_id"`
+			}
+			if json.Unmarshal([]byte(record.SNS.Message), &envelope) != nil || envelope.CorrelationId == "" {
+				envelope.CorrelationId = record.SNS.MessageID
+			}
+			recordCtx := logging.WithRequest(ctx, logging.RequestFields{
+				CorrelationId:   envelope.CorrelationId,
+				LambdaRequestId: lambdaRequestId,
+				Route:           "sns:payment-failed",
+			})
+			logging.FromContext(recordCtx).Info("Received event")
+			dynamoSub.SendPaymentFailedAlert(recordCtx, dynamoCli, snsCli, snsArn, record.SNS.Message)
+		}
+		return "200", nil
+	}
+
+	ctx = logging.WithRequest(ctx, logging.RequestFields{
+		LambdaRequestId: lambdaRequestId,
+		Route:           "schedule:alerts",
+	})
+	logging.FromContext(ctx).Info("Sending scheduled alerts")
+	dynamoSub.SendAlert(ctx, dynamoCli, snsCli, snsArn)
+	dynamoSub.SendCancellationReminders(ctx, dynamoCli, snsCli, snsArn)
+	dynamoSub.SendCardExpiryAlerts(ctx, dynamoCli, snsCli, snsArn)
 
 	return "200", nil
 }
 
 func main() {
+	logging.Setup("alerter")
 	lambda.Start(HandleRequest)
 }
@@ -0,0 +1,174 @@
+package dynamoSub
+
+import (
+	"Notifier/src/logging"
+	"Notifier/src/sns_notifier"
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// subscriptionsTable is the table of the subscriptions service, which
+// records the cancellations
+const subscriptionsTable = "subscriptions-new"
+
+// cancellationReminderDays is how many days before its cancel-by date a
+// pending cancellation is reminded of, every day until it is confirmed
+const cancellationReminderDays = 7
+
+type CancellationToRemind struct {
+	PartitionKey   string `dynamodbav:"username"`
+	SubscriptionId string `dynamodbav:"uuid"`
+	Name           string `dynamodbav:"name"`
+	Cancellation   struct {
+		Status           string   `dynamodbav:"status"`
+		CancelBy         string   `dynamodbav:"cancel_by"`
+		RequestedBy      string   `dynamodbav:"requested_by"`
+		SettingsUrl      string   `dynamodbav:"settings_url"`
+		Steps            []string `dynamodbav:"steps"`
+		LastReminderDate string   `dynamodbav:"last_reminder_date"`
+	} `dynamodbav:"cancellation"`
+}
+
+func getUserEmail(dynamoCli *dynamodb.DynamoDB, userName string) (string, bool, error) {
+	/*
+		Gets the email a user signed up with.
+		Params: dynamoCli *dynamodb.DynamoDB
+				userName string
+		Returned: string, bool (whether the user exists), error
+	*/
+	result, err := dynamoCli.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("users"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserName": {
+				S: aws.String(userName),
+			},
+		},
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if result.Item == nil || result.Item["Email"] == nil || result.Item["Email"].S == nil {
+		return "", false, nil
+	}
+	return *result.Item["Email"].S, true, nil
+}
+
+func GetPendingCancellations(ctx context.Context, dynamoCli *dynamodb.DynamoDB, today string) []CancellationToRemind {
+	/*
+		Gets the pending cancellations not reminded of today whose cancel-by
+		date is at most cancellationReminderDays away or already past.
+		Params: ctx context.Context
+				dynamoCli *dynamodb.DynamoDB
+				today string (YYYY-MM-DD)
+		Returned: []CancellationToRemind
+	*/
+	horizon, _ := time.Parse("2006-01-02", today)
+	remindFrom := horizon.AddDate(0, 0, cancellationReminderDays).Format("2006-01-02")
+
+	scanExpr := &dynamodb.ScanInput{
+		TableName:        aws.String(subscriptionsTable),
+		FilterExpression: aws.String("cancellation.#status = :pending AND cancellation.cancel_by <= :remind_from AND (attribute_not_exists(cancellation.last_reminder_date) OR cancellation.last_reminder_date < :today)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pending":     {S: aws.String("pending")},
+			":remind_from": {S: aws.String(remindFrom)},
+			":today":       {S: aws.String(today)},
+		},
+	}
+	logging.FromContext(ctx).Info("Scanning the dynamoDB table to get pending cancellations")
+	var cancellations []CancellationToRemind
+	err := dynamoCli.ScanPages(scanExpr, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var cancellation CancellationToRemind
+			if err := dynamodbattribute.UnmarshalMap(item, &cancellation); err != nil {
+				logging.FromContext(ctx).Warn("Skipping unreadable cancellation", logging.ErrorField, err)
+				continue
+			}
+			cancellations = append(cancellations, cancellation)
+		}
+		return true
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Error scanning table", logging.ErrorField, err)
+		return nil
+	}
+	return cancellations
+}
+
+func markReminded(dynamoCli *dynamodb.DynamoDB, cancellation CancellationToRemind, today string) error {
+	/*
+		Records that a pending cancellation was reminded of today, unless it
+		was confirmed or abandoned meanwhile.
+		Params: dynamoCli *dynamodb.DynamoDB
+				cancellation CancellationToRemind
+				today string
+		Returned: error
+	*/
+	_, err := dynamoCli.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(subscriptionsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {S: aws.String(cancellation.PartitionKey)},
+			"uuid":     {S: aws.String(cancellation.SubscriptionId)},
+		},
+		UpdateExpression:    aws.String("SET cancellation.last_reminder_date = :today"),
+		ConditionExpression: aws.String("cancellation.#status = :pending"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pending": {S: aws.String("pending")},
+			":today":   {S: aws.String(today)},
+		},
+	})
+	return err
+}
+
+func SendCancellationReminders(ctx context.Context, dynamoCli *dynamodb.DynamoDB, snsCli *sns.SNS, snsArn string) {
+	/*
+		Reminds the users of the cancellations they started and did not
+		confirm yet, once a day, with the vendor's settings page and steps.
+		Params: ctx context.Context
+				dynamoCli *dynamodb.DynamoDB
+				snsCli *sns.SNS
+				snsArn string
+		Returned: None
+	*/
+	today := time.Now().UTC().Format("2006-01-02")
+	cancellations := GetPendingCancellations(ctx, dynamoCli, today)
+	logging.FromContext(ctx).Info("Found pending cancellations to remind of", "count", len(cancellations))
+
+	for _, cancellation := range cancellations {
+		userCtx := logging.WithUserName(ctx, cancellation.Cancellation.RequestedBy)
+		logger := logging.FromContext(userCtx)
+		email, ok, err := getUserEmail(dynamoCli, cancellation.Cancellation.RequestedBy)
+		if err != nil {
+			logger.Error("Error getting email of user", logging.ErrorField, err)
+			continue
+		}
+		if !ok {
+			logger.Info("User has no email to remind of cancelling", logging.SubscriptionIdField, cancellation.SubscriptionId)
+			continue
+		}
+		emailValues := sns_notifier.CancellationReminderFormat(
+			cancellation.Cancellation.RequestedBy,
+			cancellation.Name,
+			cancellation.Cancellation.CancelBy,
+			cancellation.Cancellation.SettingsUrl,
+			cancellation.Cancellation.Steps,
+			cancellation.Cancellation.CancelBy < today,
+		)
+		sns_notifier.PublishMessage(userCtx, snsCli, snsArn, emailValues.Message, emailValues.Body, email)
+
+		err = markReminded(dynamoCli, cancellation, today)
+		if err != nil {
+			logger.Error("Error recording the reminder of cancelling", logging.SubscriptionIdField, cancellation.SubscriptionId, logging.ErrorField, err)
+		}
+	}
+}
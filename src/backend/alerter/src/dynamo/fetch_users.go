@@ -1,9 +1,9 @@
 package dynamoSub
 
 import (
+	"Notifier/src/logging"
 	"Notifier/src/sns_notifier"
-	"fmt"
-	"log"
+	"context"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -27,7 +27,7 @@ type Result struct {
 	Error        error
 }
 
-func worker(dynamoCli *dynamodb.DynamoDB, snsCli *sns.SNS, snsArn string, jobs <-chan Job, results chan<- Result) {
+func worker(ctx context.Context, dynamoCli *dynamodb.DynamoDB, snsCli *sns.SNS, snsArn string, jobs <-chan Job, results chan<- Result) {
 	for job := range jobs {
 		item := job.Subscription
 
@@ -40,30 +40,31 @@ func worker(dynamoCli *dynamodb.DynamoDB, snsCli *sns.SNS, snsArn string, jobs <
 			},
 		}
 
-		log.Printf("Getting email for username %s \n", item.UserName)
+		logger := logging.FromContext(ctx).With(logging.UserNameField, item.UserName)
+		logger.Info("Getting email for username")
 		result, derr := dynamoCli.GetItem(input)
 		if derr != nil {
 			results <- Result{Subscription: item, Error: derr}
 			continue
 		}
 		if result.Item == nil {
-			fmt.Printf("%s does not have any subscriptions \n", item.UserName)
+			logger.Info("User does not have any subscriptions")
 			continue
 		}
-		fmt.Println(result)
 		email := *result.Item["Email"].S
 		emailValues := sns_notifier.SnsMessageFormat(item.UserName, item.VendorName)
-		sns_notifier.PublishMessage(snsCli, snsArn, emailValues.Message, emailValues.Body, email)
+		sns_notifier.PublishMessage(logging.WithUserName(ctx, item.UserName), snsCli, snsArn, emailValues.Message, emailValues.Body, email)
 
 		results <- Result{Subscription: item}
 	}
 }
 
-func GetAllExpiringSubscriptions(dynamoCli *dynamodb.DynamoDB) []SubscriptionsToAlert {
+func GetAllExpiringSubscriptions(ctx context.Context, dynamoCli *dynamodb.DynamoDB) []SubscriptionsToAlert {
 	/*
 		Gets all the subscriptions that are only one day
 		from getting renewed.
-		Params: dynamoCli *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoCli *dynamodb.DynamoDB
 		Returned: []SubscriptionsToAlert
 	*/
 
@@ -76,10 +77,10 @@ func GetAllExpiringSubscriptions(dynamoCli *dynamodb.DynamoDB) []SubscriptionsTo
 			":rt": {S: aws.String(nextDay)},
 		},
 	}
-	log.Println("Scanning the dynamoDB table to get expiring subscriptions")
+	logging.FromContext(ctx).Info("Scanning the dynamoDB table to get expiring subscriptions")
 	result, err := dynamoCli.Scan(scanExpr)
 	if err != nil {
-		fmt.Println("Error scanning table:", err)
+		logging.FromContext(ctx).Error("Error scanning table", logging.ErrorField, err)
 		return nil
 	}
 
@@ -96,14 +97,14 @@ func GetAllExpiringSubscriptions(dynamoCli *dynamodb.DynamoDB) []SubscriptionsTo
 	return subscriptions
 }
 
-func SendAlert(dynamoCli *dynamodb.DynamoDB, snsCli *sns.SNS, snsArn string) {
-	subscriptions := GetAllExpiringSubscriptions(dynamoCli)
+func SendAlert(ctx context.Context, dynamoCli *dynamodb.DynamoDB, snsCli *sns.SNS, snsArn string) {
+	subscriptions := GetAllExpiringSubscriptions(ctx, dynamoCli)
 
 	jobs := make(chan Job, len(subscriptions))
 	results := make(chan Result, len(subscriptions))
 
 	for w := 1; w <= workerCount; w++ {
-		go worker(dynamoCli, snsCli, snsArn, jobs, results)
+		go worker(ctx, dynamoCli, snsCli, snsArn, jobs, results)
 	}
 
 	for _, subscription := range subscriptions {
@@ -114,7 +115,7 @@ func SendAlert(dynamoCli *dynamodb.DynamoDB, snsCli *sns.SNS, snsArn string) {
 	for range subscriptions {
 		result := <-results
 		if result.Error != nil {
-			log.Printf("Error processing subscription for user %s: %v", result.Subscription.UserName, result.Error)
+			logging.FromContext(ctx).Error("Error processing subscription", logging.UserNameField, result.Subscription.UserName, logging.ErrorField, result.Error)
 		}
 	}
 }
@@ -0,0 +1,77 @@
+package dynamoSub
+
+import (
+	"Notifier/src/logging"
+	"Notifier/src/sns_notifier"
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// paymentFailedEvent is the type of the event the subscriptions service
+// publishes when a payment fails
+const paymentFailedEvent = "payment.failed"
+
+type PaymentFailedEvent struct {
+	Id       string `json:"id"`
+	Type     string `json:"type"`
+	UserName string `json:"username"`
+	Data     struct {
+		Payment struct {
+			SubscriptionId string  `json:"subscription_id"`
+			Amount         float32 `json:"amount"`
+			PaymentDate    string  `json:"payment_date"`
+			FailureReason  string  `json:"failure_reason"`
+		} `json:"payment"`
+		SubscriptionName string `json:"subscription_name"`
+	} `json:"data"`
+}
+
+func SendPaymentFailedAlert(ctx context.Context, dynamoCli *dynamodb.DynamoDB, snsCli *sns.SNS, snsArn string, message string) {
+	/*
+		Emails the user who recorded a payment that it failed, from a
+		payment.failed event of the events topic. Other events are ignored.
+		Params: ctx context.Context
+				dynamoCli *dynamodb.DynamoDB
+				snsCli *sns.SNS
+				snsArn string
+				message string (the event)
+		Returned: None
+	*/
+	var event PaymentFailedEvent
+	err := json.Unmarshal([]byte(message), &event)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Skipping unreadable event", logging.ErrorField, err)
+		return
+	}
+	if event.Type != paymentFailedEvent {
+		return
+	}
+	ctx = logging.WithUserName(ctx, event.UserName)
+	logger := logging.FromContext(ctx).With(logging.EventIdField, event.Id)
+
+	email, ok, err := getUserEmail(dynamoCli, event.UserName)
+	if err != nil {
+		logger.Error("Error getting email of user", logging.ErrorField, err)
+		return
+	}
+	if !ok {
+		logger.Info("User has no email to alert of failed payment", logging.SubscriptionIdField, event.Data.Payment.SubscriptionId)
+		return
+	}
+	subscription := event.Data.SubscriptionName
+	if subscription == "" {
+		subscription = "your subscription"
+	}
+	emailValues := sns_notifier.PaymentFailedFormat(
+		event.UserName,
+		subscription,
+		event.Data.Payment.Amount,
+		event.Data.Payment.PaymentDate,
+		event.Data.Payment.FailureReason,
+	)
+	sns_notifier.PublishMessage(ctx, snsCli, snsArn, emailValues.Message, emailValues.Body, email)
+	logger.Info("Alerted user of failed payment")
+}
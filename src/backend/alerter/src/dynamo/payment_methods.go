@@ -0,0 +1,235 @@
+package dynamoSub
+
+import (
+	"Notifier/src/logging"
+	"Notifier/src/sns_notifier"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// paymentMethodsTable is the table of the payment methods of the
+// subscriptions service
+const paymentMethodsTable = "payment-methods"
+
+// cardExpiryAlertDays is how many days before its expiry a card is warned
+// of, once per expiry
+const cardExpiryAlertDays = 30
+
+type ExpiringCard struct {
+	UserName         string `dynamodbav:"username"`
+	PaymentMethodId  string `dynamodbav:"payment_method_id"`
+	Nickname         string `dynamodbav:"nickname"`
+	Brand            string `dynamodbav:"brand"`
+	LastFour         string `dynamodbav:"last_four"`
+	ExpiryMonth      int    `dynamodbav:"expiry_month"`
+	ExpiryYear       int    `dynamodbav:"expiry_year"`
+	ExpiryAlertedFor string `dynamodbav:"expiry_alerted_for"`
+}
+
+type CardSubscription struct {
+	PaymentMethodId string  `dynamodbav:"payment_method_id"`
+	Name            string  `dynamodbav:"name"`
+	Cost            float64 `dynamodbav:"cost"`
+	Currency        string  `dynamodbav:"currency"`
+	BillingCycle    string  `dynamodbav:"billing_cycle"`
+	Status          string  `dynamodbav:"status"`
+	CancelAt        string  `dynamodbav:"cancel_at"`
+}
+
+func (card ExpiringCard) expiry() string {
+	/*
+		Returns the expiry of a card as YYYY-MM.
+		Params: None
+		Returned: string
+	*/
+	return fmt.Sprintf("%04d-%02d", card.ExpiryYear, card.ExpiryMonth)
+}
+
+func (card ExpiringCard) expiresOn() string {
+	/*
+		Returns the last day a card can be charged, the last day of its
+		expiry month, as YYYY-MM-DD.
+		Params: None
+		Returned: string
+	*/
+	return time.Date(card.ExpiryYear, time.Month(card.ExpiryMonth)+1, 0, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+}
+
+func GetExpiringCards(ctx context.Context, dynamoCli *dynamodb.DynamoDB, now time.Time) []ExpiringCard {
+	/*
+		Gets the cards expiring within cardExpiryAlertDays, or already
+		expired, whose current expiry was not warned of yet.
+		Params: ctx context.Context
+				dynamoCli *dynamodb.DynamoDB
+				now time.Time
+		Returned: []ExpiringCard
+	*/
+	horizon := now.AddDate(0, 0, cardExpiryAlertDays).Format("2006-01-02")
+
+	scanExpr := &dynamodb.ScanInput{
+		TableName:        aws.String(paymentMethodsTable),
+		FilterExpression: aws.String("#type = :card AND attribute_exists(expiry_year)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#type": aws.String("type"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":card": {S: aws.String("card")},
+		},
+	}
+	logging.FromContext(ctx).Info("Scanning the dynamoDB table to get expiring cards")
+	var cards []ExpiringCard
+	err := dynamoCli.ScanPages(scanExpr, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var card ExpiringCard
+			if err := dynamodbattribute.UnmarshalMap(item, &card); err != nil {
+				logging.FromContext(ctx).Warn("Skipping unreadable payment method", logging.ErrorField, err)
+				continue
+			}
+			// the expiry is computed here, it is stored as month and year
+			if card.ExpiryMonth < 1 || card.ExpiryMonth > 12 || card.expiresOn() > horizon || card.ExpiryAlertedFor == card.expiry() {
+				continue
+			}
+			cards = append(cards, card)
+		}
+		return true
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Error scanning table", logging.ErrorField, err)
+		return nil
+	}
+	return cards
+}
+
+func GetCardSubscriptions(ctx context.Context, dynamoCli *dynamodb.DynamoDB, cards []ExpiringCard) map[string][]CardSubscription {
+	/*
+		Gets the subscriptions that will fail to renew on each expiring card:
+		those paid with it which are neither cancelled, paused nor ending by
+		the card's expiry.
+		Params: ctx context.Context
+				dynamoCli *dynamodb.DynamoDB
+				cards []ExpiringCard
+		Returned: map[string][]CardSubscription (by payment method id)
+	*/
+	expiresOn := map[string]string{}
+	for _, card := range cards {
+		expiresOn[card.PaymentMethodId] = card.expiresOn()
+	}
+
+	scanExpr := &dynamodb.ScanInput{
+		TableName:        aws.String(subscriptionsTable),
+		FilterExpression: aws.String("attribute_exists(payment_method_id) AND payment_method_id <> :none"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":none": {S: aws.String("")},
+		},
+	}
+	logging.FromContext(ctx).Info("Scanning the dynamoDB table to get the subscriptions paid with expiring cards")
+	subscriptions := map[string][]CardSubscription{}
+	err := dynamoCli.ScanPages(scanExpr, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var subscription CardSubscription
+			if err := dynamodbattribute.UnmarshalMap(item, &subscription); err != nil {
+				logging.FromContext(ctx).Warn("Skipping unreadable subscription", logging.ErrorField, err)
+				continue
+			}
+			expiry, ok := expiresOn[subscription.PaymentMethodId]
+			if !ok || subscription.Status == "cancelled" || subscription.Status == "paused" {
+				continue
+			}
+			if subscription.CancelAt != "" && subscription.CancelAt <= expiry {
+				continue
+			}
+			subscriptions[subscription.PaymentMethodId] = append(subscriptions[subscription.PaymentMethodId], subscription)
+		}
+		return true
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Error scanning table", logging.ErrorField, err)
+		return nil
+	}
+	return subscriptions
+}
+
+func markExpiryAlerted(dynamoCli *dynamodb.DynamoDB, card ExpiringCard) error {
+	/*
+		Records that the current expiry of a card was warned of, unless the
+		card was renewed or deleted meanwhile.
+		Params: dynamoCli *dynamodb.DynamoDB
+				card ExpiringCard
+		Returned: error
+	*/
+	_, err := dynamoCli.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(paymentMethodsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username":          {S: aws.String(card.UserName)},
+			"payment_method_id": {S: aws.String(card.PaymentMethodId)},
+		},
+		UpdateExpression:    aws.String("SET expiry_alerted_for = :expiry"),
+		ConditionExpression: aws.String("expiry_month = :month AND expiry_year = :year"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":expiry": {S: aws.String(card.expiry())},
+			":month":  {N: aws.String(fmt.Sprint(card.ExpiryMonth))},
+			":year":   {N: aws.String(fmt.Sprint(card.ExpiryYear))},
+		},
+	})
+	return err
+}
+
+func SendCardExpiryAlerts(ctx context.Context, dynamoCli *dynamodb.DynamoDB, snsCli *sns.SNS, snsArn string) {
+	/*
+		Warns the users of their cards expiring within cardExpiryAlertDays,
+		once per expiry, listing the subscriptions that will fail to renew
+		on them. Cards paying for no renewing subscription are not warned of.
+		Params: ctx context.Context
+				dynamoCli *dynamodb.DynamoDB
+				snsCli *sns.SNS
+				snsArn string
+		Returned: None
+	*/
+	now := time.Now().UTC()
+	cards := GetExpiringCards(ctx, dynamoCli, now)
+	logging.FromContext(ctx).Info("Found expiring cards to warn of", "count", len(cards))
+	if len(cards) == 0 {
+		return
+	}
+	subscriptions := GetCardSubscriptions(ctx, dynamoCli, cards)
+	if subscriptions == nil {
+		return
+	}
+	today := now.Format("2006-01-02")
+
+	for _, card := range cards {
+		affected := subscriptions[card.PaymentMethodId]
+		if len(affected) == 0 {
+			// warned of later if a renewing subscription is linked to it
+			continue
+		}
+		cardCtx := logging.WithUserName(ctx, card.UserName)
+		logger := logging.FromContext(cardCtx)
+		email, ok, err := getUserEmail(dynamoCli, card.UserName)
+		if err != nil {
+			logger.Error("Error getting email of user", logging.ErrorField, err)
+			continue
+		}
+		if !ok {
+			logger.Info("User has no email to warn of card expiring", logging.PaymentMethodIdField, card.PaymentMethodId)
+			continue
+		}
+		names := make([]string, len(affected))
+		for i, subscription := range affected {
+			names[i] = fmt.Sprintf("%s (%.2f %s %s)", subscription.Name, subscription.Cost, subscription.Currency, subscription.BillingCycle)
+		}
+		emailValues := sns_notifier.CardExpiryFormat(card.UserName, card.Nickname, card.Brand, card.LastFour, card.expiresOn(), names, card.expiresOn() < today)
+		sns_notifier.PublishMessage(cardCtx, snsCli, snsArn, emailValues.Message, emailValues.Body, email)
+
+		err = markExpiryAlerted(dynamoCli, card)
+		if err != nil {
+			logger.Error("Error recording the expiry alert of card", logging.PaymentMethodIdField, card.PaymentMethodId, logging.ErrorField, err)
+		}
+	}
+}
@@ -1,11 +1,12 @@
 package sns_notifier
 
 import (
+	"Notifier/src/logging"
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/sns"
-	"log"
 	"os"
 )
 
@@ -43,11 +44,12 @@ SUBHUB
 	}
 }
 
-func PublishMessage(snsCli *sns.SNS, snsArn, subject, body, email string) {
+func PublishMessage(ctx context.Context, snsCli *sns.SNS, snsArn, subject, body, email string) {
 	/*
 		Publishes an SNS message to the specified email
 		address
-		Params: snsCli *sns.SNS,
+		Params: ctx context.Context
+				snsCli *sns.SNS,
 				snsArn string
 				subject string
 				body string
@@ -65,28 +67,158 @@ func PublishMessage(snsCli *sns.SNS, snsArn, subject, body, email string) {
 			},
 		},
 	}
-	fmt.Printf("Sending alert to email %s", email)
+	logger := logging.FromContext(ctx)
+	logger.Info("Sending alert", "email", email)
 	_, err := snsCli.Publish(input)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case sns.ErrCodeInvalidParameterException, sns.ErrCodeValidationException:
-				log.Printf("Invalid parameter for subscription for email %s", email)
+				logger.Error("Invalid parameter for subscription", "email", email, logging.ErrorField, err)
 				os.Exit(1)
 			case sns.ErrCodeNotFoundException:
-				log.Printf("Unable to find SNS topic for pushing subscription, please check arn %s", snsArn)
+				logger.Error("Unable to find SNS topic for pushing subscription, please check arn", "sns_arn", snsArn, logging.ErrorField, err)
 				os.Exit(1)
 			case sns.ErrCodeEndpointDisabledException:
-				log.Printf("Invalid Endpoint for subscribing email %s", email)
+				logger.Error("Invalid Endpoint for subscribing email", "email", email, logging.ErrorField, err)
 				os.Exit(1)
 			}
 		} else {
-			log.Printf("Got error calling GetItem: %s", err)
+			logger.Error("Got error calling Publish", logging.ErrorField, err)
 			os.Exit(1)
 		}
 	}
 	if err != nil {
-		fmt.Printf("Unable to Publish message to %s", email)
+		logger.Error("Unable to Publish message", "email", email, logging.ErrorField, err)
 		os.Exit(1)
 	}
 }
+
+func CancellationReminderFormat(username, subscription, cancelBy, settingsUrl string, steps []string, overdue bool) MessageAttributes {
+	/*
+		Formats the email body and message reminding a user to
+		cancel a subscription they decided to drop
+		Params: username string
+				subscription string
+				cancelBy string
+				settingsUrl string
+				steps []string
+				overdue bool (whether the cancel-by date is past)
+		Return: MessageAttributes
+	*/
+
+	subject := fmt.Sprintf("Reminder: Cancel your %s Subscription by %s", subscription, cancelBy)
+	deadline := fmt.Sprintf("Please cancel it by %s so that it does not renew.", cancelBy)
+	if overdue {
+		subject = fmt.Sprintf("Overdue: Your %s Subscription is not cancelled yet", subscription)
+		deadline = fmt.Sprintf("It was due to be cancelled by %s; it may renew if it is not cancelled now.", cancelBy)
+	}
+
+	instructions := ""
+	if settingsUrl != "" {
+		instructions += fmt.Sprintf("Manage the subscription at %s\n\n", settingsUrl)
+	}
+	for i, step := range steps {
+		instructions += fmt.Sprintf("%d. %s\n", i+1, step)
+	}
+
+	message := fmt.Sprintf(`Dear %s,
+
+You decided to cancel your subscription to %s. %s
+
+%s
+Once it is cancelled, confirm the cancellation in SUBHUB with the confirmation number from %s to stop these reminders.
+
+Sincerely,
+SUBHUB
+	`, username, subscription, deadline, instructions, subscription)
+
+	return MessageAttributes{
+		Message: subject,
+		Body:    message,
+	}
+}
+
+func CardExpiryFormat(username, nickname, brand, lastFour, expiresOn string, subscriptions []string, expired bool) MessageAttributes {
+	/*
+		Formats the email body and message warning a user that a
+		card expires, with the subscriptions that will fail to renew
+		Params: username string
+				nickname string
+				brand string
+				lastFour string
+				expiresOn string
+				subscriptions []string
+				expired bool (whether the card is already expired)
+		Return: MessageAttributes
+	*/
+
+	card := nickname
+	if brand != "" && lastFour != "" {
+		card = fmt.Sprintf("%s (%s ending in %s)", nickname, brand, lastFour)
+	} else if lastFour != "" {
+		card = fmt.Sprintf("%s (ending in %s)", nickname, lastFour)
+	}
+
+	subject := fmt.Sprintf("Your card %s expires on %s", nickname, expiresOn)
+	notice := fmt.Sprintf("Your card %s expires on %s.", card, expiresOn)
+	if expired {
+		subject = fmt.Sprintf("Your card %s has expired", nickname)
+		notice = fmt.Sprintf("Your card %s expired on %s.", card, expiresOn)
+	}
+
+	list := ""
+	for _, subscription := range subscriptions {
+		list += fmt.Sprintf("- %s\n", subscription)
+	}
+
+	message := fmt.Sprintf(`Dear %s,
+
+%s The following subscriptions are paid with it and will fail to renew unless you update the card with each provider:
+
+%s
+Once the card is renewed, update its expiry in SUBHUB.
+
+Sincerely,
+SUBHUB
+	`, username, notice, list)
+
+	return MessageAttributes{
+		Message: subject,
+		Body:    message,
+	}
+}
+
+func PaymentFailedFormat(username, subscription string, amount float32, paymentDate, reason string) MessageAttributes {
+	/*
+		Formats the email body and message telling a user that a
+		payment of a subscription failed
+		Params: username string
+				subscription string
+				amount float32
+				paymentDate string
+				reason string (empty when unknown)
+		Return: MessageAttributes
+	*/
+
+	subject := fmt.Sprintf("Payment failed: %s", subscription)
+	failure := fmt.Sprintf("The payment of %.2f for %s on %s failed.", amount, subscription, paymentDate)
+	if reason != "" {
+		failure += fmt.Sprintf(" Reason: %s.", reason)
+	}
+
+	message := fmt.Sprintf(`Dear %s,
+
+%s
+
+Please check the payment method of the subscription with the provider so that it does not lapse.
+
+Sincerely,
+SUBHUB
+	`, username, failure)
+
+	return MessageAttributes{
+		Message: subject,
+		Body:    message,
+	}
+}
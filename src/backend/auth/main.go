@@ -3,17 +3,20 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/sns"
+	"log/slog"
 	"movers/src/cognito_auth"
+	"movers/src/logging"
 	"movers/src/notifier"
 	"os"
+	"strings"
 )
 
 type cognitoAttr struct {
@@ -66,7 +69,7 @@ func initialize() cognitoAttr {
 	})
 
 	if err != nil {
-		fmt.Println("Error creating sess", err)
+		slog.Error("Error creating session", logging.ErrorField, err)
 		os.Exit(0)
 	}
 
@@ -92,16 +95,16 @@ func handlerSignUp(ctx context.Context, request events.APIGatewayProxyRequest) (
 	if err != nil {
 		return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 	}
+	ctx = logging.WithUserName(ctx, signup.Username)
 	cog_cli := initialize()
-	fmt.Println(request.Body)
-	userExists := cognito_auth.CheckIfUserExists(cog_cli.dynamoCli, cog_cli.tableName, signup.Username, signup.Email)
+	userExists := cognito_auth.CheckIfUserExists(ctx, cog_cli.dynamoCli, cog_cli.tableName, signup.Username, signup.Email)
 	if !userExists {
-		singupResponse := cognito_auth.SignUp(cog_cli.cognitoCli, cog_cli.clientId, signup.Username, signup.Password, signup.Name, signup.Email)
-		cognito_auth.AddUserToTable(cog_cli.dynamoCli, cog_cli.tableName, cognito_auth.TableItem{
+		singupResponse := cognito_auth.SignUp(ctx, cog_cli.cognitoCli, cog_cli.clientId, signup.Username, signup.Password, signup.Name, signup.Email)
+		cognito_auth.AddUserToTable(ctx, cog_cli.dynamoCli, cog_cli.tableName, cognito_auth.TableItem{
 			UserName: signup.Username,
 			Email:    signup.Email,
 		})
-		notifier.AddSNSSubscription(cog_cli.snsCli, cog_cli.topicArn, signup.Email)
+		notifier.AddSNSSubscription(ctx, cog_cli.snsCli, cog_cli.topicArn, signup.Email)
 		return events.APIGatewayProxyResponse{
 			StatusCode: singupResponse.Status,
 			Body:       singupResponse.Message,
@@ -121,9 +124,9 @@ func handlerSignIn(ctx context.Context, request events.APIGatewayProxyRequest) (
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 		}
+		ctx = logging.WithUserName(ctx, signin.Username)
 		cog_cli := initialize()
-		fmt.Println(request.Body)
-		singupResponse := cognito_auth.SignIn(cog_cli.cognitoCli, cog_cli.clientId, signin.Username, signin.Password)
+		singupResponse := cognito_auth.SignIn(ctx, cog_cli.cognitoCli, cog_cli.clientId, signin.Username, signin.Password)
 		return events.APIGatewayProxyResponse{
 			StatusCode: singupResponse.Status,
 			Body:       singupResponse.Message,
@@ -139,9 +142,9 @@ func handlerResendVerificationCode(ctx context.Context, request events.APIGatewa
 	if err != nil {
 		return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 	}
+	ctx = logging.WithUserName(ctx, cogGen.Username)
 	cog_cli := initialize()
-	fmt.Println(request.Body)
-	singupResponse := cognito_auth.ResendVerificationCode(cog_cli.cognitoCli, cog_cli.clientId, cogGen.Username)
+	singupResponse := cognito_auth.ResendVerificationCode(ctx, cog_cli.cognitoCli, cog_cli.clientId, cogGen.Username)
 	return events.APIGatewayProxyResponse{
 		StatusCode: singupResponse.Status,
 		Body:       singupResponse.Message,
@@ -155,9 +158,9 @@ func handlerForgotPassword(ctx context.Context, request events.APIGatewayProxyRe
 	if err != nil {
 		return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 	}
+	ctx = logging.WithUserName(ctx, resetGen.Username)
 	cog_cli := initialize()
-	fmt.Println(request.Body)
-	singupResponse := cognito_auth.ForgotPassword(cog_cli.cognitoCli, cog_cli.clientId, resetGen.Username)
+	singupResponse := cognito_auth.ForgotPassword(ctx, cog_cli.cognitoCli, cog_cli.clientId, resetGen.Username)
 	return events.APIGatewayProxyResponse{
 		StatusCode: singupResponse.Status,
 		Body:       singupResponse.Message,
@@ -169,12 +172,12 @@ func handlerConfirmSignup(ctx context.Context, request events.APIGatewayProxyReq
 	var signupConfirm Resetgen
 	err := json.Unmarshal([]byte(request.Body), &signupConfirm)
 	if err != nil {
-		fmt.Println(err)
+		logging.FromContext(ctx).Error("Error reading the request body", logging.ErrorField, err)
 		return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 	}
+	ctx = logging.WithUserName(ctx, signupConfirm.Username)
 	cog_cli := initialize()
-	fmt.Println(request.Body)
-	singupResponse := cognito_auth.ConfirmSignUp(cog_cli.cognitoCli, cog_cli.clientId, signupConfirm.Username, signupConfirm.Confcode)
+	singupResponse := cognito_auth.ConfirmSignUp(ctx, cog_cli.cognitoCli, cog_cli.clientId, signupConfirm.Username, signupConfirm.Confcode)
 	return events.APIGatewayProxyResponse{
 		StatusCode: singupResponse.Status,
 		Body:       singupResponse.Message,
@@ -188,21 +191,48 @@ func handlerConfirmForgotPassword(ctx context.Context, request events.APIGateway
 	if err != nil {
 		return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 	}
+	ctx = logging.WithUserName(ctx, resetPass.Username)
 	cog_cli := initialize()
-	fmt.Println(request.Body)
-	singupResponse := cognito_auth.ConfirmForgetPassword(cog_cli.cognitoCli, cog_cli.clientId, resetPass.Username, resetPass.Confcode, resetPass.Password)
+	singupResponse := cognito_auth.ConfirmForgetPassword(ctx, cog_cli.cognitoCli, cog_cli.clientId, resetPass.Username, resetPass.Confcode, resetPass.Password)
 	return events.APIGatewayProxyResponse{
 		StatusCode: singupResponse.Status,
 		Body:       singupResponse.Message,
 	}, nil
 }
 
+func requestHeader(request events.APIGatewayProxyRequest, name string) string {
+	// header names are case-insensitive
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
 func handlerPath(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	path := request.Path
 
 	var handlerFunc func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
-	fmt.Println(request)
-	fmt.Println("Entering Handler path")
+	lambdaRequestId := ""
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		lambdaRequestId = lc.AwsRequestID
+	}
+	// the caller's correlation id lets a request be followed across services
+	correlationId := requestHeader(request, logging.CorrelationIdHeader)
+	if correlationId == "" {
+		correlationId = request.RequestContext.RequestID
+	}
+	if correlationId == "" {
+		correlationId = lambdaRequestId
+	}
+	ctx = logging.WithRequest(ctx, logging.RequestFields{
+		CorrelationId:   correlationId,
+		ApiRequestId:    request.RequestContext.RequestID,
+		LambdaRequestId: lambdaRequestId,
+		Route:           request.HTTPMethod + " " + path,
+	})
+	logging.FromContext(ctx).Info("Received request")
 	switch path {
 	case "/auth-signin":
 		handlerFunc = handlerSignIn
@@ -222,6 +252,7 @@ func handlerPath(ctx context.Context, request events.APIGatewayProxyRequest) (ev
 	}
 	response, err := handlerFunc(ctx, request)
 	if err != nil {
+		logging.FromContext(ctx).Error("Error handling request", logging.ErrorField, err)
 		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 	}
 
@@ -237,13 +268,16 @@ func handlerPath(ctx context.Context, request events.APIGatewayProxyRequest) (ev
 		Headers: map[string]string{
 			"Access-Control-Allow-Origin":      "*",
 			"Access-Control-Allow-Methods":     "GET, POST, OPTIONS, DELETE",
-			"Access-Control-Allow-Headers":     "Content-Type, Authorization",
+			"Access-Control-Allow-Headers":     "Content-Type, Authorization, " + logging.CorrelationIdHeader,
+			"Access-Control-Expose-Headers":    logging.CorrelationIdHeader,
 			"Access-Control-Allow-Credentials": "true",
+			logging.CorrelationIdHeader:        correlationId,
 		},
 	}, nil
 }
 
 func main() {
+	logging.Setup("auth")
 	initialize()
 
 	lambda.Start(handlerPath)
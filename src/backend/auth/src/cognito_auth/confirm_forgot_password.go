@@ -1,18 +1,17 @@
 package cognito_auth
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
-	"log/slog"
-	"os"
+	"movers/src/logging"
 )
 
-func ConfirmForgetPassword(cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username, confCode, newPassword string) ReturnResults {
+func ConfirmForgetPassword(ctx context.Context, cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username, confCode, newPassword string) ReturnResults {
 
-	jsonhandler := slog.NewJSONHandler(os.Stderr, nil)
-	logger := slog.New(jsonhandler)
+	logger := logging.FromContext(ctx)
 	var res ReturnResults
 
 	input := &cognitoidentityprovider.ConfirmForgotPasswordInput{
@@ -64,7 +63,7 @@ func ConfirmForgetPassword(cognitoClient *cognitoidentityprovider.CognitoIdentit
 
 			}
 		} else {
-			fmt.Println(err.Error())
+			logger.Error("Unexpected error", logging.ErrorField, err)
 		}
 	}
 	res.Message = fmt.Sprintf("Succesfully changed password for %s", username)
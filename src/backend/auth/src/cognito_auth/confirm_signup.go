@@ -1,18 +1,17 @@
 package cognito_auth
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
-	"log/slog"
-	"os"
+	"movers/src/logging"
 )
 
-func ConfirmSignUp(cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username, confCode string) ReturnResults {
+func ConfirmSignUp(ctx context.Context, cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username, confCode string) ReturnResults {
 
-	jsonhandler := slog.NewJSONHandler(os.Stderr, nil)
-	logger := slog.New(jsonhandler)
+	logger := logging.FromContext(ctx)
 	var res ReturnResults // ????
 
 	input := &cognitoidentityprovider.ConfirmSignUpInput{
@@ -48,7 +47,7 @@ func ConfirmSignUp(cognitoClient *cognitoidentityprovider.CognitoIdentityProvide
 				return res
 			}
 		} else {
-			fmt.Println(err.Error())
+			logger.Error("Unexpected error", logging.ErrorField, err)
 		}
 	}
 	res.Message = fmt.Sprintf("Succesfully Verified %s", username)
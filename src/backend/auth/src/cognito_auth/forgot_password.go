@@ -1,18 +1,17 @@
 package cognito_auth
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
-	"log/slog"
-	"os"
+	"movers/src/logging"
 )
 
-func ForgotPassword(cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username string) ReturnResults {
+func ForgotPassword(ctx context.Context, cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username string) ReturnResults {
 
-	jsonhandler := slog.NewJSONHandler(os.Stderr, nil)
-	logger := slog.New(jsonhandler)
+	logger := logging.FromContext(ctx)
 	var res ReturnResults // ????
 
 	input := &cognitoidentityprovider.ForgotPasswordInput{
@@ -36,7 +35,7 @@ func ForgotPassword(cognitoClient *cognitoidentityprovider.CognitoIdentityProvid
 				return res
 			}
 		} else {
-			fmt.Println(err.Error())
+			logger.Error("Unexpected error", logging.ErrorField, err)
 		}
 	}
 	res.Message = fmt.Sprintf("Succesfully resent verification code to %s", username)
@@ -1,18 +1,17 @@
 package cognito_auth
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
-	"log/slog"
-	"os"
+	"movers/src/logging"
 )
 
-func ResendVerificationCode(cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username string) ReturnResults {
+func ResendVerificationCode(ctx context.Context, cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username string) ReturnResults {
 
-	jsonhandler := slog.NewJSONHandler(os.Stderr, nil)
-	logger := slog.New(jsonhandler)
+	logger := logging.FromContext(ctx)
 	var res ReturnResults // ????
 
 	input := &cognitoidentityprovider.ResendConfirmationCodeInput{
@@ -36,7 +35,7 @@ func ResendVerificationCode(cognitoClient *cognitoidentityprovider.CognitoIdenti
 				return res
 			}
 		} else {
-			fmt.Println(err.Error())
+			logger.Error("Unexpected error", logging.ErrorField, err)
 		}
 	}
 	res.Message = fmt.Sprintf("Succesfully resent verification code to %s", username)
@@ -1,12 +1,12 @@
 package cognito_auth
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
-	"log/slog"
-	"os"
+	"movers/src/logging"
 )
 
 const (
@@ -14,11 +14,10 @@ const (
 	PASSWORD = "PASSWORD"
 )
 
-func SignIn(cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username, password string) ReturnResults {
+func SignIn(ctx context.Context, cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, client_id, username, password string) ReturnResults {
 
 	var res ReturnResults // ????
-	jsonhandler := slog.NewJSONHandler(os.Stderr, nil)
-	logger := slog.New(jsonhandler)
+	logger := logging.FromContext(ctx)
 
 	input := &cognitoidentityprovider.InitiateAuthInput{
 		ClientId: aws.String(client_id),
@@ -64,7 +63,7 @@ func SignIn(cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, clie
 				return res
 			}
 		} else {
-			fmt.Println(err.Error())
+			logger.Error("Unexpected error", logging.ErrorField, err)
 		}
 	}
 	res.Message = fmt.Sprintf("Succesfully signed in user %s", username)
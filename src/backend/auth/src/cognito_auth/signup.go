@@ -1,13 +1,14 @@
 package cognito_auth
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"log"
+	"movers/src/logging"
 	"os"
 )
 
@@ -26,7 +27,8 @@ type GetItem struct {
 	Email    string
 }
 
-func CheckIfUserExists(dynamoClient *dynamodb.DynamoDB, tableName, userName, email string) bool {
+func CheckIfUserExists(ctx context.Context, dynamoClient *dynamodb.DynamoDB, tableName, userName, email string) bool {
+	logger := logging.FromContext(ctx)
 
 	input := &dynamodb.GetItemInput{
 		TableName: aws.String(tableName),
@@ -41,19 +43,18 @@ func CheckIfUserExists(dynamoClient *dynamodb.DynamoDB, tableName, userName, ema
 	}
 
 	result, derr := dynamoClient.GetItem(input)
-	log.Println(result)
 	if derr != nil {
 		if aerr, ok := derr.(awserr.Error); ok {
 			switch aerr.Code() {
 			case dynamodb.ErrCodeProvisionedThroughputExceededException:
-				log.Printf("Throughput exceeded for table %s please try again after sometime", tableName)
+				logger.Error("Throughput exceeded for table, please try again after sometime", "table", tableName)
 				os.Exit(1)
 			case dynamodb.ErrCodeResourceNotFoundException:
-				log.Printf("Table %s not found, or item not found please check tablename/item", tableName)
+				logger.Error("Table not found, or item not found please check tablename/item", "table", tableName)
 				os.Exit(1)
 			}
 		} else {
-			log.Printf("Got error calling GetItem: %s", derr)
+			logger.Error("Got error calling GetItem", logging.ErrorField, derr)
 			os.Exit(1)
 		}
 	}
@@ -61,21 +62,21 @@ func CheckIfUserExists(dynamoClient *dynamodb.DynamoDB, tableName, userName, ema
 	item := GetItem{}
 	err := dynamodbattribute.UnmarshalMap(result.Item, &item)
 	if err != nil {
-		log.Printf("Failed to unmarshal Record, %v", err)
+		logger.Error("Failed to unmarshal Record", logging.ErrorField, err)
 		os.Exit(1)
 	}
 
-	log.Printf("Successfully retreived Item from table %s", tableName)
+	logger.Info("Successfully retreived Item from table", "table", tableName)
 	if (GetItem{}) == item {
 		return false
 	}
 	return true
 }
 
-func SignUp(cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, clientId, username, password, name, email string) ReturnResults {
+func SignUp(ctx context.Context, cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, clientId, username, password, name, email string) ReturnResults {
 
+	logger := logging.FromContext(ctx)
 	var res ReturnResults
-	fmt.Println(clientId, username, password, name, email)
 	input := &cognitoidentityprovider.SignUpInput{
 		ClientId: aws.String(clientId),
 		Username: aws.String(username),
@@ -116,9 +117,9 @@ func SignUp(cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, clie
 				res.Message = fmt.Sprintf("Please check if the password satisfies all contraints")
 
 			}
-			fmt.Println(aerr.Error())
+			logger.Error("Unexpected error signing up user", logging.ErrorField, aerr)
 		} else {
-			fmt.Println(err.Error())
+			logger.Error("Unexpected error signing up user", logging.ErrorField, err)
 		}
 	}
 	res.Message = fmt.Sprintf("Succesfully signed up user %s", username)
@@ -126,7 +127,8 @@ func SignUp(cognitoClient *cognitoidentityprovider.CognitoIdentityProvider, clie
 	return res
 }
 
-func AddUserToTable(dynamoClient *dynamodb.DynamoDB, tableName string, tableItems TableItem) {
+func AddUserToTable(ctx context.Context, dynamoClient *dynamodb.DynamoDB, tableName string, tableItems TableItem) {
+	logger := logging.FromContext(ctx)
 	mappedItem, _ := dynamodbattribute.MarshalMap(tableItems)
 	tableInput := &dynamodb.PutItemInput{
 		Item:      mappedItem,
@@ -137,22 +139,22 @@ func AddUserToTable(dynamoClient *dynamodb.DynamoDB, tableName string, tableItem
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case dynamodb.ErrCodeConditionalCheckFailedException:
-				log.Printf("Conditional Check failed for item addition")
+				logger.Error("Conditional Check failed for item addition")
 				os.Exit(1)
 			case dynamodb.ErrCodeProvisionedThroughputExceededException:
-				log.Printf("Throughput exceeded for table %s please try again after sometime", tableName)
+				logger.Error("Throughput exceeded for table, please try again after sometime", "table", tableName)
 				os.Exit(1)
 			case dynamodb.ErrCodeResourceNotFoundException:
-				log.Printf("Table %s not found, please check tablename", tableName)
+				logger.Error("Table not found, please check tablename", "table", tableName)
 				os.Exit(1)
 			case dynamodb.ErrCodeTransactionConflictException:
-				log.Printf("Transaction already in progress for itme, please try again after sometime")
+				logger.Error("Transaction already in progress for itme, please try again after sometime")
 				os.Exit(1)
 			}
 		} else {
-			log.Printf("Unable to add item to table: %s\n", err)
+			logger.Error("Unable to add item to table", logging.ErrorField, err)
 			os.Exit(1)
 		}
 	}
-	log.Printf("Successfully added the items into the table %s", tableName)
+	logger.Info("Successfully added the items into the table", "table", tableName)
 }
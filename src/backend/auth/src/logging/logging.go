@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// The fields of the JSON log schema shared by the subscriptions service, the
+// auth service and the alerter, on top of time, level, message and error
+const (
+	ServiceField         = "service"
+	CorrelationIdField   = "correlation_id"
+	ApiRequestIdField    = "api_request_id"
+	LambdaRequestIdField = "lambda_request_id"
+	UserNameField        = "username"
+	RouteField           = "route"
+	ErrorField           = "error"
+	// the ids of the entities a log line is about
+	SubscriptionIdField  = "subscription_id"
+	PaymentIdField       = "payment_id"
+	PaymentMethodIdField = "payment_method_id"
+	HouseholdIdField     = "household_id"
+	MessageIdField       = "message_id"
+	EventIdField         = "event_id"
+)
+
+// CorrelationIdHeader is the header a caller passes its correlation id in
+const CorrelationIdHeader = "X-Correlation-Id"
+
+// RequestFields identify the request a log line was written for
+type RequestFields struct {
+	// CorrelationId follows a request across services: the caller's
+	// correlation id header, else the API Gateway request id, else the
+	// Lambda request id
+	CorrelationId   string
+	ApiRequestId    string
+	LambdaRequestId string
+	UserName        string
+	Route           string
+}
+
+type loggerKey struct{}
+
+func replaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	// write the time, level and message the way the other services do
+	if len(groups) > 0 {
+		return attr
+	}
+	switch attr.Key {
+	case slog.TimeKey:
+		attr.Value = slog.StringValue(attr.Value.Time().Format(time.RFC3339Nano))
+	case slog.LevelKey:
+		attr.Value = slog.StringValue(strings.ToLower(attr.Value.String()))
+	case slog.MessageKey:
+		attr.Key = "message"
+	}
+	return attr
+}
+
+// Setup makes the default logger write the shared JSON schema
+func Setup(service string) {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{ReplaceAttr: replaceAttr})
+	slog.SetDefault(slog.New(handler).With(ServiceField, service))
+}
+
+// WithRequest returns a context carrying a logger that writes the fields of
+// a request on every line, leaving out the empty ones
+func WithRequest(ctx context.Context, fields RequestFields) context.Context {
+	if fields.CorrelationId == "" {
+		fields.CorrelationId = fields.ApiRequestId
+	}
+	if fields.CorrelationId == "" {
+		fields.CorrelationId = fields.LambdaRequestId
+	}
+	args := []any{}
+	for _, field := range [][2]string{
+		{CorrelationIdField, fields.CorrelationId},
+		{ApiRequestIdField, fields.ApiRequestId},
+		{LambdaRequestIdField, fields.LambdaRequestId},
+		{UserNameField, fields.UserName},
+		{RouteField, fields.Route},
+	} {
+		if field[1] != "" {
+			args = append(args, field[0], field[1])
+		}
+	}
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(args...))
+}
+
+// WithUserName returns a context whose logger also writes the user a request
+// is made for, once it is known
+func WithUserName(ctx context.Context, userName string) context.Context {
+	if userName == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(UserNameField, userName))
+}
+
+// FromContext returns the logger a context carries, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -1,16 +1,17 @@
 package notifier
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/sns"
-	"log"
+	"movers/src/logging"
 	"os"
 )
 
-func AddSNSSubscription(snsClient *sns.SNS, sns_arn, email string) {
+func AddSNSSubscription(ctx context.Context, snsClient *sns.SNS, sns_arn, email string) {
+	logger := logging.FromContext(ctx)
 
 	filterPolicy := map[string]interface{}{
 		"target_email": email,
@@ -18,7 +19,7 @@ func AddSNSSubscription(snsClient *sns.SNS, sns_arn, email string) {
 
 	filterPolicyJson, jerr := json.Marshal(filterPolicy)
 	if jerr != nil {
-		fmt.Println("Error marshaling filter policy:", jerr)
+		logger.Error("Error marshaling filter policy", logging.ErrorField, jerr)
 		return
 	}
 
@@ -31,23 +32,23 @@ func AddSNSSubscription(snsClient *sns.SNS, sns_arn, email string) {
 		},
 	}
 	_, err := snsClient.Subscribe(snsInput)
-	log.Printf("Successfully created SNS subscription for %s", email)
+	logger.Info("Successfully created SNS subscription", "email", email)
 
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case sns.ErrCodeSubscriptionLimitExceededException:
-				log.Printf("The subscription limit has been reached for the SNS topic.")
+				logger.Error("The subscription limit has been reached for the SNS topic.")
 				os.Exit(0)
 			case sns.ErrCodeInvalidParameterException:
-				log.Printf("Invalid parameter to create SNS subscription")
+				logger.Error("Invalid parameter to create SNS subscription")
 				os.Exit(0)
 			case sns.ErrCodeNotFoundException:
-				log.Printf("The requested resource(SNS_TOPIC) does not exist")
+				logger.Error("The requested resource(SNS_TOPIC) does not exist")
 				os.Exit(0)
 			}
 		} else {
-			fmt.Println(err.Error())
+			logger.Error("Unexpected error creating SNS subscription", logging.ErrorField, err)
 		}
 	}
 }
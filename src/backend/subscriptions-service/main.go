@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"regexp"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/rs/zerolog/log"
 
+	"subHandler/src/config"
 	"subHandler/src/handlers"
+	"subHandler/src/logging"
+	"subHandler/src/repository"
 )
 
 func getCORSHeaders() map[string]string {
@@ -20,7 +26,8 @@ func getCORSHeaders() map[string]string {
 	return map[string]string{
 		"Access-Control-Allow-Origin":      "*",
 		"Access-Control-Allow-Methods":     "GET, POST, PATCH, OPTIONS, DELETE",
-		"Access-Control-Allow-Headers":     "Content-Type, Authorization",
+		"Access-Control-Allow-Headers":     "Content-Type, Authorization, " + config.CORRELATION_ID_HEADER,
+		"Access-Control-Expose-Headers":    config.CORRELATION_ID_HEADER,
 		"Access-Control-Allow-Credentials": "true",
 	}
 }
@@ -36,6 +43,46 @@ func getHandlerFunc(path string) (HandlerFunc, error) {
 		return handlers.SubscriptionsHandler, nil
 	}
 
+	subscriptionsImportRegex, err := regexp.Compile(`^\/v2\/subscriptions\/import$`)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptionsImportRegex.MatchString(path) {
+		return handlers.SubscriptionsImportHandler, nil
+	}
+
+	subscriptionsBatchRegex, err := regexp.Compile(`^\/v2\/subscriptions:batch$`)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptionsBatchRegex.MatchString(path) {
+		return handlers.SubscriptionsBatchHandler, nil
+	}
+
+	subscriptionSuggestionsRegex, err := regexp.Compile(`^\/v2\/subscriptions\/suggestions$`)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptionSuggestionsRegex.MatchString(path) {
+		return handlers.SubscriptionSuggestionsHandler, nil
+	}
+
+	subscriptionSummaryRegex, err := regexp.Compile(`^\/v2\/subscriptions\/summary$`)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptionSummaryRegex.MatchString(path) {
+		return handlers.SubscriptionSummaryHandler, nil
+	}
+
+	subscriptionHistoryRegex, err := regexp.Compile(`^\/v2\/subscriptions\/[a-zA-Z0-9-]+\/history$`)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptionHistoryRegex.MatchString(path) {
+		return handlers.SubscriptionHistoryHandler, nil
+	}
+
 	subscriptionByIdRegex, err := regexp.Compile(`^\/v2\/subscriptions\/[a-zA-Z0-9-]+$`)
 	if err != nil {
 		return nil, err
@@ -60,6 +107,278 @@ func getHandlerFunc(path string) (HandlerFunc, error) {
 		return handlers.PaymentByIDHandler, nil
 	}
 
+	paymentRefundsRegex, err := regexp.Compile(`^\/v2\/payments\/[a-zA-Z0-9-]+\/refunds$`)
+	if err != nil {
+		return nil, err
+	}
+	if paymentRefundsRegex.MatchString(path) {
+		return handlers.PaymentRefundsHandler, nil
+	}
+
+	reconciliationRegex, err := regexp.Compile(`^\/v2\/reconciliation$`)
+	if err != nil {
+		return nil, err
+	}
+	if reconciliationRegex.MatchString(path) {
+		return handlers.ReconciliationHandler, nil
+	}
+
+	paymentAttachmentsRegex, err := regexp.Compile(`^\/v2\/payments\/[a-zA-Z0-9-]+\/attachments$`)
+	if err != nil {
+		return nil, err
+	}
+	if paymentAttachmentsRegex.MatchString(path) {
+		return handlers.PaymentAttachmentsHandler, nil
+	}
+
+	paymentAttachmentByIdRegex, err := regexp.Compile(`^\/v2\/payments\/[a-zA-Z0-9-]+\/attachments\/[a-zA-Z0-9-]+$`)
+	if err != nil {
+		return nil, err
+	}
+	if paymentAttachmentByIdRegex.MatchString(path) {
+		return handlers.PaymentAttachmentByIDHandler, nil
+	}
+
+	receiptsIngestRegex, err := regexp.Compile(`^\/v2\/receipts\/ingest$`)
+	if err != nil {
+		return nil, err
+	}
+	if receiptsIngestRegex.MatchString(path) {
+		return handlers.ReceiptsIngestHandler, nil
+	}
+
+	receiptsAddressRegex, err := regexp.Compile(`^\/v2\/receipts\/address$`)
+	if err != nil {
+		return nil, err
+	}
+	if receiptsAddressRegex.MatchString(path) {
+		return handlers.ReceiptAddressHandler, nil
+	}
+
+	statementsImportRegex, err := regexp.Compile(`^\/v2\/statements\/import$`)
+	if err != nil {
+		return nil, err
+	}
+	if statementsImportRegex.MatchString(path) {
+		return handlers.StatementsImportHandler, nil
+	}
+
+	statementsAcceptRegex, err := regexp.Compile(`^\/v2\/statements\/accept$`)
+	if err != nil {
+		return nil, err
+	}
+	if statementsAcceptRegex.MatchString(path) {
+		return handlers.StatementsAcceptHandler, nil
+	}
+
+	exportRegex, err := regexp.Compile(`^\/v2\/export$`)
+	if err != nil {
+		return nil, err
+	}
+	if exportRegex.MatchString(path) {
+		return handlers.ExportHandler, nil
+	}
+
+	calendarTokenRegex, err := regexp.Compile(`^\/v2\/calendar\/token$`)
+	if err != nil {
+		return nil, err
+	}
+	if calendarTokenRegex.MatchString(path) {
+		return handlers.CalendarTokenHandler, nil
+	}
+
+	calendarFeedRegex, err := regexp.Compile(`^\/v2\/calendar\/[a-zA-Z0-9_-]+\.ics$`)
+	if err != nil {
+		return nil, err
+	}
+	if calendarFeedRegex.MatchString(path) {
+		return handlers.CalendarFeedHandler, nil
+	}
+
+	vendorsRegex, err := regexp.Compile(`^\/v2\/vendors$`)
+	if err != nil {
+		return nil, err
+	}
+	if vendorsRegex.MatchString(path) {
+		return handlers.VendorsHandler, nil
+	}
+
+	vendorByIDRegex, err := regexp.Compile(`^\/v2\/vendors\/[a-zA-Z0-9-]+$`)
+	if err != nil {
+		return nil, err
+	}
+	if vendorByIDRegex.MatchString(path) {
+		return handlers.VendorByIDHandler, nil
+	}
+
+	subscriptionSharesRegex, err := regexp.Compile(`^\/v2\/subscriptions\/[a-zA-Z0-9-]+\/shares$`)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptionSharesRegex.MatchString(path) {
+		return handlers.SubscriptionSharesHandler, nil
+	}
+
+	subscriptionCancellationRegex, err := regexp.Compile(`^\/v2\/subscriptions\/[a-zA-Z0-9-]+\/cancellation$`)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptionCancellationRegex.MatchString(path) {
+		return handlers.CancellationHandler, nil
+	}
+
+	cancellationConfirmRegex, err := regexp.Compile(`^\/v2\/subscriptions\/[a-zA-Z0-9-]+\/cancellation\/confirm$`)
+	if err != nil {
+		return nil, err
+	}
+	if cancellationConfirmRegex.MatchString(path) {
+		return handlers.CancellationConfirmHandler, nil
+	}
+
+	balancesRegex, err := regexp.Compile(`^\/v2\/balances$`)
+	if err != nil {
+		return nil, err
+	}
+	if balancesRegex.MatchString(path) {
+		return handlers.BalancesHandler, nil
+	}
+
+	settlementsRegex, err := regexp.Compile(`^\/v2\/balances\/settle$`)
+	if err != nil {
+		return nil, err
+	}
+	if settlementsRegex.MatchString(path) {
+		return handlers.SettlementsHandler, nil
+	}
+
+	householdsRegex, err := regexp.Compile(`^\/v2\/households$`)
+	if err != nil {
+		return nil, err
+	}
+	if householdsRegex.MatchString(path) {
+		return handlers.HouseholdsHandler, nil
+	}
+
+	householdByIDRegex, err := regexp.Compile(`^\/v2\/households\/[a-zA-Z0-9-]+$`)
+	if err != nil {
+		return nil, err
+	}
+	if householdByIDRegex.MatchString(path) {
+		return handlers.HouseholdByIDHandler, nil
+	}
+
+	householdMembersRegex, err := regexp.Compile(`^\/v2\/households\/[a-zA-Z0-9-]+\/members$`)
+	if err != nil {
+		return nil, err
+	}
+	if householdMembersRegex.MatchString(path) {
+		return handlers.HouseholdMembersHandler, nil
+	}
+
+	householdMemberByIDRegex, err := regexp.Compile(`^\/v2\/households\/[a-zA-Z0-9-]+\/members\/[^\/]+$`)
+	if err != nil {
+		return nil, err
+	}
+	if householdMemberByIDRegex.MatchString(path) {
+		return handlers.HouseholdMemberByIDHandler, nil
+	}
+
+	householdJoinRegex, err := regexp.Compile(`^\/v2\/households\/[a-zA-Z0-9-]+\/join$`)
+	if err != nil {
+		return nil, err
+	}
+	if householdJoinRegex.MatchString(path) {
+		return handlers.HouseholdJoinHandler, nil
+	}
+
+	categoriesRegex, err := regexp.Compile(`^\/v2\/categories$`)
+	if err != nil {
+		return nil, err
+	}
+	if categoriesRegex.MatchString(path) {
+		return handlers.CategoriesHandler, nil
+	}
+
+	categoryByIDRegex, err := regexp.Compile(`^\/v2\/categories\/[a-zA-Z0-9-]+$`)
+	if err != nil {
+		return nil, err
+	}
+	if categoryByIDRegex.MatchString(path) {
+		return handlers.CategoryByIDHandler, nil
+	}
+
+	categoryMergeRegex, err := regexp.Compile(`^\/v2\/categories\/[a-zA-Z0-9-]+\/merge$`)
+	if err != nil {
+		return nil, err
+	}
+	if categoryMergeRegex.MatchString(path) {
+		return handlers.CategoryMergeHandler, nil
+	}
+
+	forecastRegex, err := regexp.Compile(`^\/v2\/reports\/forecast$`)
+	if err != nil {
+		return nil, err
+	}
+	if forecastRegex.MatchString(path) {
+		return handlers.ForecastHandler, nil
+	}
+
+	savingsRegex, err := regexp.Compile(`^\/v2\/insights\/savings$`)
+	if err != nil {
+		return nil, err
+	}
+	if savingsRegex.MatchString(path) {
+		return handlers.SavingsHandler, nil
+	}
+
+	usageRegex, err := regexp.Compile(`^\/v2\/usage$`)
+	if err != nil {
+		return nil, err
+	}
+	if usageRegex.MatchString(path) {
+		return handlers.UsageHandler, nil
+	}
+
+	paymentMethodsRegex, err := regexp.Compile(`^\/v2\/payment-methods$`)
+	if err != nil {
+		return nil, err
+	}
+	if paymentMethodsRegex.MatchString(path) {
+		return handlers.PaymentMethodsHandler, nil
+	}
+
+	paymentMethodByIDRegex, err := regexp.Compile(`^\/v2\/payment-methods\/[a-zA-Z0-9-]+$`)
+	if err != nil {
+		return nil, err
+	}
+	if paymentMethodByIDRegex.MatchString(path) {
+		return handlers.PaymentMethodByIDHandler, nil
+	}
+
+	webhooksRegex, err := regexp.Compile(`^\/v2\/webhooks$`)
+	if err != nil {
+		return nil, err
+	}
+	if webhooksRegex.MatchString(path) {
+		return handlers.WebhooksHandler, nil
+	}
+
+	webhookByIDRegex, err := regexp.Compile(`^\/v2\/webhooks\/[a-zA-Z0-9-]+$`)
+	if err != nil {
+		return nil, err
+	}
+	if webhookByIDRegex.MatchString(path) {
+		return handlers.WebhookByIDHandler, nil
+	}
+
+	webhookDeliveriesRegex, err := regexp.Compile(`^\/v2\/webhooks\/[a-zA-Z0-9-]+\/deliveries$`)
+	if err != nil {
+		return nil, err
+	}
+	if webhookDeliveriesRegex.MatchString(path) {
+		return handlers.WebhookDeliveriesHandler, nil
+	}
+
 	return nil, nil
 }
 
@@ -70,26 +389,136 @@ func callHandler(hfunc HandlerFunc, ctx context.Context, request events.APIGatew
 	}
 
 	headers := getCORSHeaders()
+	for key, value := range response.Headers {
+		headers[key] = value
+	}
 
 	return events.APIGatewayProxyResponse{
-		StatusCode: response.StatusCode,
-		Body:       response.Body,
-		Headers:    headers,
+		StatusCode:      response.StatusCode,
+		Body:            response.Body,
+		Headers:         headers,
+		IsBase64Encoded: response.IsBase64Encoded,
 	}, nil
 }
 
+func requestActor(request events.APIGatewayProxyRequest) string {
+	// the user signed in through the Cognito authorizer, or else the user
+	// the request names
+	if claims, ok := request.RequestContext.Authorizer["claims"].(map[string]interface{}); ok {
+		if userName, ok := claims["cognito:username"].(string); ok && userName != "" {
+			return userName
+		}
+	}
+	return request.QueryStringParameters["username"]
+}
+
+func invocationRequestId(ctx context.Context) string {
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		return lc.AwsRequestID
+	}
+	return ""
+}
+
+func requestHeader(request events.APIGatewayProxyRequest, name string) string {
+	// header names are case-insensitive
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func invocationContext(ctx context.Context, route string) context.Context {
+	// the logger and audit context of an invocation that is not an API request
+	lambdaRequestId := invocationRequestId(ctx)
+	ctx = repository.WithAuditContext(ctx, "", lambdaRequestId)
+	return logging.WithRequest(ctx, logging.RequestFields{LambdaRequestId: lambdaRequestId, Route: route})
+}
+
 func pathHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	log.Info().Str("path", request.Path).Msg("Received request")
+	requestId := request.RequestContext.RequestID
+	if requestId == "" {
+		requestId = invocationRequestId(ctx)
+	}
+	// the caller's correlation id lets a request be followed across services
+	correlationId := requestHeader(request, config.CORRELATION_ID_HEADER)
+	if correlationId == "" {
+		correlationId = requestId
+	}
+	actor := requestActor(request)
+	ctx = logging.WithRequest(ctx, logging.RequestFields{
+		CorrelationId:   correlationId,
+		ApiRequestId:    request.RequestContext.RequestID,
+		LambdaRequestId: invocationRequestId(ctx),
+		UserName:        actor,
+		Route:           request.HTTPMethod + " " + request.Path,
+	})
+	ctx = repository.WithAuditContext(ctx, actor, requestId)
+	log.Ctx(ctx).Info().Msg("Received request")
 	handler, err := getHandlerFunc(request.Path)
 	if handler == nil {
-		return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found"}, nil
+		return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found", Headers: map[string]string{config.CORRELATION_ID_HEADER: correlationId}}, nil
 	}
 	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error routing request")
 		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 	}
-	return callHandler(handler, ctx, request)
+	response, err := callHandler(handler, ctx, request)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error handling request")
+		return response, err
+	}
+	response.Headers[config.CORRELATION_ID_HEADER] = correlationId
+	log.Ctx(ctx).Info().Int("status_code", response.StatusCode).Msg("Request handled")
+	return response, nil
+}
+
+func scheduledByRule(event events.CloudWatchEvent, rule string) bool {
+	for _, resource := range event.Resources {
+		if strings.HasSuffix(resource, ":rule/"+rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func eventHandler(ctx context.Context, event json.RawMessage) (interface{}, error) {
+	// SES invokes the function with the receipt emails it receives,
+	// DynamoDB Streams with the changes to publish as domain events, an
+	// EventBridge schedule to reconcile payments, another to retry webhook
+	// deliveries and API Gateway with everything else
+	var emailEvent events.SimpleEmailEvent
+	if json.Unmarshal(event, &emailEvent) == nil && len(emailEvent.Records) > 0 && emailEvent.Records[0].EventSource == "aws:ses" {
+		ctx = invocationContext(ctx, "ses:receipts")
+		return handlers.ReceiptEmailHandler(ctx, emailEvent)
+	}
+	var streamEvent events.DynamoDBEvent
+	if json.Unmarshal(event, &streamEvent) == nil && len(streamEvent.Records) > 0 && streamEvent.Records[0].EventSource == "aws:dynamodb" {
+		ctx = invocationContext(ctx, "dynamodb:stream")
+		publisher, err := repository.NewEventPublisher()
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error creating the event publisher")
+			return nil, err
+		}
+		return handlers.StreamHandler(ctx, publisher, streamEvent)
+	}
+	var scheduledEvent events.CloudWatchEvent
+	if json.Unmarshal(event, &scheduledEvent) == nil && scheduledEvent.Source == "aws.events" && scheduledEvent.DetailType == "Scheduled Event" {
+		if scheduledByRule(scheduledEvent, config.RECONCILIATION_SCHEDULE_RULE) {
+			return handlers.ReconciliationScheduleHandler(invocationContext(ctx, "schedule:reconciliation"), scheduledEvent)
+		}
+		return handlers.WebhookRetryHandler(invocationContext(ctx, "schedule:webhook-retries"), scheduledEvent)
+	}
+	var request events.APIGatewayProxyRequest
+	err := json.Unmarshal(event, &request)
+	if err != nil {
+		return nil, err
+	}
+	return pathHandler(ctx, request)
 }
 
 func main() {
-	lambda.Start(pathHandler)
+	logging.Setup(config.SERVICE_NAME)
+	lambda.Start(eventHandler)
 }
@@ -3,3 +3,103 @@ package config
 const AWS_REGION = "us-east-1"
 const SUBSCRIPTIONS_DYNAMODB_TABLE = "subscriptions-new"
 const PAYMENTS_DYNAMODB_TABLE = "subscription-payments"
+
+const DATE_FORMAT = "2006-01-02"
+const DEFAULT_CURRENCY = "USD"
+const DYNAMODB_BATCH_WRITE_SIZE = 25
+const DYNAMODB_BATCH_WRITE_RETRIES = 5
+const IMPORT_MAX_ROWS = 500
+const STATEMENT_MAX_TRANSACTIONS = 5000
+const STATEMENT_MAX_PROPOSALS = 100
+const DETECTOR_MIN_OCCURRENCES = 2
+const DETECTOR_AMOUNT_TOLERANCE = 0.10
+const LEDGER_EXPENSE_ACCOUNT_PREFIX = "Expenses:Subscriptions"
+const LEDGER_FUNDING_ACCOUNT = "Liabilities:CreditCard"
+const CALENDAR_TOKENS_DYNAMODB_TABLE = "calendar-feed-tokens"
+const CALENDAR_TOKEN_INDEX = "token-index"
+const CALENDAR_DEFAULT_REMINDER_DAYS = 1
+const DEFAULT_ICON_URL = "https://via.placeholder.com/150"
+const VENDOR_ICON_BASE_URL = "./logos/"
+const DEFAULT_PLAN_REGION = "US"
+const USERS_DYNAMODB_TABLE = "users"
+const SHARES_DYNAMODB_TABLE = "subscription-shares"
+const SHARES_PARTICIPANT_INDEX = "participant-index"
+const SHARES_OWNER_INDEX = "owner-index"
+const SETTLEMENTS_DYNAMODB_TABLE = "share-settlements"
+const HOUSEHOLDS_DYNAMODB_TABLE = "households"
+const HOUSEHOLD_MEMBERS_DYNAMODB_TABLE = "household-members"
+const HOUSEHOLD_MEMBERS_USER_INDEX = "username-index"
+const HOUSEHOLD_PARTITION_PREFIX = "household#"
+const SNS_TOPIC_ARN_ENV = "sns_arn"
+const CATEGORIES_DYNAMODB_TABLE = "subscription-categories"
+const CATEGORY_NAME_MAX_LENGTH = 40
+const SUBSCRIPTION_MAX_TAGS = 20
+const TAG_MAX_LENGTH = 32
+const ATTACHMENTS_DYNAMODB_TABLE = "payment-attachments"
+const ATTACHMENT_MAX_SIZE = 10 << 20
+const ATTACHMENT_URL_EXPIRY_MINUTES = 15
+const ATTACHMENT_KEY_PREFIX = "attachments/"
+const BLOB_STORE_ENV = "blob_store"
+const ATTACHMENTS_BUCKET_ENV = "attachments_bucket"
+const ATTACHMENTS_DIR_ENV = "attachments_dir"
+const DEFAULT_ATTACHMENTS_DIR = "/tmp/subhub-attachments"
+const RECEIPTS_BUCKET_ENV = "receipts_bucket"
+const RECEIPTS_PREFIX_ENV = "receipts_prefix"
+
+// RECEIPTS_ADDRESS_ENV holds the address SES receives receipts at; users
+// forward to it with their ingest token after a plus
+const RECEIPTS_ADDRESS_ENV = "receipts_address"
+const RECEIPT_TOKENS_DYNAMODB_TABLE = "receipt-ingest-tokens"
+const RECEIPT_TOKEN_INDEX = "token-index"
+const RECEIPT_EMAIL_MAX_SIZE = 10 << 20
+const RECEIPT_MATCH_WINDOW_DAYS = 3
+const RECEIPT_AMOUNT_TOLERANCE = 0.01
+const AUDIT_DYNAMODB_TABLE = "subscription-audit"
+const AUDIT_SYSTEM_ACTOR = "system"
+const EVENT_SCHEMA_VERSION = "1.0"
+const EVENT_SOURCE = "subhub.subscriptions"
+const EVENTS_PUBLISHER_ENV = "events_publisher"
+const EVENTS_TOPIC_ARN_ENV = "events_topic_arn"
+const EVENT_BUS_NAME_ENV = "event_bus_name"
+const EVENTS_FILE_ENV = "events_file"
+const EVENTBRIDGE_BATCH_SIZE = 10
+const WEBHOOKS_DYNAMODB_TABLE = "webhooks"
+const WEBHOOK_DELIVERIES_DYNAMODB_TABLE = "webhook-deliveries"
+const WEBHOOK_DELIVERIES_PENDING_INDEX = "pending-index"
+const WEBHOOK_MAX_PER_USER = 10
+const WEBHOOK_SECRET_BYTES = 32
+const WEBHOOK_TIMEOUT_SECONDS = 10
+const WEBHOOK_MAX_ATTEMPTS = 8
+const WEBHOOK_RETRY_BASE_SECONDS = 30
+const WEBHOOK_DISABLE_AFTER_FAILURES = 10
+const WEBHOOK_RESPONSE_MAX_LENGTH = 512
+const WEBHOOK_DELIVERY_LOG_LIMIT = 100
+const BATCH_MAX_OPERATIONS = 100
+const FORECAST_DEFAULT_MONTHS = 12
+const FORECAST_MAX_MONTHS = 36
+const SAVINGS_UNUSED_DAYS = 60
+const SAVINGS_PRICE_INCREASE_THRESHOLD = 0.1
+const USAGE_DYNAMODB_TABLE = "subscription-usage"
+const USAGE_MAX_EVENTS = 100
+const USAGE_VISIT_WINDOW_MINUTES = 30
+const USAGE_MAX_SESSION_MINUTES = 24 * 60
+const USAGE_METRICS_DAYS = 30
+const USAGE_RETENTION_DAYS = 400
+const CANCELLATION_RENEWAL_MARGIN_DAYS = 1
+const CANCELLATION_NUMBER_MAX_LENGTH = 100
+const CANCELLATION_SCREENSHOT_KEY_PREFIX = "cancellations/"
+const PAYMENT_METHODS_DYNAMODB_TABLE = "payment-methods"
+const PAYMENT_METHOD_MAX_PER_USER = 20
+const PAYMENT_METHOD_NICKNAME_MAX_LENGTH = 40
+const PAYMENT_REFUNDS_DYNAMODB_TABLE = "payment-refunds"
+const PAYMENT_REASON_MAX_LENGTH = 200
+const RECONCILIATION_ALERTS_DYNAMODB_TABLE = "reconciliation-alerts"
+const RECONCILIATION_LOOKBACK_DAYS = 90
+const RECONCILIATION_MAX_DAYS = 366
+const RECONCILIATION_MATCH_WINDOW_DAYS = 3
+const RECONCILIATION_AMOUNT_TOLERANCE = 0.02
+const RECONCILIATION_ALERT_RETENTION_DAYS = 400
+const RECONCILIATION_SCHEDULE_RULE = "subhub-reconciliation"
+const PAYMENT_TAX_REFERENCE_MAX_LENGTH = 64
+const SERVICE_NAME = "subscriptions-service"
+const CORRELATION_ID_HEADER = "X-Correlation-Id"
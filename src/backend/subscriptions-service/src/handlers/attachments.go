@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func attachmentErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	/*
+		Maps the errors of the attachment service to a response.
+		Params: err error
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	if errors.Is(err, service.ErrInvalidAttachment) {
+		return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+	}
+	return householdErrorResponse(err)
+}
+
+func PaymentAttachmentsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the upload (POST) and listing (GET) of the receipts attached
+		to a payment of the subscription given with ?subscription_id=.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	paymentId := request.PathParameters["payment_id"]
+	subscriptionId := request.QueryStringParameters["subscription_id"]
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if reqBody == "" || paymentId == "" || subscriptionId == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var attachmentInput models.AttachmentCreateInput
+		err := json.Unmarshal([]byte(reqBody), &attachmentInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if attachmentInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.AddAttachment(ctx, subscriptionId, paymentId, attachmentInput)
+		if err != nil {
+			return attachmentErrorResponse(err)
+		}
+		return jsonResponse(201, res)
+	}
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if paymentId == "" || subscriptionId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetAttachments(ctx, subscriptionId, paymentId, userName)
+		if err != nil {
+			return attachmentErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func PaymentAttachmentByIDHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the retrieval (GET) and deletion (DELETE) of a receipt
+		attached to a payment.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	paymentId := request.PathParameters["payment_id"]
+	attachmentId := request.PathParameters["attachment_id"]
+	subscriptionId := request.QueryStringParameters["subscription_id"]
+	userName := request.QueryStringParameters["username"]
+	if reqMethod == "GET" {
+		if paymentId == "" || attachmentId == "" || subscriptionId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetAttachment(ctx, subscriptionId, paymentId, attachmentId, userName)
+		if err != nil {
+			return attachmentErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "DELETE" {
+		if paymentId == "" || attachmentId == "" || subscriptionId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.DeleteAttachment(ctx, subscriptionId, paymentId, attachmentId, userName)
+		if err != nil {
+			return attachmentErrorResponse(err)
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 204,
+			Body:       `{"message": "Attachment deleted"}`,
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
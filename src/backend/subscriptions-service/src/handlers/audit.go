@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func SubscriptionHistoryHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the retrieval (GET) of the audit log of a subscription and
+		its payments.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "GET" {
+		subID := request.PathParameters["subscription-id"]
+		userName := request.QueryStringParameters["username"]
+		if subID == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetSubscriptionHistory(ctx, subID, userName)
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func SubscriptionsBatchHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles a batch (POST) of update, delete and status change operations
+		on subscriptions. The response holds the result of each operation; an
+		atomic batch that was not written responds with 409.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var batchInput models.BatchInput
+		err := json.Unmarshal([]byte(reqBody), &batchInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if batchInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.BatchSubscriptions(ctx, batchInput)
+		if errors.Is(err, service.ErrInvalidBatch) {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+		}
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		if res.Mode == models.BatchAtomic && res.Failed > 0 {
+			return jsonResponse(409, res)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
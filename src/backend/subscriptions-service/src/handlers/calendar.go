@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func CalendarTokenHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the creation (POST) and revocation (DELETE) of the secret
+		token used to subscribe to the calendar feed.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var tokenInput models.CalendarTokenInput
+		err := json.Unmarshal([]byte(reqBody), &tokenInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if tokenInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.CreateCalendarToken(ctx, tokenInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		resBody, err := json.Marshal(res)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 201,
+			Body:       string(resBody),
+		}, nil
+	}
+	if reqMethod == "DELETE" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.RevokeCalendarToken(ctx, userName)
+		if err != nil && err.Error() == "404" {
+			return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found"}, nil
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 204,
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func CalendarFeedHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Serves the iCalendar feed of renewals at /v2/calendar/{token}.ics.
+		The secret token replaces the Cognito login so calendar apps can subscribe.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "GET" {
+		token := strings.TrimSuffix(path.Base(request.Path), ".ics")
+		if token == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetCalendarFeed(ctx, token)
+		if err != nil && err.Error() == "404" {
+			return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found"}, nil
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers: map[string]string{
+				"Content-Type":  "text/calendar; charset=utf-8",
+				"Cache-Control": "private, max-age=900",
+			},
+			Body: res,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func cancellationErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	/*
+		Maps the errors of the cancellation service to a response.
+		Params: err error
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	if errors.Is(err, service.ErrInvalidCancellation) {
+		return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+	}
+	return householdErrorResponse(err)
+}
+
+func CancellationHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the cancellation of a subscription: POST starts it with the
+		cancel-by date, GET returns it with the vendor's instructions and
+		DELETE abandons a pending one.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	subID := request.PathParameters["subscription-id"]
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if subID == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var startInput models.CancellationStartInput
+		err := json.Unmarshal([]byte(reqBody), &startInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if startInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.StartCancellation(ctx, subID, startInput)
+		if err != nil {
+			return cancellationErrorResponse(err)
+		}
+		return jsonResponse(201, res)
+	}
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if subID == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetCancellation(ctx, subID, userName)
+		if err != nil {
+			return cancellationErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "DELETE" {
+		userName := request.QueryStringParameters["username"]
+		if subID == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.AbandonCancellation(ctx, subID, userName)
+		if err != nil {
+			return cancellationErrorResponse(err)
+		}
+		return events.APIGatewayProxyResponse{StatusCode: 204}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func CancellationConfirmHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the confirmation (POST) that a subscription was cancelled
+		with the vendor, with the confirmation number and an optional
+		screenshot.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		subID := request.PathParameters["subscription-id"]
+		reqBody := request.Body
+		if subID == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var confirmInput models.CancellationConfirmInput
+		err := json.Unmarshal([]byte(reqBody), &confirmInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if confirmInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.ConfirmCancellation(ctx, subID, confirmInput)
+		if err != nil {
+			return cancellationErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
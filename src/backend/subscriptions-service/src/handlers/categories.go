@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func categoryErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	/*
+		Maps the errors of the category service to a response.
+		Params: err error
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	if errors.Is(err, service.ErrInvalidCategory) {
+		return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+	}
+	return householdErrorResponse(err)
+}
+
+func subscriptionFilter(params map[string]string) models.SubscriptionFilter {
+	/*
+		Reads the ?category=<id> and ?tag=<tag>,<tag> filters of a list or report.
+		Params: params map[string]string
+		Return: models.SubscriptionFilter
+	*/
+	filter := models.SubscriptionFilter{Category: models.SubscriptionCategory(params["category"])}
+	for _, tag := range strings.Split(params["tag"], ",") {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+	return filter
+}
+
+func CategoriesHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the creation (POST) and listing (GET) of the categories of a
+		user, or of a household with ?household_id=.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var categoryInput models.CategoryCreateInput
+		err := json.Unmarshal([]byte(reqBody), &categoryInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if categoryInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.CreateCategory(ctx, categoryInput)
+		if err != nil {
+			return categoryErrorResponse(err)
+		}
+		return jsonResponse(201, res)
+	}
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.ListCategories(ctx, userName, request.QueryStringParameters["household_id"])
+		if err != nil {
+			return categoryErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func CategoryByIDHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the renaming or recoloring (PATCH) and deletion (DELETE) of a
+		category. A deleted category's subscriptions move to Other.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	categoryId := request.PathParameters["category-id"]
+	if reqMethod == "PATCH" {
+		reqBody := request.Body
+		if categoryId == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var categoryInput models.CategoryUpdateInput
+		err := json.Unmarshal([]byte(reqBody), &categoryInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if categoryInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.UpdateCategory(ctx, categoryId, categoryInput)
+		if err != nil {
+			return categoryErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "DELETE" {
+		userName := request.QueryStringParameters["username"]
+		if categoryId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.DeleteCategory(ctx, categoryId, userName, request.QueryStringParameters["household_id"])
+		if err != nil {
+			return categoryErrorResponse(err)
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 204,
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func CategoryMergeHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the merge of a category into the one given as "into".
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		categoryId := request.PathParameters["category-id"]
+		reqBody := request.Body
+		if categoryId == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var mergeInput models.CategoryMergeInput
+		err := json.Unmarshal([]byte(reqBody), &mergeInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if mergeInput.UserName == "" || mergeInput.Into == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.MergeCategory(ctx, categoryId, mergeInput)
+		if err != nil {
+			return categoryErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func SubscriptionSummaryHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the report of a user's subscriptions grouped with
+		?group_by=category|tag (category by default), accepting the same
+		?category= and ?tag= filters as the subscription list, with the tax
+		paid per quarter when ?include_tax=true.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		groupBy := models.SubscriptionGroupBy(request.QueryStringParameters["group_by"])
+		if groupBy == "" {
+			groupBy = models.GroupByCategory
+		}
+		includeTax := false
+		if value := request.QueryStringParameters["include_tax"]; value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+			}
+			includeTax = parsed
+		}
+		res, err := service.SummarizeSubscriptions(ctx, userName, groupBy, subscriptionFilter(request.QueryStringParameters), includeTax)
+		if err != nil {
+			return categoryErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
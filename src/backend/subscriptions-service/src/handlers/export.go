@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func ExportHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the export of all the subscriptions and payments of a user.
+		The format is chosen with ?format=csv|json|xlsx|ledger|hledger|beancount
+		(csv by default) and narrowed down with ?category= and ?tag=. The
+		accounting formats accept ?funding_account= and an ?account_<category>=
+		override of the expense account of each category.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		format := models.ExportFormat(request.QueryStringParameters["format"])
+		if format == "" {
+			format = models.ExportCSV
+		}
+		options := models.LedgerOptions{
+			FundingAccount: request.QueryStringParameters["funding_account"],
+			Accounts:       map[models.SubscriptionCategory]string{},
+		}
+		for key, value := range request.QueryStringParameters {
+			if strings.HasPrefix(key, "account_") {
+				options.Accounts[models.SubscriptionCategory(strings.TrimPrefix(key, "account_"))] = value
+			}
+		}
+		body, contentType, err := service.ExportUserData(ctx, userName, format, options, subscriptionFilter(request.QueryStringParameters))
+		if errors.Is(err, service.ErrUnsupportedExportFormat) {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+
+		headers := map[string]string{
+			"Content-Type":        contentType,
+			"Content-Disposition": `attachment; filename="subscriptions.` + string(format) + `"`,
+		}
+		if format == models.ExportXLSX {
+			return events.APIGatewayProxyResponse{
+				StatusCode:      200,
+				Headers:         headers,
+				Body:            base64.StdEncoding.EncodeToString(body),
+				IsBase64Encoded: true,
+			}, nil
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers:    headers,
+			Body:       string(body),
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"subHandler/src/config"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func ForecastHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the projection (GET) of a user's spend for the next
+		?months=<n> months (12 by default), accepting the same ?category= and
+		?tag= filters as the subscription list.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		months := config.FORECAST_DEFAULT_MONTHS
+		if value := request.QueryStringParameters["months"]; value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+			}
+			months = parsed
+		}
+		res, err := service.ForecastSpend(ctx, userName, months, subscriptionFilter(request.QueryStringParameters))
+		if errors.Is(err, service.ErrInvalidForecast) {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+		}
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
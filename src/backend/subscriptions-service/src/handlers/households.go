@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func householdErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	/*
+		Maps the errors of the household service to a response.
+		Params: err error
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	if errors.Is(err, service.ErrForbidden) {
+		return events.APIGatewayProxyResponse{StatusCode: 403, Body: err.Error()}, nil
+	}
+	if errors.Is(err, service.ErrInvalidHousehold) {
+		return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+	}
+	if err.Error() == "404" {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found"}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+}
+
+func jsonResponse(statusCode int, res interface{}) (events.APIGatewayProxyResponse, error) {
+	/*
+		Returns a response with the given JSON body.
+		Params: statusCode int
+				res interface{}
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	resBody, err := json.Marshal(res)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Body:       string(resBody),
+	}, nil
+}
+
+func HouseholdsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the creation (POST) and listing (GET) of the households of a user.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var householdInput models.HouseholdCreateInput
+		err := json.Unmarshal([]byte(reqBody), &householdInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if householdInput.UserName == "" || householdInput.Name == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.CreateHousehold(ctx, householdInput)
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return jsonResponse(201, res)
+	}
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetUserHouseholds(ctx, userName)
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func HouseholdByIDHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the retrieval (GET) and deletion (DELETE) of a household.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	householdId := request.PathParameters["household-id"]
+	userName := request.QueryStringParameters["username"]
+	if reqMethod == "GET" {
+		if householdId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetHousehold(ctx, householdId, userName)
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "DELETE" {
+		if householdId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.DeleteHousehold(ctx, householdId, userName)
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 204,
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func HouseholdMembersHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the invitation of a user to a household.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		householdId := request.PathParameters["household-id"]
+		reqBody := request.Body
+		if householdId == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var inviteInput models.HouseholdInviteInput
+		err := json.Unmarshal([]byte(reqBody), &inviteInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if inviteInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.InviteHouseholdMember(ctx, householdId, inviteInput)
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return jsonResponse(201, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func HouseholdMemberByIDHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the role change (PATCH) and removal (DELETE) of a household member.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	householdId := request.PathParameters["household-id"]
+	member := request.PathParameters["member"]
+	userName := request.QueryStringParameters["username"]
+	if reqMethod == "PATCH" {
+		reqBody := request.Body
+		if householdId == "" || member == "" || userName == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var roleInput models.HouseholdRoleInput
+		err := json.Unmarshal([]byte(reqBody), &roleInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		res, err := service.UpdateHouseholdMemberRole(ctx, householdId, userName, member, roleInput.Role)
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "DELETE" {
+		if householdId == "" || member == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.RemoveHouseholdMember(ctx, householdId, userName, member)
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 204,
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func HouseholdJoinHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the acceptance of a household invitation.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		householdId := request.PathParameters["household-id"]
+		reqBody := request.Body
+		if householdId == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var joinInput models.HouseholdJoinInput
+		err := json.Unmarshal([]byte(reqBody), &joinInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if joinInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.AcceptHouseholdInvitation(ctx, householdId, joinInput.UserName)
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
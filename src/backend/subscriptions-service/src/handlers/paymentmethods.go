@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func paymentMethodErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	/*
+		Maps the errors of the payment method service to a response.
+		Params: err error
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	if errors.Is(err, service.ErrInvalidPaymentMethod) {
+		return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+	}
+	return householdErrorResponse(err)
+}
+
+func PaymentMethodsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the creation (POST) and listing (GET) of the payment methods
+		of a user.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var methodInput models.PaymentMethodInput
+		err := json.Unmarshal([]byte(reqBody), &methodInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if methodInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.CreatePaymentMethod(ctx, methodInput)
+		if err != nil {
+			return paymentMethodErrorResponse(err)
+		}
+		return jsonResponse(201, res)
+	}
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetPaymentMethods(ctx, userName)
+		if err != nil {
+			return paymentMethodErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func PaymentMethodByIDHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the retrieval (GET), update (PATCH) and deletion (DELETE) of
+		a payment method. Deleting a method unlinks its subscriptions.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	paymentMethodId := request.PathParameters["payment-method-id"]
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if paymentMethodId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetPaymentMethod(ctx, paymentMethodId, userName)
+		if err != nil {
+			return paymentMethodErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "PATCH" {
+		reqBody := request.Body
+		if paymentMethodId == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var methodInput models.PaymentMethodInput
+		err := json.Unmarshal([]byte(reqBody), &methodInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if methodInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.UpdatePaymentMethod(ctx, paymentMethodId, methodInput)
+		if err != nil {
+			return paymentMethodErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "DELETE" {
+		userName := request.QueryStringParameters["username"]
+		if paymentMethodId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.DeletePaymentMethod(ctx, paymentMethodId, userName)
+		if err != nil {
+			return paymentMethodErrorResponse(err)
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 204,
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"subHandler/src/models"
 	"subHandler/src/service"
 
@@ -29,9 +30,9 @@ func PaymentsHandler(ctx context.Context, request events.APIGatewayProxyRequest)
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
-		res, err := service.AddPayment(pay)
+		res, err := service.AddPayment(ctx, pay)
 		if err != nil {
-			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+			return paymentErrorResponse(err)
 		}
 		resBody, err := json.Marshal(res)
 		if err != nil {
@@ -47,7 +48,7 @@ func PaymentsHandler(ctx context.Context, request events.APIGatewayProxyRequest)
 		if subscriptionId == "" {
 			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 		}
-		res, err := service.GetPayments(subscriptionId)
+		res, err := service.GetPayments(ctx, subscriptionId)
 		if len(res) == 0 {
 			return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found"}, nil
 		}
@@ -82,7 +83,7 @@ func PaymentByIDHandler(ctx context.Context, request events.APIGatewayProxyReque
 		if paymentId == "" || subscriptionId == "" {
 			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 		}
-		res, err := service.GetPayment(subscriptionId, paymentId)
+		res, err := service.GetPayment(ctx, subscriptionId, paymentId)
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
@@ -98,7 +99,8 @@ func PaymentByIDHandler(ctx context.Context, request events.APIGatewayProxyReque
 	if reqMethod == "PATCH" {
 		paymentId := request.PathParameters["payment_id"]
 		subscriptionId := request.QueryStringParameters["subscription_id"]
-		if paymentId == "" || subscriptionId == "" {
+		userName := request.QueryStringParameters["username"]
+		if paymentId == "" || subscriptionId == "" || userName == "" {
 			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 		}
 		reqBody := request.Body
@@ -110,9 +112,9 @@ func PaymentByIDHandler(ctx context.Context, request events.APIGatewayProxyReque
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
-		res, err := service.UpdatePayment(subscriptionId, paymentId, pay)
+		res, err := service.UpdatePayment(ctx, subscriptionId, paymentId, userName, pay)
 		if err != nil {
-			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+			return paymentErrorResponse(err)
 		}
 		resBody, err := json.Marshal(res)
 		if err != nil {
@@ -126,12 +128,13 @@ func PaymentByIDHandler(ctx context.Context, request events.APIGatewayProxyReque
 	if reqMethod == "DELETE" {
 		paymentId := request.PathParameters["payment_id"]
 		subscriptionId := request.QueryStringParameters["subscription_id"]
-		if paymentId == "" || subscriptionId == "" {
+		userName := request.QueryStringParameters["username"]
+		if paymentId == "" || subscriptionId == "" || userName == "" {
 			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 		}
-		err := service.DeletePayment(subscriptionId, paymentId)
+		err := service.DeletePayment(ctx, subscriptionId, paymentId, userName)
 		if err != nil {
-			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+			return paymentErrorResponse(err)
 		}
 		return events.APIGatewayProxyResponse{
 			StatusCode: 204,
@@ -144,3 +147,69 @@ func PaymentByIDHandler(ctx context.Context, request events.APIGatewayProxyReque
 	}
 	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 }
+
+func paymentErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	/*
+		Maps the errors of the payment service to a response.
+		Params: err error
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	if errors.Is(err, service.ErrInvalidPayment) {
+		return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+	}
+	if errors.Is(err, service.ErrPaymentChanged) {
+		return events.APIGatewayProxyResponse{StatusCode: 409, Body: err.Error()}, nil
+	}
+	return householdErrorResponse(err)
+}
+
+func PaymentRefundsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the recording (POST) and listing (GET) of the refunds of a
+		payment of the subscription given with ?subscription_id=.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	paymentId := request.PathParameters["payment_id"]
+	subscriptionId := request.QueryStringParameters["subscription_id"]
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if reqBody == "" || paymentId == "" || subscriptionId == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var refundInput models.PaymentRefundInput
+		err := json.Unmarshal([]byte(reqBody), &refundInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if refundInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.RefundPayment(ctx, subscriptionId, paymentId, refundInput)
+		if err != nil {
+			return paymentErrorResponse(err)
+		}
+		return jsonResponse(201, res)
+	}
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if paymentId == "" || subscriptionId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetPaymentRefunds(ctx, subscriptionId, paymentId, userName)
+		if err != nil {
+			return paymentErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
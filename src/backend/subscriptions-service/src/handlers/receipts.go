@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/rs/zerolog/log"
+)
+
+func ReceiptsIngestHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the ingestion (POST) of a receipt email sent as the raw .eml
+		body. The user is read from the ingest address the email was sent to
+		unless given with ?username=.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		raw := []byte(request.Body)
+		if request.IsBase64Encoded {
+			decoded, err := base64.StdEncoding.DecodeString(request.Body)
+			if err != nil {
+				return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+			}
+			raw = decoded
+		}
+		if len(raw) == 0 {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.IngestReceiptEmail(ctx, raw, request.QueryStringParameters["username"])
+		if errors.Is(err, service.ErrInvalidReceipt) {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+		}
+		if err != nil {
+			return householdErrorResponse(err)
+		}
+		if res.Status == models.ReceiptCreated {
+			return jsonResponse(201, res)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func ReceiptEmailHandler(ctx context.Context, event events.SimpleEmailEvent) (events.SimpleEmailDisposition, error) {
+	/*
+		Handles the receipt emails received by SES. The receipt rule stores
+		each email in S3 before invoking the function, which reads it by its
+		message id. Spam, viruses and emails failing both SPF and DKIM are
+		dropped. The sender is trusted to identify the user only when it
+		passes DMARC.
+		Params: ctx context.Context
+				event events.SimpleEmailEvent
+		Returns: events.SimpleEmailDisposition
+				 error
+	*/
+	for _, record := range event.Records {
+		mail := record.SES.Mail
+		receipt := record.SES.Receipt
+		if receipt.SpamVerdict.Status == "FAIL" || receipt.VirusVerdict.Status == "FAIL" ||
+			(receipt.SPFVerdict.Status == "FAIL" && receipt.DKIMVerdict.Status == "FAIL") {
+			log.Ctx(ctx).Warn().Str(logging.MessageIdField, mail.MessageID).Str("source", mail.Source).Msg("Dropping receipt email failing the SES verdicts")
+			continue
+		}
+		senderVerified := receipt.DMARCVerdict.Status == "PASS"
+		_, err := service.IngestInboundEmail(ctx, mail.MessageID, receipt.Recipients, senderVerified)
+		if errors.Is(err, service.ErrInvalidReceipt) {
+			// retrying cannot fix an unreadable email or an unknown sender
+			continue
+		}
+		if err != nil {
+			return events.SimpleEmailDisposition{}, err
+		}
+	}
+	return events.SimpleEmailDisposition{Disposition: events.SimpleEmailStopRuleSet}, nil
+}
+
+func ReceiptAddressHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the creation (POST) and revocation (DELETE) of a user's
+		receipt ingest address.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		var input models.ReceiptTokenInput
+		err := json.Unmarshal([]byte(request.Body), &input)
+		if err != nil || input.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.CreateReceiptToken(ctx, input)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, nil
+		}
+		return jsonResponse(201, res)
+	}
+	if reqMethod == "DELETE" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.RevokeReceiptToken(ctx, userName)
+		if err != nil && err.Error() == "404" {
+			return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found"}, nil
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, nil
+		}
+		return events.APIGatewayProxyResponse{StatusCode: 204}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func ReconciliationHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the reconciliation (GET) of a user's recorded payments
+		against the charges their subscriptions call for.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.ReconcilePayments(ctx, userName, request.QueryStringParameters["from"], request.QueryStringParameters["to"])
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidReconciliation) {
+				return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+			}
+			return householdErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func ReconciliationScheduleHandler(ctx context.Context, event events.CloudWatchEvent) (models.ReconciliationRunResult, error) {
+	/*
+		Handles the scheduled event reconciling the payments of every user
+		and alerting them of new discrepancies.
+		Params: ctx context.Context
+				event events.CloudWatchEvent
+		Returns: models.ReconciliationRunResult
+				 error
+	*/
+	return service.RunReconciliation(ctx)
+}
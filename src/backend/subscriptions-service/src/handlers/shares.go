@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func SubscriptionSharesHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the sharing of a subscription: POST sets the participants and
+		the split, GET returns the split and DELETE removes ?participant=
+		(the owner removing someone, or a participant leaving).
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	subID := request.PathParameters["subscription-id"]
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if subID == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var shareInput models.SubscriptionShareInput
+		err := json.Unmarshal([]byte(reqBody), &shareInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if shareInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.ShareSubscription(ctx, subID, shareInput)
+		if errors.Is(err, service.ErrInvalidShare) {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+		}
+		if err != nil && err.Error() == "404" {
+			return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found"}, nil
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		resBody, err := json.Marshal(res)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Body:       string(resBody),
+		}, nil
+	}
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if subID == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetSubscriptionSplit(ctx, subID, userName)
+		if err != nil && err.Error() == "404" {
+			return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found"}, nil
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		resBody, err := json.Marshal(res)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Body:       string(resBody),
+		}, nil
+	}
+	if reqMethod == "DELETE" {
+		userName := request.QueryStringParameters["username"]
+		participant := request.QueryStringParameters["participant"]
+		if participant == "" {
+			participant = userName
+		}
+		if subID == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.UnshareSubscription(ctx, subID, userName, participant)
+		if err != nil && err.Error() == "404" {
+			return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Not Found"}, nil
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 204,
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func BalancesHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the balances of the shared subscriptions of a user.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetBalances(ctx, userName)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		resBody, err := json.Marshal(res)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Body:       string(resBody),
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func SettlementsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the recording of a settlement between two users by its payee.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var settlementInput models.SettlementInput
+		err := json.Unmarshal([]byte(reqBody), &settlementInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		res, err := service.SettleBalance(ctx, settlementInput)
+		if errors.Is(err, service.ErrInvalidShare) {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return events.APIGatewayProxyResponse{StatusCode: 403, Body: err.Error()}, nil
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		resBody, err := json.Marshal(res)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 201,
+			Body:       string(resBody),
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
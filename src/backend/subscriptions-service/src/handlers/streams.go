@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"context"
+	"subHandler/src/repository"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func StreamHandler(ctx context.Context, publisher repository.EventPublisher, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	/*
+		Handles the DynamoDB Stream records of the subscriptions and payments
+		tables, publishing their domain events. When a record fails, it and
+		the records after it are reported for retry so that events keep the
+		order of the changes. The events go to the publisher, then to the
+		users' webhooks.
+		Params: ctx context.Context
+				publisher repository.EventPublisher
+				event events.DynamoDBEvent
+		Returns: events.DynamoDBEventResponse
+				 error
+	*/
+	failed, err := service.PublishStreamRecords(ctx, repository.EventPublishers{publisher, service.WebhookPublisher{}}, event.Records)
+	if err != nil && failed == "" {
+		return events.DynamoDBEventResponse{}, err
+	}
+	response := events.DynamoDBEventResponse{BatchItemFailures: []events.DynamoDBBatchItemFailure{}}
+	if failed != "" {
+		response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{ItemIdentifier: failed})
+	}
+	return response, nil
+}
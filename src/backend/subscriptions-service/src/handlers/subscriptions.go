@@ -3,6 +3,8 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"subHandler/src/logging"
 	"subHandler/src/models"
 	"subHandler/src/service"
 
@@ -30,7 +32,13 @@ func SubscriptionsHandler(ctx context.Context, request events.APIGatewayProxyReq
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
-		res, err := service.AddSubscription(sub)
+		res, err := service.AddSubscription(ctx, sub)
+		if errors.Is(err, service.ErrForbidden) {
+			return events.APIGatewayProxyResponse{StatusCode: 403, Body: err.Error()}, nil
+		}
+		if errors.Is(err, service.ErrInvalidCategory) || errors.Is(err, service.ErrInvalidSubscription) {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+		}
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
@@ -48,7 +56,7 @@ func SubscriptionsHandler(ctx context.Context, request events.APIGatewayProxyReq
 		if userName == "" {
 			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 		}
-		res, err := service.GetUserSubscriptions(userName)
+		res, err := service.ListUserSubscriptions(ctx, userName, subscriptionFilter(request.QueryStringParameters))
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
@@ -83,11 +91,14 @@ func SubscriptionByIDHandler(ctx context.Context, request events.APIGatewayProxy
 	if reqMethod == "GET" {
 		subID := request.PathParameters["subscription-id"]
 		userName := request.QueryStringParameters["username"]
-		log.Info().Str("subID", subID).Str("userName", userName).Msg("Received request with parameters")
+		log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subID).Str(logging.UserNameField, userName).Msg("Received request with parameters")
 		if subID == "" || userName == "" {
 			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 		}
-		res, err := service.GetSubscription(subID, userName)
+		res, err := service.GetSubscription(ctx, subID, userName)
+		if errors.Is(err, service.ErrForbidden) {
+			return events.APIGatewayProxyResponse{StatusCode: 403, Body: err.Error()}, nil
+		}
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
@@ -108,7 +119,10 @@ func SubscriptionByIDHandler(ctx context.Context, request events.APIGatewayProxy
 		if subID == "" || userName == "" {
 			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
 		}
-		err := service.DeleteSubscription(subID, userName)
+		err := service.DeleteSubscription(ctx, subID, userName)
+		if errors.Is(err, service.ErrForbidden) {
+			return events.APIGatewayProxyResponse{StatusCode: 403, Body: err.Error()}, nil
+		}
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
@@ -133,7 +147,13 @@ func SubscriptionByIDHandler(ctx context.Context, request events.APIGatewayProxy
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
-		res, err := service.UpdateSubscription(subID, userName, sub)
+		res, err := service.UpdateSubscription(ctx, subID, userName, sub)
+		if errors.Is(err, service.ErrForbidden) {
+			return events.APIGatewayProxyResponse{StatusCode: 403, Body: err.Error()}, nil
+		}
+		if errors.Is(err, service.ErrInvalidCategory) || errors.Is(err, service.ErrInvalidSubscription) {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+		}
 		if err != nil {
 			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
 		}
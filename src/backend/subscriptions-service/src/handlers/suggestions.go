@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func SubscriptionSuggestionsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the cheaper plan suggestions of a user. ?with=<user>,<user>
+		lists the users to consider a shared family plan with, who must share
+		a household or a subscription with the user, and ?region=
+		selects the catalog prices (US by default).
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		members := []string{}
+		if with := request.QueryStringParameters["with"]; with != "" {
+			members = strings.Split(with, ",")
+		}
+		res, err := service.SuggestCheaperPlans(ctx, userName, members, request.QueryStringParameters["region"])
+		if errors.Is(err, service.ErrForbidden) {
+			return events.APIGatewayProxyResponse{StatusCode: 403, Body: err.Error()}, nil
+		}
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		resBody, err := json.Marshal(res)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Body:       string(resBody),
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
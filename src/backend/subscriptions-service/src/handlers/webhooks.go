@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"subHandler/src/models"
+	"subHandler/src/service"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func webhookErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	/*
+		Maps the errors of the webhook service to a response.
+		Params: err error
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	if errors.Is(err, service.ErrInvalidWebhook) {
+		return events.APIGatewayProxyResponse{StatusCode: 400, Body: err.Error()}, nil
+	}
+	return householdErrorResponse(err)
+}
+
+func WebhooksHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the registration (POST) and listing (GET) of the webhooks of
+		a user.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "POST" {
+		reqBody := request.Body
+		if reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var webhookInput models.WebhookCreateInput
+		err := json.Unmarshal([]byte(reqBody), &webhookInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if webhookInput.UserName == "" || webhookInput.Url == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.CreateWebhook(ctx, webhookInput)
+		if err != nil {
+			return webhookErrorResponse(err)
+		}
+		return jsonResponse(201, res)
+	}
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetWebhooks(ctx, userName)
+		if err != nil {
+			return webhookErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func WebhookByIDHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the retrieval (GET), update (PATCH) and deletion (DELETE) of
+		a webhook. A PATCH with "rotate_secret" returns the new secret.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	webhookId := request.PathParameters["webhook-id"]
+	if reqMethod == "GET" {
+		userName := request.QueryStringParameters["username"]
+		if webhookId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetWebhook(ctx, webhookId, userName)
+		if err != nil {
+			return webhookErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "PATCH" {
+		reqBody := request.Body
+		if webhookId == "" || reqBody == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		var webhookInput models.WebhookUpdateInput
+		err := json.Unmarshal([]byte(reqBody), &webhookInput)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Server Error"}, err
+		}
+		if webhookInput.UserName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.UpdateWebhook(ctx, webhookId, webhookInput)
+		if err != nil {
+			return webhookErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "DELETE" {
+		userName := request.QueryStringParameters["username"]
+		if webhookId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		err := service.DeleteWebhook(ctx, webhookId, userName)
+		if err != nil {
+			return webhookErrorResponse(err)
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 204,
+		}, nil
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func WebhookDeliveriesHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	/*
+		Handles the retrieval (GET) of the delivery log of a webhook,
+		optionally filtered with ?status=pending|succeeded|failed.
+		Params: ctx context.Context
+				request events.APIGatewayProxyRequest
+		Returns: events.APIGatewayProxyResponse
+				 error
+	*/
+	reqMethod := request.HTTPMethod
+	if reqMethod == "GET" {
+		webhookId := request.PathParameters["webhook-id"]
+		userName := request.QueryStringParameters["username"]
+		if webhookId == "" || userName == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		status := models.WebhookDeliveryStatus(request.QueryStringParameters["status"])
+		if status != "" && status != models.DeliveryPending && status != models.DeliverySucceeded && status != models.DeliveryFailed {
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+		}
+		res, err := service.GetWebhookDeliveries(ctx, webhookId, userName, status)
+		if err != nil {
+			return webhookErrorResponse(err)
+		}
+		return jsonResponse(200, res)
+	}
+	if reqMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+		}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Bad Request"}, nil
+}
+
+func WebhookRetryHandler(ctx context.Context, event events.CloudWatchEvent) (models.WebhookRetryResult, error) {
+	/*
+		Handles the scheduled event retrying the webhook deliveries that are due.
+		Params: ctx context.Context
+				event events.CloudWatchEvent
+		Returns: models.WebhookRetryResult
+				 error
+	*/
+	return service.RetryWebhookDeliveries(ctx)
+}
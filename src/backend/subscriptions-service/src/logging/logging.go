@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// The fields of the JSON log schema shared by the subscriptions service, the
+// auth service and the alerter, on top of time, level, message and error
+const (
+	ServiceField         = "service"
+	CorrelationIdField   = "correlation_id"
+	ApiRequestIdField    = "api_request_id"
+	LambdaRequestIdField = "lambda_request_id"
+	UserNameField        = "username"
+	RouteField           = "route"
+	ErrorField           = "error"
+	// the ids of the entities a log line is about
+	SubscriptionIdField  = "subscription_id"
+	PaymentIdField       = "payment_id"
+	PaymentMethodIdField = "payment_method_id"
+	HouseholdIdField     = "household_id"
+	MessageIdField       = "message_id"
+	EventIdField         = "event_id"
+)
+
+type correlationIdKey struct{}
+
+// RequestFields identify the request a log line was written for
+type RequestFields struct {
+	// CorrelationId follows a request across services: the caller's
+	// correlation id header, else the API Gateway request id, else the
+	// Lambda request id
+	CorrelationId   string
+	ApiRequestId    string
+	LambdaRequestId string
+	UserName        string
+	Route           string
+}
+
+func Setup(service string) {
+	/*
+		Sets the global logger up to write the shared JSON schema, and to be
+		the logger of contexts that carry none.
+		Params: service string
+		Return: None
+	*/
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+	zerolog.TimestampFieldName = "time"
+	zerolog.LevelFieldName = "level"
+	zerolog.MessageFieldName = "message"
+	zerolog.ErrorFieldName = ErrorField
+	log.Logger = zerolog.New(os.Stdout).With().Timestamp().Str(ServiceField, service).Logger()
+	zerolog.DefaultContextLogger = &log.Logger
+}
+
+func WithRequest(ctx context.Context, fields RequestFields) context.Context {
+	/*
+		Returns a context carrying a logger that writes the fields of a
+		request on every line. Empty fields are left out.
+		Params: ctx context.Context
+				fields RequestFields
+		Return: context.Context
+	*/
+	if fields.CorrelationId == "" {
+		fields.CorrelationId = fields.ApiRequestId
+	}
+	if fields.CorrelationId == "" {
+		fields.CorrelationId = fields.LambdaRequestId
+	}
+	logContext := log.Logger.With()
+	for _, field := range [][2]string{
+		{CorrelationIdField, fields.CorrelationId},
+		{ApiRequestIdField, fields.ApiRequestId},
+		{LambdaRequestIdField, fields.LambdaRequestId},
+		{UserNameField, fields.UserName},
+		{RouteField, fields.Route},
+	} {
+		if field[1] != "" {
+			logContext = logContext.Str(field[0], field[1])
+		}
+	}
+	logger := logContext.Logger()
+	ctx = context.WithValue(ctx, correlationIdKey{}, fields.CorrelationId)
+	return logger.WithContext(ctx)
+}
+
+func CorrelationId(ctx context.Context) string {
+	/*
+		Returns the correlation id of the request a context was made for, so
+		that it can be passed on to other services.
+		Params: ctx context.Context
+		Return: string (empty outside a request)
+	*/
+	correlationId, _ := ctx.Value(correlationIdKey{}).(string)
+	return correlationId
+}
@@ -0,0 +1,43 @@
+package models
+
+type AttachmentStatus string
+
+const (
+	// AttachmentPending is an attachment whose file has not been uploaded yet
+	AttachmentPending  AttachmentStatus = "pending"
+	AttachmentUploaded AttachmentStatus = "uploaded"
+)
+
+// AttachmentContentTypes are the file types payments accept as receipts
+var AttachmentContentTypes = []string{"application/pdf", "image/png", "image/jpeg", "image/gif", "image/webp"}
+
+type PaymentAttachment struct {
+	PaymentId      string           `json:"payment_id"`
+	AttachmentId   string           `json:"attachment_id"`
+	SubscriptionId string           `json:"subscription_id"`
+	UserName       string           `json:"username"`
+	FileName       string           `json:"file_name"`
+	ContentType    string           `json:"content_type"`
+	Size           int64            `json:"size"`
+	StorageKey     string           `json:"storage_key"`
+	Status         AttachmentStatus `json:"status"`
+	CreatedAt      string           `json:"created_at"`
+}
+
+type AttachmentDetails struct {
+	PaymentAttachment
+	// UploadUrl is where a pending file is PUT, with its content type and size
+	UploadUrl   string `json:"upload_url,omitempty"`
+	DownloadUrl string `json:"download_url,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+}
+
+type AttachmentCreateInput struct {
+	UserName    string `json:"username"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// Content is the base64 encoded file, for uploads through the API
+	// instead of through the upload URL
+	Content string `json:"content,omitempty"`
+}
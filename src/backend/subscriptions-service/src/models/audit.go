@@ -0,0 +1,38 @@
+package models
+
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+)
+
+type AuditEntity string
+
+const (
+	AuditSubscription AuditEntity = "subscription"
+	AuditPayment      AuditEntity = "payment"
+)
+
+type AuditChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type AuditEntry struct {
+	SubscriptionId string `json:"subscription_id"`
+	// the timestamp followed by a uuid, so that entries sort chronologically
+	EntryId string `json:"entry_id"`
+	// partition key of the subscription, kept to authorize reading the
+	// history of a deleted subscription
+	Partition string        `json:"partition,omitempty"`
+	Entity    AuditEntity   `json:"entity"`
+	EntityId  string        `json:"entity_id"`
+	Action    AuditAction   `json:"action"`
+	Actor     string        `json:"actor"`
+	RequestId string        `json:"request_id"`
+	Timestamp string        `json:"timestamp"`
+	Changes   []AuditChange `json:"changes"`
+}
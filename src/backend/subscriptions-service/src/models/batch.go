@@ -0,0 +1,88 @@
+package models
+
+type BatchOperationType string
+
+const (
+	BatchUpdate    BatchOperationType = "update"
+	BatchDelete    BatchOperationType = "delete"
+	BatchSetStatus BatchOperationType = "set_status"
+)
+
+type BatchMode string
+
+const (
+	// BatchAtomic writes every operation or none of them
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort writes the valid operations and reports the others
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+// SubscriptionChanges holds the fields an update operation changes; nil
+// fields are kept
+type SubscriptionChanges struct {
+	Name            *string   `json:"name,omitempty"`
+	Plan            *string   `json:"plan,omitempty"`
+	Cost            *float32  `json:"cost,omitempty"`
+	Currency        *string   `json:"currency,omitempty"`
+	BillingCycle    *string   `json:"billing_cycle,omitempty"`
+	Category        *string   `json:"category,omitempty"`
+	StartDate       *string   `json:"start_date,omitempty"`
+	LastPaymentDate *string   `json:"last_payment_date,omitempty"`
+	TrialEndDate    *string   `json:"trial_end_date,omitempty"`
+	Tags            *[]string `json:"tags,omitempty"`
+	// an empty date removes the scheduled cancellation
+	CancelAt     *string        `json:"cancel_at,omitempty"`
+	PriceChanges *[]PriceChange `json:"price_changes,omitempty"`
+	LastUsedDate *string        `json:"last_used_date,omitempty"`
+	// an empty id unlinks the payment method
+	PaymentMethodId *string `json:"payment_method_id,omitempty"`
+}
+
+type BatchOperation struct {
+	Op             BatchOperationType   `json:"op"`
+	SubscriptionId string               `json:"subscription_id"`
+	Changes        *SubscriptionChanges `json:"changes,omitempty"`
+	// Status is the new status of a set_status operation
+	Status SubscriptionStatus `json:"status,omitempty"`
+}
+
+type BatchInput struct {
+	UserName   string           `json:"username"`
+	Mode       BatchMode        `json:"mode"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchOperationStatus string
+
+const (
+	BatchSucceeded BatchOperationStatus = "succeeded"
+	BatchFailed    BatchOperationStatus = "failed"
+	// BatchAborted operations were valid but not written because another
+	// operation of an atomic batch failed
+	BatchAborted BatchOperationStatus = "aborted"
+)
+
+type BatchOperationResult struct {
+	Index          int                  `json:"index"`
+	Op             BatchOperationType   `json:"op"`
+	SubscriptionId string               `json:"subscription_id"`
+	Status         BatchOperationStatus `json:"status"`
+	StatusCode     int                  `json:"status_code"`
+	Error          string               `json:"error,omitempty"`
+	// Subscription is the subscription as written by an update or status change
+	Subscription *SubscriptionDynamodb `json:"subscription,omitempty"`
+}
+
+type BatchResult struct {
+	Mode      BatchMode              `json:"mode"`
+	Succeeded int                    `json:"succeeded"`
+	Failed    int                    `json:"failed"`
+	Results   []BatchOperationResult `json:"results"`
+}
+
+// SubscriptionWrite is a change of a batch: the subscription is replaced by
+// After, or deleted when After is nil
+type SubscriptionWrite struct {
+	Before SubscriptionDynamodb
+	After  *SubscriptionDynamodb
+}
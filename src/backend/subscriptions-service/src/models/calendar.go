@@ -0,0 +1,13 @@
+package models
+
+type CalendarFeedToken struct {
+	UserName     string `json:"username"`
+	Token        string `json:"token"`
+	ReminderDays int    `json:"reminder_days"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type CalendarTokenInput struct {
+	UserName     string `json:"username"`
+	ReminderDays *int   `json:"reminder_days"`
+}
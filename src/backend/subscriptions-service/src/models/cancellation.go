@@ -0,0 +1,61 @@
+package models
+
+type CancellationStatus string
+
+const (
+	// CancellationPending is a cancellation decided on but not yet done
+	// with the vendor; the alerter reminds the user of it every day
+	CancellationPending   CancellationStatus = "pending"
+	CancellationConfirmed CancellationStatus = "confirmed"
+)
+
+type SubscriptionCancellation struct {
+	Status CancellationStatus `json:"status"`
+	// CancelBy is the day the subscription has to be cancelled by, usually
+	// just before its next renewal
+	CancelBy    string `json:"cancel_by"`
+	RequestedBy string `json:"requested_by"`
+	RequestedAt string `json:"requested_at"`
+	// the settings page and steps are copied from the catalog when the
+	// cancellation starts, for the reminders
+	SettingsUrl string   `json:"settings_url,omitempty"`
+	Steps       []string `json:"steps,omitempty"`
+	// LastReminderDate is set by the alerter
+	LastReminderDate   string `json:"last_reminder_date,omitempty"`
+	ConfirmedBy        string `json:"confirmed_by,omitempty"`
+	ConfirmedAt        string `json:"confirmed_at,omitempty"`
+	ConfirmationNumber string `json:"confirmation_number,omitempty"`
+	// EndsOn is the last day of service the vendor confirmed
+	EndsOn                string `json:"ends_on,omitempty"`
+	ScreenshotKey         string `json:"screenshot_key,omitempty"`
+	ScreenshotContentType string `json:"screenshot_content_type,omitempty"`
+}
+
+type CancellationStartInput struct {
+	UserName string `json:"username"`
+	// CancelBy defaults to the day before the next renewal
+	CancelBy string `json:"cancel_by,omitempty"`
+}
+
+type CancellationConfirmInput struct {
+	UserName           string `json:"username"`
+	ConfirmationNumber string `json:"confirmation_number"`
+	// EndsOn defaults to the next renewal, when the paid period ends
+	EndsOn string `json:"ends_on,omitempty"`
+	// Screenshot is an optional base64 encoded image of the confirmation
+	Screenshot            string `json:"screenshot,omitempty"`
+	ScreenshotContentType string `json:"screenshot_content_type,omitempty"`
+}
+
+type CancellationDetails struct {
+	SubscriptionId string                   `json:"subscription_id"`
+	Name           string                   `json:"name"`
+	Cancellation   SubscriptionCancellation `json:"cancellation"`
+	NextRenewal    string                   `json:"next_renewal,omitempty"`
+	VendorName     string                   `json:"vendor_name,omitempty"`
+	SettingsUrl    string                   `json:"settings_url,omitempty"`
+	Steps          []string                 `json:"steps"`
+	ScreenshotUrl  string                   `json:"screenshot_url,omitempty"`
+	// ExpiresAt is when the screenshot URL expires
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,73 @@
+package models
+
+type Category struct {
+	// UserName is the owner of the category, or the subscriptions partition
+	// of a household
+	UserName   string               `json:"username"`
+	CategoryId SubscriptionCategory `json:"category_id"`
+	Name       string               `json:"name"`
+	Color      string               `json:"color"`
+	BuiltIn    bool                 `json:"built_in"`
+	CreatedAt  string               `json:"created_at,omitempty"`
+}
+
+type CategoryCreateInput struct {
+	UserName    string `json:"username"`
+	HouseholdId string `json:"household_id"`
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+}
+
+type CategoryUpdateInput struct {
+	UserName    string `json:"username"`
+	HouseholdId string `json:"household_id"`
+	Name        string `json:"name,omitempty"`
+	Color       string `json:"color,omitempty"`
+}
+
+type CategoryMergeInput struct {
+	UserName    string               `json:"username"`
+	HouseholdId string               `json:"household_id"`
+	Into        SubscriptionCategory `json:"into"`
+}
+
+type CategoryMergeResult struct {
+	Into Category `json:"into"`
+	// MovedSubscriptions is the number of subscriptions recategorized
+	MovedSubscriptions int `json:"moved_subscriptions"`
+	// Deleted tells whether the merged category was removed, which built-in
+	// categories never are
+	Deleted bool `json:"deleted"`
+}
+
+type SubscriptionFilter struct {
+	Category SubscriptionCategory
+	// Tags must all be carried by a subscription
+	Tags []string
+}
+
+type SubscriptionGroupBy string
+
+const (
+	GroupByCategory SubscriptionGroupBy = "category"
+	GroupByTag      SubscriptionGroupBy = "tag"
+)
+
+type SubscriptionGroup struct {
+	Key               string   `json:"key"`
+	Name              string   `json:"name"`
+	Color             string   `json:"color,omitempty"`
+	SubscriptionCount int      `json:"subscription_count"`
+	SubscriptionIds   []string `json:"subscription_ids"`
+	// costs are totalled per currency
+	MonthlyCosts map[string]float32 `json:"monthly_costs"`
+	AnnualCosts  map[string]float32 `json:"annual_costs"`
+	// TaxQuarters totals the tax of the group's payments when asked for
+	TaxQuarters []TaxQuarterTotal `json:"tax_quarters,omitempty"`
+}
+
+type SubscriptionSummary struct {
+	UserName string              `json:"username"`
+	GroupBy  SubscriptionGroupBy `json:"group_by"`
+	Groups   []SubscriptionGroup `json:"groups"`
+}
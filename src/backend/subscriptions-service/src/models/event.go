@@ -0,0 +1,45 @@
+package models
+
+type DomainEventType string
+
+const (
+	SubscriptionCreated     DomainEventType = "subscription.created"
+	SubscriptionCostChanged DomainEventType = "subscription.cost_changed"
+	SubscriptionCancelled   DomainEventType = "subscription.cancelled"
+	PaymentRecorded         DomainEventType = "payment.recorded"
+	PaymentFailed           DomainEventType = "payment.failed"
+)
+
+func (t DomainEventType) IsValid() bool {
+	return t == SubscriptionCreated || t == SubscriptionCostChanged || t == SubscriptionCancelled || t == PaymentRecorded || t == PaymentFailed
+}
+
+// DomainEvent is the envelope every event is published in. Consumers read
+// Data according to Type, and check Version before relying on its shape.
+type DomainEvent struct {
+	Version string          `json:"version"`
+	Id      string          `json:"id"`
+	Type    DomainEventType `json:"type"`
+	Source  string          `json:"source"`
+	Time    string          `json:"time"`
+	// id of the subscription the event is about
+	Subject  string `json:"subject"`
+	UserName string `json:"username"`
+	// correlation id of the invocation that published the event, for the
+	// consumers to log theirs under
+	CorrelationId string      `json:"correlation_id,omitempty"`
+	Data          interface{} `json:"data"`
+}
+
+type SubscriptionEventData struct {
+	Subscription SubscriptionDynamodb `json:"subscription"`
+	// set on subscription.cost_changed only
+	PreviousCost     *float32 `json:"previous_cost,omitempty"`
+	PreviousCurrency string   `json:"previous_currency,omitempty"`
+}
+
+type PaymentEventData struct {
+	Payment PaymentDynamodb `json:"payment"`
+	// set on payment.failed only, for the notification
+	SubscriptionName string `json:"subscription_name,omitempty"`
+}
@@ -0,0 +1,62 @@
+package models
+
+type ExportFormat string
+
+const (
+	ExportCSV  ExportFormat = "csv"
+	ExportJSON ExportFormat = "json"
+	ExportXLSX ExportFormat = "xlsx"
+
+	// plain-text accounting formats, hledger reads the ledger syntax
+	ExportLedger    ExportFormat = "ledger"
+	ExportHledger   ExportFormat = "hledger"
+	ExportBeancount ExportFormat = "beancount"
+)
+
+// ExportColumns is the column schema of the CSV export. Downstream scripts
+// depend on it, so columns may be appended but never renamed or reordered.
+var ExportColumns = []string{
+	"subscription_id",
+	"name",
+	"url",
+	"plan",
+	"category",
+	"billing_cycle",
+	"currency",
+	"cost",
+	"start_date",
+	"last_payment_date",
+	"payment_id",
+	"payment_date",
+	"payment_amount",
+	"category_name",
+	"tags",
+	"payment_status",
+	"refunded_amount",
+	"net_amount",
+	// the tax breakdown; net_amount above is the amount net of refunds
+	"amount_before_tax",
+	"tax_amount",
+	"tax_rate",
+	"invoice_number",
+	"seller_tax_id",
+}
+
+type SubscriptionExport struct {
+	SubscriptionDynamodb
+	Payments []PaymentDynamodb `json:"payments"`
+}
+
+type UserExport struct {
+	UserName      string               `json:"username"`
+	ExportedAt    string               `json:"exported_at"`
+	Subscriptions []SubscriptionExport `json:"subscriptions"`
+	Categories    []Category           `json:"categories"`
+}
+
+type LedgerOptions struct {
+	// FundingAccount is the account every payment is drawn from
+	FundingAccount string
+	// Accounts overrides the expense account of a category
+	Accounts map[SubscriptionCategory]string
+}
@@ -0,0 +1,56 @@
+package models
+
+type ForecastCharge struct {
+	SubscriptionId string               `json:"subscription_id"`
+	Name           string               `json:"name"`
+	Date           string               `json:"date"`
+	Amount         float32              `json:"amount"`
+	Currency       string               `json:"currency"`
+	Category       SubscriptionCategory `json:"category"`
+	// AfterTrial is set on the first charge after a free trial
+	AfterTrial bool `json:"after_trial,omitempty"`
+	// PriceChanged is set on the charges made at an announced new price
+	PriceChanged bool `json:"price_changed,omitempty"`
+}
+
+type ForecastCategory struct {
+	CategoryId SubscriptionCategory `json:"category_id"`
+	Name       string               `json:"name"`
+	Color      string               `json:"color,omitempty"`
+	// totals are per currency
+	Totals map[string]float32 `json:"totals"`
+}
+
+type ForecastMonth struct {
+	// Month is formatted YYYY-MM
+	Month      string             `json:"month"`
+	Totals     map[string]float32 `json:"totals"`
+	Categories []ForecastCategory `json:"categories"`
+	Charges    []ForecastCharge   `json:"charges"`
+}
+
+type ForecastPriceChange struct {
+	SubscriptionId string  `json:"subscription_id"`
+	Name           string  `json:"name"`
+	EffectiveDate  string  `json:"effective_date"`
+	PreviousCost   float32 `json:"previous_cost"`
+	Cost           float32 `json:"cost"`
+	Currency       string  `json:"currency"`
+}
+
+type ForecastCancellation struct {
+	SubscriptionId string `json:"subscription_id"`
+	Name           string `json:"name"`
+	CancelAt       string `json:"cancel_at"`
+}
+
+type Forecast struct {
+	UserName string `json:"username"`
+	// From and To are the first and last days projected
+	From          string                 `json:"from"`
+	To            string                 `json:"to"`
+	Totals        map[string]float32     `json:"totals"`
+	Months        []ForecastMonth        `json:"months"`
+	PriceChanges  []ForecastPriceChange  `json:"price_changes"`
+	Cancellations []ForecastCancellation `json:"cancellations"`
+}
@@ -0,0 +1,72 @@
+package models
+
+type HouseholdRole string
+
+const (
+	HouseholdOwner  HouseholdRole = "owner"
+	HouseholdAdmin  HouseholdRole = "admin"
+	HouseholdMember HouseholdRole = "member"
+)
+
+func (r HouseholdRole) IsValid() bool {
+	return r == HouseholdOwner || r == HouseholdAdmin || r == HouseholdMember
+}
+
+type HouseholdAction string
+
+const (
+	HouseholdView          HouseholdAction = "view"
+	HouseholdAddPayment    HouseholdAction = "add_payment"
+	HouseholdEdit          HouseholdAction = "edit"
+	HouseholdDelete        HouseholdAction = "delete"
+	HouseholdManageMembers HouseholdAction = "manage_members"
+)
+
+type MembershipStatus string
+
+const (
+	MembershipInvited MembershipStatus = "invited"
+	MembershipActive  MembershipStatus = "active"
+)
+
+type Household struct {
+	HouseholdId string `json:"household_id"`
+	Name        string `json:"name"`
+	CreatedBy   string `json:"created_by"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type HouseholdMembership struct {
+	HouseholdId string           `json:"household_id"`
+	UserName    string           `json:"username"`
+	Role        HouseholdRole    `json:"role"`
+	Status      MembershipStatus `json:"status"`
+	InvitedBy   string           `json:"invited_by"`
+	CreatedAt   string           `json:"created_at"`
+}
+
+type HouseholdDetails struct {
+	Household
+	Role    HouseholdRole         `json:"role"`
+	Members []HouseholdMembership `json:"members,omitempty"`
+}
+
+type HouseholdCreateInput struct {
+	UserName string `json:"username"`
+	Name     string `json:"name"`
+}
+
+type HouseholdInviteInput struct {
+	UserName        string        `json:"username"`
+	InviteeUserName string        `json:"invitee_username"`
+	InviteeEmail    string        `json:"invitee_email"`
+	Role            HouseholdRole `json:"role"`
+}
+
+type HouseholdRoleInput struct {
+	Role HouseholdRole `json:"role"`
+}
+
+type HouseholdJoinInput struct {
+	UserName string `json:"username"`
+}
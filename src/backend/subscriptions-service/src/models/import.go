@@ -0,0 +1,24 @@
+package models
+
+type SubscriptionImportInput struct {
+	UserName      string            `json:"username"`
+	Csv           string            `json:"csv"`
+	ColumnMapping map[string]string `json:"column_mapping"`
+	Commit        bool              `json:"commit"`
+}
+
+type ImportRowResult struct {
+	Row          int                   `json:"row"`
+	Valid        bool                  `json:"valid"`
+	Errors       []string              `json:"errors,omitempty"`
+	Subscription *SubscriptionDynamodb `json:"subscription,omitempty"`
+}
+
+type SubscriptionImportResult struct {
+	DryRun      bool              `json:"dry_run"`
+	TotalRows   int               `json:"total_rows"`
+	ValidRows   int               `json:"valid_rows"`
+	InvalidRows int               `json:"invalid_rows"`
+	Imported    int               `json:"imported"`
+	Rows        []ImportRowResult `json:"rows"`
+}
@@ -0,0 +1,28 @@
+package models
+
+type SavingsRule string
+
+const (
+	OverlapRule       SavingsRule = "overlapping_services"
+	YearlyPlanRule    SavingsRule = "yearly_plan"
+	UnusedRule        SavingsRule = "unused_subscription"
+	PriceIncreaseRule SavingsRule = "price_increase"
+)
+
+type SavingsRecommendation struct {
+	Rule            SavingsRule `json:"rule"`
+	Title           string      `json:"title"`
+	Description     string      `json:"description"`
+	SubscriptionIds []string    `json:"subscription_ids"`
+	// EstimatedAnnualSavings is what following the recommendation saves
+	// over a year
+	EstimatedAnnualSavings float32 `json:"estimated_annual_savings"`
+	Currency               string  `json:"currency"`
+}
+
+type SavingsReport struct {
+	UserName        string                  `json:"username"`
+	Recommendations []SavingsRecommendation `json:"recommendations"`
+	// totals are per currency, counting each subscription once
+	TotalAnnualSavings map[string]float32 `json:"total_annual_savings"`
+}
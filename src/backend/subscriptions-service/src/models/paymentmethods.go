@@ -0,0 +1,50 @@
+package models
+
+type PaymentMethodType string
+
+const (
+	CardPaymentMethod   PaymentMethodType = "card"
+	BankPaymentMethod   PaymentMethodType = "bank_account"
+	WalletPaymentMethod PaymentMethodType = "wallet"
+)
+
+func (t PaymentMethodType) IsValid() bool {
+	return t == CardPaymentMethod || t == BankPaymentMethod || t == WalletPaymentMethod
+}
+
+// PaymentMethod is the card or account paying for subscriptions. Only the
+// last four digits of its number are kept, never the full number.
+type PaymentMethod struct {
+	UserName        string            `json:"username"`
+	PaymentMethodId string            `json:"payment_method_id"`
+	Type            PaymentMethodType `json:"type"`
+	Nickname        string            `json:"nickname"`
+	Brand           string            `json:"brand,omitempty"`
+	LastFour        string            `json:"last_four,omitempty"`
+	// the expiry is set on cards only
+	ExpiryMonth int    `json:"expiry_month,omitempty"`
+	ExpiryYear  int    `json:"expiry_year,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	// ExpiryAlertedFor is the expiry (YYYY-MM) the alerter last warned of
+	ExpiryAlertedFor string `json:"expiry_alerted_for,omitempty"`
+}
+
+type PaymentMethodInput struct {
+	UserName    string            `json:"username"`
+	Type        PaymentMethodType `json:"type"`
+	Nickname    string            `json:"nickname"`
+	Brand       string            `json:"brand"`
+	LastFour    string            `json:"last_four"`
+	ExpiryMonth int               `json:"expiry_month"`
+	ExpiryYear  int               `json:"expiry_year"`
+}
+
+type PaymentMethodDetails struct {
+	PaymentMethod
+	// ExpiresOn is the last day a card can be charged
+	ExpiresOn string `json:"expires_on,omitempty"`
+	Expired   bool   `json:"expired"`
+	// SubscriptionIds are the subscriptions of the user paid with the method
+	SubscriptionIds []string `json:"subscription_ids"`
+}
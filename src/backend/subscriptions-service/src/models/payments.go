@@ -1,14 +1,102 @@
 package models
 
+type PaymentStatus string
+
+const (
+	PaymentStatusScheduled         PaymentStatus = "scheduled"
+	PaymentStatusPaid              PaymentStatus = "paid"
+	PaymentStatusFailed            PaymentStatus = "failed"
+	PaymentStatusRefunded          PaymentStatus = "refunded"
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded"
+)
+
+func (s PaymentStatus) IsValid() bool {
+	return s == PaymentStatusScheduled || s == PaymentStatusPaid || s == PaymentStatusFailed || s == PaymentStatusRefunded || s == PaymentStatusPartiallyRefunded
+}
+
 type PaymentDynamodb struct {
 	SubscriptionId string  `json:"subscription_id"`
 	UUID           string  `json:"uuid"`
 	UserName       string  `json:"username"`
 	Amount         float32 `json:"amount"`
 	PaymentDate    string  `json:"payment_date"`
+	// Status is empty on payments recorded before statuses, which are paid
+	Status        PaymentStatus `json:"status,omitempty"`
+	FailureReason string        `json:"failure_reason,omitempty"`
+	// RefundedAmount is the total of the payment's refunds
+	RefundedAmount float32 `json:"refunded_amount,omitempty"`
+	PaymentTax
+}
+
+// PaymentTax is the tax breakdown and invoice of a payment. The amount before
+// tax and the tax amount add up to the payment amount; both are unset on a
+// payment recorded without a breakdown.
+type PaymentTax struct {
+	AmountBeforeTax float32 `json:"amount_before_tax,omitempty"`
+	TaxAmount       float32 `json:"tax_amount,omitempty"`
+	// TaxRate is a percentage of the amount before tax
+	TaxRate       float32 `json:"tax_rate,omitempty"`
+	InvoiceNumber string  `json:"invoice_number,omitempty"`
+	SellerTaxId   string  `json:"seller_tax_id,omitempty"`
+}
+
+// PaymentTaxInput is the tax breakdown given with a payment. Any one of the
+// amount before tax, tax amount or tax rate is enough, the others are derived
+// from the payment amount.
+type PaymentTaxInput struct {
+	AmountBeforeTax string `json:"amount_before_tax"`
+	TaxAmount       string `json:"tax_amount"`
+	TaxRate         string `json:"tax_rate"`
+	InvoiceNumber   string `json:"invoice_number"`
+	SellerTaxId     string `json:"seller_tax_id"`
+}
+
+// TaxQuarterTotal is the tax paid in a quarter in one currency
+type TaxQuarterTotal struct {
+	// Quarter is written YYYY-Qn
+	Quarter         string  `json:"quarter"`
+	Currency        string  `json:"currency"`
+	PaymentCount    int     `json:"payment_count"`
+	AmountBeforeTax float32 `json:"amount_before_tax"`
+	TaxAmount       float32 `json:"tax_amount"`
+	GrossAmount     float32 `json:"gross_amount"`
+	// UntrackedAmount is the part of the gross amount paid without a tax
+	// breakdown, counted in neither the amount before tax nor the tax amount
+	UntrackedAmount float32 `json:"untracked_amount"`
 }
 
 type PaymentUpdate struct {
 	Amount      float32 `json:"amount"`
 	PaymentDate string  `json:"payment_date"`
+	// an update with only a status keeps the amount and date
+	Status        PaymentStatus `json:"status,omitempty"`
+	FailureReason string        `json:"failure_reason,omitempty"`
+	// an update without a breakdown keeps the payment's, at its tax rate
+	PaymentTaxInput
+	// Tax is the breakdown to store, resolved from the input
+	Tax *PaymentTax `json:"-"`
+}
+
+// PaymentRefund is money returned on a payment, stored under the payment
+type PaymentRefund struct {
+	PaymentId      string  `json:"payment_id"`
+	UUID           string  `json:"uuid"`
+	SubscriptionId string  `json:"subscription_id"`
+	UserName       string  `json:"username"`
+	Amount         float32 `json:"amount"`
+	RefundDate     string  `json:"refund_date"`
+	Reason         string  `json:"reason,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+type PaymentRefundInput struct {
+	UserName   string `json:"username"`
+	Amount     string `json:"amount"`
+	RefundDate string `json:"refund_date"`
+	Reason     string `json:"reason"`
+}
+
+type PaymentRefundResult struct {
+	Payment PaymentDynamodb `json:"payment"`
+	Refund  PaymentRefund   `json:"refund"`
 }
@@ -0,0 +1,53 @@
+package models
+
+type ReceiptStatus string
+
+const (
+	// a new payment was recorded from the receipt
+	ReceiptCreated ReceiptStatus = "created"
+	// the payment of the receipt was already recorded
+	ReceiptMatched ReceiptStatus = "matched"
+	// the receipt was read but no payment could be recorded from it
+	ReceiptUnmatched ReceiptStatus = "unmatched"
+)
+
+type ReceiptEmail struct {
+	MessageId  string   `json:"message_id"`
+	From       string   `json:"from"`
+	To         []string `json:"to"`
+	Subject    string   `json:"subject"`
+	Date       string   `json:"date"`
+	Sender     string   `json:"sender"`
+	SenderName string   `json:"sender_name"`
+	Text       string   `json:"-"`
+}
+
+type ReceiptIngestResult struct {
+	MessageId      string           `json:"message_id"`
+	UserName       string           `json:"username"`
+	Sender         string           `json:"sender"`
+	Subject        string           `json:"subject"`
+	VendorId       string           `json:"vendor_id,omitempty"`
+	VendorName     string           `json:"vendor_name,omitempty"`
+	Amount         float32          `json:"amount,omitempty"`
+	Currency       string           `json:"currency,omitempty"`
+	PaymentDate    string           `json:"payment_date,omitempty"`
+	SubscriptionId string           `json:"subscription_id,omitempty"`
+	Payment        *PaymentDynamodb `json:"payment,omitempty"`
+	Status         ReceiptStatus    `json:"status"`
+	Reason         string           `json:"reason,omitempty"`
+}
+
+// ReceiptIngestToken is the secret that ties the receipts forwarded to
+// receipts+<token>@ to a user
+type ReceiptIngestToken struct {
+	UserName  string `json:"username"`
+	Token     string `json:"token"`
+	CreatedAt string `json:"created_at"`
+	// Address is the address to forward receipts to, set on reads only
+	Address string `json:"address,omitempty" dynamodbav:"-"`
+}
+
+type ReceiptTokenInput struct {
+	UserName string `json:"username"`
+}
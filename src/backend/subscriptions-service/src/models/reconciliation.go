@@ -0,0 +1,52 @@
+package models
+
+type DiscrepancyType string
+
+const (
+	DiscrepancyMissing   DiscrepancyType = "missing_charge"
+	DiscrepancyDuplicate DiscrepancyType = "duplicate_charge"
+	DiscrepancyAmount    DiscrepancyType = "amount_mismatch"
+)
+
+// PaymentDiscrepancy is a difference between the charges a subscription's
+// billing cycle and cost call for and the payments recorded for it
+type PaymentDiscrepancy struct {
+	// Id stays the same across runs, so that a discrepancy is alerted once
+	Id             string          `json:"id"`
+	Type           DiscrepancyType `json:"type"`
+	SubscriptionId string          `json:"subscription_id"`
+	Name           string          `json:"name"`
+	Currency       string          `json:"currency"`
+	// the expected charge, unset on a duplicate
+	ExpectedDate   string  `json:"expected_date,omitempty"`
+	ExpectedAmount float32 `json:"expected_amount,omitempty"`
+	// the recorded payments, the first one being the charge matched
+	PaymentIds  []string `json:"payment_ids,omitempty"`
+	PaymentDate string   `json:"payment_date,omitempty"`
+	Amount      float32  `json:"amount,omitempty"`
+}
+
+type ReconciliationReport struct {
+	UserName string `json:"username"`
+	// From and To are the first and last days reconciled
+	From                 string               `json:"from"`
+	To                   string               `json:"to"`
+	SubscriptionsChecked int                  `json:"subscriptions_checked"`
+	ExpectedCharges      int                  `json:"expected_charges"`
+	Discrepancies        []PaymentDiscrepancy `json:"discrepancies"`
+}
+
+// ReconciliationAlert records that a discrepancy was emailed to a user
+type ReconciliationAlert struct {
+	UserName      string `json:"username"`
+	DiscrepancyId string `json:"discrepancy_id"`
+	AlertedAt     string `json:"alerted_at"`
+	// ExpiresAt is the TTL of the record, in Unix seconds
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+type ReconciliationRunResult struct {
+	UsersChecked  int `json:"users_checked"`
+	Discrepancies int `json:"discrepancies"`
+	UsersAlerted  int `json:"users_alerted"`
+}
@@ -1,14 +1,22 @@
 package models
 
 type SubscriptionCreateInput struct {
-	UserName    string               `json:"username"`
-	Name        string               `json:"name"`
-	Url         string               `json:"url"`
-	SettingsUrl string               `json:"settings_url"`
-	Plan        string               `json:"plan"`
-	Cost        string               `json:"cost"`
-	StartDate   string               `json:"start_date"`
-	Category    SubscriptionCategory `json:"category"`
+	UserName     string               `json:"username"`
+	Name         string               `json:"name"`
+	Url          string               `json:"url"`
+	SettingsUrl  string               `json:"settings_url"`
+	Icon         string               `json:"icon"`
+	Plan         string               `json:"plan"`
+	Cost         string               `json:"cost"`
+	Currency     string               `json:"currency"`
+	BillingCycle BillingCycle         `json:"billing_cycle"`
+	StartDate    string               `json:"start_date"`
+	TrialEndDate string               `json:"trial_end_date"`
+	Category     SubscriptionCategory `json:"category"`
+	Tags         []string             `json:"tags"`
+	HouseholdId  string               `json:"household_id"`
+	// PaymentMethodId is one of the user's payment methods
+	PaymentMethodId string `json:"payment_method_id"`
 }
 
 type PaymentCreateInput struct {
@@ -16,4 +24,8 @@ type PaymentCreateInput struct {
 	UserName       string `json:"username"`
 	Amount         string `json:"amount"`
 	PaymentDate    string `json:"payment_date"`
+	// Status defaults to paid
+	Status        PaymentStatus `json:"status"`
+	FailureReason string        `json:"failure_reason"`
+	PaymentTaxInput
 }
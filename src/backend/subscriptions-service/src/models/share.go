@@ -0,0 +1,86 @@
+package models
+
+type SplitMethod string
+
+const (
+	SplitEqual      SplitMethod = "equal"
+	SplitPercentage SplitMethod = "percentage"
+	SplitFixed      SplitMethod = "fixed"
+)
+
+func (s SplitMethod) IsValid() bool {
+	return s == SplitEqual || s == SplitPercentage || s == SplitFixed
+}
+
+type SubscriptionShare struct {
+	SubscriptionId string      `json:"subscription_id"`
+	Participant    string      `json:"participant"`
+	Owner          string      `json:"owner"`
+	SplitMethod    SplitMethod `json:"split_method"`
+	Percentage     float32     `json:"percentage"`
+	Amount         float32     `json:"amount"`
+	CreatedAt      string      `json:"created_at"`
+}
+
+type ShareParticipantInput struct {
+	UserName   string  `json:"username"`
+	Email      string  `json:"email"`
+	Percentage float32 `json:"percentage"`
+	Amount     float32 `json:"amount"`
+}
+
+type SubscriptionShareInput struct {
+	UserName     string                  `json:"username"`
+	SplitMethod  SplitMethod             `json:"split_method"`
+	Participants []ShareParticipantInput `json:"participants"`
+}
+
+type ParticipantShare struct {
+	UserName   string  `json:"username"`
+	Owner      bool    `json:"owner"`
+	Percentage float32 `json:"percentage"`
+	Amount     float32 `json:"amount"`
+	Since      string  `json:"since,omitempty"`
+}
+
+type SubscriptionSplit struct {
+	SubscriptionId string             `json:"subscription_id"`
+	Name           string             `json:"name"`
+	Owner          string             `json:"owner"`
+	Cost           float32            `json:"cost"`
+	Currency       string             `json:"currency"`
+	BillingCycle   BillingCycle       `json:"billing_cycle"`
+	SplitMethod    SplitMethod        `json:"split_method"`
+	Shares         []ParticipantShare `json:"shares"`
+}
+
+type Settlement struct {
+	UserName     string  `json:"username"`
+	SettlementId string  `json:"settlement_id"`
+	From         string  `json:"from"`
+	To           string  `json:"to"`
+	Amount       float32 `json:"amount"`
+	Currency     string  `json:"currency"`
+	Date         string  `json:"date"`
+}
+
+type SettlementInput struct {
+	UserName string `json:"username"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+	Date     string `json:"date"`
+}
+
+type Balance struct {
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Amount   float32 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+type UserBalances struct {
+	UserName string    `json:"username"`
+	Balances []Balance `json:"balances"`
+}
@@ -0,0 +1,54 @@
+package models
+
+type StatementFormat string
+
+const (
+	StatementOFX StatementFormat = "ofx"
+	StatementQFX StatementFormat = "qfx"
+	StatementCSV StatementFormat = "csv"
+)
+
+type StatementImportInput struct {
+	UserName      string            `json:"username"`
+	Format        StatementFormat   `json:"format"`
+	Content       string            `json:"content"`
+	ColumnMapping map[string]string `json:"column_mapping"`
+}
+
+type StatementTransaction struct {
+	Date        string  `json:"date"`
+	Description string  `json:"description"`
+	Amount      float32 `json:"amount"`
+	Currency    string  `json:"currency"`
+}
+
+type SubscriptionProposal struct {
+	Merchant     string                  `json:"merchant"`
+	Confidence   float32                 `json:"confidence"`
+	Subscription SubscriptionCreateInput `json:"subscription"`
+	Transactions []StatementTransaction  `json:"transactions"`
+}
+
+type StatementImportResult struct {
+	TransactionCount int                    `json:"transaction_count"`
+	Proposals        []SubscriptionProposal `json:"proposals"`
+}
+
+type ProposalAcceptInput struct {
+	UserName  string                 `json:"username"`
+	Proposals []SubscriptionProposal `json:"proposals"`
+}
+
+// ProposalAcceptResult is the outcome of one accepted proposal, in the
+// order they were sent
+type ProposalAcceptResult struct {
+	Index      int                  `json:"index"`
+	Merchant   string               `json:"merchant"`
+	Status     BatchOperationStatus `json:"status"`
+	StatusCode int                  `json:"status_code"`
+	Error      string               `json:"error,omitempty"`
+	// Subscription is set once created, even when its payments failed, so
+	// that the proposal is not accepted again
+	Subscription *SubscriptionDynamodb `json:"subscription,omitempty"`
+	Payments     []PaymentDynamodb     `json:"payments,omitempty"`
+}
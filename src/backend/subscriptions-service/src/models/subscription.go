@@ -1,5 +1,7 @@
 package models
 
+import "strings"
+
 type SubscriptionCategory string
 
 const (
@@ -7,15 +9,86 @@ const (
 	Music     SubscriptionCategory = "music"
 	Gaming    SubscriptionCategory = "gaming"
 	Delivery  SubscriptionCategory = "delivery"
-	Fittness  SubscriptionCategory = "fittness"
+	Fitness   SubscriptionCategory = "fitness"
 	Education SubscriptionCategory = "education"
-	Magzine   SubscriptionCategory = "magzine"
+	Magazine  SubscriptionCategory = "magazine"
 	Software  SubscriptionCategory = "software"
 	Finance   SubscriptionCategory = "finance"
 	Fashion   SubscriptionCategory = "fashion"
 	Other     SubscriptionCategory = "other"
 )
 
+var SubscriptionCategories = []SubscriptionCategory{
+	OTT, Music, Gaming, Delivery, Fitness, Education, Magazine, Software, Finance, Fashion, Other,
+}
+
+// LegacyCategories maps the misspelled values stored by earlier versions
+// to the built-in category replacing them
+var LegacyCategories = map[SubscriptionCategory]SubscriptionCategory{
+	"fittness": Fitness,
+	"magzine":  Magazine,
+}
+
+func (c SubscriptionCategory) IsValid() bool {
+	for _, category := range SubscriptionCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func (c SubscriptionCategory) Normalize() SubscriptionCategory {
+	/*
+		Returns the category in lower case, with a legacy value replaced by
+		the built-in category it was migrated to.
+		Params: None
+		Return: SubscriptionCategory
+	*/
+	category := SubscriptionCategory(strings.ToLower(strings.TrimSpace(string(c))))
+	if migrated, ok := LegacyCategories[category]; ok {
+		return migrated
+	}
+	return category
+}
+
+type BillingCycle string
+
+const (
+	Weekly    BillingCycle = "weekly"
+	Monthly   BillingCycle = "monthly"
+	Quarterly BillingCycle = "quarterly"
+	Yearly    BillingCycle = "yearly"
+)
+
+var BillingCycles = []BillingCycle{Weekly, Monthly, Quarterly, Yearly}
+
+func (b BillingCycle) IsValid() bool {
+	for _, cycle := range BillingCycles {
+		if b == cycle {
+			return true
+		}
+	}
+	return false
+}
+
+type SubscriptionStatus string
+
+const (
+	StatusActive    SubscriptionStatus = "active"
+	StatusPaused    SubscriptionStatus = "paused"
+	StatusCancelled SubscriptionStatus = "cancelled"
+)
+
+func (s SubscriptionStatus) IsValid() bool {
+	return s == StatusActive || s == StatusPaused || s == StatusCancelled
+}
+
+type PriceChange struct {
+	EffectiveDate string  `json:"effective_date"`
+	Cost          float32 `json:"cost"`
+}
+
 type SubscriptionDynamodb struct {
 	UserName        string               `json:"username"`
 	UUID            string               `json:"uuid"`
@@ -23,11 +96,41 @@ type SubscriptionDynamodb struct {
 	Url             string               `json:"url"`
 	SettingsUrl     string               `json:"settings_url"`
 	Plan            string               `json:"plan"`
+	VendorId        string               `json:"vendor_id"`
+	PlanId          string               `json:"plan_id"`
 	StartDate       string               `json:"start_date"`
 	Cost            float32              `json:"cost"`
+	Currency        string               `json:"currency"`
+	BillingCycle    BillingCycle         `json:"billing_cycle"`
 	Icon            string               `json:"icon"`
 	LastPaymentDate string               `json:"last_payment_date"`
+	TrialEndDate    string               `json:"trial_end_date"`
 	Category        SubscriptionCategory `json:"category"`
+	Tags            []string             `json:"tags,omitempty"`
+	HouseholdId     string               `json:"household_id,omitempty"`
+	// Status is empty for the subscriptions stored before it was added,
+	// which are active
+	Status SubscriptionStatus `json:"status,omitempty"`
+	// CancelAt is the scheduled end of the subscription; it does not renew
+	// on or after this date
+	CancelAt string `json:"cancel_at,omitempty"`
+	// PriceChanges are the announced changes of the cost, by effective date
+	PriceChanges []PriceChange `json:"price_changes,omitempty"`
+	// LastUsedDate is the last day the subscription was used
+	LastUsedDate string `json:"last_used_date,omitempty"`
+	// PaymentMethodId is the card or account the subscription is paid with
+	PaymentMethodId string `json:"payment_method_id,omitempty"`
+	// Cancellation is the cancellation being done with the vendor
+	Cancellation *SubscriptionCancellation `json:"cancellation,omitempty"`
+	// set on reads only, when the cost is the share of a shared subscription
+	SharedBy string  `json:"shared_by,omitempty"`
+	FullCost float32 `json:"full_cost,omitempty"`
+	// set on reads only: the uses recorded by the reader in the last
+	// USAGE_METRICS_DAYS days, the cost of each of them and the days since
+	// the subscription was last used
+	RecentUses       *int     `json:"recent_uses,omitempty"`
+	CostPerUse       *float32 `json:"cost_per_use,omitempty"`
+	DaysSinceLastUse *int     `json:"days_since_last_use,omitempty"`
 }
 
 type SubscriptionUpdate struct {
@@ -37,4 +140,16 @@ type SubscriptionUpdate struct {
 	Cost            float32 `json:"cost"`
 	LastPaymentDate string  `json:"last_payment_date"`
 	Category        string  `json:"category"`
+	Currency        string  `json:"currency,omitempty"`
+	BillingCycle    string  `json:"billing_cycle,omitempty"`
+	TrialEndDate    string  `json:"trial_end_date,omitempty"`
+	PlanId          string  `json:"plan_id,omitempty"`
+	// nil keeps the scheduled end, an empty date clears it
+	CancelAt *string `json:"cancel_at,omitempty"`
+	// nil keeps the tags, an empty list removes them
+	Tags []string `json:"tags,omitempty"`
+	// nil keeps the price changes, an empty list removes them
+	PriceChanges []PriceChange `json:"price_changes,omitempty"`
+	// nil keeps the payment method, an empty id unlinks it
+	PaymentMethodId *string `json:"payment_method_id,omitempty"`
 }
@@ -0,0 +1,68 @@
+package models
+
+type UsageSource string
+
+const (
+	// UsageVisit is a visit to a vendor domain, reported by the extension
+	UsageVisit UsageSource = "visit"
+	// UsageSession is a session logged by the user
+	UsageSession UsageSource = "session"
+)
+
+type UsageEventInput struct {
+	// SubscriptionId may be left out of a visit, which is then matched to
+	// a subscription by its domain
+	SubscriptionId string      `json:"subscription_id,omitempty"`
+	Domain         string      `json:"domain,omitempty"`
+	Source         UsageSource `json:"source"`
+	// OccurredAt is RFC 3339, now when empty
+	OccurredAt      string `json:"occurred_at,omitempty"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+}
+
+type UsageInput struct {
+	UserName string            `json:"username"`
+	Events   []UsageEventInput `json:"events"`
+}
+
+type UsageDynamodb struct {
+	UserName string `json:"username"`
+	// Id is "<window start>#<subscription id>" for a visit, so that the
+	// visits of a window are stored once, and
+	// "<occurred at>#<subscription id>#<uuid>" for a session
+	Id              string      `json:"id"`
+	SubscriptionId  string      `json:"subscription_id"`
+	Source          UsageSource `json:"source"`
+	Domain          string      `json:"domain,omitempty"`
+	OccurredAt      string      `json:"occurred_at"`
+	DurationMinutes int         `json:"duration_minutes,omitempty"`
+	// ExpiresAt is the epoch second the item is removed at (DynamoDB TTL)
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+type UsageEventStatus string
+
+const (
+	UsageRecorded UsageEventStatus = "recorded"
+	// UsageThrottled is a visit to a subscription already visited in the
+	// same window
+	UsageThrottled UsageEventStatus = "throttled"
+	// UsageIgnored is a visit to a domain none of the subscriptions is on
+	UsageIgnored  UsageEventStatus = "ignored"
+	UsageRejected UsageEventStatus = "rejected"
+)
+
+type UsageEventResult struct {
+	Index          int              `json:"index"`
+	Status         UsageEventStatus `json:"status"`
+	SubscriptionId string           `json:"subscription_id,omitempty"`
+	Error          string           `json:"error,omitempty"`
+}
+
+type UsageResult struct {
+	Recorded  int                `json:"recorded"`
+	Throttled int                `json:"throttled"`
+	Ignored   int                `json:"ignored"`
+	Rejected  int                `json:"rejected"`
+	Results   []UsageEventResult `json:"results"`
+}
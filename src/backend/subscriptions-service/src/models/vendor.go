@@ -0,0 +1,58 @@
+package models
+
+type VendorPlan struct {
+	Id           string       `json:"id"`
+	Name         string       `json:"name"`
+	Tier         string       `json:"tier"`
+	Price        float32      `json:"price"`
+	Currency     string       `json:"currency"`
+	BillingCycle BillingCycle `json:"billing_cycle"`
+	Region       string       `json:"region"`
+	Seats        int          `json:"seats"`
+	Ads          bool         `json:"ads"`
+	Eligibility  string       `json:"eligibility,omitempty"`
+}
+
+type Vendor struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	// Domains are the hosts of the vendor, a host shared with other
+	// vendors is scoped to the vendor's path ("apple.com/apple-arcade")
+	Domains     []string             `json:"domains"`
+	Url         string               `json:"url"`
+	SettingsUrl string               `json:"settings_url"`
+	Icon        string               `json:"icon"`
+	Category    SubscriptionCategory `json:"category"`
+	Plans       []VendorPlan         `json:"plans,omitempty"`
+	// CancellationSteps are the steps to cancel from the settings page
+	CancellationSteps []string `json:"cancellation_steps,omitempty"`
+}
+
+type PlanSuggestionType string
+
+const (
+	CheaperPlanSuggestion PlanSuggestionType = "cheaper_plan"
+	YearlyPlanSuggestion  PlanSuggestionType = "yearly_plan"
+	FamilyPlanSuggestion  PlanSuggestionType = "family_plan"
+)
+
+type PlanSuggestion struct {
+	Type                PlanSuggestionType `json:"type"`
+	VendorId            string             `json:"vendor_id"`
+	VendorName          string             `json:"vendor_name"`
+	SubscriptionIds     []string           `json:"subscription_ids"`
+	UserNames           []string           `json:"usernames"`
+	CurrentAnnualCost   float32            `json:"current_annual_cost"`
+	SuggestedPlan       VendorPlan         `json:"suggested_plan"`
+	SuggestedAnnualCost float32            `json:"suggested_annual_cost"`
+	AnnualSavings       float32            `json:"annual_savings"`
+	Currency            string             `json:"currency"`
+}
+
+type PlanSuggestionResult struct {
+	UserName           string           `json:"username"`
+	Region             string           `json:"region"`
+	Suggestions        []PlanSuggestion `json:"suggestions"`
+	TotalAnnualSavings float32          `json:"total_annual_savings"`
+}
@@ -0,0 +1,73 @@
+package models
+
+type Webhook struct {
+	UserName    string `json:"username"`
+	WebhookId   string `json:"webhook_id"`
+	Url         string `json:"url"`
+	Description string `json:"description,omitempty"`
+	// EventTypes filters the events delivered, all of them when empty
+	EventTypes []DomainEventType `json:"event_types"`
+	// Secret signs the deliveries. It is returned on creation and rotation only.
+	Secret  string `json:"secret,omitempty"`
+	Enabled bool   `json:"enabled"`
+	// ConsecutiveFailures counts the failed attempts since the last
+	// successful one; the webhook is disabled when it reaches the limit
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	DisabledReason      string `json:"disabled_reason,omitempty"`
+	CreatedAt           string `json:"created_at"`
+	UpdatedAt           string `json:"updated_at,omitempty"`
+}
+
+type WebhookCreateInput struct {
+	UserName    string            `json:"username"`
+	Url         string            `json:"url"`
+	Description string            `json:"description"`
+	EventTypes  []DomainEventType `json:"event_types"`
+}
+
+type WebhookUpdateInput struct {
+	UserName    string             `json:"username"`
+	Url         string             `json:"url,omitempty"`
+	Description *string            `json:"description,omitempty"`
+	EventTypes  *[]DomainEventType `json:"event_types,omitempty"`
+	// Enabled re-enables a webhook disabled after repeated failures
+	Enabled      *bool `json:"enabled,omitempty"`
+	RotateSecret bool  `json:"rotate_secret,omitempty"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+type WebhookDelivery struct {
+	WebhookId string `json:"webhook_id"`
+	// DeliveryId is the id of the event delivered, so that an event is
+	// delivered once to each webhook
+	DeliveryId string                `json:"delivery_id"`
+	UserName   string                `json:"username"`
+	EventType  DomainEventType       `json:"event_type"`
+	Payload    string                `json:"payload"`
+	Status     WebhookDeliveryStatus `json:"status"`
+	Attempts   int                   `json:"attempts"`
+	// Pending is set while the delivery is retried, keying the pending index
+	// with NextAttemptAt
+	Pending            string `json:"pending,omitempty"`
+	NextAttemptAt      string `json:"next_attempt_at,omitempty"`
+	LastStatusCode     int    `json:"last_status_code,omitempty"`
+	LastError          string `json:"last_error,omitempty"`
+	LastResponse       string `json:"last_response,omitempty"`
+	LastAttemptAt      string `json:"last_attempt_at,omitempty"`
+	LastDurationMillis int64  `json:"last_duration_ms,omitempty"`
+	DeliveredAt        string `json:"delivered_at,omitempty"`
+	CreatedAt          string `json:"created_at"`
+}
+
+type WebhookRetryResult struct {
+	Attempted int `json:"attempted"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func PutAttachment(ctx context.Context, item models.PaymentAttachment) (models.PaymentAttachment, error) {
+	/*
+		Stores the details of a file attached to a payment.
+		Params: ctx context.Context
+				item models.PaymentAttachment
+		Return: models.PaymentAttachment, error
+	*/
+	da, err := initialize("attachments")
+	if err != nil {
+		return models.PaymentAttachment{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, item.PaymentId).Str("attachment_id", item.AttachmentId).Msg("Storing attachment")
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing attachment")
+		return models.PaymentAttachment{}, err
+	}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		Item:      mappedItem,
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing attachment")
+		return models.PaymentAttachment{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, item.PaymentId).Str("attachment_id", item.AttachmentId).Msg("Attachment stored")
+	return item, nil
+}
+
+func GetAttachment(ctx context.Context, paymentId string, attachmentId string) (models.PaymentAttachment, error) {
+	/*
+		Gets the details of a file attached to a payment.
+		Params: ctx context.Context
+				paymentId string
+				attachmentId string
+		Return: models.PaymentAttachment, error
+	*/
+	da, err := initialize("attachments")
+	if err != nil {
+		return models.PaymentAttachment{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Str("attachment_id", attachmentId).Msg("Getting attachment")
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"payment_id": {
+				S: aws.String(paymentId),
+			},
+			"attachment_id": {
+				S: aws.String(attachmentId),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting attachment")
+		return models.PaymentAttachment{}, err
+	}
+	if len(result.Item) == 0 {
+		log.Ctx(ctx).Error().Msg("Error getting attachment. No item found.")
+		return models.PaymentAttachment{}, errors.New("404")
+	}
+	item := models.PaymentAttachment{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting attachment")
+		return models.PaymentAttachment{}, err
+	}
+	return item, nil
+}
+
+func GetPaymentAttachments(ctx context.Context, paymentId string) ([]models.PaymentAttachment, error) {
+	/*
+		Gets the details of the files attached to a payment.
+		Params: ctx context.Context
+				paymentId string
+		Return: []models.PaymentAttachment, error
+	*/
+	da, err := initialize("attachments")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Msg("Getting payment attachments")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:     aws.String(da.TableName),
+		KeyConditions: keyCondition("payment_id", paymentId),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Msg("Error getting payment attachments")
+		return nil, err
+	}
+	items := []models.PaymentAttachment{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Msg("Error getting payment attachments")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Int("attachment_count", len(items)).Msg("Payment attachments retrieved")
+	return items, nil
+}
+
+func DeleteAttachment(ctx context.Context, paymentId string, attachmentId string) error {
+	/*
+		Deletes the details of a file attached to a payment.
+		Params: ctx context.Context
+				paymentId string
+				attachmentId string
+		Return: error
+	*/
+	da, err := initialize("attachments")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Str("attachment_id", attachmentId).Msg("Deleting attachment")
+	_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"payment_id": {
+				S: aws.String(paymentId),
+			},
+			"attachment_id": {
+				S: aws.String(attachmentId),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting attachment")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Str("attachment_id", attachmentId).Msg("Attachment deleted")
+	return nil
+}
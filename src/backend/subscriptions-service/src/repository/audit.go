@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// auditContextKey is the context key of the auditContext of a request
+type auditContextKey struct{}
+
+// auditContext identifies who makes the changes of the request being handled
+type auditContext struct {
+	actor     string
+	requestId string
+}
+
+func WithAuditContext(ctx context.Context, actor string, requestId string) context.Context {
+	/*
+		Returns a context carrying the actor and request id recorded with the
+		changes made while handling a request.
+		Params: ctx context.Context
+				actor string (empty when the request names no user)
+				requestId string
+		Return: context.Context
+	*/
+	return context.WithValue(ctx, auditContextKey{}, auditContext{actor: actor, requestId: requestId})
+}
+
+func auditFields(item interface{}) map[string]interface{} {
+	/*
+		Returns the fields of an item by their JSON name, without the empty
+		ones, so that a cleared field shows as removed.
+		Params: item interface{}
+		Return: map[string]interface{}
+	*/
+	fields := map[string]interface{}{}
+	if item == nil {
+		return fields
+	}
+	encoded, err := json.Marshal(item)
+	if err != nil || json.Unmarshal(encoded, &fields) != nil {
+		return map[string]interface{}{}
+	}
+	for field, value := range fields {
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			delete(fields, field)
+		} else if v := reflect.ValueOf(value); (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+			delete(fields, field)
+		}
+	}
+	return fields
+}
+
+func auditChanges(before interface{}, after interface{}) []models.AuditChange {
+	/*
+		Returns the field level differences between two versions of an item,
+		sorted by field.
+		Params: before interface{} (nil on create)
+				after interface{} (nil on delete)
+		Return: []models.AuditChange
+	*/
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+	changes := []models.AuditChange{}
+	for field, value := range afterFields {
+		if !reflect.DeepEqual(beforeFields[field], value) {
+			changes = append(changes, models.AuditChange{Field: field, Before: beforeFields[field], After: value})
+		}
+	}
+	for field, value := range beforeFields {
+		if _, ok := afterFields[field]; !ok {
+			changes = append(changes, models.AuditChange{Field: field, Before: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func recordAudit(ctx context.Context, entry models.AuditEntry, before interface{}, after interface{}, owner string) {
+	/*
+		Appends an entry with the differences between two versions of an
+		item to the audit log. The change is already stored, so a failure is
+		logged rather than returned. Entries are never updated or deleted.
+		Params: ctx context.Context
+				entry models.AuditEntry (subscription, partition, entity and action)
+				before interface{}
+				after interface{}
+				owner string (actor when the request names no user)
+		Return: None
+	*/
+	entry.Changes = auditChanges(before, after)
+	if entry.Action == models.AuditUpdate && len(entry.Changes) == 0 {
+		return
+	}
+	audit, _ := ctx.Value(auditContextKey{}).(auditContext)
+	entry.Actor = audit.actor
+	if entry.Actor == "" {
+		entry.Actor = owner
+	}
+	if entry.Actor == "" {
+		entry.Actor = config.AUDIT_SYSTEM_ACTOR
+	}
+	entry.RequestId = audit.requestId
+	entry.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	entry.EntryId = entry.Timestamp + "#" + uuid.New().String()
+
+	da, err := initialize("audit")
+	var mappedItem map[string]*dynamodb.AttributeValue
+	if err == nil {
+		mappedItem, err = dynamodbattribute.MarshalMap(entry)
+	}
+	if err == nil {
+		_, err = da.DynamoCli.PutItem(&dynamodb.PutItemInput{
+			TableName:           aws.String(da.TableName),
+			Item:                mappedItem,
+			ConditionExpression: aws.String("attribute_not_exists(entry_id)"),
+		})
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, entry.SubscriptionId).Str("entity_id", entry.EntityId).Str("action", string(entry.Action)).Msg("Error recording audit entry")
+		return
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, entry.SubscriptionId).Str("entity_id", entry.EntityId).Str("action", string(entry.Action)).Str("actor", entry.Actor).Msg("Audit entry recorded")
+}
+
+func auditSubscription(ctx context.Context, action models.AuditAction, partition string, subscriptionId string, before interface{}, after interface{}) {
+	/*
+		Records a change of a subscription in the audit log.
+		Params: ctx context.Context
+				action models.AuditAction
+				partition string
+				subscriptionId string
+				before interface{}
+				after interface{}
+		Return: None
+	*/
+	recordAudit(ctx, models.AuditEntry{
+		SubscriptionId: subscriptionId,
+		Partition:      partition,
+		Entity:         models.AuditSubscription,
+		EntityId:       subscriptionId,
+		Action:         action,
+	}, before, after, partition)
+}
+
+func auditPayment(ctx context.Context, action models.AuditAction, payment models.PaymentDynamodb, before interface{}, after interface{}) {
+	/*
+		Records a change of a payment in the audit log of its subscription.
+		Params: ctx context.Context
+				action models.AuditAction
+				payment models.PaymentDynamodb
+				before interface{}
+				after interface{}
+		Return: None
+	*/
+	recordAudit(ctx, models.AuditEntry{
+		SubscriptionId: payment.SubscriptionId,
+		Entity:         models.AuditPayment,
+		EntityId:       payment.UUID,
+		Action:         action,
+	}, before, after, payment.UserName)
+}
+
+func GetSubscriptionHistory(ctx context.Context, subscriptionId string) ([]models.AuditEntry, error) {
+	/*
+		Returns the audit entries of a subscription and its payments, newest first.
+		Params: ctx context.Context
+				subscriptionId string
+		Return: []models.AuditEntry, error
+	*/
+	da, err := initialize("audit")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Msg("Getting subscription history")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:        aws.String(da.TableName),
+		KeyConditions:    keyCondition("subscription_id", subscriptionId),
+		ScanIndexForward: aws.Bool(false),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error getting subscription history")
+		return nil, err
+	}
+	entries := []models.AuditEntry{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &entries)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error getting subscription history")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Int("entry_count", len(entries)).Msg("Subscription history retrieved")
+	return entries, nil
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"subHandler/src/config"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rs/zerolog/log"
+)
+
+// BlobStore keeps the files attached to payments. Keys are slash separated
+// paths; a missing blob is reported with a "404" error.
+type BlobStore interface {
+	// Put stores a file uploaded through the API
+	Put(ctx context.Context, key string, contentType string, body []byte) error
+	// UploadURL returns a URL the client PUTs a file of the given type and size to
+	UploadURL(ctx context.Context, key string, contentType string, size int64, expiry time.Duration) (string, error)
+	// DownloadURL returns a URL the file can be fetched from under its file name
+	DownloadURL(ctx context.Context, key string, fileName string, expiry time.Duration) (string, error)
+	// Size returns the size of a stored file
+	Size(ctx context.Context, key string) (int64, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func NewBlobStore() (BlobStore, error) {
+	/*
+		Returns the blob store selected by the blob_store environment
+		variable: "s3" (the default) stores files in the attachments_bucket
+		bucket, "local" in the attachments_dir directory for development.
+		Params: None
+		Return: BlobStore, error
+	*/
+	switch os.Getenv(config.BLOB_STORE_ENV) {
+	case "local":
+		dir := os.Getenv(config.ATTACHMENTS_DIR_ENV)
+		if dir == "" {
+			dir = config.DEFAULT_ATTACHMENTS_DIR
+		}
+		return &localBlobStore{dir: dir}, nil
+	case "", "s3":
+		bucket := os.Getenv(config.ATTACHMENTS_BUCKET_ENV)
+		if bucket == "" {
+			return nil, errors.New("attachments bucket is not configured")
+		}
+		sess, err := session.NewSession(&aws.Config{
+			Region: aws.String(config.AWS_REGION),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &s3BlobStore{client: s3.New(sess), bucket: bucket}, nil
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", os.Getenv(config.BLOB_STORE_ENV))
+	}
+}
+
+type s3BlobStore struct {
+	client *s3.S3
+	bucket string
+}
+
+func (store *s3BlobStore) Put(ctx context.Context, key string, contentType string, body []byte) error {
+	log.Ctx(ctx).Info().Str("key", key).Int("size", len(body)).Msg("Storing blob in S3")
+	_, err := store.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(store.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+		Body:        bytes.NewReader(body),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error storing blob in S3")
+	}
+	return err
+}
+
+func (store *s3BlobStore) UploadURL(ctx context.Context, key string, contentType string, size int64, expiry time.Duration) (string, error) {
+	// the content type and length are signed, so the upload must match them
+	req, _ := store.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:        aws.String(store.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	})
+	url, err := req.Presign(expiry)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error presigning upload URL")
+	}
+	return url, err
+}
+
+func (store *s3BlobStore) DownloadURL(ctx context.Context, key string, fileName string, expiry time.Duration) (string, error) {
+	req, _ := store.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket:                     aws.String(store.bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": fileName})),
+	})
+	url, err := req.Presign(expiry)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error presigning download URL")
+	}
+	return url, err
+}
+
+func (store *s3BlobStore) Size(ctx context.Context, key string) (int64, error) {
+	result, err := store.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+		return 0, errors.New("404")
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error getting blob size")
+		return 0, err
+	}
+	return aws.Int64Value(result.ContentLength), nil
+}
+
+func (store *s3BlobStore) Delete(ctx context.Context, key string) error {
+	log.Ctx(ctx).Info().Str("key", key).Msg("Deleting blob from S3")
+	_, err := store.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error deleting blob from S3")
+	}
+	return err
+}
+
+// localBlobStore keeps the files in a directory. It has no upload server,
+// so its URLs are file:// URLs for development only.
+type localBlobStore struct {
+	dir string
+}
+
+func (store *localBlobStore) path(key string) string {
+	// keys never leave the store's directory
+	return filepath.Join(store.dir, filepath.FromSlash(filepath.Clean("/"+key)))
+}
+
+func (store *localBlobStore) Put(ctx context.Context, key string, contentType string, body []byte) error {
+	path := store.path(key)
+	log.Ctx(ctx).Info().Str("path", path).Int("size", len(body)).Msg("Storing blob on disk")
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		err = os.WriteFile(path, body, 0o644)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("path", path).Msg("Error storing blob on disk")
+	}
+	return err
+}
+
+func (store *localBlobStore) UploadURL(ctx context.Context, key string, contentType string, size int64, expiry time.Duration) (string, error) {
+	path := store.path(key)
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return "", err
+	}
+	return "file://" + filepath.ToSlash(path), nil
+}
+
+func (store *localBlobStore) DownloadURL(ctx context.Context, key string, fileName string, expiry time.Duration) (string, error) {
+	return "file://" + filepath.ToSlash(store.path(key)), nil
+}
+
+func (store *localBlobStore) Size(ctx context.Context, key string) (int64, error) {
+	info, err := os.Stat(store.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, errors.New("404")
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (store *localBlobStore) Delete(ctx context.Context, key string) error {
+	path := store.path(key)
+	log.Ctx(ctx).Info().Str("path", path).Msg("Deleting blob from disk")
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Ctx(ctx).Error().Err(err).Str("path", path).Msg("Error deleting blob from disk")
+		return err
+	}
+	// drop the payment's directory once its last file is gone
+	dir := filepath.Dir(path)
+	if strings.HasPrefix(dir, filepath.Clean(store.dir)+string(filepath.Separator)) {
+		os.Remove(dir)
+	}
+	return nil
+}
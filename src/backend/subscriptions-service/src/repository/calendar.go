@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func PutCalendarToken(ctx context.Context, item models.CalendarFeedToken) (models.CalendarFeedToken, error) {
+	/*
+		Stores the calendar feed token of a user, replacing (and so revoking)
+		any previous token.
+		Params: ctx context.Context
+				item models.CalendarFeedToken
+		Return: models.CalendarFeedToken, error
+	*/
+	da, err := initialize("calendar")
+	if err != nil {
+		return models.CalendarFeedToken{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Msg("Storing calendar token")
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing calendar token")
+		return models.CalendarFeedToken{}, err
+	}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		Item:      mappedItem,
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing calendar token")
+		return models.CalendarFeedToken{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Msg("Calendar token stored")
+	return item, nil
+}
+
+func GetCalendarTokenByToken(ctx context.Context, token string) (models.CalendarFeedToken, error) {
+	/*
+		Looks up a calendar feed token through the token index.
+		Params: ctx context.Context
+				token string
+		Return: models.CalendarFeedToken, error
+	*/
+	da, err := initialize("calendar")
+	if err != nil {
+		return models.CalendarFeedToken{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Msg("Getting calendar token")
+	result, err := dynamoClient.Query(&dynamodb.QueryInput{
+		TableName: aws.String(tableName),
+		IndexName: aws.String(config.CALENDAR_TOKEN_INDEX),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"token": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodb.AttributeValue{
+					{
+						S: aws.String(token),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting calendar token")
+		return models.CalendarFeedToken{}, err
+	}
+	if len(result.Items) == 0 {
+		log.Ctx(ctx).Error().Msg("Error getting calendar token. No item found.")
+		return models.CalendarFeedToken{}, errors.New("404")
+	}
+
+	item := models.CalendarFeedToken{}
+	err = dynamodbattribute.UnmarshalMap(result.Items[0], &item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting calendar token")
+		return models.CalendarFeedToken{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Msg("Calendar token retrieved")
+	return item, nil
+}
+
+func DeleteCalendarToken(ctx context.Context, partitionKey string) error {
+	/*
+		Deletes the calendar feed token of a user.
+		Params: ctx context.Context
+				partitionKey string (username)
+		Return: error
+	*/
+	da, err := initialize("calendar")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, partitionKey).Msg("Deleting calendar token")
+	_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(partitionKey),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(username)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			log.Ctx(ctx).Error().Msg("Error deleting calendar token. No item found.")
+			return errors.New("404")
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting calendar token")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, partitionKey).Msg("Calendar token deleted")
+	return nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func PutCategory(ctx context.Context, item models.Category) (models.Category, error) {
+	/*
+		Stores a custom category, or the name and color a user gave to a
+		built-in category.
+		Params: ctx context.Context
+				item models.Category
+		Return: models.Category, error
+	*/
+	da, err := initialize("categories")
+	if err != nil {
+		return models.Category{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Str("category_id", string(item.CategoryId)).Msg("Storing category")
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing category")
+		return models.Category{}, err
+	}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		Item:      mappedItem,
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing category")
+		return models.Category{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Str("category_id", string(item.CategoryId)).Msg("Category stored")
+	return item, nil
+}
+
+func GetCategory(ctx context.Context, userName string, categoryId models.SubscriptionCategory) (models.Category, error) {
+	/*
+		Gets a stored category of a user.
+		Params: ctx context.Context
+				userName string
+				categoryId models.SubscriptionCategory
+		Return: models.Category, error
+	*/
+	da, err := initialize("categories")
+	if err != nil {
+		return models.Category{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("category_id", string(categoryId)).Msg("Getting category")
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(userName),
+			},
+			"category_id": {
+				S: aws.String(string(categoryId)),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting category")
+		return models.Category{}, err
+	}
+	if len(result.Item) == 0 {
+		log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("category_id", string(categoryId)).Msg("No category found")
+		return models.Category{}, errors.New("404")
+	}
+	item := models.Category{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting category")
+		return models.Category{}, err
+	}
+	return item, nil
+}
+
+func GetCategories(ctx context.Context, userName string) ([]models.Category, error) {
+	/*
+		Gets the stored categories of a user.
+		Params: ctx context.Context
+				userName string
+		Return: []models.Category, error
+	*/
+	da, err := initialize("categories")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting categories")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:     aws.String(da.TableName),
+		KeyConditions: keyCondition("username", userName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting categories")
+		return nil, err
+	}
+	items := []models.Category{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting categories")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("category_count", len(items)).Msg("Categories retrieved")
+	return items, nil
+}
+
+func DeleteCategory(ctx context.Context, userName string, categoryId models.SubscriptionCategory) error {
+	/*
+		Deletes a stored category of a user.
+		Params: ctx context.Context
+				userName string
+				categoryId models.SubscriptionCategory
+		Return: error
+	*/
+	da, err := initialize("categories")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("category_id", string(categoryId)).Msg("Deleting category")
+	_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(userName),
+			},
+			"category_id": {
+				S: aws.String(string(categoryId)),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting category")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("category_id", string(categoryId)).Msg("Category deleted")
+	return nil
+}
@@ -1,27 +1,62 @@
 package repository
 
 import (
-	"fmt"
-	"os"
+	"context"
+	"errors"
 	"subHandler/src/config"
 	"subHandler/src/models"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/rs/zerolog/log"
 )
 
-func initialize(service string) models.DynamoAttr {
+func initialize(service string) (models.DynamoAttr, error) {
 	/*
 		Used to initialize the table attributes and sdk clients
-		Params: None
-		Return: None
+		Params: service string
+		Return: models.DynamoAttr, error
 	*/
 	awsRegion := config.AWS_REGION
 	var dynamodbTable string
-	if service == "payments" {
+	switch service {
+	case "payments":
 		dynamodbTable = config.PAYMENTS_DYNAMODB_TABLE
-	} else {
+	case "calendar":
+		dynamodbTable = config.CALENDAR_TOKENS_DYNAMODB_TABLE
+	case "receipt-tokens":
+		dynamodbTable = config.RECEIPT_TOKENS_DYNAMODB_TABLE
+	case "users":
+		dynamodbTable = config.USERS_DYNAMODB_TABLE
+	case "shares":
+		dynamodbTable = config.SHARES_DYNAMODB_TABLE
+	case "settlements":
+		dynamodbTable = config.SETTLEMENTS_DYNAMODB_TABLE
+	case "households":
+		dynamodbTable = config.HOUSEHOLDS_DYNAMODB_TABLE
+	case "household-members":
+		dynamodbTable = config.HOUSEHOLD_MEMBERS_DYNAMODB_TABLE
+	case "categories":
+		dynamodbTable = config.CATEGORIES_DYNAMODB_TABLE
+	case "attachments":
+		dynamodbTable = config.ATTACHMENTS_DYNAMODB_TABLE
+	case "audit":
+		dynamodbTable = config.AUDIT_DYNAMODB_TABLE
+	case "webhooks":
+		dynamodbTable = config.WEBHOOKS_DYNAMODB_TABLE
+	case "webhook-deliveries":
+		dynamodbTable = config.WEBHOOK_DELIVERIES_DYNAMODB_TABLE
+	case "usage":
+		dynamodbTable = config.USAGE_DYNAMODB_TABLE
+	case "payment-methods":
+		dynamodbTable = config.PAYMENT_METHODS_DYNAMODB_TABLE
+	case "payment-refunds":
+		dynamodbTable = config.PAYMENT_REFUNDS_DYNAMODB_TABLE
+	case "reconciliation-alerts":
+		dynamodbTable = config.RECONCILIATION_ALERTS_DYNAMODB_TABLE
+	default:
 		dynamodbTable = config.SUBSCRIPTIONS_DYNAMODB_TABLE
 	}
 
@@ -30,8 +65,8 @@ func initialize(service string) models.DynamoAttr {
 	})
 
 	if err != nil {
-		fmt.Println("Error creating sess", err)
-		os.Exit(0)
+		log.Error().Err(err).Str("table", dynamodbTable).Msg("Error creating AWS session")
+		return models.DynamoAttr{}, err
 	}
 
 	dynamoClient := dynamodb.New(sess)
@@ -39,5 +74,81 @@ func initialize(service string) models.DynamoAttr {
 		DynamoCli: dynamoClient,
 		AwsRegion: awsRegion,
 		TableName: dynamodbTable,
+	}, nil
+}
+
+func batchWrite(ctx context.Context, dynamoClient *dynamodb.DynamoDB, tableName string, requests []*dynamodb.WriteRequest) error {
+	/*
+		Writes the given requests to a table in chunks of DYNAMODB_BATCH_WRITE_SIZE,
+		retrying unprocessed items with an exponential backoff.
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
+				tableName string
+				requests []*dynamodb.WriteRequest
+		Return: error
+	*/
+	for start := 0; start < len(requests); start += config.DYNAMODB_BATCH_WRITE_SIZE {
+		end := start + config.DYNAMODB_BATCH_WRITE_SIZE
+		if end > len(requests) {
+			end = len(requests)
+		}
+		pending := map[string][]*dynamodb.WriteRequest{tableName: requests[start:end]}
+
+		for attempt := 0; len(pending[tableName]) > 0; attempt++ {
+			if attempt == config.DYNAMODB_BATCH_WRITE_RETRIES {
+				return errors.New("unprocessed items remaining after batch write retries")
+			}
+			if attempt > 0 {
+				time.Sleep(time.Duration(50<<attempt) * time.Millisecond)
+			}
+			res, err := dynamoClient.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return err
+			}
+			pending = res.UnprocessedItems
+			log.Ctx(ctx).Info().Int("unprocessed", len(pending[tableName])).Msg("Batch write chunk processed")
+		}
+	}
+	return nil
+}
+
+func queryItems(dynamoClient *dynamodb.DynamoDB, input *dynamodb.QueryInput) ([]map[string]*dynamodb.AttributeValue, error) {
+	/*
+		Runs a query and follows LastEvaluatedKey so that results larger than
+		1MB are not truncated.
+		Params: dynamoClient *dynamodb.DynamoDB
+				input *dynamodb.QueryInput
+		Return: []map[string]*dynamodb.AttributeValue, error
+	*/
+	items := []map[string]*dynamodb.AttributeValue{}
+	for {
+		result, err := dynamoClient.Query(input)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, result.Items...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+func keyCondition(attribute string, value string) map[string]*dynamodb.Condition {
+	/*
+		Returns the KeyConditions of a query matching a single string key.
+		Params: attribute string
+				value string
+		Return: map[string]*dynamodb.Condition
+	*/
+	return map[string]*dynamodb.Condition{
+		attribute: {
+			ComparisonOperator: aws.String("EQ"),
+			AttributeValueList: []*dynamodb.AttributeValue{
+				{
+					S: aws.String(value),
+				},
+			},
+		},
 	}
 }
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rs/zerolog/log"
+)
+
+func GetInboundEmail(ctx context.Context, messageId string) ([]byte, error) {
+	/*
+		Reads a received email stored by the SES receipt rule in the
+		receipts_bucket bucket under receipts_prefix and its message id.
+		Params: ctx context.Context
+				messageId string
+		Return: []byte, error
+	*/
+	bucket := os.Getenv(config.RECEIPTS_BUCKET_ENV)
+	if bucket == "" {
+		return nil, errors.New("receipts bucket is not configured")
+	}
+	key := os.Getenv(config.RECEIPTS_PREFIX_ENV) + messageId
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(config.AWS_REGION),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.MessageIdField, messageId).Str("key", key).Msg("Getting inbound email")
+	result, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+		log.Ctx(ctx).Error().Str("key", key).Msg("Error getting inbound email. No email found.")
+		return nil, errors.New("404")
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error getting inbound email")
+		return nil, err
+	}
+	defer result.Body.Close()
+	// one byte over the limit is enough to reject the email
+	raw, err := io.ReadAll(io.LimitReader(result.Body, config.RECEIPT_EMAIL_MAX_SIZE+1))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error reading inbound email")
+		return nil, err
+	}
+	return raw, nil
+}
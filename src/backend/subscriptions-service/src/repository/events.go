@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/rs/zerolog/log"
+)
+
+// EventPublisher delivers domain events to the services subscribing to them.
+type EventPublisher interface {
+	Publish(ctx context.Context, events []models.DomainEvent) error
+}
+
+func NewEventPublisher() (EventPublisher, error) {
+	/*
+		Returns the event publisher selected by the events_publisher
+		environment variable: "sns" (the default) publishes to the
+		events_topic_arn topic, "eventbridge" to the event_bus_name bus and
+		"local" to the events_file file, or only in memory without one.
+		Params: None
+		Return: EventPublisher, error
+	*/
+	switch os.Getenv(config.EVENTS_PUBLISHER_ENV) {
+	case "local":
+		return &LocalEventPublisher{Path: os.Getenv(config.EVENTS_FILE_ENV)}, nil
+	case "eventbridge":
+		bus := os.Getenv(config.EVENT_BUS_NAME_ENV)
+		if bus == "" {
+			return nil, errors.New("event bus is not configured")
+		}
+		sess, err := session.NewSession(&aws.Config{
+			Region: aws.String(config.AWS_REGION),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &eventBridgePublisher{client: eventbridge.New(sess), bus: bus}, nil
+	case "", "sns":
+		topicArn := os.Getenv(config.EVENTS_TOPIC_ARN_ENV)
+		if topicArn == "" {
+			return nil, errors.New("events topic is not configured")
+		}
+		sess, err := session.NewSession(&aws.Config{
+			Region: aws.String(config.AWS_REGION),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &snsEventPublisher{client: sns.New(sess), topicArn: topicArn}, nil
+	default:
+		return nil, fmt.Errorf("unknown event publisher %q", os.Getenv(config.EVENTS_PUBLISHER_ENV))
+	}
+}
+
+// EventPublishers publishes events with each of its publishers in turn,
+// stopping at the first that fails.
+type EventPublishers []EventPublisher
+
+func (publishers EventPublishers) Publish(ctx context.Context, domainEvents []models.DomainEvent) error {
+	for _, publisher := range publishers {
+		err := publisher.Publish(ctx, domainEvents)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type snsEventPublisher struct {
+	client   *sns.SNS
+	topicArn string
+}
+
+func (publisher *snsEventPublisher) Publish(ctx context.Context, domainEvents []models.DomainEvent) error {
+	for _, event := range domainEvents {
+		message, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		// subscribers filter on the event type without parsing the message
+		_, err = publisher.client.Publish(&sns.PublishInput{
+			TopicArn: aws.String(publisher.topicArn),
+			Message:  aws.String(string(message)),
+			MessageAttributes: map[string]*sns.MessageAttributeValue{
+				"event_type": {
+					DataType:    aws.String("String"),
+					StringValue: aws.String(string(event.Type)),
+				},
+				"version": {
+					DataType:    aws.String("String"),
+					StringValue: aws.String(event.Version),
+				},
+			},
+		})
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.EventIdField, event.Id).Msg("Error publishing event to SNS")
+			return err
+		}
+		log.Ctx(ctx).Info().Str(logging.EventIdField, event.Id).Str("event_type", string(event.Type)).Msg("Event published to SNS")
+	}
+	return nil
+}
+
+type eventBridgePublisher struct {
+	client *eventbridge.EventBridge
+	bus    string
+}
+
+func (publisher *eventBridgePublisher) Publish(ctx context.Context, domainEvents []models.DomainEvent) error {
+	for start := 0; start < len(domainEvents); start += config.EVENTBRIDGE_BATCH_SIZE {
+		end := start + config.EVENTBRIDGE_BATCH_SIZE
+		if end > len(domainEvents) {
+			end = len(domainEvents)
+		}
+		entries := []*eventbridge.PutEventsRequestEntry{}
+		for _, event := range domainEvents[start:end] {
+			detail, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, &eventbridge.PutEventsRequestEntry{
+				EventBusName: aws.String(publisher.bus),
+				Source:       aws.String(event.Source),
+				DetailType:   aws.String(string(event.Type)),
+				Detail:       aws.String(string(detail)),
+			})
+		}
+		result, err := publisher.client.PutEvents(&eventbridge.PutEventsInput{Entries: entries})
+		if err == nil && aws.Int64Value(result.FailedEntryCount) > 0 {
+			err = fmt.Errorf("%d events were not accepted by EventBridge", aws.Int64Value(result.FailedEntryCount))
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error publishing events to EventBridge")
+			return err
+		}
+		log.Ctx(ctx).Info().Int("event_count", len(entries)).Msg("Events published to EventBridge")
+	}
+	return nil
+}
+
+// LocalEventPublisher stands in for SNS and EventBridge in development and
+// tests. It keeps the events it publishes and appends them to a JSON lines
+// file when given a path.
+type LocalEventPublisher struct {
+	Path      string
+	mutex     sync.Mutex
+	Published []models.DomainEvent
+}
+
+func (publisher *LocalEventPublisher) Publish(ctx context.Context, domainEvents []models.DomainEvent) error {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	if publisher.Path != "" {
+		file, err := os.OpenFile(publisher.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		encoder := json.NewEncoder(file)
+		for _, event := range domainEvents {
+			err = encoder.Encode(event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	publisher.Published = append(publisher.Published, domainEvents...)
+	log.Ctx(ctx).Info().Int("event_count", len(domainEvents)).Str("path", publisher.Path).Msg("Events published locally")
+	return nil
+}
+
+func UnmarshalStreamImage(image map[string]events.DynamoDBAttributeValue, out interface{}) error {
+	/*
+		Unmarshals the image of an item in a DynamoDB Stream record. Stream
+		attribute values share the wire format of the SDK's, so they are
+		converted through JSON.
+		Params: image map[string]events.DynamoDBAttributeValue
+				out interface{}
+		Return: error
+	*/
+	encoded, err := json.Marshal(image)
+	if err != nil {
+		return err
+	}
+	item := map[string]*dynamodb.AttributeValue{}
+	err = json.Unmarshal(encoded, &item)
+	if err != nil {
+		return err
+	}
+	return dynamodbattribute.UnmarshalMap(item, out)
+}
@@ -0,0 +1,325 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func PutHousehold(ctx context.Context, item models.Household) (models.Household, error) {
+	/*
+		Stores a household.
+		Params: ctx context.Context
+				item models.Household
+		Return: models.Household, error
+	*/
+	da, err := initialize("households")
+	if err != nil {
+		return models.Household{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, item.HouseholdId).Msg("Storing household")
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing household")
+		return models.Household{}, err
+	}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		Item:      mappedItem,
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing household")
+		return models.Household{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, item.HouseholdId).Msg("Household stored")
+	return item, nil
+}
+
+func GetHousehold(ctx context.Context, householdId string) (models.Household, error) {
+	/*
+		Gets a household.
+		Params: ctx context.Context
+				householdId string
+		Return: models.Household, error
+	*/
+	da, err := initialize("households")
+	if err != nil {
+		return models.Household{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Msg("Getting household")
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"household_id": {
+				S: aws.String(householdId),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting household")
+		return models.Household{}, err
+	}
+	if len(result.Item) == 0 {
+		log.Ctx(ctx).Error().Msg("Error getting household. No item found.")
+		return models.Household{}, errors.New("404")
+	}
+	item := models.Household{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting household")
+		return models.Household{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Msg("Household retrieved")
+	return item, nil
+}
+
+func DeleteHousehold(ctx context.Context, householdId string) error {
+	/*
+		Deletes a household along with its memberships.
+		Params: ctx context.Context
+				householdId string
+		Return: error
+	*/
+	members, err := GetHouseholdMembers(ctx, householdId)
+	if err != nil {
+		return err
+	}
+
+	da, err := initialize("household-members")
+	if err != nil {
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Msg("Deleting household")
+	requests := []*dynamodb.WriteRequest{}
+	for _, member := range members {
+		requests = append(requests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{
+			Key: map[string]*dynamodb.AttributeValue{
+				"household_id": {
+					S: aws.String(member.HouseholdId),
+				},
+				"username": {
+					S: aws.String(member.UserName),
+				},
+			},
+		}})
+	}
+	err = batchWrite(ctx, da.DynamoCli, da.TableName, requests)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting household members")
+		return err
+	}
+
+	da, err = initialize("households")
+	if err != nil {
+		return err
+	}
+	_, err = da.DynamoCli.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(da.TableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"household_id": {
+				S: aws.String(householdId),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting household")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Msg("Household deleted")
+	return nil
+}
+
+func PutHouseholdMember(ctx context.Context, item models.HouseholdMembership) (models.HouseholdMembership, error) {
+	/*
+		Stores the membership of a user in a household.
+		Params: ctx context.Context
+				item models.HouseholdMembership
+		Return: models.HouseholdMembership, error
+	*/
+	da, err := initialize("household-members")
+	if err != nil {
+		return models.HouseholdMembership{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, item.HouseholdId).Str(logging.UserNameField, item.UserName).Msg("Storing household member")
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing household member")
+		return models.HouseholdMembership{}, err
+	}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		Item:      mappedItem,
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing household member")
+		return models.HouseholdMembership{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, item.HouseholdId).Str(logging.UserNameField, item.UserName).Msg("Household member stored")
+	return item, nil
+}
+
+func GetHouseholdMember(ctx context.Context, householdId string, userName string) (models.HouseholdMembership, error) {
+	/*
+		Gets the membership of a user in a household.
+		Params: ctx context.Context
+				householdId string
+				userName string
+		Return: models.HouseholdMembership, error
+	*/
+	da, err := initialize("household-members")
+	if err != nil {
+		return models.HouseholdMembership{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Getting household member")
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"household_id": {
+				S: aws.String(householdId),
+			},
+			"username": {
+				S: aws.String(userName),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting household member")
+		return models.HouseholdMembership{}, err
+	}
+	if len(result.Item) == 0 {
+		log.Ctx(ctx).Error().Msg("Error getting household member. No item found.")
+		return models.HouseholdMembership{}, errors.New("404")
+	}
+	item := models.HouseholdMembership{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting household member")
+		return models.HouseholdMembership{}, err
+	}
+	return item, nil
+}
+
+func queryHouseholdMembers(indexName string, attribute string, value string) ([]models.HouseholdMembership, error) {
+	/*
+		Gets the memberships matching a key of the table or of its index.
+		Params: indexName string (empty for the table itself)
+				attribute string
+				value string
+		Return: []models.HouseholdMembership, error
+	*/
+	da, err := initialize("household-members")
+	if err != nil {
+		return nil, err
+	}
+	input := &dynamodb.QueryInput{
+		TableName:     aws.String(da.TableName),
+		KeyConditions: keyCondition(attribute, value),
+	}
+	if indexName != "" {
+		input.IndexName = aws.String(indexName)
+	}
+	result, err := queryItems(da.DynamoCli, input)
+	if err != nil {
+		return nil, err
+	}
+	items := []models.HouseholdMembership{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func GetHouseholdMembers(ctx context.Context, householdId string) ([]models.HouseholdMembership, error) {
+	/*
+		Gets the members and pending invitations of a household.
+		Params: ctx context.Context
+				householdId string
+		Return: []models.HouseholdMembership, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Msg("Getting household members")
+	items, err := queryHouseholdMembers("", "household_id", householdId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error getting household members")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Int("member_count", len(items)).Msg("Household members retrieved")
+	return items, nil
+}
+
+func GetUserMemberships(ctx context.Context, userName string) ([]models.HouseholdMembership, error) {
+	/*
+		Gets the household memberships and invitations of a user.
+		Params: ctx context.Context
+				userName string
+		Return: []models.HouseholdMembership, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting user memberships")
+	items, err := queryHouseholdMembers(config.HOUSEHOLD_MEMBERS_USER_INDEX, "username", userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting user memberships")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("membership_count", len(items)).Msg("User memberships retrieved")
+	return items, nil
+}
+
+func DeleteHouseholdMember(ctx context.Context, householdId string, userName string) error {
+	/*
+		Removes a user, or their invitation, from a household.
+		Params: ctx context.Context
+				householdId string
+				userName string
+		Return: error
+	*/
+	da, err := initialize("household-members")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Deleting household member")
+	_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"household_id": {
+				S: aws.String(householdId),
+			},
+			"username": {
+				S: aws.String(userName),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(username)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			log.Ctx(ctx).Error().Msg("Error deleting household member. No item found.")
+			return errors.New("404")
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting household member")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Household member deleted")
+	return nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"subHandler/src/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/rs/zerolog/log"
+)
+
+func PublishEmail(ctx context.Context, email string, subject string, body string) error {
+	/*
+		Sends an email through the SNS topic the users subscribe to at sign
+		up. The target_email attribute matches the filter policy of the
+		recipient's subscription.
+		Params: ctx context.Context
+				email string
+				subject string
+				body string
+		Return: error
+	*/
+	topicArn := os.Getenv(config.SNS_TOPIC_ARN_ENV)
+	if topicArn == "" {
+		log.Ctx(ctx).Error().Msg("Error publishing email. SNS topic is not configured.")
+		return errors.New("sns topic is not configured")
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(config.AWS_REGION),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error publishing email")
+		return err
+	}
+
+	log.Ctx(ctx).Info().Str("subject", subject).Msg("Publishing email")
+	_, err = sns.New(sess).Publish(&sns.PublishInput{
+		TopicArn: aws.String(topicArn),
+		Subject:  aws.String(subject),
+		Message:  aws.String(body),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			"target_email": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(email),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error publishing email")
+		return err
+	}
+	log.Ctx(ctx).Info().Str("subject", subject).Msg("Email published")
+	return nil
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func PutPaymentMethod(ctx context.Context, item models.PaymentMethod) (models.PaymentMethod, error) {
+	/*
+		Stores a payment method of a user.
+		Params: ctx context.Context
+				item models.PaymentMethod
+		Return: models.PaymentMethod, error
+	*/
+	da, err := initialize("payment-methods")
+	if err != nil {
+		return models.PaymentMethod{}, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Str(logging.PaymentMethodIdField, item.PaymentMethodId).Msg("Storing payment method")
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing payment method")
+		return models.PaymentMethod{}, err
+	}
+	_, err = da.DynamoCli.PutItem(&dynamodb.PutItemInput{
+		Item:      mappedItem,
+		TableName: aws.String(da.TableName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing payment method")
+		return models.PaymentMethod{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Str(logging.PaymentMethodIdField, item.PaymentMethodId).Msg("Payment method stored")
+	return item, nil
+}
+
+func GetPaymentMethod(ctx context.Context, userName string, paymentMethodId string) (models.PaymentMethod, error) {
+	/*
+		Gets a payment method of a user.
+		Params: ctx context.Context
+				userName string
+				paymentMethodId string
+		Return: models.PaymentMethod, error
+	*/
+	da, err := initialize("payment-methods")
+	if err != nil {
+		return models.PaymentMethod{}, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str(logging.PaymentMethodIdField, paymentMethodId).Msg("Getting payment method")
+	result, err := da.DynamoCli.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(da.TableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(userName),
+			},
+			"payment_method_id": {
+				S: aws.String(paymentMethodId),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting payment method")
+		return models.PaymentMethod{}, err
+	}
+	if result.Item == nil {
+		log.Ctx(ctx).Error().Str(logging.PaymentMethodIdField, paymentMethodId).Msg("Error getting payment method. No item found.")
+		return models.PaymentMethod{}, errors.New("404")
+	}
+	item := models.PaymentMethod{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting payment method")
+		return models.PaymentMethod{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str(logging.PaymentMethodIdField, paymentMethodId).Msg("Payment method retrieved")
+	return item, nil
+}
+
+func GetPaymentMethods(ctx context.Context, userName string) ([]models.PaymentMethod, error) {
+	/*
+		Gets the payment methods of a user.
+		Params: ctx context.Context
+				userName string
+		Return: []models.PaymentMethod, error
+	*/
+	da, err := initialize("payment-methods")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting payment methods")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:     aws.String(da.TableName),
+		KeyConditions: keyCondition("username", userName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting payment methods")
+		return nil, err
+	}
+	items := []models.PaymentMethod{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting payment methods")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("payment_method_count", len(items)).Msg("Payment methods retrieved")
+	return items, nil
+}
+
+func DeletePaymentMethod(ctx context.Context, userName string, paymentMethodId string) error {
+	/*
+		Deletes a payment method of a user.
+		Params: ctx context.Context
+				userName string
+				paymentMethodId string
+		Return: error
+	*/
+	da, err := initialize("payment-methods")
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str(logging.PaymentMethodIdField, paymentMethodId).Msg("Deleting payment method")
+	_, err = da.DynamoCli.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(da.TableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(userName),
+			},
+			"payment_method_id": {
+				S: aws.String(paymentMethodId),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(payment_method_id)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			log.Ctx(ctx).Error().Msg("Error deleting payment method. No item found.")
+			return errors.New("404")
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting payment method")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str(logging.PaymentMethodIdField, paymentMethodId).Msg("Payment method deleted")
+	return nil
+}
+
+func UpdateSubscriptionPaymentMethod(ctx context.Context, partitionKey string, sortKey string, paymentMethodId string) error {
+	/*
+		Links a subscription to a payment method, or unlinks it with an
+		empty id.
+		Params: ctx context.Context
+				partitionKey string
+				sortKey string
+				paymentMethodId string
+		Return: error
+	*/
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, sortKey).Str(logging.PaymentMethodIdField, paymentMethodId).Msg("Updating subscription payment method")
+	result, err := da.DynamoCli.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(da.TableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(partitionKey),
+			},
+			"uuid": {
+				S: aws.String(sortKey),
+			},
+		},
+		UpdateExpression: aws.String("SET #payment_method_id = :payment_method_id"),
+		ExpressionAttributeNames: map[string]*string{
+			"#payment_method_id": aws.String("payment_method_id"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":payment_method_id": {
+				S: aws.String(paymentMethodId),
+			},
+		},
+		ReturnValues: aws.String("UPDATED_OLD"),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, sortKey).Msg("Error updating subscription payment method")
+		return err
+	}
+	before := models.SubscriptionDynamodb{}
+	dynamodbattribute.UnmarshalMap(result.Attributes, &before)
+	auditSubscription(ctx, models.AuditUpdate, partitionKey, sortKey, models.SubscriptionDynamodb{PaymentMethodId: before.PaymentMethodId}, models.SubscriptionDynamodb{PaymentMethodId: paymentMethodId})
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, sortKey).Str(logging.PaymentMethodIdField, paymentMethodId).Msg("Subscription payment method updated")
+	return nil
+}
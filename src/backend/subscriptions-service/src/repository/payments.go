@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"strconv"
+	"strings"
 	"subHandler/src/config"
+	"subHandler/src/logging"
 	"subHandler/src/models"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,16 +15,17 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func IsPaymentExists(dynamoClient *dynamodb.DynamoDB, tableName string, partitionKey string, sortKey string) bool {
+func IsPaymentExists(ctx context.Context, dynamoClient *dynamodb.DynamoDB, tableName string, partitionKey string, sortKey string) bool {
 	/*
 		Checks if a given Item exists in the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName
 				partitionKey
 				sortKey
 		Return: bool
 	*/
-	log.Info().Msg("Checking if payment exists")
+	log.Ctx(ctx).Info().Msg("Checking if payment exists")
 	res, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
 		TableName: aws.String(tableName),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -34,39 +38,43 @@ func IsPaymentExists(dynamoClient *dynamodb.DynamoDB, tableName string, partitio
 		},
 	})
 	if err != nil {
-		log.Error().Err(err).Msg("Error checking if payment exists")
+		log.Ctx(ctx).Error().Err(err).Msg("Error checking if payment exists")
 		return false
 	}
 	if len(res.Item) == 0 {
-		log.Info().Msg("Payment does not exist")
+		log.Ctx(ctx).Info().Msg("Payment does not exist")
 		return false
 	}
-	log.Info().Msg("Payment exists")
+	log.Ctx(ctx).Info().Msg("Payment exists")
 	return true
 }
 
-func AddSubscriptionPayment(item models.PaymentDynamodb) (models.PaymentDynamodb, error) {
+func AddSubscriptionPayment(ctx context.Context, item models.PaymentDynamodb) (models.PaymentDynamodb, error) {
 	/*
 		Adds a given Item to the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 			    tableName
 				item models.PaymentsDynamodb
 		Return: models.PaymentsDynamodb, error
 	*/
 
-	da := initialize("payments")
+	da, err := initialize("payments")
+	if err != nil {
+		return models.PaymentDynamodb{}, err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Msg("Adding subscription payment")
-	if !IsSubscriptionExists(dynamoClient, config.SUBSCRIPTIONS_DYNAMODB_TABLE, item.UserName, item.SubscriptionId) {
-		log.Info().Msg("Subscription does not exists")
+	log.Ctx(ctx).Info().Msg("Adding subscription payment")
+	if !IsSubscriptionExists(ctx, dynamoClient, config.SUBSCRIPTIONS_DYNAMODB_TABLE, item.UserName, item.SubscriptionId) {
+		log.Ctx(ctx).Info().Msg("Subscription does not exists")
 		return item, errors.New("subscription does not exist")
 	}
 
 	mappedItem, err := dynamodbattribute.MarshalMap(item)
 	if err != nil {
-		log.Error().Err(err).Msg("Error adding payment")
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding payment")
 		return item, err
 	}
 
@@ -77,28 +85,33 @@ func AddSubscriptionPayment(item models.PaymentDynamodb) (models.PaymentDynamodb
 
 	_, err = dynamoClient.PutItem(tableInput)
 	if err != nil {
-		log.Error().Err(err).Msg("Error adding payment")
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding payment")
 		return item, err
 	}
+	auditPayment(ctx, models.AuditCreate, item, nil, item)
 
-	log.Info().Msg("Payment added successfully")
+	log.Ctx(ctx).Info().Msg("Payment added successfully")
 	return item, nil
 }
 
-func GetSubscriptionPayments(partitionKey string) ([]models.PaymentDynamodb, error) {
+func GetSubscriptionPayments(ctx context.Context, partitionKey string) ([]models.PaymentDynamodb, error) {
 	/*
 		Returns all the payments for a given subscription.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName
 				partitionKey
 		Return: []models.PaymentDynamodb, error
 	*/
 
-	da := initialize("payments")
+	da, err := initialize("payments")
+	if err != nil {
+		return nil, err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Str("SubscriptionId", partitionKey).Msg("Getting subscription payments")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Msg("Getting subscription payments")
 
 	// query the dynamodb table using the partition key
 	input := &dynamodb.QueryInput{
@@ -114,42 +127,54 @@ func GetSubscriptionPayments(partitionKey string) ([]models.PaymentDynamodb, err
 			},
 		},
 	}
-	result, err := dynamoClient.Query(input)
-	if err != nil {
-		log.Error().Err(err).Msg("Error getting subscription payments")
-		return nil, err
-	}
-
 	items := []models.PaymentDynamodb{}
-	for _, i := range result.Items {
-		item := models.PaymentDynamodb{}
-		err = dynamodbattribute.UnmarshalMap(i, &item)
+	// follow LastEvaluatedKey so that results larger than 1MB are not truncated
+	for {
+		result, err := dynamoClient.Query(input)
 		if err != nil {
-			log.Error().Err(err).Msg("Error getting subscription payments")
+			log.Ctx(ctx).Error().Err(err).Msg("Error getting subscription payments")
 			return nil, err
 		}
-		items = append(items, item)
+
+		for _, i := range result.Items {
+			item := models.PaymentDynamodb{}
+			err = dynamodbattribute.UnmarshalMap(i, &item)
+			if err != nil {
+				log.Ctx(ctx).Error().Err(err).Msg("Error getting subscription payments")
+				return nil, err
+			}
+			items = append(items, item)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
 	}
 
-	log.Info().Str("SubscriptionId", partitionKey).Int("PaymentCount", len(items)).Msg("Subscription payments retrieved successfully")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Int("payment_count", len(items)).Msg("Subscription payments retrieved successfully")
 	return items, nil
 }
 
-func GetSubscriptionPayment(partitionKey string, sortKey string) (models.PaymentDynamodb, error) {
+func GetSubscriptionPayment(ctx context.Context, partitionKey string, sortKey string) (models.PaymentDynamodb, error) {
 	/*
 		Returns a payment for a given subscription.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName
 				partitionKey
 				sortKey
 		Return: models.PaymentDynamodb, error
 	*/
 
-	da := initialize("payments")
+	da, err := initialize("payments")
+	if err != nil {
+		return models.PaymentDynamodb{}, err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Str("SubscriptionId", partitionKey).Str("PaymentId", sortKey).Msg("Getting payment")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Str(logging.PaymentIdField, sortKey).Msg("Getting payment")
 
 	input := &dynamodb.GetItemInput{
 		TableName: aws.String(tableName),
@@ -165,53 +190,55 @@ func GetSubscriptionPayment(partitionKey string, sortKey string) (models.Payment
 
 	result, err := dynamoClient.GetItem(input)
 	if err != nil {
-		log.Error().Err(err).Msg("Error getting payment")
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting payment")
 		return models.PaymentDynamodb{}, err
 	}
 
 	item := models.PaymentDynamodb{}
 	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
 	if err != nil {
-		log.Error().Err(err).Msg("Error getting payment")
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting payment")
 		return models.PaymentDynamodb{}, err
 	}
 
-	log.Info().Str("SubscriptionId", partitionKey).Str("PaymentId", sortKey).Msg("Payment retrieved successfully")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Str(logging.PaymentIdField, sortKey).Msg("Payment retrieved successfully")
 	return item, nil
 }
 
-func UpdateSubscriptionPayment(partitionKey string, sortKey string, updateItem models.PaymentUpdate) (models.PaymentDynamodb, error) {
+func UpdateSubscriptionPayment(ctx context.Context, partitionKey string, sortKey string, updateItem models.PaymentUpdate) (models.PaymentDynamodb, error) {
 	/*
 		Updates a given Item in the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName
 				partitionKey
 				sortKey
 				updateItem
 		Return: models.PaymentDynamodb, error
 	*/
-	da := initialize("payments")
+	da, err := initialize("payments")
+	if err != nil {
+		return models.PaymentDynamodb{}, err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Str("SubscriptionId", partitionKey).Str("PaymentId", sortKey).Msg("Updating payment")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Str(logging.PaymentIdField, sortKey).Msg("Updating payment")
 
 	// subscriptionExists := IsSubscriptionExists(dynamoClient, config.SUBSCRIPTIONS_DYNAMODB_TABLE, updateItem.UserName, partitionKey)
-	paymentExists := IsPaymentExists(dynamoClient, tableName, partitionKey, sortKey)
+	paymentExists := IsPaymentExists(ctx, dynamoClient, tableName, partitionKey, sortKey)
 
 	if !paymentExists {
-		log.Info().Str("SubscriptionId", partitionKey).Str("PaymentId", sortKey).Msg("Payment does not exist")
+		log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Str(logging.PaymentIdField, sortKey).Msg("Payment does not exist")
 		return models.PaymentDynamodb{}, errors.New("payment does not exist")
 	}
 
-	payment, _ := GetSubscriptionPayment(partitionKey, sortKey)
-	newPayment := models.PaymentDynamodb{
-		SubscriptionId: partitionKey,
-		UUID:           sortKey,
-		UserName:       payment.UserName,
-		Amount:         updateItem.Amount,
-		PaymentDate:    updateItem.PaymentDate,
-	}
+	payment, _ := GetSubscriptionPayment(ctx, partitionKey, sortKey)
+	newPayment := payment
+	newPayment.SubscriptionId = partitionKey
+	newPayment.UUID = sortKey
+	newPayment.Amount = updateItem.Amount
+	newPayment.PaymentDate = updateItem.PaymentDate
 	tableInput := &dynamodb.UpdateItemInput{
 		TableName: aws.String(tableName),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -230,37 +257,81 @@ func UpdateSubscriptionPayment(partitionKey string, sortKey string, updateItem m
 				S: aws.String(updateItem.PaymentDate),
 			},
 		},
-		ReturnValues:     aws.String("ALL_NEW"),
-		UpdateExpression: aws.String("SET amount = :a, payment_date = :d"),
+		ReturnValues: aws.String("ALL_NEW"),
+	}
+	sets := []string{"amount = :a", "payment_date = :d"}
+	removes := []string{}
+	if updateItem.Status != "" {
+		newPayment.Status = updateItem.Status
+		newPayment.FailureReason = updateItem.FailureReason
+		tableInput.ExpressionAttributeNames = map[string]*string{"#status": aws.String("status")}
+		tableInput.ExpressionAttributeValues[":s"] = &dynamodb.AttributeValue{S: aws.String(string(updateItem.Status))}
+		sets = append(sets, "#status = :s")
+		if updateItem.FailureReason != "" {
+			tableInput.ExpressionAttributeValues[":r"] = &dynamodb.AttributeValue{S: aws.String(updateItem.FailureReason)}
+			sets = append(sets, "failure_reason = :r")
+		} else {
+			removes = append(removes, "failure_reason")
+		}
 	}
-	_, err := dynamoClient.UpdateItem(tableInput)
+	if updateItem.Tax != nil {
+		newPayment.PaymentTax = *updateItem.Tax
+		taxAttributes, err := dynamodbattribute.MarshalMap(updateItem.Tax)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error updating payment")
+			return models.PaymentDynamodb{}, err
+		}
+		// unset attributes are omitted from the map and removed from the item
+		for _, name := range []string{"amount_before_tax", "tax_amount", "tax_rate", "invoice_number", "seller_tax_id"} {
+			value, ok := taxAttributes[name]
+			if !ok {
+				removes = append(removes, name)
+				continue
+			}
+			tableInput.ExpressionAttributeValues[":"+name] = value
+			sets = append(sets, name+" = :"+name)
+		}
+	}
+	expression := "SET " + strings.Join(sets, ", ")
+	if len(removes) > 0 {
+		expression += " REMOVE " + strings.Join(removes, ", ")
+	}
+	tableInput.UpdateExpression = aws.String(expression)
+	result, err := dynamoClient.UpdateItem(tableInput)
 	if err != nil {
-		log.Error().Err(err).Msg("Error updating payment")
+		log.Ctx(ctx).Error().Err(err).Msg("Error updating payment")
 		return models.PaymentDynamodb{}, err
 	}
+	after := models.PaymentDynamodb{}
+	dynamodbattribute.UnmarshalMap(result.Attributes, &after)
+	auditPayment(ctx, models.AuditUpdate, newPayment, payment, after)
 
-	log.Info().Str("SubscriptionId", partitionKey).Str("PaymentId", sortKey).Msg("Payment updated successfully")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Str(logging.PaymentIdField, sortKey).Msg("Payment updated successfully")
 	return newPayment, nil
 }
 
-func DeleteSubscriptionPayment(partitionKey string, sortKey string) error {
+func DeleteSubscriptionPayment(ctx context.Context, partitionKey string, sortKey string) error {
 	/*
 		Deletes a given Item from the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName
 				partitionKey
 				sortKey
 		Return: error
 	*/
-	da := initialize("payments")
+	da, err := initialize("payments")
+	if err != nil {
+		return err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Str("SubscriptionId", partitionKey).Str("PaymentId", sortKey).Msg("Deleting payment")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Str(logging.PaymentIdField, sortKey).Msg("Deleting payment")
 
-	paymentExists := IsPaymentExists(dynamoClient, tableName, partitionKey, sortKey)
+	paymentExists := IsPaymentExists(ctx, dynamoClient, tableName, partitionKey, sortKey)
 	if !paymentExists {
-		log.Info().Str("SubscriptionId", partitionKey).Str("PaymentId", sortKey).Msg("Payment does not exist")
+		log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Str(logging.PaymentIdField, sortKey).Msg("Payment does not exist")
 		return errors.New("payment does not exist")
 	}
 
@@ -274,14 +345,55 @@ func DeleteSubscriptionPayment(partitionKey string, sortKey string) error {
 				S: aws.String(sortKey),
 			},
 		},
+		ReturnValues: aws.String("ALL_OLD"),
 	}
 
-	_, err := dynamoClient.DeleteItem(input)
+	result, err := dynamoClient.DeleteItem(input)
 	if err != nil {
-		log.Error().Err(err).Msg("Error deleting payment")
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting payment")
 		return err
 	}
+	before := models.PaymentDynamodb{}
+	dynamodbattribute.UnmarshalMap(result.Attributes, &before)
+	auditPayment(ctx, models.AuditDelete, models.PaymentDynamodb{SubscriptionId: partitionKey, UUID: sortKey, UserName: before.UserName}, before, nil)
 
-	log.Info().Str("SubscriptionId", partitionKey).Str("PaymentId", sortKey).Msg("Payment deleted successfully")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, partitionKey).Str(logging.PaymentIdField, sortKey).Msg("Payment deleted successfully")
+	return nil
+}
+
+func BatchAddSubscriptionPayments(ctx context.Context, items []models.PaymentDynamodb) error {
+	/*
+		Adds the given Items to the DynamoDB table using BatchWriteItem.
+		Params: ctx context.Context
+				items []models.PaymentDynamodb
+		Return: error
+	*/
+	da, err := initialize("payments")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Int("payment_count", len(items)).Msg("Batch adding payments")
+	requests := []*dynamodb.WriteRequest{}
+	for _, item := range items {
+		mappedItem, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error batch adding payments")
+			return err
+		}
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: mappedItem}})
+	}
+
+	err = batchWrite(ctx, dynamoClient, tableName, requests)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error batch adding payments")
+		return err
+	}
+	for _, item := range items {
+		auditPayment(ctx, models.AuditCreate, item, nil, item)
+	}
+	log.Ctx(ctx).Info().Int("payment_count", len(items)).Msg("Payments batch added")
 	return nil
 }
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func PutReceiptToken(ctx context.Context, item models.ReceiptIngestToken) (models.ReceiptIngestToken, error) {
+	/*
+		Stores the receipt ingest token of a user, replacing (and so revoking)
+		any previous token.
+		Params: ctx context.Context
+				item models.ReceiptIngestToken
+		Return: models.ReceiptIngestToken, error
+	*/
+	da, err := initialize("receipt-tokens")
+	if err != nil {
+		return models.ReceiptIngestToken{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Msg("Storing receipt token")
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing receipt token")
+		return models.ReceiptIngestToken{}, err
+	}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		Item:      mappedItem,
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing receipt token")
+		return models.ReceiptIngestToken{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Msg("Receipt token stored")
+	return item, nil
+}
+
+func GetReceiptTokenByToken(ctx context.Context, token string) (models.ReceiptIngestToken, error) {
+	/*
+		Looks up a receipt ingest token through the token index.
+		Params: ctx context.Context
+				token string
+		Return: models.ReceiptIngestToken, error
+	*/
+	da, err := initialize("receipt-tokens")
+	if err != nil {
+		return models.ReceiptIngestToken{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Msg("Getting receipt token")
+	result, err := dynamoClient.Query(&dynamodb.QueryInput{
+		TableName: aws.String(tableName),
+		IndexName: aws.String(config.RECEIPT_TOKEN_INDEX),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"token": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodb.AttributeValue{
+					{
+						S: aws.String(token),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting receipt token")
+		return models.ReceiptIngestToken{}, err
+	}
+	if len(result.Items) == 0 {
+		log.Ctx(ctx).Error().Msg("Error getting receipt token. No item found.")
+		return models.ReceiptIngestToken{}, errors.New("404")
+	}
+
+	item := models.ReceiptIngestToken{}
+	err = dynamodbattribute.UnmarshalMap(result.Items[0], &item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting receipt token")
+		return models.ReceiptIngestToken{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Msg("Receipt token retrieved")
+	return item, nil
+}
+
+func DeleteReceiptToken(ctx context.Context, partitionKey string) error {
+	/*
+		Deletes the receipt ingest token of a user.
+		Params: ctx context.Context
+				partitionKey string (username)
+		Return: error
+	*/
+	da, err := initialize("receipt-tokens")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, partitionKey).Msg("Deleting receipt token")
+	_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(partitionKey),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(username)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			log.Ctx(ctx).Error().Msg("Error deleting receipt token. No item found.")
+			return errors.New("404")
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting receipt token")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, partitionKey).Msg("Receipt token deleted")
+	return nil
+}
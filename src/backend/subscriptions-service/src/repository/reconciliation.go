@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func GetReconciliationAlerts(ctx context.Context, userName string) ([]models.ReconciliationAlert, error) {
+	/*
+		Returns the discrepancies already emailed to a user.
+		Params: ctx context.Context
+				userName string
+		Return: []models.ReconciliationAlert, error
+	*/
+	da, err := initialize("reconciliation-alerts")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting reconciliation alerts")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:     aws.String(da.TableName),
+		KeyConditions: keyCondition("username", userName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting reconciliation alerts")
+		return nil, err
+	}
+	items := []models.ReconciliationAlert{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting reconciliation alerts")
+		return nil, err
+	}
+	return items, nil
+}
+
+func AddReconciliationAlerts(ctx context.Context, items []models.ReconciliationAlert) error {
+	/*
+		Records the discrepancies emailed to a user.
+		Params: ctx context.Context
+				items []models.ReconciliationAlert
+		Return: error
+	*/
+	da, err := initialize("reconciliation-alerts")
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Info().Int("alert_count", len(items)).Msg("Adding reconciliation alerts")
+	requests := []*dynamodb.WriteRequest{}
+	for _, item := range items {
+		mappedItem, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error adding reconciliation alerts")
+			return err
+		}
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: mappedItem}})
+	}
+	err = batchWrite(ctx, da.DynamoCli, da.TableName, requests)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding reconciliation alerts")
+		return err
+	}
+	return nil
+}
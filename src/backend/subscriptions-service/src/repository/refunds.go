@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func AddPaymentRefund(ctx context.Context, refund models.PaymentRefund, before models.PaymentDynamodb, after models.PaymentDynamodb) ([]string, error) {
+	/*
+		Stores a refund and the refunded total and status of its payment in
+		one transaction. The payment is only written when its amount,
+		refunded total and status are still those it was read with.
+		Params: ctx context.Context
+				refund models.PaymentRefund
+				before models.PaymentDynamodb (as read)
+				after models.PaymentDynamodb (with the refund)
+		Return: []string (cancellation reasons of the refund and the payment when the transaction is cancelled), error
+	*/
+	refunds, err := initialize("payment-refunds")
+	if err != nil {
+		return nil, err
+	}
+	payments, err := initialize("payments")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, refund.PaymentId).Str("refund_id", refund.UUID).Msg("Adding payment refund")
+	mappedRefund, err := dynamodbattribute.MarshalMap(refund)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding payment refund")
+		return nil, err
+	}
+	mappedPayment, err := dynamodbattribute.MarshalMap(after)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding payment refund")
+		return nil, err
+	}
+	statusCondition := "attribute_not_exists(#status)"
+	values := map[string]*dynamodb.AttributeValue{
+		":amount":   {N: aws.String(strconv.FormatFloat(float64(before.Amount), 'f', -1, 32))},
+		":refunded": {N: aws.String(strconv.FormatFloat(float64(before.RefundedAmount), 'f', -1, 32))},
+	}
+	if before.Status != "" {
+		statusCondition = "#status = :status"
+		values[":status"] = &dynamodb.AttributeValue{S: aws.String(string(before.Status))}
+	}
+
+	_, err = payments.DynamoCli.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(refunds.TableName),
+					Item:                mappedRefund,
+					ConditionExpression: aws.String("attribute_not_exists(#uuid)"),
+					ExpressionAttributeNames: map[string]*string{
+						"#uuid": aws.String("uuid"),
+					},
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(payments.TableName),
+					Item:                mappedPayment,
+					ConditionExpression: aws.String("attribute_exists(#uuid) AND amount = :amount AND (attribute_not_exists(refunded_amount) OR refunded_amount = :refunded) AND " + statusCondition),
+					ExpressionAttributeNames: map[string]*string{
+						"#uuid":   aws.String("uuid"),
+						"#status": aws.String("status"),
+					},
+					ExpressionAttributeValues: values,
+				},
+			},
+		},
+	})
+	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			reasons := []string{}
+			for _, reason := range canceled.CancellationReasons {
+				reasons = append(reasons, aws.StringValue(reason.Code))
+			}
+			log.Ctx(ctx).Error().Err(err).Strs("reasons", reasons).Msg("Payment refund transaction cancelled")
+			return reasons, err
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding payment refund")
+		return nil, err
+	}
+	auditPayment(ctx, models.AuditUpdate, after, before, after)
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, refund.PaymentId).Str("refund_id", refund.UUID).Msg("Payment refund added")
+	return nil, nil
+}
+
+func GetPaymentRefunds(ctx context.Context, paymentId string) ([]models.PaymentRefund, error) {
+	/*
+		Returns the refunds of a payment.
+		Params: ctx context.Context
+				paymentId string
+		Return: []models.PaymentRefund, error
+	*/
+	da, err := initialize("payment-refunds")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Msg("Getting payment refunds")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:     aws.String(da.TableName),
+		KeyConditions: keyCondition("payment_id", paymentId),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Msg("Error getting payment refunds")
+		return nil, err
+	}
+	items := []models.PaymentRefund{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Msg("Error getting payment refunds")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Int("refund_count", len(items)).Msg("Payment refunds retrieved")
+	return items, nil
+}
+
+func DeletePaymentRefunds(ctx context.Context, paymentId string) error {
+	/*
+		Deletes the refunds of a payment.
+		Params: ctx context.Context
+				paymentId string
+		Return: error
+	*/
+	da, err := initialize("payment-refunds")
+	if err != nil {
+		return err
+	}
+
+	refunds, err := GetPaymentRefunds(ctx, paymentId)
+	if err != nil || len(refunds) == 0 {
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Int("refund_count", len(refunds)).Msg("Deleting payment refunds")
+	requests := []*dynamodb.WriteRequest{}
+	for _, refund := range refunds {
+		requests = append(requests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{
+			Key: map[string]*dynamodb.AttributeValue{
+				"payment_id": {S: aws.String(refund.PaymentId)},
+				"uuid":       {S: aws.String(refund.UUID)},
+			},
+		}})
+	}
+	err = batchWrite(ctx, da.DynamoCli, da.TableName, requests)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Msg("Error deleting payment refunds")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Msg("Payment refunds deleted")
+	return nil
+}
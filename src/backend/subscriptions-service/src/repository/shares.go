@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func queryShares(indexName string, attribute string, value string) ([]models.SubscriptionShare, error) {
+	/*
+		Gets the shares matching a key of the table or of one of its indexes.
+		Params: indexName string (empty for the table itself)
+				attribute string
+				value string
+		Return: []models.SubscriptionShare, error
+	*/
+	da, err := initialize("shares")
+	if err != nil {
+		return nil, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	input := &dynamodb.QueryInput{
+		TableName:     aws.String(tableName),
+		KeyConditions: keyCondition(attribute, value),
+	}
+	if indexName != "" {
+		input.IndexName = aws.String(indexName)
+	}
+	result, err := queryItems(dynamoClient, input)
+	if err != nil {
+		return nil, err
+	}
+	items := []models.SubscriptionShare{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func GetSubscriptionShares(ctx context.Context, subscriptionId string) ([]models.SubscriptionShare, error) {
+	/*
+		Gets the participants a subscription is shared with.
+		Params: ctx context.Context
+				subscriptionId string
+		Return: []models.SubscriptionShare, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Msg("Getting subscription shares")
+	items, err := queryShares("", "subscription_id", subscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error getting subscription shares")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Int("share_count", len(items)).Msg("Subscription shares retrieved")
+	return items, nil
+}
+
+func GetSharesByParticipant(ctx context.Context, userName string) ([]models.SubscriptionShare, error) {
+	/*
+		Gets the shares of the subscriptions shared with a user.
+		Params: ctx context.Context
+				userName string
+		Return: []models.SubscriptionShare, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting shares by participant")
+	items, err := queryShares(config.SHARES_PARTICIPANT_INDEX, "participant", userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting shares by participant")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("share_count", len(items)).Msg("Shares by participant retrieved")
+	return items, nil
+}
+
+func GetSharesByOwner(ctx context.Context, userName string) ([]models.SubscriptionShare, error) {
+	/*
+		Gets the shares of the subscriptions a user shares with others.
+		Params: ctx context.Context
+				userName string
+		Return: []models.SubscriptionShare, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting shares by owner")
+	items, err := queryShares(config.SHARES_OWNER_INDEX, "owner", userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting shares by owner")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("share_count", len(items)).Msg("Shares by owner retrieved")
+	return items, nil
+}
+
+func PutSubscriptionShares(ctx context.Context, subscriptionId string, items []models.SubscriptionShare) error {
+	/*
+		Replaces the shares of a subscription with the given ones.
+		Params: ctx context.Context
+				subscriptionId string
+				items []models.SubscriptionShare
+		Return: error
+	*/
+	da, err := initialize("shares")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Int("share_count", len(items)).Msg("Storing subscription shares")
+	existing, err := GetSubscriptionShares(ctx, subscriptionId)
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{}
+	requests := []*dynamodb.WriteRequest{}
+	for _, item := range items {
+		kept[item.Participant] = true
+		mappedItem, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error storing subscription shares")
+			return err
+		}
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: mappedItem}})
+	}
+	// a batch cannot both put and delete the same key, so only the removed
+	// participants are deleted
+	for _, share := range existing {
+		if kept[share.Participant] {
+			continue
+		}
+		requests = append(requests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{
+			Key: map[string]*dynamodb.AttributeValue{
+				"subscription_id": {
+					S: aws.String(share.SubscriptionId),
+				},
+				"participant": {
+					S: aws.String(share.Participant),
+				},
+			},
+		}})
+	}
+
+	err = batchWrite(ctx, dynamoClient, tableName, requests)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing subscription shares")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Msg("Subscription shares stored")
+	return nil
+}
+
+func DeleteSubscriptionShare(ctx context.Context, subscriptionId string, participant string) error {
+	/*
+		Removes a participant from a shared subscription.
+		Params: ctx context.Context
+				subscriptionId string
+				participant string
+		Return: error
+	*/
+	da, err := initialize("shares")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str("participant", participant).Msg("Deleting subscription share")
+	_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"subscription_id": {
+				S: aws.String(subscriptionId),
+			},
+			"participant": {
+				S: aws.String(participant),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(participant)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			log.Ctx(ctx).Error().Msg("Error deleting subscription share. No item found.")
+			return errors.New("404")
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting subscription share")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str("participant", participant).Msg("Subscription share deleted")
+	return nil
+}
+
+func AddSettlement(ctx context.Context, item models.Settlement) error {
+	/*
+		Records a settlement between two users. The settlement is stored once
+		under each of them so that both can query their balances.
+		Params: ctx context.Context
+				item models.Settlement
+		Return: error
+	*/
+	da, err := initialize("settlements")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str("from", item.From).Str("to", item.To).Msg("Adding settlement")
+	requests := []*dynamodb.WriteRequest{}
+	for _, userName := range []string{item.From, item.To} {
+		item.UserName = userName
+		mappedItem, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error adding settlement")
+			return err
+		}
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: mappedItem}})
+	}
+	err = batchWrite(ctx, dynamoClient, tableName, requests)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding settlement")
+		return err
+	}
+	log.Ctx(ctx).Info().Str("settlement_id", item.SettlementId).Msg("Settlement added")
+	return nil
+}
+
+func GetUserSettlements(ctx context.Context, userName string) ([]models.Settlement, error) {
+	/*
+		Gets the settlements a user paid or received.
+		Params: ctx context.Context
+				userName string
+		Return: []models.Settlement, error
+	*/
+	da, err := initialize("settlements")
+	if err != nil {
+		return nil, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting user settlements")
+	result, err := queryItems(dynamoClient, &dynamodb.QueryInput{
+		TableName:     aws.String(tableName),
+		KeyConditions: keyCondition("username", userName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting user settlements")
+		return nil, err
+	}
+	items := []models.Settlement{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting user settlements")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("settlement_count", len(items)).Msg("User settlements retrieved")
+	return items, nil
+}
@@ -1,26 +1,34 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"strconv"
+	"subHandler/src/logging"
 	"subHandler/src/models"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/rs/zerolog/log"
 )
 
-func IsSubscriptionExists(dynamoClient *dynamodb.DynamoDB, tableName string, partitionKey string, sortKey string) bool {
+// ErrSubscriptionGone is the error of a write whose subscription was
+// deleted after it was read
+var ErrSubscriptionGone = errors.New("the subscription no longer exists")
+
+func IsSubscriptionExists(ctx context.Context, dynamoClient *dynamodb.DynamoDB, tableName string, partitionKey string, sortKey string) bool {
 	/*
 		Checks if a given Item exists in the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName
 				partitionKey
 				sortKey
 		Return: bool
 	*/
-	log.Info().Msg("Checking if subscription exists")
+	log.Ctx(ctx).Info().Msg("Checking if subscription exists")
 	res, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
 		TableName: aws.String(tableName),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -33,59 +41,68 @@ func IsSubscriptionExists(dynamoClient *dynamodb.DynamoDB, tableName string, par
 		},
 	})
 	if err != nil {
-		log.Error().Err(err).Msg("Error checking if subscription exists")
+		log.Ctx(ctx).Error().Err(err).Msg("Error checking if subscription exists")
 		return false
 	}
 	if len(res.Item) == 0 {
-		log.Info().Msg("Subscription does not exist")
+		log.Ctx(ctx).Info().Msg("Subscription does not exist")
 		return false
 	}
-	log.Info().Msg("Subscription exists")
+	log.Ctx(ctx).Info().Msg("Subscription exists")
 	return true
 }
 
-func AddSubscription(item models.SubscriptionDynamodb) (models.SubscriptionDynamodb, error) {
+func AddSubscription(ctx context.Context, item models.SubscriptionDynamodb) (models.SubscriptionDynamodb, error) {
 	/*
 		Adds a given Item to the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 			    tableName
 				item models.SubscriptionDynamodb
 		Return: models.SubscriptionDynamodb, error
 	*/
 
-	da := initialize("subscriptions")
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return models.SubscriptionDynamodb{}, err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Msg("Adding subscription")
+	log.Ctx(ctx).Info().Msg("Adding subscription")
 	mappedItem, _ := dynamodbattribute.MarshalMap(item)
 	tableInput := &dynamodb.PutItemInput{
 		Item:      mappedItem,
 		TableName: aws.String(tableName),
 	}
-	_, err := dynamoClient.PutItem(tableInput)
+	_, err = dynamoClient.PutItem(tableInput)
 	if err != nil {
-		log.Error().Err(err).Msg("Error adding subscription")
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding subscription")
 		return models.SubscriptionDynamodb{}, err
 	}
-	log.Info().Msg("Subscription added")
+	auditSubscription(ctx, models.AuditCreate, item.UserName, item.UUID, nil, item)
+	log.Ctx(ctx).Info().Msg("Subscription added")
 	return item, nil
 }
 
-func GetSubscription(partitionKey string, sortKey string) (models.SubscriptionDynamodb, error) {
+func GetSubscription(ctx context.Context, partitionKey string, sortKey string) (models.SubscriptionDynamodb, error) {
 	/*
 		Gets a given Item from the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 			    tableName
 				partitionKey
 				sortKey
 		Return: models.SubscriptionDynamodb, error
 	*/
-	da := initialize("subscriptions")
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return models.SubscriptionDynamodb{}, err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Msg("Getting subscription")
+	log.Ctx(ctx).Info().Msg("Getting subscription")
 	input := &dynamodb.GetItemInput{
 		TableName: aws.String(tableName),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -100,43 +117,48 @@ func GetSubscription(partitionKey string, sortKey string) (models.SubscriptionDy
 
 	result, err := dynamoClient.GetItem(input)
 	if err != nil {
-		log.Error().Err(err).Msg("Error getting subscription")
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting subscription")
 		return models.SubscriptionDynamodb{}, err
 	}
 
 	if len(result.Item) == 0 {
-		log.Error().Msg("Error getting subscription. No item found.")
+		log.Ctx(ctx).Error().Msg("Error getting subscription. No item found.")
 		return models.SubscriptionDynamodb{}, errors.New("404")
 	}
 
 	item := models.SubscriptionDynamodb{}
 	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
 	if err != nil {
-		log.Error().Err(err).Msg("Error getting subscription")
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting subscription")
 		return models.SubscriptionDynamodb{}, err
 	}
+	migrateLegacyCategory(ctx, &item)
 
-	log.Info().Msg("Subscription retrieved")
+	log.Ctx(ctx).Info().Msg("Subscription retrieved")
 	return item, nil
 }
 
-func DeleteSubscription(partitionKey string, sortKey string) error {
+func DeleteSubscription(ctx context.Context, partitionKey string, sortKey string) error {
 	/*
 		Deletes a given Item from the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 			    tableName
 				partitionKey
 				sortKey
 		Return: error
 	*/
 
-	da := initialize("subscriptions")
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Msg("Deleting subscription")
-	if !IsSubscriptionExists(dynamoClient, tableName, partitionKey, sortKey) {
-		log.Error().Msg("Error deleting subscription. Subscription does not exist.")
+	log.Ctx(ctx).Info().Msg("Deleting subscription")
+	if !IsSubscriptionExists(ctx, dynamoClient, tableName, partitionKey, sortKey) {
+		log.Ctx(ctx).Error().Msg("Error deleting subscription. Subscription does not exist.")
 		return errors.New("404")
 	}
 
@@ -150,40 +172,48 @@ func DeleteSubscription(partitionKey string, sortKey string) error {
 				S: aws.String(sortKey),
 			},
 		},
+		ReturnValues: aws.String("ALL_OLD"),
 	}
 
-	_, err := dynamoClient.DeleteItem(input)
+	result, err := dynamoClient.DeleteItem(input)
 	if err != nil {
-		log.Error().Err(err).Msg("Error deleting subscription")
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting subscription")
 		return err
 	}
+	before := models.SubscriptionDynamodb{}
+	dynamodbattribute.UnmarshalMap(result.Attributes, &before)
+	auditSubscription(ctx, models.AuditDelete, partitionKey, sortKey, before, nil)
 
-	log.Info().Msg("Subscription deleted")
+	log.Ctx(ctx).Info().Msg("Subscription deleted")
 	return nil
 }
 
-func UpdateSubscription(partitionKey string, sortKey string, updateItem models.SubscriptionUpdate) (models.SubscriptionDynamodb, error) {
+func UpdateSubscription(ctx context.Context, partitionKey string, sortKey string, updateItem models.SubscriptionUpdate) (models.SubscriptionDynamodb, error) {
 	/*
 		Updates a given Item in the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 			    tableName
 				partitionKey
 				sortKey
 				updateItem models.SubscriptionUpdate
 		Return: models.SubscriptionDynamodb, error
 	*/
-	da := initialize("subscriptions")
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return models.SubscriptionDynamodb{}, err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Msg("Updating subscription")
+	log.Ctx(ctx).Info().Msg("Updating subscription")
 
-	if !IsSubscriptionExists(dynamoClient, tableName, partitionKey, sortKey) {
-		log.Error().Msg("Error updating subscription. Subscription does not exist.")
+	if !IsSubscriptionExists(ctx, dynamoClient, tableName, partitionKey, sortKey) {
+		log.Ctx(ctx).Error().Msg("Error updating subscription. Subscription does not exist.")
 		return models.SubscriptionDynamodb{}, errors.New("404")
 	}
 
-	subscription, _ := GetSubscription(partitionKey, sortKey)
+	subscription, _ := GetSubscription(ctx, partitionKey, sortKey)
 	newSubscription := models.SubscriptionDynamodb{
 		UserName:        partitionKey,
 		UUID:            sortKey,
@@ -191,11 +221,24 @@ func UpdateSubscription(partitionKey string, sortKey string, updateItem models.S
 		Url:             subscription.Url,
 		SettingsUrl:     subscription.SettingsUrl,
 		Plan:            updateItem.Plan,
+		VendorId:        subscription.VendorId,
+		PlanId:          updateItem.PlanId,
 		StartDate:       updateItem.StartDate,
 		Cost:            updateItem.Cost,
 		LastPaymentDate: updateItem.LastPaymentDate,
+		Currency:        subscription.Currency,
+		BillingCycle:    subscription.BillingCycle,
+		TrialEndDate:    subscription.TrialEndDate,
 		Icon:            subscription.Icon,
 		Category:        models.SubscriptionCategory(updateItem.Category),
+		Tags:            subscription.Tags,
+		HouseholdId:     subscription.HouseholdId,
+		Status:          subscription.Status,
+		CancelAt:        subscription.CancelAt,
+		PriceChanges:    subscription.PriceChanges,
+		LastUsedDate:    subscription.LastUsedDate,
+		PaymentMethodId: subscription.PaymentMethodId,
+		Cancellation:    subscription.Cancellation,
 	}
 	tableInput := &dynamodb.UpdateItemInput{
 		TableName: aws.String(tableName),
@@ -226,9 +269,12 @@ func UpdateSubscription(partitionKey string, sortKey string, updateItem models.S
 			":category": {
 				S: aws.String(updateItem.Category),
 			},
+			":plan_id": {
+				S: aws.String(updateItem.PlanId),
+			},
 		},
 		ReturnValues:     aws.String("ALL_NEW"),
-		UpdateExpression: aws.String("SET #name = :name, #plan = :plan, #start_date = :start_date, #cost = :cost, #last_payment_date = :last_payment_date, #category = :category"),
+		UpdateExpression: aws.String("SET #name = :name, #plan = :plan, #start_date = :start_date, #cost = :cost, #last_payment_date = :last_payment_date, #category = :category, #plan_id = :plan_id"),
 		ExpressionAttributeNames: map[string]*string{
 			"#name":              aws.String("name"),
 			"#plan":              aws.String("plan"),
@@ -236,30 +282,308 @@ func UpdateSubscription(partitionKey string, sortKey string, updateItem models.S
 			"#cost":              aws.String("cost"),
 			"#last_payment_date": aws.String("last_payment_date"),
 			"#category":          aws.String("category"),
+			"#plan_id":           aws.String("plan_id"),
 		},
 	}
-	_, err := dynamoClient.UpdateItem(tableInput)
+	// the fields below are only changed when provided
+	if updateItem.Currency != "" {
+		newSubscription.Currency = updateItem.Currency
+		addUpdateField(tableInput, "currency", &dynamodb.AttributeValue{S: aws.String(updateItem.Currency)})
+	}
+	if updateItem.BillingCycle != "" {
+		newSubscription.BillingCycle = models.BillingCycle(updateItem.BillingCycle)
+		addUpdateField(tableInput, "billing_cycle", &dynamodb.AttributeValue{S: aws.String(updateItem.BillingCycle)})
+	}
+	if updateItem.TrialEndDate != "" {
+		newSubscription.TrialEndDate = updateItem.TrialEndDate
+		addUpdateField(tableInput, "trial_end_date", &dynamodb.AttributeValue{S: aws.String(updateItem.TrialEndDate)})
+	}
+	if updateItem.Tags != nil {
+		newSubscription.Tags = updateItem.Tags
+		addUpdateField(tableInput, "tags", tagsAttribute(updateItem.Tags))
+	}
+	removed := []string{}
+	if updateItem.CancelAt != nil {
+		newSubscription.CancelAt = *updateItem.CancelAt
+		if *updateItem.CancelAt == "" {
+			removed = append(removed, "cancel_at")
+		} else {
+			addUpdateField(tableInput, "cancel_at", &dynamodb.AttributeValue{S: aws.String(*updateItem.CancelAt)})
+		}
+	}
+	if updateItem.PriceChanges != nil {
+		priceChanges, err := dynamodbattribute.Marshal(updateItem.PriceChanges)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error updating subscription")
+			return models.SubscriptionDynamodb{}, err
+		}
+		newSubscription.PriceChanges = updateItem.PriceChanges
+		addUpdateField(tableInput, "price_changes", priceChanges)
+	}
+	if updateItem.PaymentMethodId != nil {
+		newSubscription.PaymentMethodId = *updateItem.PaymentMethodId
+		addUpdateField(tableInput, "payment_method_id", &dynamodb.AttributeValue{S: aws.String(*updateItem.PaymentMethodId)})
+	}
+	for i, attribute := range removed {
+		// the removals follow every SET clause
+		clause := ", #" + attribute
+		if i == 0 {
+			clause = " REMOVE #" + attribute
+		}
+		tableInput.UpdateExpression = aws.String(*tableInput.UpdateExpression + clause)
+		tableInput.ExpressionAttributeNames["#"+attribute] = aws.String(attribute)
+	}
+
+	result, err := dynamoClient.UpdateItem(tableInput)
 	if err != nil {
-		log.Error().Err(err).Msg("Error updating subscription")
+		log.Ctx(ctx).Error().Err(err).Msg("Error updating subscription")
 		return models.SubscriptionDynamodb{}, err
 	}
-	log.Info().Str("SubscriptionId", sortKey).Str("UserName", partitionKey).Msg("Subscription updated")
+	after := models.SubscriptionDynamodb{}
+	dynamodbattribute.UnmarshalMap(result.Attributes, &after)
+	auditSubscription(ctx, models.AuditUpdate, partitionKey, sortKey, subscription, after)
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, sortKey).Str(logging.UserNameField, partitionKey).Msg("Subscription updated")
 	return newSubscription, nil
 }
 
-func GetUserSubscriptions(partitionKey string) ([]models.SubscriptionDynamodb, error) {
+func tagsAttribute(tags []string) *dynamodb.AttributeValue {
+	/*
+		Returns the list attribute holding the tags of a subscription.
+		Params: tags []string
+		Return: *dynamodb.AttributeValue
+	*/
+	values := []*dynamodb.AttributeValue{}
+	for _, tag := range tags {
+		values = append(values, &dynamodb.AttributeValue{S: aws.String(tag)})
+	}
+	return &dynamodb.AttributeValue{L: values}
+}
+
+func UpdateSubscriptionCategory(ctx context.Context, partitionKey string, sortKey string, category models.SubscriptionCategory) error {
+	/*
+		Moves a subscription to another category.
+		Params: ctx context.Context
+				partitionKey string
+				sortKey string
+				category models.SubscriptionCategory
+		Return: error
+	*/
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, sortKey).Str("category", string(category)).Msg("Updating subscription category")
+	result, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(partitionKey),
+			},
+			"uuid": {
+				S: aws.String(sortKey),
+			},
+		},
+		UpdateExpression:    aws.String("SET #category = :category"),
+		ConditionExpression: aws.String("attribute_exists(#uuid)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uuid":     aws.String("uuid"),
+			"#category": aws.String("category"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":category": {
+				S: aws.String(string(category)),
+			},
+		},
+		ReturnValues: aws.String("UPDATED_OLD"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// the subscription was deleted meanwhile
+		return nil
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, sortKey).Msg("Error updating subscription category")
+		return err
+	}
+	before := models.SubscriptionDynamodb{}
+	dynamodbattribute.UnmarshalMap(result.Attributes, &before)
+	auditSubscription(ctx, models.AuditUpdate, partitionKey, sortKey, models.SubscriptionDynamodb{Category: before.Category}, models.SubscriptionDynamodb{Category: category})
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, sortKey).Str("category", string(category)).Msg("Subscription category updated")
+	return nil
+}
+
+func UpdateSubscriptionLastPayment(ctx context.Context, partitionKey string, sortKey string, paymentDate string) error {
+	/*
+		Moves the last payment date of a subscription forward to a newer
+		payment. An older payment date leaves the subscription unchanged.
+		Params: ctx context.Context
+				partitionKey string
+				sortKey string
+				paymentDate string
+		Return: error
+	*/
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, sortKey).Str("payment_date", paymentDate).Msg("Updating subscription last payment date")
+	result, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(partitionKey),
+			},
+			"uuid": {
+				S: aws.String(sortKey),
+			},
+		},
+		UpdateExpression:    aws.String("SET #last_payment_date = :last_payment_date"),
+		ConditionExpression: aws.String("attribute_exists(#uuid) AND (attribute_not_exists(#last_payment_date) OR #last_payment_date < :last_payment_date)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uuid":              aws.String("uuid"),
+			"#last_payment_date": aws.String("last_payment_date"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":last_payment_date": {
+				S: aws.String(paymentDate),
+			},
+		},
+		ReturnValues: aws.String("UPDATED_OLD"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, sortKey).Msg("Error updating subscription last payment date")
+		return err
+	}
+	before := models.SubscriptionDynamodb{}
+	dynamodbattribute.UnmarshalMap(result.Attributes, &before)
+	auditSubscription(ctx, models.AuditUpdate, partitionKey, sortKey, models.SubscriptionDynamodb{LastPaymentDate: before.LastPaymentDate}, models.SubscriptionDynamodb{LastPaymentDate: paymentDate})
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, sortKey).Str("payment_date", paymentDate).Msg("Subscription last payment date updated")
+	return nil
+}
+
+func migrateLegacyCategory(ctx context.Context, item *models.SubscriptionDynamodb) {
+	/*
+		Rewrites the misspelled category of a subscription stored by an
+		earlier version, so that every read sees the migrated value. The
+		write happens once per subscription, only while it still exists with
+		the legacy value, and is not audited as it changes nothing a user
+		sees. A failed write is retried on the next read.
+		Params: ctx context.Context
+				item *models.SubscriptionDynamodb
+		Return: None
+	*/
+	migrated, ok := models.LegacyCategories[item.Category]
+	if !ok {
+		return
+	}
+	da, err := initialize("subscriptions")
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, item.UUID).Msg("Error migrating legacy category")
+		return
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, item.UUID).Str("category", string(item.Category)).Msg("Migrating legacy category")
+	_, err = dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(tableName),
+		Key:                 subscriptionKey(*item),
+		UpdateExpression:    aws.String("SET #category = :category"),
+		ConditionExpression: aws.String("attribute_exists(#uuid) AND #category = :legacy"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uuid":     aws.String("uuid"),
+			"#category": aws.String("category"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":category": {S: aws.String(string(migrated))},
+			":legacy":   {S: aws.String(string(item.Category))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// deleted or recategorized meanwhile
+		err = nil
+	}
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str(logging.SubscriptionIdField, item.UUID).Msg("Error migrating legacy category")
+	}
+	item.Category = migrated
+}
+
+func addUpdateField(tableInput *dynamodb.UpdateItemInput, attribute string, value *dynamodb.AttributeValue) {
+	/*
+		Appends an extra "SET #attribute = :attribute" clause to an update expression.
+		Params: tableInput *dynamodb.UpdateItemInput
+				attribute string
+				value *dynamodb.AttributeValue
+		Return: None
+	*/
+	tableInput.UpdateExpression = aws.String(*tableInput.UpdateExpression + ", #" + attribute + " = :" + attribute)
+	tableInput.ExpressionAttributeNames["#"+attribute] = aws.String(attribute)
+	tableInput.ExpressionAttributeValues[":"+attribute] = value
+}
+
+func BatchAddSubscriptions(ctx context.Context, items []models.SubscriptionDynamodb) error {
+	/*
+		Adds the given Items to the DynamoDB table using BatchWriteItem.
+		Params: ctx context.Context
+				items []models.SubscriptionDynamodb
+		Return: error
+	*/
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Int("subscription_count", len(items)).Msg("Batch adding subscriptions")
+	requests := []*dynamodb.WriteRequest{}
+	for _, item := range items {
+		mappedItem, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error batch adding subscriptions")
+			return err
+		}
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: mappedItem}})
+	}
+
+	err = batchWrite(ctx, dynamoClient, tableName, requests)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error batch adding subscriptions")
+		return err
+	}
+	for _, item := range items {
+		auditSubscription(ctx, models.AuditCreate, item.UserName, item.UUID, nil, item)
+	}
+	log.Ctx(ctx).Info().Int("subscription_count", len(items)).Msg("Subscriptions batch added")
+	return nil
+}
+
+func GetUserSubscriptions(ctx context.Context, partitionKey string) ([]models.SubscriptionDynamodb, error) {
 	/*
 		Gets all the Items for a given User from the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 			    tableName
 				partitionKey
 		Return: []models.SubscriptionDynamodb, error
 	*/
-	da := initialize("subscriptions")
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return nil, err
+	}
 	dynamoClient := da.DynamoCli
 	tableName := da.TableName
 
-	log.Info().Str("UserName", partitionKey).Msg("Getting user subscriptions")
+	log.Ctx(ctx).Info().Str(logging.UserNameField, partitionKey).Msg("Getting user subscriptions")
 
 	// query the dynamodb table using the partition key
 	input := &dynamodb.QueryInput{
@@ -275,23 +599,189 @@ func GetUserSubscriptions(partitionKey string) ([]models.SubscriptionDynamodb, e
 			},
 		},
 	}
-	result, err := dynamoClient.Query(input)
+	items := []models.SubscriptionDynamodb{}
+	// follow LastEvaluatedKey so that results larger than 1MB are not truncated
+	for {
+		result, err := dynamoClient.Query(input)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error getting user subscriptions")
+			return nil, err
+		}
+
+		for _, i := range result.Items {
+			item := models.SubscriptionDynamodb{}
+			err = dynamodbattribute.UnmarshalMap(i, &item)
+			if err != nil {
+				log.Ctx(ctx).Error().Err(err).Msg("Error getting user subscriptions")
+				return nil, err
+			}
+			migrateLegacyCategory(ctx, &item)
+			items = append(items, item)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, partitionKey).Int("subscription_count", len(items)).Msg("User subscriptions retrieved successfully")
+	return items, nil
+}
+
+func subscriptionKey(item models.SubscriptionDynamodb) map[string]*dynamodb.AttributeValue {
+	/*
+		Returns the key of a subscription item.
+		Params: item models.SubscriptionDynamodb
+		Return: map[string]*dynamodb.AttributeValue
+	*/
+	return map[string]*dynamodb.AttributeValue{
+		"username": {
+			S: aws.String(item.UserName),
+		},
+		"uuid": {
+			S: aws.String(item.UUID),
+		},
+	}
+}
+
+func auditSubscriptionWrite(ctx context.Context, write models.SubscriptionWrite) {
+	/*
+		Records a written change of a batch in the audit log.
+		Params: ctx context.Context
+				write models.SubscriptionWrite
+		Return: None
+	*/
+	if write.After == nil {
+		auditSubscription(ctx, models.AuditDelete, write.Before.UserName, write.Before.UUID, write.Before, nil)
+		return
+	}
+	auditSubscription(ctx, models.AuditUpdate, write.Before.UserName, write.Before.UUID, write.Before, *write.After)
+}
+
+func TransactSubscriptionWrites(ctx context.Context, writes []models.SubscriptionWrite) ([]string, error) {
+	/*
+		Writes the changes of a batch in one transaction, so that either all
+		of them or none are stored. A change fails when its subscription was
+		deleted in the meantime.
+		Params: ctx context.Context
+				writes []models.SubscriptionWrite (up to 100)
+		Return: []string (cancellation reason of each change when the transaction is cancelled), error
+	*/
+	da, err := initialize("subscriptions")
 	if err != nil {
-		log.Error().Err(err).Msg("Error getting user subscriptions")
 		return nil, err
 	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
 
-	items := []models.SubscriptionDynamodb{}
-	for _, i := range result.Items {
-		item := models.SubscriptionDynamodb{}
-		err = dynamodbattribute.UnmarshalMap(i, &item)
+	log.Ctx(ctx).Info().Int("write_count", len(writes)).Msg("Writing subscriptions transaction")
+	items := []*dynamodb.TransactWriteItem{}
+	for _, write := range writes {
+		if write.After == nil {
+			items = append(items, &dynamodb.TransactWriteItem{
+				Delete: &dynamodb.Delete{
+					TableName:           aws.String(tableName),
+					Key:                 subscriptionKey(write.Before),
+					ConditionExpression: aws.String("attribute_exists(#uuid)"),
+					ExpressionAttributeNames: map[string]*string{
+						"#uuid": aws.String("uuid"),
+					},
+				},
+			})
+			continue
+		}
+		mappedItem, err := dynamodbattribute.MarshalMap(*write.After)
 		if err != nil {
-			log.Error().Err(err).Msg("Error getting user subscriptions")
+			log.Ctx(ctx).Error().Err(err).Msg("Error writing subscriptions transaction")
 			return nil, err
 		}
-		items = append(items, item)
+		items = append(items, &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName:           aws.String(tableName),
+				Item:                mappedItem,
+				ConditionExpression: aws.String("attribute_exists(#uuid)"),
+				ExpressionAttributeNames: map[string]*string{
+					"#uuid": aws.String("uuid"),
+				},
+			},
+		})
 	}
 
-	log.Info().Str("UserName", partitionKey).Int("SubscriptionCount", len(items)).Msg("User subscriptions retrieved successfully")
-	return items, nil
+	_, err = dynamoClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			reasons := []string{}
+			for _, reason := range canceled.CancellationReasons {
+				reasons = append(reasons, aws.StringValue(reason.Code))
+			}
+			log.Ctx(ctx).Error().Err(err).Strs("reasons", reasons).Msg("Subscriptions transaction cancelled")
+			return reasons, err
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error writing subscriptions transaction")
+		return nil, err
+	}
+	for _, write := range writes {
+		auditSubscriptionWrite(ctx, write)
+	}
+	log.Ctx(ctx).Info().Int("write_count", len(writes)).Msg("Subscriptions transaction written")
+	return nil, nil
+}
+
+func BatchSubscriptionWrites(ctx context.Context, writes []models.SubscriptionWrite) []error {
+	/*
+		Writes the changes of a batch one by one. As in a transaction, a
+		change fails with ErrSubscriptionGone when its subscription was
+		deleted in the meantime, rather than bringing it back. A change
+		failing does not stop the next ones.
+		Params: ctx context.Context
+				writes []models.SubscriptionWrite
+		Return: []error (the error of each change, nil when written)
+	*/
+	log.Ctx(ctx).Info().Int("write_count", len(writes)).Msg("Batch writing subscriptions")
+	errs := make([]error, len(writes))
+	da, err := initialize("subscriptions")
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+	condition := aws.String("attribute_exists(#uuid)")
+	names := map[string]*string{"#uuid": aws.String("uuid")}
+	for i, write := range writes {
+		if write.After == nil {
+			_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+				TableName:                aws.String(tableName),
+				Key:                      subscriptionKey(write.Before),
+				ConditionExpression:      condition,
+				ExpressionAttributeNames: names,
+			})
+		} else {
+			var mappedItem map[string]*dynamodb.AttributeValue
+			mappedItem, err = dynamodbattribute.MarshalMap(*write.After)
+			if err == nil {
+				_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+					TableName:                aws.String(tableName),
+					Item:                     mappedItem,
+					ConditionExpression:      condition,
+					ExpressionAttributeNames: names,
+				})
+			}
+		}
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			err = ErrSubscriptionGone
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, write.Before.UUID).Msg("Error batch writing subscription")
+			errs[i] = err
+			continue
+		}
+		auditSubscriptionWrite(ctx, write)
+	}
+	log.Ctx(ctx).Info().Int("write_count", len(writes)).Msg("Subscriptions batch written")
+	return errs
 }
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+func AddUsageEvents(ctx context.Context, items []models.UsageDynamodb) error {
+	/*
+		Batch writes usage events. A visit replaces the one stored for the
+		same window.
+		Params: ctx context.Context
+				items []models.UsageDynamodb
+		Return: error
+	*/
+	da, err := initialize("usage")
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Info().Int("event_count", len(items)).Msg("Adding usage events")
+	requests := []*dynamodb.WriteRequest{}
+	for _, item := range items {
+		mappedItem, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error adding usage events")
+			return err
+		}
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: mappedItem}})
+	}
+	err = batchWrite(ctx, da.DynamoCli, da.TableName, requests)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding usage events")
+		return err
+	}
+	log.Ctx(ctx).Info().Int("event_count", len(items)).Msg("Usage events added")
+	return nil
+}
+
+func GetUserUsage(ctx context.Context, userName string, since string) ([]models.UsageDynamodb, error) {
+	/*
+		Gets the usage events of a user from a given time on.
+		Params: ctx context.Context
+				userName string
+				since string (RFC 3339)
+		Return: []models.UsageDynamodb, error
+	*/
+	da, err := initialize("usage")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("since", since).Msg("Getting usage events")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:              aws.String(da.TableName),
+		KeyConditionExpression: aws.String("#username = :username AND #id >= :since"),
+		ExpressionAttributeNames: map[string]*string{
+			"#username": aws.String("username"),
+			"#id":       aws.String("id"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":username": {
+				S: aws.String(userName),
+			},
+			":since": {
+				S: aws.String(since),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting usage events")
+		return nil, err
+	}
+	items := []models.UsageDynamodb{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting usage events")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("event_count", len(items)).Msg("Usage events retrieved")
+	return items, nil
+}
+
+func UpdateSubscriptionLastUsed(ctx context.Context, partitionKey string, sortKey string, usedDate string) error {
+	/*
+		Moves the last used date of a subscription forward. An older date
+		leaves the subscription unchanged. Usage is not audited, as it is
+		not a change made to the subscription.
+		Params: ctx context.Context
+				partitionKey string
+				sortKey string
+				usedDate string
+		Return: error
+	*/
+	da, err := initialize("subscriptions")
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, sortKey).Str("used_date", usedDate).Msg("Updating subscription last used date")
+	_, err = da.DynamoCli.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(da.TableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(partitionKey),
+			},
+			"uuid": {
+				S: aws.String(sortKey),
+			},
+		},
+		UpdateExpression:    aws.String("SET #last_used_date = :last_used_date"),
+		ConditionExpression: aws.String("attribute_exists(#uuid) AND (attribute_not_exists(#last_used_date) OR #last_used_date < :last_used_date)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uuid":           aws.String("uuid"),
+			"#last_used_date": aws.String("last_used_date"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":last_used_date": {
+				S: aws.String(usedDate),
+			},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, sortKey).Msg("Error updating subscription last used date")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, sortKey).Str("used_date", usedDate).Msg("Subscription last used date updated")
+	return nil
+}
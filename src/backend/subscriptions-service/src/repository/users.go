@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"subHandler/src/logging"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/rs/zerolog/log"
+)
+
+func GetUserNameByEmail(ctx context.Context, email string) (string, error) {
+	/*
+		Looks up the username registered with an email in the users table
+		populated at sign up.
+		Params: ctx context.Context
+				email string
+		Return: string, error
+	*/
+	da, err := initialize("users")
+	if err != nil {
+		return "", err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Msg("Getting username by email")
+	input := &dynamodb.ScanInput{
+		TableName:        aws.String(tableName),
+		FilterExpression: aws.String("#email = :email"),
+		ExpressionAttributeNames: map[string]*string{
+			"#email": aws.String("Email"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":email": {
+				S: aws.String(strings.TrimSpace(email)),
+			},
+		},
+		ProjectionExpression: aws.String("UserName"),
+	}
+	for {
+		result, err := dynamoClient.Scan(input)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error getting username by email")
+			return "", err
+		}
+		for _, item := range result.Items {
+			if userName, ok := item["UserName"]; ok && userName.S != nil {
+				log.Ctx(ctx).Info().Str(logging.UserNameField, *userName.S).Msg("Username retrieved by email")
+				return *userName.S, nil
+			}
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	log.Ctx(ctx).Error().Msg("Error getting username by email. No user found.")
+	return "", errors.New("404")
+}
+
+func GetUserEmail(ctx context.Context, userName string) (string, error) {
+	/*
+		Returns the email a user signed up with.
+		Params: ctx context.Context
+				userName string
+		Return: string, error
+	*/
+	da, err := initialize("users")
+	if err != nil {
+		return "", err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting user email")
+	result, err := dynamoClient.Query(&dynamodb.QueryInput{
+		TableName:     aws.String(tableName),
+		KeyConditions: keyCondition("UserName", userName),
+		Limit:         aws.Int64(1),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting user email")
+		return "", err
+	}
+	if len(result.Items) == 0 || result.Items[0]["Email"] == nil || result.Items[0]["Email"].S == nil {
+		log.Ctx(ctx).Error().Str(logging.UserNameField, userName).Msg("Error getting user email. No user found.")
+		return "", errors.New("404")
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("User email retrieved")
+	return *result.Items[0]["Email"].S, nil
+}
+
+func GetUserNames(ctx context.Context) ([]string, error) {
+	/*
+		Returns the usernames of every user in the users table.
+		Params: ctx context.Context
+		Return: []string, error
+	*/
+	da, err := initialize("users")
+	if err != nil {
+		return nil, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Msg("Getting usernames")
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(tableName),
+		ProjectionExpression: aws.String("UserName"),
+	}
+	userNames := []string{}
+	for {
+		result, err := dynamoClient.Scan(input)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Error getting usernames")
+			return nil, err
+		}
+		for _, item := range result.Items {
+			if userName, ok := item["UserName"]; ok && userName.S != nil {
+				userNames = append(userNames, *userName.S)
+			}
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	log.Ctx(ctx).Info().Int("user_count", len(userNames)).Msg("Usernames retrieved")
+	return userNames, nil
+}
@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"subHandler/src/models"
+)
+
+// vendorCatalog is seeded from the vendor list (popup/category.txt) and the
+// logos (popup/logos) shipped with the browser extension. Icon holds the
+// logo file name and is resolved against VENDOR_ICON_BASE_URL by the service.
+var vendorCatalog = []models.Vendor{
+	// OTT
+	{Id: "netflix", Name: "Netflix", Category: models.OTT, Url: "https://www.netflix.com", SettingsUrl: "https://www.netflix.com/account", Domains: []string{"netflix.com"}, Icon: "netflix.png"},
+	{Id: "hulu", Name: "Hulu", Category: models.OTT, Url: "https://www.hulu.com", SettingsUrl: "https://secure.hulu.com/account", Domains: []string{"hulu.com"}, Icon: "hulu.png"},
+	{Id: "hbo-max", Name: "HBO Max", Aliases: []string{"hbo", "max"}, Category: models.OTT, Url: "https://www.max.com", SettingsUrl: "https://auth.max.com/subscription", Domains: []string{"max.com", "hbomax.com"}, Icon: "hbo.png"},
+	{Id: "peacock", Name: "Peacock", Category: models.OTT, Url: "https://www.peacocktv.com", SettingsUrl: "https://www.peacocktv.com/account/plans", Domains: []string{"peacocktv.com"}, Icon: "peacock.png"},
+	{Id: "f1-tv", Name: "F1 TV", Aliases: []string{"f1tv", "formula"}, Category: models.OTT, Url: "https://f1tv.formula1.com", SettingsUrl: "https://account.formula1.com/#/en/my-account", Domains: []string{"f1tv.formula1.com", "formula1.com"}, Icon: "f1tv.png"},
+	{Id: "disney-plus", Name: "Disney+", Aliases: []string{"disney", "disney plus"}, Category: models.OTT, Url: "https://www.disneyplus.com", SettingsUrl: "https://www.disneyplus.com/account", Domains: []string{"disneyplus.com"}},
+	{Id: "youtube-premium", Name: "YouTube Premium", Aliases: []string{"youtube"}, Category: models.OTT, Url: "https://www.youtube.com/premium", SettingsUrl: "https://www.youtube.com/paid_memberships", Domains: []string{"youtube.com"}},
+	{Id: "prime-video", Name: "Prime Video", Aliases: []string{"amazon prime", "prime"}, Category: models.OTT, Url: "https://www.primevideo.com", SettingsUrl: "https://www.amazon.com/mc", Domains: []string{"primevideo.com"}},
+
+	// Music
+	{Id: "spotify", Name: "Spotify", Category: models.Music, Url: "https://www.spotify.com", SettingsUrl: "https://www.spotify.com/account/overview/", Domains: []string{"spotify.com"}, Icon: "spotify.png"},
+	{Id: "apple-music", Name: "Apple Music", Category: models.Music, Url: "https://music.apple.com", SettingsUrl: "https://support.apple.com/en-us/118428", Domains: []string{"music.apple.com"}},
+	{Id: "amazon-music-unlimited", Name: "Amazon Music Unlimited", Aliases: []string{"amazon music"}, Category: models.Music, Url: "https://music.amazon.com", SettingsUrl: "https://www.amazon.com/music/settings", Domains: []string{"music.amazon.com"}},
+	{Id: "tidal", Name: "Tidal", Category: models.Music, Url: "https://tidal.com", SettingsUrl: "https://account.tidal.com/subscription", Domains: []string{"tidal.com"}},
+	{Id: "deezer", Name: "Deezer", Category: models.Music, Url: "https://www.deezer.com", SettingsUrl: "https://www.deezer.com/account/subscription", Domains: []string{"deezer.com"}},
+	{Id: "pandora", Name: "Pandora", Category: models.Music, Url: "https://www.pandora.com", SettingsUrl: "https://www.pandora.com/settings/subscription", Domains: []string{"pandora.com"}},
+	{Id: "youtube-music", Name: "YouTube Music", Category: models.Music, Url: "https://music.youtube.com", SettingsUrl: "https://www.youtube.com/paid_memberships", Domains: []string{"music.youtube.com"}},
+
+	// Gaming
+	{Id: "xbox-game-pass", Name: "Xbox Game Pass", Aliases: []string{"xbox", "game pass"}, Category: models.Gaming, Url: "https://www.xbox.com/xbox-game-pass", SettingsUrl: "https://account.microsoft.com/services", Domains: []string{"xbox.com"}, Icon: "xbox.png"},
+	{Id: "playstation-plus", Name: "PlayStation Plus", Aliases: []string{"playstation", "ps plus"}, Category: models.Gaming, Url: "https://www.playstation.com/ps-plus/", SettingsUrl: "https://www.playstation.com/acct/subscriptions", Domains: []string{"playstation.com"}},
+	{Id: "nintendo-switch-online", Name: "Nintendo Switch Online", Aliases: []string{"nintendo"}, Category: models.Gaming, Url: "https://www.nintendo.com/switch/online/", SettingsUrl: "https://ec.nintendo.com/my/membership", Domains: []string{"nintendo.com"}},
+	{Id: "ea-play", Name: "EA Play", Category: models.Gaming, Url: "https://www.ea.com/ea-play", SettingsUrl: "https://myaccount.ea.com/cp-ui/subscription/index", Domains: []string{"ea.com"}},
+	{Id: "ubisoft-plus", Name: "Ubisoft+", Aliases: []string{"ubisoft", "ubisoft plus"}, Category: models.Gaming, Url: "https://www.ubisoft.com/ubisoft-plus", SettingsUrl: "https://account.ubisoft.com/subscriptions", Domains: []string{"ubisoft.com"}},
+	{Id: "apple-arcade", Name: "Apple Arcade", Category: models.Gaming, Url: "https://www.apple.com/apple-arcade/", SettingsUrl: "https://support.apple.com/en-us/118428", Domains: []string{"apple.com/apple-arcade"}},
+
+	// Delivery
+	{Id: "doordash", Name: "DoorDash", Aliases: []string{"dashpass"}, Category: models.Delivery, Url: "https://www.doordash.com", SettingsUrl: "https://www.doordash.com/dashpass/manage", Domains: []string{"doordash.com"}},
+	{Id: "uber-eats", Name: "Uber Eats", Aliases: []string{"uber", "uber one"}, Category: models.Delivery, Url: "https://www.ubereats.com", SettingsUrl: "https://account.uber.com/uber-one", Domains: []string{"ubereats.com", "uber.com"}, Icon: "uber.png"},
+	{Id: "grubhub", Name: "Grubhub", Aliases: []string{"grubhub plus"}, Category: models.Delivery, Url: "https://www.grubhub.com", SettingsUrl: "https://www.grubhub.com/account/plus", Domains: []string{"grubhub.com"}},
+	{Id: "postmates", Name: "Postmates", Category: models.Delivery, Url: "https://postmates.com", SettingsUrl: "https://postmates.com/account", Domains: []string{"postmates.com"}},
+	{Id: "instacart", Name: "Instacart", Aliases: []string{"instacart plus"}, Category: models.Delivery, Url: "https://www.instacart.com", SettingsUrl: "https://www.instacart.com/store/account/instacart-plus", Domains: []string{"instacart.com"}, Icon: "instacart.png"},
+	{Id: "deliveroo", Name: "Deliveroo", Aliases: []string{"deliveroo plus"}, Category: models.Delivery, Url: "https://deliveroo.co.uk", SettingsUrl: "https://deliveroo.co.uk/account/plus", Domains: []string{"deliveroo.co.uk", "deliveroo.com"}},
+	{Id: "just-eat", Name: "Just Eat", Category: models.Delivery, Url: "https://www.just-eat.co.uk", SettingsUrl: "https://www.just-eat.co.uk/account/info", Domains: []string{"just-eat.co.uk", "just-eat.com"}},
+
+	// Fitness & Wellness
+	{Id: "peloton", Name: "Peloton", Category: models.Fitness, Url: "https://www.onepeloton.com", SettingsUrl: "https://members.onepeloton.com/preferences/subscriptions", Domains: []string{"onepeloton.com"}},
+	{Id: "daily-burn", Name: "Daily Burn", Category: models.Fitness, Url: "https://dailyburn.com", SettingsUrl: "https://dailyburn.com/account", Domains: []string{"dailyburn.com"}},
+	{Id: "classpass", Name: "ClassPass", Category: models.Fitness, Url: "https://classpass.com", SettingsUrl: "https://classpass.com/settings/membership", Domains: []string{"classpass.com"}},
+	{Id: "headspace", Name: "Headspace", Category: models.Fitness, Url: "https://www.headspace.com", SettingsUrl: "https://www.headspace.com/subscriptions", Domains: []string{"headspace.com"}, Icon: "headspace.png"},
+	{Id: "calm", Name: "Calm", Category: models.Fitness, Url: "https://www.calm.com", SettingsUrl: "https://www.calm.com/account", Domains: []string{"calm.com"}},
+	{Id: "myfitnesspal", Name: "MyFitnessPal", Aliases: []string{"myfitnesspal premium"}, Category: models.Fitness, Url: "https://www.myfitnesspal.com", SettingsUrl: "https://www.myfitnesspal.com/account/premium", Domains: []string{"myfitnesspal.com"}},
+	{Id: "fitbit-premium", Name: "Fitbit Premium", Aliases: []string{"fitbit"}, Category: models.Fitness, Url: "https://www.fitbit.com/global/us/products/services/premium", SettingsUrl: "https://www.fitbit.com/settings/subscription", Domains: []string{"fitbit.com"}, Icon: "fitbit.png"},
+
+	// Education & Learning
+	{Id: "coursera", Name: "Coursera", Aliases: []string{"coursera plus"}, Category: models.Education, Url: "https://www.coursera.org", SettingsUrl: "https://www.coursera.org/my-purchases", Domains: []string{"coursera.org"}, Icon: "coursera.png"},
+	{Id: "udemy", Name: "Udemy", Category: models.Education, Url: "https://www.udemy.com", SettingsUrl: "https://www.udemy.com/user/manage-subscriptions/", Domains: []string{"udemy.com"}},
+	{Id: "skillshare", Name: "Skillshare", Category: models.Education, Url: "https://www.skillshare.com", SettingsUrl: "https://www.skillshare.com/settings/payments", Domains: []string{"skillshare.com"}},
+	{Id: "linkedin-learning", Name: "LinkedIn Learning", Aliases: []string{"linkedin", "linkedin premium"}, Category: models.Education, Url: "https://www.linkedin.com/learning", SettingsUrl: "https://www.linkedin.com/premium/manage", Domains: []string{"linkedin.com"}, Icon: "linkedin.webp"},
+	{Id: "masterclass", Name: "MasterClass", Category: models.Education, Url: "https://www.masterclass.com", SettingsUrl: "https://www.masterclass.com/account/edit", Domains: []string{"masterclass.com"}},
+	{Id: "rosetta-stone", Name: "Rosetta Stone", Category: models.Education, Url: "https://www.rosettastone.com", SettingsUrl: "https://www.rosettastone.com/account", Domains: []string{"rosettastone.com"}},
+	{Id: "duolingo-plus", Name: "Duolingo Plus", Aliases: []string{"duolingo", "super duolingo"}, Category: models.Education, Url: "https://www.duolingo.com", SettingsUrl: "https://www.duolingo.com/settings/subscription", Domains: []string{"duolingo.com"}, Icon: "duolingo.png"},
+
+	// Magazines & News
+	{Id: "new-york-times", Name: "New York Times", Aliases: []string{"nytimes", "nyt"}, Category: models.Magazine, Url: "https://www.nytimes.com", SettingsUrl: "https://myaccount.nytimes.com/seg/subscription", Domains: []string{"nytimes.com"}},
+	{Id: "wall-street-journal", Name: "Wall Street Journal", Aliases: []string{"wsj"}, Category: models.Magazine, Url: "https://www.wsj.com", SettingsUrl: "https://customercenter.wsj.com/view/manage-subscription", Domains: []string{"wsj.com"}, Icon: "wsj.png"},
+	{Id: "the-economist", Name: "The Economist", Aliases: []string{"economist"}, Category: models.Magazine, Url: "https://www.economist.com", SettingsUrl: "https://myaccount.economist.com/s/subscriptions", Domains: []string{"economist.com"}},
+	{Id: "national-geographic", Name: "National Geographic", Aliases: []string{"natgeo"}, Category: models.Magazine, Url: "https://www.nationalgeographic.com", SettingsUrl: "https://www.nationalgeographic.com/account", Domains: []string{"nationalgeographic.com"}},
+	{Id: "time", Name: "Time", Aliases: []string{"time magazine"}, Category: models.Magazine, Url: "https://time.com", SettingsUrl: "https://time.com/account", Domains: []string{"time.com"}},
+	{Id: "wired", Name: "Wired", Category: models.Magazine, Url: "https://www.wired.com", SettingsUrl: "https://www.wired.com/account/profile", Domains: []string{"wired.com"}, Icon: "wired.png"},
+	{Id: "vogue", Name: "Vogue", Category: models.Magazine, Url: "https://www.vogue.com", SettingsUrl: "https://www.vogue.com/account/profile", Domains: []string{"vogue.com"}, Icon: "vogue.png"},
+
+	// Software & Productivity
+	{Id: "microsoft-365", Name: "Microsoft 365", Aliases: []string{"microsoft", "office 365"}, Category: models.Software, Url: "https://www.microsoft.com/microsoft-365", SettingsUrl: "https://account.microsoft.com/services", Domains: []string{"microsoft.com", "office.com"}, Icon: "microsoft.png"},
+	{Id: "adobe-creative-cloud", Name: "Adobe Creative Cloud", Aliases: []string{"adobe", "creative cloud"}, Category: models.Software, Url: "https://www.adobe.com/creativecloud.html", SettingsUrl: "https://account.adobe.com/plans", Domains: []string{"adobe.com"}, Icon: "adobe.png"},
+	{Id: "google-workspace", Name: "Google Workspace", Aliases: []string{"gsuite", "g suite"}, Category: models.Software, Url: "https://workspace.google.com", SettingsUrl: "https://admin.google.com/ac/billing/subscriptions", Domains: []string{"workspace.google.com"}},
+	{Id: "dropbox", Name: "Dropbox", Category: models.Software, Url: "https://www.dropbox.com", SettingsUrl: "https://www.dropbox.com/account/plan", Domains: []string{"dropbox.com"}},
+	{Id: "evernote", Name: "Evernote", Category: models.Software, Url: "https://evernote.com", SettingsUrl: "https://www.evernote.com/Settings.action", Domains: []string{"evernote.com"}},
+	{Id: "trello", Name: "Trello", Category: models.Software, Url: "https://trello.com", SettingsUrl: "https://trello.com/billing", Domains: []string{"trello.com"}},
+	{Id: "todoist", Name: "Todoist", Category: models.Software, Url: "https://todoist.com", SettingsUrl: "https://todoist.com/app/settings/subscription", Domains: []string{"todoist.com"}},
+
+	// Finance & Money Management
+	{Id: "mint", Name: "Mint", Category: models.Finance, Url: "https://mint.intuit.com", SettingsUrl: "https://mint.intuit.com/settings", Domains: []string{"mint.intuit.com", "mint.com"}, Icon: "mint.png"},
+	{Id: "ynab", Name: "YNAB (You Need A Budget)", Aliases: []string{"ynab", "you need a budget"}, Category: models.Finance, Url: "https://www.ynab.com", SettingsUrl: "https://app.ynab.com/settings/subscription", Domains: []string{"ynab.com"}},
+	{Id: "acorns", Name: "Acorns", Category: models.Finance, Url: "https://www.acorns.com", SettingsUrl: "https://app.acorns.com/settings/subscription", Domains: []string{"acorns.com"}},
+	{Id: "robinhood-gold", Name: "Robinhood Gold", Aliases: []string{"robinhood"}, Category: models.Finance, Url: "https://robinhood.com/gold", SettingsUrl: "https://robinhood.com/account/settings", Domains: []string{"robinhood.com"}},
+	{Id: "morningstar-premium", Name: "Morningstar Premium", Aliases: []string{"morningstar"}, Category: models.Finance, Url: "https://www.morningstar.com", SettingsUrl: "https://www.morningstar.com/user/account", Domains: []string{"morningstar.com"}},
+	{Id: "bloomberg-terminal", Name: "Bloomberg Terminal", Aliases: []string{"bloomberg"}, Category: models.Finance, Url: "https://www.bloomberg.com/professional/solution/bloomberg-terminal/", SettingsUrl: "https://www.bloomberg.com/account", Domains: []string{"bloomberg.com"}},
+	{Id: "stock-advisor", Name: "Stock Advisor", Aliases: []string{"motley fool", "fool"}, Category: models.Finance, Url: "https://www.fool.com", SettingsUrl: "https://www.fool.com/account/", Domains: []string{"fool.com"}},
+
+	// Fashion & Beauty
+	{Id: "birchbox", Name: "Birchbox", Category: models.Fashion, Url: "https://www.birchbox.com", SettingsUrl: "https://www.birchbox.com/account", Domains: []string{"birchbox.com"}},
+	{Id: "ipsy", Name: "Ipsy", Category: models.Fashion, Url: "https://www.ipsy.com", SettingsUrl: "https://www.ipsy.com/account", Domains: []string{"ipsy.com"}},
+	{Id: "fabfitfun", Name: "FabFitFun", Category: models.Fashion, Url: "https://fabfitfun.com", SettingsUrl: "https://fabfitfun.com/my-account", Domains: []string{"fabfitfun.com"}},
+	{Id: "stitch-fix", Name: "Stitch Fix", Category: models.Fashion, Url: "https://www.stitchfix.com", SettingsUrl: "https://www.stitchfix.com/settings", Domains: []string{"stitchfix.com"}},
+	{Id: "sephora-play", Name: "Sephora Play", Aliases: []string{"sephora"}, Category: models.Fashion, Url: "https://www.sephora.com", SettingsUrl: "https://www.sephora.com/profile/MyAccount", Domains: []string{"sephora.com"}, Icon: "sephora.png"},
+	{Id: "boxycharm", Name: "BoxyCharm", Category: models.Fashion, Url: "https://www.boxycharm.com", SettingsUrl: "https://www.ipsy.com/account", Domains: []string{"boxycharm.com"}},
+	{Id: "allure-beauty-box", Name: "Allure Beauty Box", Aliases: []string{"allure"}, Category: models.Fashion, Url: "https://www.allure.com/beauty-box", SettingsUrl: "https://www.allure.com/beauty-box/account", Domains: []string{"allure.com"}},
+}
+
+// vendorPlans are the list prices of the plans of each vendor, keyed by
+// vendor id. Plans of the same tier give access to the same content and only
+// differ by billing cycle, number of seats or eligibility.
+var vendorPlans = map[string][]models.VendorPlan{
+	"netflix": {
+		{Id: "netflix-standard-ads-us", Name: "Standard with ads", Tier: "standard", Price: 7.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 2, Ads: true},
+		{Id: "netflix-standard-us", Name: "Standard", Tier: "standard", Price: 17.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 2},
+		{Id: "netflix-premium-us", Name: "Premium", Tier: "premium", Price: 24.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 4},
+		{Id: "netflix-standard-ads-gb", Name: "Standard with ads", Tier: "standard", Price: 5.99, Currency: "GBP", BillingCycle: models.Monthly, Region: "GB", Seats: 2, Ads: true},
+		{Id: "netflix-standard-gb", Name: "Standard", Tier: "standard", Price: 12.99, Currency: "GBP", BillingCycle: models.Monthly, Region: "GB", Seats: 2},
+		{Id: "netflix-premium-gb", Name: "Premium", Tier: "premium", Price: 18.99, Currency: "GBP", BillingCycle: models.Monthly, Region: "GB", Seats: 4},
+	},
+	"hulu": {
+		{Id: "hulu-ads-us", Name: "With Ads", Tier: "standard", Price: 9.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 2, Ads: true},
+		{Id: "hulu-ads-yearly-us", Name: "With Ads Yearly", Tier: "standard", Price: 99.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 2, Ads: true},
+		{Id: "hulu-no-ads-us", Name: "No Ads", Tier: "standard", Price: 18.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 2},
+	},
+	"disney-plus": {
+		{Id: "disney-plus-basic-us", Name: "Basic", Tier: "standard", Price: 9.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 2, Ads: true},
+		{Id: "disney-plus-premium-us", Name: "Premium", Tier: "premium", Price: 15.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 4},
+		{Id: "disney-plus-premium-yearly-us", Name: "Premium Yearly", Tier: "premium", Price: 159.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 4},
+	},
+	"youtube-premium": {
+		{Id: "youtube-premium-individual-us", Name: "Individual", Tier: "premium", Price: 13.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "youtube-premium-individual-yearly-us", Name: "Individual Yearly", Tier: "premium", Price: 139.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+		{Id: "youtube-premium-family-us", Name: "Family", Tier: "premium", Price: 22.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 6},
+		{Id: "youtube-premium-student-us", Name: "Student", Tier: "premium", Price: 7.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1, Eligibility: "student"},
+	},
+	"spotify": {
+		{Id: "spotify-individual-us", Name: "Individual", Tier: "premium", Price: 11.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "spotify-duo-us", Name: "Duo", Tier: "premium", Price: 16.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 2},
+		{Id: "spotify-family-us", Name: "Family", Tier: "premium", Price: 19.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 6},
+		{Id: "spotify-student-us", Name: "Student", Tier: "premium", Price: 5.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1, Eligibility: "student"},
+		{Id: "spotify-individual-gb", Name: "Individual", Tier: "premium", Price: 11.99, Currency: "GBP", BillingCycle: models.Monthly, Region: "GB", Seats: 1},
+		{Id: "spotify-duo-gb", Name: "Duo", Tier: "premium", Price: 16.99, Currency: "GBP", BillingCycle: models.Monthly, Region: "GB", Seats: 2},
+		{Id: "spotify-family-gb", Name: "Family", Tier: "premium", Price: 19.99, Currency: "GBP", BillingCycle: models.Monthly, Region: "GB", Seats: 6},
+		{Id: "spotify-student-gb", Name: "Student", Tier: "premium", Price: 5.99, Currency: "GBP", BillingCycle: models.Monthly, Region: "GB", Seats: 1, Eligibility: "student"},
+	},
+	"apple-music": {
+		{Id: "apple-music-individual-us", Name: "Individual", Tier: "standard", Price: 10.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "apple-music-individual-yearly-us", Name: "Individual Yearly", Tier: "standard", Price: 109, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+		{Id: "apple-music-family-us", Name: "Family", Tier: "standard", Price: 16.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 6},
+		{Id: "apple-music-student-us", Name: "Student", Tier: "standard", Price: 5.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1, Eligibility: "student"},
+	},
+	"xbox-game-pass": {
+		{Id: "xbox-game-pass-core-us", Name: "Core", Tier: "core", Price: 9.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "xbox-game-pass-core-yearly-us", Name: "Core Yearly", Tier: "core", Price: 74.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+		{Id: "xbox-game-pass-standard-us", Name: "Standard", Tier: "standard", Price: 14.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "xbox-game-pass-ultimate-us", Name: "Ultimate", Tier: "ultimate", Price: 19.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+	},
+	"playstation-plus": {
+		{Id: "playstation-plus-essential-us", Name: "Essential", Tier: "essential", Price: 9.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "playstation-plus-essential-quarterly-us", Name: "Essential Quarterly", Tier: "essential", Price: 24.99, Currency: "USD", BillingCycle: models.Quarterly, Region: "US", Seats: 1},
+		{Id: "playstation-plus-essential-yearly-us", Name: "Essential Yearly", Tier: "essential", Price: 79.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+		{Id: "playstation-plus-extra-us", Name: "Extra", Tier: "extra", Price: 14.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "playstation-plus-extra-yearly-us", Name: "Extra Yearly", Tier: "extra", Price: 134.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+		{Id: "playstation-plus-premium-us", Name: "Premium", Tier: "premium", Price: 17.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "playstation-plus-premium-yearly-us", Name: "Premium Yearly", Tier: "premium", Price: 159.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+	},
+	"nintendo-switch-online": {
+		{Id: "nintendo-switch-online-individual-us", Name: "Individual", Tier: "standard", Price: 3.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "nintendo-switch-online-individual-yearly-us", Name: "Individual Yearly", Tier: "standard", Price: 19.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+		{Id: "nintendo-switch-online-family-us", Name: "Family", Tier: "standard", Price: 34.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 8},
+	},
+	"headspace": {
+		{Id: "headspace-monthly-us", Name: "Monthly", Tier: "standard", Price: 12.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "headspace-yearly-us", Name: "Yearly", Tier: "standard", Price: 69.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+	},
+	"calm": {
+		{Id: "calm-monthly-us", Name: "Monthly", Tier: "standard", Price: 14.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "calm-yearly-us", Name: "Yearly", Tier: "standard", Price: 69.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+	},
+	"duolingo-plus": {
+		{Id: "duolingo-super-monthly-us", Name: "Super", Tier: "super", Price: 12.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "duolingo-super-yearly-us", Name: "Super Yearly", Tier: "super", Price: 84.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+		{Id: "duolingo-super-family-us", Name: "Super Family", Tier: "super", Price: 119.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 6},
+	},
+	"microsoft-365": {
+		{Id: "microsoft-365-personal-us", Name: "Personal", Tier: "standard", Price: 9.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "microsoft-365-personal-yearly-us", Name: "Personal Yearly", Tier: "standard", Price: 99.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+		{Id: "microsoft-365-family-us", Name: "Family", Tier: "standard", Price: 12.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 6},
+		{Id: "microsoft-365-family-yearly-us", Name: "Family Yearly", Tier: "standard", Price: 129.99, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 6},
+	},
+	"dropbox": {
+		{Id: "dropbox-plus-us", Name: "Plus", Tier: "plus", Price: 11.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 1},
+		{Id: "dropbox-plus-yearly-us", Name: "Plus Yearly", Tier: "plus", Price: 119.88, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 1},
+		{Id: "dropbox-family-us", Name: "Family", Tier: "plus", Price: 19.99, Currency: "USD", BillingCycle: models.Monthly, Region: "US", Seats: 6},
+		{Id: "dropbox-family-yearly-us", Name: "Family Yearly", Tier: "plus", Price: 203.88, Currency: "USD", BillingCycle: models.Yearly, Region: "US", Seats: 6},
+	},
+}
+
+// vendorCancellationSteps are the steps to cancel a subscription of each
+// vendor, keyed by vendor id. Vendors without steps get generic ones built
+// from their settings URL by the service.
+var vendorCancellationSteps = map[string][]string{
+	"netflix": {
+		"Sign in and open Account.",
+		"Select Cancel Membership.",
+		"Select Finish Cancellation.",
+	},
+	"hulu": {
+		"Sign in and open Account.",
+		"Under Your Subscription, select Cancel.",
+		"Skip the offers and select Cancel Subscription.",
+	},
+	"disney-plus": {
+		"Sign in and open Account.",
+		"Select your subscription, then Cancel Subscription.",
+		"Confirm with Complete Cancellation.",
+	},
+	"youtube-premium": {
+		"Open Paid memberships.",
+		"Select Manage membership, then Deactivate.",
+		"Select Continue to cancel, then Yes, cancel.",
+	},
+	"prime-video": {
+		"Open Memberships & Subscriptions.",
+		"Select Cancel Subscription next to the subscription.",
+		"Confirm the cancellation on the last page.",
+	},
+	"spotify": {
+		"Sign in to the account overview.",
+		"Under Your plan, select Change plan.",
+		"Scroll to Spotify Free and select Cancel Premium.",
+	},
+	"apple-music": {
+		"On an iPhone or iPad, open Settings, tap your name, then Subscriptions.",
+		"Select Apple Music.",
+		"Tap Cancel Subscription.",
+	},
+	"apple-arcade": {
+		"On an iPhone or iPad, open Settings, tap your name, then Subscriptions.",
+		"Select Apple Arcade.",
+		"Tap Cancel Subscription.",
+	},
+	"xbox-game-pass": {
+		"Sign in to Services & subscriptions of your Microsoft account.",
+		"Select Manage next to Game Pass.",
+		"Select Cancel subscription and confirm.",
+	},
+	"playstation-plus": {
+		"Sign in to Subscriptions Management of your PlayStation account.",
+		"Select Turn Off Auto-Renew.",
+	},
+	"microsoft-365": {
+		"Sign in to Services & subscriptions of your Microsoft account.",
+		"Select Manage next to Microsoft 365.",
+		"Select Cancel subscription and confirm.",
+	},
+	"adobe-creative-cloud": {
+		"Sign in to Plans and payment of your Adobe account.",
+		"Select Manage plan, then Cancel your plan.",
+		"Check the early termination fee of an annual plan before confirming.",
+	},
+	"dropbox": {
+		"Sign in and open Settings, then Plan.",
+		"Select Cancel plan.",
+		"Confirm the downgrade to Dropbox Basic.",
+	},
+}
+
+func GetVendors() []models.Vendor {
+	/*
+		Returns every vendor of the catalog along with its plans and
+		cancellation steps.
+		Params: None
+		Return: []models.Vendor
+	*/
+	vendors := make([]models.Vendor, len(vendorCatalog))
+	for i, vendor := range vendorCatalog {
+		vendor.Plans = vendorPlans[vendor.Id]
+		vendor.CancellationSteps = vendorCancellationSteps[vendor.Id]
+		vendors[i] = vendor
+	}
+	return vendors
+}
+
+func GetVendor(id string) (models.Vendor, bool) {
+	/*
+		Returns the vendor with the given id along with its plans and
+		cancellation steps.
+		Params: id string
+		Return: models.Vendor, bool
+	*/
+	for _, vendor := range vendorCatalog {
+		if vendor.Id == id {
+			vendor.Plans = vendorPlans[vendor.Id]
+			vendor.CancellationSteps = vendorCancellationSteps[vendor.Id]
+			return vendor, true
+		}
+	}
+	return models.Vendor{}, false
+}
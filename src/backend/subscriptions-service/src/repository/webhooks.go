@@ -0,0 +1,537 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+)
+
+// deliveryPendingKey is the value of the pending attribute of the deliveries
+// being retried
+const deliveryPendingKey = "1"
+
+func PutWebhook(ctx context.Context, item models.Webhook) (models.Webhook, error) {
+	/*
+		Stores a webhook of a user.
+		Params: ctx context.Context
+				item models.Webhook
+		Return: models.Webhook, error
+	*/
+	da, err := initialize("webhooks")
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Str("webhook_id", item.WebhookId).Msg("Storing webhook")
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing webhook")
+		return models.Webhook{}, err
+	}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		Item:      mappedItem,
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing webhook")
+		return models.Webhook{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, item.UserName).Str("webhook_id", item.WebhookId).Msg("Webhook stored")
+	return item, nil
+}
+
+func GetWebhook(ctx context.Context, userName string, webhookId string) (models.Webhook, error) {
+	/*
+		Gets a webhook of a user.
+		Params: ctx context.Context
+				userName string
+				webhookId string
+		Return: models.Webhook, error
+	*/
+	da, err := initialize("webhooks")
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("webhook_id", webhookId).Msg("Getting webhook")
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(userName),
+			},
+			"webhook_id": {
+				S: aws.String(webhookId),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting webhook")
+		return models.Webhook{}, err
+	}
+	if len(result.Item) == 0 {
+		log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("webhook_id", webhookId).Msg("No webhook found")
+		return models.Webhook{}, errors.New("404")
+	}
+	item := models.Webhook{}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting webhook")
+		return models.Webhook{}, err
+	}
+	return item, nil
+}
+
+func GetWebhooks(ctx context.Context, userName string) ([]models.Webhook, error) {
+	/*
+		Gets the webhooks of a user.
+		Params: ctx context.Context
+				userName string
+		Return: []models.Webhook, error
+	*/
+	da, err := initialize("webhooks")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting webhooks")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:     aws.String(da.TableName),
+		KeyConditions: keyCondition("username", userName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting webhooks")
+		return nil, err
+	}
+	items := []models.Webhook{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting webhooks")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("webhook_count", len(items)).Msg("Webhooks retrieved")
+	return items, nil
+}
+
+func DeleteWebhook(ctx context.Context, userName string, webhookId string) error {
+	/*
+		Deletes a webhook of a user and its delivery log.
+		Params: ctx context.Context
+				userName string
+				webhookId string
+		Return: error
+	*/
+	da, err := initialize("webhooks")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("webhook_id", webhookId).Msg("Deleting webhook")
+	_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(userName),
+			},
+			"webhook_id": {
+				S: aws.String(webhookId),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(webhook_id)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			log.Ctx(ctx).Error().Msg("Error deleting webhook. No item found.")
+			return errors.New("404")
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error deleting webhook")
+		return err
+	}
+
+	deliveries, err := GetWebhookDeliveries(ctx, webhookId)
+	if err != nil {
+		return err
+	}
+	requests := []*dynamodb.WriteRequest{}
+	for _, delivery := range deliveries {
+		requests = append(requests, &dynamodb.WriteRequest{
+			DeleteRequest: &dynamodb.DeleteRequest{
+				Key: map[string]*dynamodb.AttributeValue{
+					"webhook_id": {
+						S: aws.String(webhookId),
+					},
+					"delivery_id": {
+						S: aws.String(delivery.DeliveryId),
+					},
+				},
+			},
+		})
+	}
+	deliveriesTable, err := initialize("webhook-deliveries")
+	if err != nil {
+		return err
+	}
+	err = batchWrite(ctx, deliveriesTable.DynamoCli, deliveriesTable.TableName, requests)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("webhook_id", webhookId).Msg("Error deleting webhook deliveries")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("webhook_id", webhookId).Int("delivery_count", len(deliveries)).Msg("Webhook deleted")
+	return nil
+}
+
+func RecordWebhookAttempt(ctx context.Context, userName string, webhookId string, succeeded bool) (models.Webhook, error) {
+	/*
+		Resets the consecutive failures of a webhook after a successful
+		delivery attempt, or counts a failed one.
+		Params: ctx context.Context
+				userName string
+				webhookId string
+				succeeded bool
+		Return: models.Webhook (updated), error
+	*/
+	da, err := initialize("webhooks")
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	updateExpression := "ADD consecutive_failures :one"
+	values := map[string]*dynamodb.AttributeValue{
+		":one": {
+			N: aws.String("1"),
+		},
+	}
+	if succeeded {
+		updateExpression = "SET consecutive_failures = :zero"
+		values = map[string]*dynamodb.AttributeValue{
+			":zero": {
+				N: aws.String("0"),
+			},
+		}
+	}
+	result, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(userName),
+			},
+			"webhook_id": {
+				S: aws.String(webhookId),
+			},
+		},
+		UpdateExpression:          aws.String(updateExpression),
+		ExpressionAttributeValues: values,
+		ConditionExpression:       aws.String("attribute_exists(webhook_id)"),
+		ReturnValues:              aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return models.Webhook{}, errors.New("404")
+		}
+		log.Ctx(ctx).Error().Err(err).Str("webhook_id", webhookId).Msg("Error recording webhook attempt")
+		return models.Webhook{}, err
+	}
+	item := models.Webhook{}
+	err = dynamodbattribute.UnmarshalMap(result.Attributes, &item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("webhook_id", webhookId).Msg("Error recording webhook attempt")
+		return models.Webhook{}, err
+	}
+	return item, nil
+}
+
+func DisableWebhook(ctx context.Context, userName string, webhookId string, reason string, updatedAt string) error {
+	/*
+		Disables a webhook, which stops receiving deliveries until re-enabled.
+		Params: ctx context.Context
+				userName string
+				webhookId string
+				reason string
+				updatedAt string
+		Return: error
+	*/
+	da, err := initialize("webhooks")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	log.Ctx(ctx).Warn().Str(logging.UserNameField, userName).Str("webhook_id", webhookId).Str("reason", reason).Msg("Disabling webhook")
+	_, err = dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {
+				S: aws.String(userName),
+			},
+			"webhook_id": {
+				S: aws.String(webhookId),
+			},
+		},
+		UpdateExpression: aws.String("SET enabled = :disabled, disabled_reason = :reason, updated_at = :updated_at"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":disabled": {
+				BOOL: aws.Bool(false),
+			},
+			":reason": {
+				S: aws.String(reason),
+			},
+			":updated_at": {
+				S: aws.String(updatedAt),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(webhook_id)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return errors.New("404")
+		}
+		log.Ctx(ctx).Error().Err(err).Str("webhook_id", webhookId).Msg("Error disabling webhook")
+		return err
+	}
+	return nil
+}
+
+func AddWebhookDelivery(ctx context.Context, item models.WebhookDelivery) (bool, error) {
+	/*
+		Stores a new delivery of an event to a webhook, unless the event was
+		already delivered to it.
+		Params: ctx context.Context
+				item models.WebhookDelivery
+		Return: bool (false when the delivery exists), error
+	*/
+	da, err := initialize("webhook-deliveries")
+	if err != nil {
+		return false, err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	markDeliveryPending(&item)
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding webhook delivery")
+		return false, err
+	}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		Item:                mappedItem,
+		TableName:           aws.String(tableName),
+		ConditionExpression: aws.String("attribute_not_exists(delivery_id)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			log.Ctx(ctx).Info().Str("webhook_id", item.WebhookId).Str("delivery_id", item.DeliveryId).Msg("Webhook delivery already exists")
+			return false, nil
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding webhook delivery")
+		return false, err
+	}
+	log.Ctx(ctx).Info().Str("webhook_id", item.WebhookId).Str("delivery_id", item.DeliveryId).Msg("Webhook delivery added")
+	return true, nil
+}
+
+func PutWebhookDelivery(ctx context.Context, item models.WebhookDelivery) error {
+	/*
+		Stores the outcome of a delivery attempt.
+		Params: ctx context.Context
+				item models.WebhookDelivery
+		Return: error
+	*/
+	da, err := initialize("webhook-deliveries")
+	if err != nil {
+		return err
+	}
+	dynamoClient := da.DynamoCli
+	tableName := da.TableName
+
+	markDeliveryPending(&item)
+	mappedItem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error storing webhook delivery")
+		return err
+	}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		Item:      mappedItem,
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("webhook_id", item.WebhookId).Str("delivery_id", item.DeliveryId).Msg("Error storing webhook delivery")
+		return err
+	}
+	log.Ctx(ctx).Info().Str("webhook_id", item.WebhookId).Str("delivery_id", item.DeliveryId).Str("status", string(item.Status)).Int("attempts", item.Attempts).Msg("Webhook delivery stored")
+	return nil
+}
+
+func GetWebhookDeliveries(ctx context.Context, webhookId string) ([]models.WebhookDelivery, error) {
+	/*
+		Gets the deliveries of a webhook.
+		Params: ctx context.Context
+				webhookId string
+		Return: []models.WebhookDelivery, error
+	*/
+	da, err := initialize("webhook-deliveries")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str("webhook_id", webhookId).Msg("Getting webhook deliveries")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:     aws.String(da.TableName),
+		KeyConditions: keyCondition("webhook_id", webhookId),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("webhook_id", webhookId).Msg("Error getting webhook deliveries")
+		return nil, err
+	}
+	items := []models.WebhookDelivery{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("webhook_id", webhookId).Msg("Error getting webhook deliveries")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str("webhook_id", webhookId).Int("delivery_count", len(items)).Msg("Webhook deliveries retrieved")
+	return items, nil
+}
+
+func GetDueWebhookDeliveries(ctx context.Context, now string) ([]models.WebhookDelivery, error) {
+	/*
+		Gets the pending deliveries whose next attempt is due, from the
+		sparse pending index.
+		Params: ctx context.Context
+				now string (RFC 3339)
+		Return: []models.WebhookDelivery, error
+	*/
+	da, err := initialize("webhook-deliveries")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).Info().Str("now", now).Msg("Getting due webhook deliveries")
+	result, err := queryItems(da.DynamoCli, &dynamodb.QueryInput{
+		TableName:              aws.String(da.TableName),
+		IndexName:              aws.String(config.WEBHOOK_DELIVERIES_PENDING_INDEX),
+		KeyConditionExpression: aws.String("pending = :pending AND next_attempt_at <= :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pending": {
+				S: aws.String(deliveryPendingKey),
+			},
+			":now": {
+				S: aws.String(now),
+			},
+		},
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting due webhook deliveries")
+		return nil, err
+	}
+	items := []models.WebhookDelivery{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result, &items)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting due webhook deliveries")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Int("delivery_count", len(items)).Msg("Due webhook deliveries retrieved")
+	return items, nil
+}
+
+func markDeliveryPending(item *models.WebhookDelivery) {
+	/*
+		Sets the attribute keying a delivery in the pending index, or clears
+		it once the delivery is no longer retried.
+		Params: item *models.WebhookDelivery
+		Return: None
+	*/
+	if item.Status == models.DeliveryPending {
+		item.Pending = deliveryPendingKey
+	} else {
+		item.Pending = ""
+		item.NextAttemptAt = ""
+	}
+}
+
+func rejectPrivateAddress(network string, address string, conn syscall.RawConn) error {
+	/*
+		Refuses connections to loopback, private and link-local addresses, so
+		that a webhook cannot reach the services next to the function.
+		Params: network string
+				address string
+				conn syscall.RawConn
+		Return: error
+	*/
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || !ip.IsGlobalUnicast() {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+var webhookClient = &http.Client{
+	Timeout: config.WEBHOOK_TIMEOUT_SECONDS * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: config.WEBHOOK_TIMEOUT_SECONDS * time.Second,
+			Control: rejectPrivateAddress,
+		}).DialContext,
+		TLSHandshakeTimeout: config.WEBHOOK_TIMEOUT_SECONDS * time.Second,
+	},
+	// a redirect would be followed without the signature being checked
+	// against the new endpoint
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func PostWebhook(ctx context.Context, url string, headers map[string]string, body []byte) (int, string, error) {
+	/*
+		Posts a payload to a webhook endpoint.
+		Params: ctx context.Context
+				url string
+				headers map[string]string
+				body []byte
+		Return: int (status code), string (start of the response body), error
+	*/
+	ctx, cancel := context.WithTimeout(ctx, config.WEBHOOK_TIMEOUT_SECONDS*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	response, _ := io.ReadAll(io.LimitReader(res.Body, config.WEBHOOK_RESPONSE_MAX_LENGTH))
+	log.Ctx(ctx).Info().Str("url", url).Int("status_code", res.StatusCode).Msg("Webhook posted")
+	return res.StatusCode, string(response), nil
+}
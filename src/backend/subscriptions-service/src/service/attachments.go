@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidAttachment = errors.New("invalid attachment")
+
+func attachmentContentType(contentType string) (string, error) {
+	/*
+		Returns the media type of an attachment without its parameters,
+		failing with ErrInvalidAttachment when the type is not accepted.
+		Params: contentType string
+		Return: string, error
+	*/
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		for _, accepted := range models.AttachmentContentTypes {
+			if mediaType == accepted {
+				return mediaType, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: content type %q is not one of %s", ErrInvalidAttachment, contentType, strings.Join(models.AttachmentContentTypes, ", "))
+}
+
+func attachmentFileName(fileName string) string {
+	/*
+		Keeps the base name of an uploaded file, without quotes or control
+		characters so that it is safe in a Content-Disposition header.
+		Params: fileName string
+		Return: string
+	*/
+	fileName = path.Base(strings.ReplaceAll(strings.TrimSpace(fileName), `\`, "/"))
+	fileName = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, fileName)
+	if fileName == "." || fileName == "/" || fileName == "" {
+		return "receipt"
+	}
+	return fileName
+}
+
+func attachmentDetails(ctx context.Context, store repository.BlobStore, attachment models.PaymentAttachment) (models.AttachmentDetails, error) {
+	/*
+		Returns an attachment along with a download URL once its file is
+		uploaded. A pending attachment is marked uploaded as soon as a file
+		of the announced size is found in the store.
+		Params: ctx context.Context
+				store repository.BlobStore
+				attachment models.PaymentAttachment
+		Return: models.AttachmentDetails, error
+	*/
+	expiry := config.ATTACHMENT_URL_EXPIRY_MINUTES * time.Minute
+	if attachment.Status == models.AttachmentPending {
+		size, err := store.Size(ctx, attachment.StorageKey)
+		if err != nil && err.Error() == "404" {
+			return models.AttachmentDetails{PaymentAttachment: attachment}, nil
+		}
+		if err != nil {
+			return models.AttachmentDetails{}, err
+		}
+		if size != attachment.Size {
+			log.Ctx(ctx).Warn().Str("attachment_id", attachment.AttachmentId).Int64("size", size).Msg("Uploaded attachment does not have the announced size")
+			return models.AttachmentDetails{PaymentAttachment: attachment}, nil
+		}
+		attachment.Status = models.AttachmentUploaded
+		attachment, err = repository.PutAttachment(ctx, attachment)
+		if err != nil {
+			return models.AttachmentDetails{}, err
+		}
+	}
+	url, err := store.DownloadURL(ctx, attachment.StorageKey, attachment.FileName, expiry)
+	if err != nil {
+		return models.AttachmentDetails{}, err
+	}
+	return models.AttachmentDetails{
+		PaymentAttachment: attachment,
+		DownloadUrl:       url,
+		ExpiresAt:         time.Now().UTC().Add(expiry).Format(time.RFC3339),
+	}, nil
+}
+
+func AddAttachment(ctx context.Context, subscriptionId string, paymentId string, input models.AttachmentCreateInput) (models.AttachmentDetails, error) {
+	/*
+		Attaches a PDF or an image to a payment. A file sent as base64 content
+		is stored right away; otherwise the attachment stays pending until
+		the client uploads the announced file to the returned upload URL.
+		Params: ctx context.Context
+				subscriptionId string
+				paymentId string
+				input models.AttachmentCreateInput
+		Return: models.AttachmentDetails, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Str(logging.UserNameField, input.UserName).Msg("Adding attachment")
+	payment, err := reachablePayment(ctx, subscriptionId, paymentId, input.UserName, models.HouseholdAddPayment)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Str(logging.UserNameField, input.UserName).Msg("Error adding attachment")
+		return models.AttachmentDetails{}, err
+	}
+	contentType, err := attachmentContentType(input.ContentType)
+	if err != nil {
+		return models.AttachmentDetails{}, err
+	}
+	var content []byte
+	if input.Content != "" {
+		content, err = base64.StdEncoding.DecodeString(input.Content)
+		if err != nil {
+			return models.AttachmentDetails{}, fmt.Errorf("%w: content is not base64 encoded", ErrInvalidAttachment)
+		}
+		// the declared type must match the file itself
+		if sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(content)); sniffed != contentType {
+			return models.AttachmentDetails{}, fmt.Errorf("%w: content is %s, not %s", ErrInvalidAttachment, sniffed, contentType)
+		}
+		input.Size = int64(len(content))
+	}
+	if input.Size <= 0 || input.Size > config.ATTACHMENT_MAX_SIZE {
+		return models.AttachmentDetails{}, fmt.Errorf("%w: files must be between 1 byte and %d MB", ErrInvalidAttachment, config.ATTACHMENT_MAX_SIZE>>20)
+	}
+
+	store, err := repository.NewBlobStore()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error adding attachment")
+		return models.AttachmentDetails{}, err
+	}
+	attachmentId := uuid.New().String()
+	attachment := models.PaymentAttachment{
+		PaymentId:      payment.UUID,
+		AttachmentId:   attachmentId,
+		SubscriptionId: subscriptionId,
+		UserName:       input.UserName,
+		FileName:       attachmentFileName(input.FileName),
+		ContentType:    contentType,
+		Size:           input.Size,
+		StorageKey:     config.ATTACHMENT_KEY_PREFIX + subscriptionId + "/" + payment.UUID + "/" + attachmentId,
+		Status:         models.AttachmentPending,
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+	}
+
+	details := models.AttachmentDetails{}
+	if content != nil {
+		err = store.Put(ctx, attachment.StorageKey, contentType, content)
+		if err == nil {
+			attachment.Status = models.AttachmentUploaded
+			attachment, err = repository.PutAttachment(ctx, attachment)
+		}
+		if err == nil {
+			details, err = attachmentDetails(ctx, store, attachment)
+		}
+	} else {
+		expiry := config.ATTACHMENT_URL_EXPIRY_MINUTES * time.Minute
+		details.UploadUrl, err = store.UploadURL(ctx, attachment.StorageKey, contentType, attachment.Size, expiry)
+		if err == nil {
+			details.ExpiresAt = time.Now().UTC().Add(expiry).Format(time.RFC3339)
+			details.PaymentAttachment, err = repository.PutAttachment(ctx, attachment)
+		}
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Msg("Error adding attachment")
+		return models.AttachmentDetails{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Str("attachment_id", attachmentId).Str("status", string(details.Status)).Msg("Attachment added")
+	return details, nil
+}
+
+func GetAttachments(ctx context.Context, subscriptionId string, paymentId string, userName string) ([]models.AttachmentDetails, error) {
+	/*
+		Returns the attachments of a payment with their download URLs.
+		Params: ctx context.Context
+				subscriptionId string
+				paymentId string
+				userName string
+		Return: []models.AttachmentDetails, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Str(logging.UserNameField, userName).Msg("Getting attachments")
+	_, err := reachablePayment(ctx, subscriptionId, paymentId, userName, models.HouseholdView)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Str(logging.UserNameField, userName).Msg("Error getting attachments")
+		return nil, err
+	}
+	attachments, err := repository.GetPaymentAttachments(ctx, paymentId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Msg("Error getting attachments")
+		return nil, err
+	}
+	store, err := repository.NewBlobStore()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting attachments")
+		return nil, err
+	}
+	res := []models.AttachmentDetails{}
+	for _, attachment := range attachments {
+		details, err := attachmentDetails(ctx, store, attachment)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Msg("Error getting attachments")
+			return nil, err
+		}
+		res = append(res, details)
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Int("attachment_count", len(res)).Msg("Attachments retrieved")
+	return res, nil
+}
+
+func GetAttachment(ctx context.Context, subscriptionId string, paymentId string, attachmentId string, userName string) (models.AttachmentDetails, error) {
+	/*
+		Returns an attachment of a payment with its download URL.
+		Params: ctx context.Context
+				subscriptionId string
+				paymentId string
+				attachmentId string
+				userName string
+		Return: models.AttachmentDetails, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Str("attachment_id", attachmentId).Str(logging.UserNameField, userName).Msg("Getting attachment")
+	_, err := reachablePayment(ctx, subscriptionId, paymentId, userName, models.HouseholdView)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Str(logging.UserNameField, userName).Msg("Error getting attachment")
+		return models.AttachmentDetails{}, err
+	}
+	attachment, err := repository.GetAttachment(ctx, paymentId, attachmentId)
+	if err != nil {
+		return models.AttachmentDetails{}, err
+	}
+	store, err := repository.NewBlobStore()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting attachment")
+		return models.AttachmentDetails{}, err
+	}
+	return attachmentDetails(ctx, store, attachment)
+}
+
+func removeAttachment(ctx context.Context, store repository.BlobStore, attachment models.PaymentAttachment) error {
+	/*
+		Deletes the file of an attachment and then its details.
+		Params: ctx context.Context
+				store repository.BlobStore
+				attachment models.PaymentAttachment
+		Return: error
+	*/
+	err := store.Delete(ctx, attachment.StorageKey)
+	if err != nil {
+		return err
+	}
+	return repository.DeleteAttachment(ctx, attachment.PaymentId, attachment.AttachmentId)
+}
+
+func DeleteAttachment(ctx context.Context, subscriptionId string, paymentId string, attachmentId string, userName string) error {
+	/*
+		Deletes an attachment of a payment along with its file.
+		Params: ctx context.Context
+				subscriptionId string
+				paymentId string
+				attachmentId string
+				userName string
+		Return: error
+	*/
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Str("attachment_id", attachmentId).Str(logging.UserNameField, userName).Msg("Deleting attachment")
+	_, err := reachablePayment(ctx, subscriptionId, paymentId, userName, models.HouseholdAddPayment)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, paymentId).Str(logging.UserNameField, userName).Msg("Error deleting attachment")
+		return err
+	}
+	attachment, err := repository.GetAttachment(ctx, paymentId, attachmentId)
+	if err != nil {
+		return err
+	}
+	store, err := repository.NewBlobStore()
+	if err == nil {
+		err = removeAttachment(ctx, store, attachment)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("attachment_id", attachmentId).Msg("Error deleting attachment")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Str("attachment_id", attachmentId).Msg("Attachment deleted")
+	return nil
+}
+
+func deletePaymentAttachments(ctx context.Context, paymentId string) error {
+	/*
+		Deletes every attachment of a payment along with its file.
+		Params: ctx context.Context
+				paymentId string
+		Return: error
+	*/
+	attachments, err := repository.GetPaymentAttachments(ctx, paymentId)
+	if err != nil || len(attachments) == 0 {
+		return err
+	}
+	store, err := repository.NewBlobStore()
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		err = removeAttachment(ctx, store, attachment)
+		if err != nil {
+			return err
+		}
+	}
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, paymentId).Int("attachment_count", len(attachments)).Msg("Payment attachments deleted")
+	return nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+func GetSubscriptionHistory(ctx context.Context, subscriptionId string, userName string) ([]models.AuditEntry, error) {
+	/*
+		Returns the audit entries of a subscription and its payments, newest
+		first. The history of a deleted subscription stays readable by its
+		owner, or by the members of its household.
+		Params: ctx context.Context
+				subscriptionId string
+				userName string
+		Return: []models.AuditEntry, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Getting subscription history")
+	_, err := subscriptionPartition(ctx, subscriptionId, userName, models.HouseholdView)
+	if err != nil && err.Error() != "404" {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error getting subscription history")
+		return nil, err
+	}
+	entries, historyErr := repository.GetSubscriptionHistory(ctx, subscriptionId)
+	if historyErr != nil {
+		return nil, historyErr
+	}
+	if err != nil {
+		err = authorizeDeletedSubscription(ctx, entries, userName)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error getting subscription history")
+			return nil, err
+		}
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Int("entry_count", len(entries)).Msg("Subscription history retrieved")
+	return entries, nil
+}
+
+func authorizeDeletedSubscription(ctx context.Context, entries []models.AuditEntry, userName string) error {
+	/*
+		Checks that a user could view a subscription that no longer exists,
+		using the partition recorded in its audit entries.
+		Params: ctx context.Context
+				entries []models.AuditEntry
+				userName string
+		Return: error
+	*/
+	for _, entry := range entries {
+		if entry.Partition == "" {
+			continue
+		}
+		if entry.Partition == userName {
+			return nil
+		}
+		if householdId, ok := strings.CutPrefix(entry.Partition, config.HOUSEHOLD_PARTITION_PREFIX); ok {
+			_, err := authorizeHousehold(ctx, householdId, userName, models.HouseholdView)
+			return err
+		}
+		break
+	}
+	return errors.New("404")
+}
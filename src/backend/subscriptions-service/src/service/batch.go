@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// errBatchConflict is the error of a change whose subscription was deleted
+// while the batch was being written
+var errBatchConflict = errors.New("the subscription was changed or deleted concurrently")
+
+func batchAction(op models.BatchOperationType) models.HouseholdAction {
+	/*
+		Returns the household action a batch operation needs.
+		Params: op models.BatchOperationType
+		Return: models.HouseholdAction
+	*/
+	if op == models.BatchDelete {
+		return models.HouseholdDelete
+	}
+	return models.HouseholdEdit
+}
+
+func batchStatusCode(err error) int {
+	/*
+		Returns the HTTP status code reported for a failed operation.
+		Params: err error
+		Return: int
+	*/
+	switch {
+	case errors.Is(err, ErrInvalidBatch), errors.Is(err, ErrInvalidCategory), errors.Is(err, ErrInvalidSubscription):
+		return 400
+	case errors.Is(err, ErrForbidden):
+		return 403
+	case err.Error() == "404":
+		return 404
+	case errors.Is(err, errBatchConflict):
+		return 409
+	}
+	return 500
+}
+
+func batchErrorMessage(err error) string {
+	/*
+		Returns the error reported for a failed operation.
+		Params: err error
+		Return: string
+	*/
+	switch batchStatusCode(err) {
+	case 404:
+		return "subscription not found"
+	case 500:
+		return "internal error"
+	}
+	return err.Error()
+}
+
+func applySubscriptionChanges(item *models.SubscriptionDynamodb, changes models.SubscriptionChanges, categories []models.Category) error {
+	/*
+		Applies the changes of an update operation to a subscription. The
+		category may be given by id or name, and the catalog plan is relinked
+		when the plan, cost or billing cycle changes.
+		Params: item *models.SubscriptionDynamodb
+				changes models.SubscriptionChanges
+				categories []models.Category (of the subscription's owner)
+		Return: error
+	*/
+	if changes.Name != nil {
+		if strings.TrimSpace(*changes.Name) == "" {
+			return fmt.Errorf("%w: name cannot be empty", ErrInvalidBatch)
+		}
+		item.Name = strings.TrimSpace(*changes.Name)
+	}
+	if changes.Cost != nil {
+		if *changes.Cost < 0 {
+			return fmt.Errorf("%w: cost cannot be negative", ErrInvalidBatch)
+		}
+		item.Cost = *changes.Cost
+	}
+	if changes.Currency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*changes.Currency))
+		if len(currency) != 3 {
+			return fmt.Errorf("%w: currency must be an ISO 4217 code", ErrInvalidBatch)
+		}
+		item.Currency = currency
+	}
+	if changes.BillingCycle != nil {
+		cycle := models.BillingCycle(*changes.BillingCycle)
+		if !cycle.IsValid() {
+			return fmt.Errorf("%w: unknown billing cycle %q", ErrInvalidBatch, cycle)
+		}
+		item.BillingCycle = cycle
+	}
+	if changes.Category != nil {
+		category, err := resolveCategory(categories, models.SubscriptionCategory(*changes.Category))
+		if err != nil {
+			return err
+		}
+		if category == "" {
+			category = models.Other
+		}
+		item.Category = category
+	}
+	if changes.Tags != nil {
+		tags, err := normalizeTags(*changes.Tags)
+		if err != nil {
+			return err
+		}
+		item.Tags = tags
+	}
+	if changes.StartDate != nil {
+		item.StartDate = *changes.StartDate
+	}
+	if changes.LastPaymentDate != nil {
+		item.LastPaymentDate = *changes.LastPaymentDate
+	}
+	if changes.TrialEndDate != nil {
+		item.TrialEndDate = *changes.TrialEndDate
+	}
+	if changes.Plan != nil {
+		item.Plan = *changes.Plan
+	}
+	if changes.LastUsedDate != nil {
+		item.LastUsedDate = *changes.LastUsedDate
+	}
+	if changes.PaymentMethodId != nil {
+		item.PaymentMethodId = *changes.PaymentMethodId
+	}
+	if changes.CancelAt != nil {
+		err := validateCancelAt(*changes.CancelAt)
+		if err != nil {
+			return err
+		}
+		item.CancelAt = *changes.CancelAt
+	}
+	if changes.PriceChanges != nil {
+		priceChanges, err := normalizePriceChanges(*changes.PriceChanges)
+		if err != nil {
+			return err
+		}
+		item.PriceChanges = priceChanges
+	}
+	if changes.Plan != nil || changes.Cost != nil || changes.BillingCycle != nil || changes.Currency != nil {
+		if vendor, ok := subscriptionVendor(*item); ok {
+			item.PlanId = ""
+			if plan, ok := matchVendorPlan(vendor, item.Plan, item.Cost, billingCycleOf(*item), item.Currency); ok {
+				item.PlanId = plan.Id
+			}
+		}
+	}
+	return nil
+}
+
+func prepareBatchOperation(ctx context.Context, operation models.BatchOperation, userName string, categories map[string][]models.Category) (models.SubscriptionWrite, error) {
+	/*
+		Checks a batch operation and returns the change it makes.
+		Params: ctx context.Context
+				operation models.BatchOperation
+				userName string
+				categories map[string][]models.Category (loaded categories by partition)
+		Return: models.SubscriptionWrite, error
+	*/
+	switch operation.Op {
+	case models.BatchUpdate:
+		if operation.Changes == nil {
+			return models.SubscriptionWrite{}, fmt.Errorf("%w: an update needs changes", ErrInvalidBatch)
+		}
+	case models.BatchSetStatus:
+		if !operation.Status.IsValid() {
+			return models.SubscriptionWrite{}, fmt.Errorf("%w: unknown status %q", ErrInvalidBatch, operation.Status)
+		}
+	case models.BatchDelete:
+	default:
+		return models.SubscriptionWrite{}, fmt.Errorf("%w: unknown operation %q", ErrInvalidBatch, operation.Op)
+	}
+	if operation.SubscriptionId == "" {
+		return models.SubscriptionWrite{}, fmt.Errorf("%w: subscription_id is required", ErrInvalidBatch)
+	}
+
+	partition, err := subscriptionPartition(ctx, operation.SubscriptionId, userName, batchAction(operation.Op))
+	if err != nil {
+		return models.SubscriptionWrite{}, err
+	}
+	before, err := repository.GetSubscription(ctx, partition, operation.SubscriptionId)
+	if err != nil {
+		return models.SubscriptionWrite{}, err
+	}
+	write := models.SubscriptionWrite{Before: before}
+	if operation.Op == models.BatchDelete {
+		return write, nil
+	}
+
+	after := before
+	after.Tags = append([]string(nil), before.Tags...)
+	if operation.Op == models.BatchSetStatus {
+		after.Status = operation.Status
+	} else {
+		if _, ok := categories[partition]; !ok && operation.Changes.Category != nil {
+			categories[partition], err = partitionCategories(ctx, partition)
+			if err != nil {
+				return models.SubscriptionWrite{}, err
+			}
+		}
+		err = applySubscriptionChanges(&after, *operation.Changes, categories[partition])
+		if err == nil && operation.Changes.PaymentMethodId != nil {
+			err = validatePaymentMethodLink(ctx, userName, *operation.Changes.PaymentMethodId)
+		}
+		if err != nil {
+			return models.SubscriptionWrite{}, err
+		}
+	}
+	write.After = &after
+	return write, nil
+}
+
+func BatchSubscriptions(ctx context.Context, input models.BatchInput) (models.BatchResult, error) {
+	/*
+		Runs a list of update, delete and status change operations on the
+		subscriptions a user can reach. In atomic mode the changes are
+		written in one transaction, and none of them when an operation
+		fails. In best effort mode the valid changes are written one by one
+		and each failure is reported with its operation.
+		Params: ctx context.Context
+				input models.BatchInput
+		Return: models.BatchResult, error
+	*/
+	if input.Mode == "" {
+		input.Mode = models.BatchAtomic
+	}
+	if input.Mode != models.BatchAtomic && input.Mode != models.BatchBestEffort {
+		return models.BatchResult{}, fmt.Errorf("%w: mode must be %q or %q", ErrInvalidBatch, models.BatchAtomic, models.BatchBestEffort)
+	}
+	if len(input.Operations) == 0 || len(input.Operations) > config.BATCH_MAX_OPERATIONS {
+		return models.BatchResult{}, fmt.Errorf("%w: a batch holds 1 to %d operations", ErrInvalidBatch, config.BATCH_MAX_OPERATIONS)
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str("mode", string(input.Mode)).Int("operation_count", len(input.Operations)).Msg("Running subscriptions batch")
+
+	result := models.BatchResult{Mode: input.Mode, Results: make([]models.BatchOperationResult, len(input.Operations))}
+	errs := make([]error, len(input.Operations))
+	writes := []models.SubscriptionWrite{}
+	// index of the operation of each write
+	writeOperations := []int{}
+	seen := map[string]bool{}
+	categories := map[string][]models.Category{}
+	for i, operation := range input.Operations {
+		result.Results[i] = models.BatchOperationResult{Index: i, Op: operation.Op, SubscriptionId: operation.SubscriptionId}
+		if operation.SubscriptionId != "" && seen[operation.SubscriptionId] {
+			errs[i] = fmt.Errorf("%w: the subscription is in an earlier operation", ErrInvalidBatch)
+			continue
+		}
+		seen[operation.SubscriptionId] = true
+		write, err := prepareBatchOperation(ctx, operation, input.UserName, categories)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		writes = append(writes, write)
+		writeOperations = append(writeOperations, i)
+	}
+
+	failed := false
+	for _, err := range errs {
+		failed = failed || err != nil
+	}
+	switch {
+	case input.Mode == models.BatchAtomic && failed:
+		// nothing is written
+		writes = nil
+		writeOperations = nil
+	case input.Mode == models.BatchAtomic && len(writes) > 0:
+		reasons, err := repository.TransactSubscriptionWrites(ctx, writes)
+		for w, i := range writeOperations {
+			if err == nil {
+				continue
+			}
+			switch {
+			case len(reasons) == 0:
+				errs[i] = err
+			case w >= len(reasons) || reasons[w] == "None" || reasons[w] == "":
+				// aborted with the transaction
+			case reasons[w] == "ConditionalCheckFailed" || reasons[w] == "TransactionConflict":
+				errs[i] = errBatchConflict
+			default:
+				errs[i] = fmt.Errorf("transaction cancelled: %s", reasons[w])
+			}
+		}
+		failed = err != nil
+	case len(writes) > 0:
+		for w, err := range repository.BatchSubscriptionWrites(ctx, writes) {
+			if errors.Is(err, repository.ErrSubscriptionGone) {
+				err = errBatchConflict
+			}
+			errs[writeOperations[w]] = err
+		}
+	}
+
+	written := map[int]models.SubscriptionWrite{}
+	for w, i := range writeOperations {
+		if errs[i] == nil && !(input.Mode == models.BatchAtomic && failed) {
+			written[i] = writes[w]
+		}
+	}
+	for i := range result.Results {
+		operationResult := &result.Results[i]
+		write, ok := written[i]
+		switch {
+		case ok:
+			operationResult.Status = models.BatchSucceeded
+			operationResult.StatusCode = 200
+			operationResult.Subscription = write.After
+			if write.After == nil {
+				operationResult.StatusCode = 204
+				// the subscription is deleted; what is left behind is only logged
+				deleteSubscriptionData(ctx, write.Before)
+			}
+			result.Succeeded++
+		case errs[i] != nil:
+			operationResult.Status = models.BatchFailed
+			operationResult.StatusCode = batchStatusCode(errs[i])
+			operationResult.Error = batchErrorMessage(errs[i])
+			if operationResult.StatusCode == 500 {
+				log.Ctx(ctx).Error().Err(errs[i]).Str(logging.SubscriptionIdField, operationResult.SubscriptionId).Int("index", i).Msg("Error running batch operation")
+			}
+			result.Failed++
+		default:
+			operationResult.Status = models.BatchAborted
+			operationResult.StatusCode = 409
+			operationResult.Error = "not written because another operation failed"
+			result.Failed++
+		}
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str("mode", string(input.Mode)).Int("succeeded", result.Succeeded).Int("failed", result.Failed).Msg("Subscriptions batch done")
+	return result, nil
+}
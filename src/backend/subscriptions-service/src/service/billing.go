@@ -0,0 +1,125 @@
+package service
+
+import (
+	"subHandler/src/config"
+	"subHandler/src/models"
+	"time"
+)
+
+// cyclesPerYear is the number of charges a billing cycle makes in a year
+var cyclesPerYear = map[models.BillingCycle]float64{
+	models.Weekly:    52,
+	models.Monthly:   12,
+	models.Quarterly: 4,
+	models.Yearly:    1,
+}
+
+func billingCycleOf(subscription models.SubscriptionDynamodb) models.BillingCycle {
+	/*
+		Returns the billing cycle of a subscription, monthly when it is not set.
+		Params: subscription models.SubscriptionDynamodb
+		Return: models.BillingCycle
+	*/
+	if subscription.BillingCycle.IsValid() {
+		return subscription.BillingCycle
+	}
+	return models.Monthly
+}
+
+func annualCost(subscription models.SubscriptionDynamodb) float64 {
+	/*
+		Returns what a subscription costs over a year.
+		Params: subscription models.SubscriptionDynamodb
+		Return: float64
+	*/
+	return float64(subscription.Cost) * cyclesPerYear[billingCycleOf(subscription)]
+}
+
+func monthlyCost(subscription models.SubscriptionDynamodb) float64 {
+	/*
+		Returns the monthly equivalent of a subscription's cost.
+		Params: subscription models.SubscriptionDynamodb
+		Return: float64
+	*/
+	return annualCost(subscription) / 12
+}
+
+func addMonths(date time.Time, months int) time.Time {
+	/*
+		Adds months to a date, clamping the day to the last day of the target
+		month so that a Jan 31 anchor renews on the last day of February.
+		Params: date time.Time
+				months int
+		Return: time.Time
+	*/
+	firstOfMonth := time.Date(date.Year(), date.Month(), 1, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+	target := firstOfMonth.AddDate(0, months, 0)
+	lastDay := target.AddDate(0, 1, -1).Day()
+	day := date.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return target.AddDate(0, 0, day-1)
+}
+
+func addBillingCycles(anchor time.Time, cycle models.BillingCycle, n int) time.Time {
+	/*
+		Returns the date n billing cycles after the anchor date. Months are
+		added to the anchor directly so that renewals do not drift, and end of
+		month anchors renew on the last day of shorter months.
+		Params: anchor time.Time
+				cycle models.BillingCycle
+				n int
+		Return: time.Time
+	*/
+	switch cycle {
+	case models.Weekly:
+		return anchor.AddDate(0, 0, 7*n)
+	case models.Quarterly:
+		return addMonths(anchor, 3*n)
+	case models.Yearly:
+		return addMonths(anchor, 12*n)
+	default:
+		return addMonths(anchor, n)
+	}
+}
+
+func billingAnchor(subscription models.SubscriptionDynamodb) (time.Time, bool) {
+	/*
+		Returns the date the billing cycles of a subscription are counted from:
+		the last payment date, or the start date when there is none.
+		Params: subscription models.SubscriptionDynamodb
+		Return: time.Time, bool
+	*/
+	for _, date := range []string{subscription.LastPaymentDate, subscription.StartDate} {
+		anchor, err := time.Parse(config.DATE_FORMAT, date)
+		if err == nil {
+			return anchor, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func nextRenewal(subscription models.SubscriptionDynamodb, from time.Time) (time.Time, bool) {
+	/*
+		Returns the first renewal of a subscription on or after the given date.
+		Params: subscription models.SubscriptionDynamodb
+				from time.Time
+		Return: time.Time, bool
+	*/
+	anchor, ok := billingAnchor(subscription)
+	if !ok {
+		return time.Time{}, false
+	}
+	cycle := billingCycleOf(subscription)
+	// an anchor in the future is a first charge that has not happened yet
+	if anchor.After(from) {
+		return anchor, true
+	}
+	for n := 1; ; n++ {
+		renewal := addBillingCycles(anchor, cycle, n)
+		if !renewal.Before(from) {
+			return renewal, true
+		}
+	}
+}
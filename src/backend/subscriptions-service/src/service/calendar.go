@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// calendarRules are the RRULEs of each billing cycle
+var calendarRules = map[models.BillingCycle]string{
+	models.Weekly:    "FREQ=WEEKLY",
+	models.Monthly:   "FREQ=MONTHLY",
+	models.Quarterly: "FREQ=MONTHLY;INTERVAL=3",
+	models.Yearly:    "FREQ=YEARLY",
+}
+
+func calendarRule(cycle models.BillingCycle, anchor time.Time) string {
+	/*
+		Returns the RRULE of a billing cycle. Months without the anchor's day
+		would be skipped by a plain monthly or yearly rule, so late anchors
+		renew on the last existing day up to theirs instead.
+		Params: cycle models.BillingCycle
+				anchor time.Time (the date the cycles are counted from)
+		Return: string
+	*/
+	rule := calendarRules[cycle]
+	day := anchor.Day()
+	// a yearly anchor outside February falls on a day its month always has
+	if cycle == models.Weekly || day <= 28 || (cycle == models.Yearly && anchor.Month() != time.February) {
+		return rule
+	}
+	days := make([]string, 0, 4)
+	for d := 28; d <= day; d++ {
+		days = append(days, fmt.Sprint(d))
+	}
+	if cycle == models.Yearly {
+		rule += ";BYMONTH=2"
+	}
+	return rule + ";BYMONTHDAY=" + strings.Join(days, ",") + ";BYSETPOS=-1"
+}
+
+func CreateCalendarToken(ctx context.Context, input models.CalendarTokenInput) (models.CalendarFeedToken, error) {
+	/*
+		Generates a new secret calendar feed token for a user. The previous
+		token of the user, if any, stops working.
+		Params: ctx context.Context
+				input models.CalendarTokenInput
+		Return: models.CalendarFeedToken, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Msg("Creating calendar token")
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error generating calendar token")
+		return models.CalendarFeedToken{}, err
+	}
+
+	reminderDays := config.CALENDAR_DEFAULT_REMINDER_DAYS
+	if input.ReminderDays != nil && *input.ReminderDays >= 0 {
+		reminderDays = *input.ReminderDays
+	}
+	token := models.CalendarFeedToken{
+		UserName:     input.UserName,
+		Token:        base64.RawURLEncoding.EncodeToString(secret),
+		ReminderDays: reminderDays,
+		CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+	res, err := repository.PutCalendarToken(ctx, token)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error creating calendar token")
+		return models.CalendarFeedToken{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Msg("Calendar token created")
+	return res, nil
+}
+
+func RevokeCalendarToken(ctx context.Context, userName string) error {
+	/*
+		Revokes the calendar feed token of a user.
+		Params: ctx context.Context
+				userName string
+		Return: error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Revoking calendar token")
+	err := repository.DeleteCalendarToken(ctx, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error revoking calendar token")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Calendar token revoked")
+	return nil
+}
+
+func escapeICSText(value string) string {
+	/*
+		Escapes a TEXT value as required by RFC 5545.
+		Params: value string
+		Return: string
+	*/
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(value)
+}
+
+func writeICSLine(out *strings.Builder, line string) {
+	/*
+		Writes a content line, folding it at 75 octets as required by RFC 5545.
+		Params: out *strings.Builder
+				line string
+		Return: None
+	*/
+	for len(line) > 75 {
+		cut := 75
+		// never split a multi-byte character
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		out.WriteString(line[:cut] + "\r\n")
+		line = " " + line[cut:]
+	}
+	out.WriteString(line + "\r\n")
+}
+
+func writeICSEvent(out *strings.Builder, uid string, date time.Time, summary string, description string, rule string, reminderDays int) {
+	/*
+		Writes an all-day VEVENT with a VALARM reminderDays before it.
+		Params: out *strings.Builder
+				uid string
+				date time.Time
+				summary string
+				description string
+				rule string (RRULE, empty for a single event)
+				reminderDays int
+		Return: None
+	*/
+	writeICSLine(out, "BEGIN:VEVENT")
+	writeICSLine(out, "UID:"+uid)
+	writeICSLine(out, "DTSTAMP:"+time.Now().UTC().Format("20060102T150405Z"))
+	writeICSLine(out, "DTSTART;VALUE=DATE:"+date.Format("20060102"))
+	writeICSLine(out, "DTEND;VALUE=DATE:"+date.AddDate(0, 0, 1).Format("20060102"))
+	if rule != "" {
+		writeICSLine(out, "RRULE:"+rule)
+	}
+	writeICSLine(out, "SUMMARY:"+escapeICSText(summary))
+	writeICSLine(out, "DESCRIPTION:"+escapeICSText(description))
+	writeICSLine(out, "TRANSP:TRANSPARENT")
+	writeICSLine(out, "BEGIN:VALARM")
+	writeICSLine(out, "ACTION:DISPLAY")
+	writeICSLine(out, fmt.Sprintf("TRIGGER:-P%dD", reminderDays))
+	writeICSLine(out, "DESCRIPTION:"+escapeICSText(summary))
+	writeICSLine(out, "END:VALARM")
+	writeICSLine(out, "END:VEVENT")
+}
+
+func buildCalendar(subscriptions []models.SubscriptionDynamodb, reminderDays int, now time.Time) string {
+	/*
+		Builds the iCalendar feed: a recurring VEVENT starting at the next
+		renewal of every subscription that keeps renewing, until its scheduled
+		end if any, and a VEVENT for every upcoming trial end.
+		Params: subscriptions []models.SubscriptionDynamodb
+				reminderDays int
+				now time.Time
+		Return: string
+	*/
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var out strings.Builder
+	writeICSLine(&out, "BEGIN:VCALENDAR")
+	writeICSLine(&out, "VERSION:2.0")
+	writeICSLine(&out, "PRODID:-//SubHub//Subscription Renewals//EN")
+	writeICSLine(&out, "CALSCALE:GREGORIAN")
+	writeICSLine(&out, "METHOD:PUBLISH")
+	writeICSLine(&out, "X-WR-CALNAME:Subscription renewals")
+
+	for _, subscription := range subscriptions {
+		if !projected(subscription) {
+			continue
+		}
+		currency := subscription.Currency
+		if currency == "" {
+			currency = config.DEFAULT_CURRENCY
+		}
+		cancelAt, err := time.Parse(config.DATE_FORMAT, subscription.CancelAt)
+		cancelled := err == nil
+
+		if renewal, ok := nextRenewal(subscription, today); ok && (!cancelled || renewal.Before(cancelAt)) {
+			cycle := billingCycleOf(subscription)
+			anchor, _ := billingAnchor(subscription)
+			rule := calendarRule(cycle, anchor)
+			if cancelled {
+				// it does not renew on or after the date it is cancelled at
+				rule += ";UNTIL=" + cancelAt.AddDate(0, 0, -1).Format("20060102")
+			}
+			writeICSEvent(&out,
+				subscription.UUID+"-renewal@subhub",
+				renewal,
+				fmt.Sprintf("%s renews (%s %s)", subscription.Name, formatAmount(subscription.Cost), currency),
+				fmt.Sprintf("Your %s %s subscription renews for %s %s.", cycle, subscription.Name, formatAmount(subscription.Cost), currency),
+				rule,
+				reminderDays,
+			)
+		}
+
+		trialEnd, err := time.Parse(config.DATE_FORMAT, subscription.TrialEndDate)
+		if err == nil && !trialEnd.Before(today) && (!cancelled || trialEnd.Before(cancelAt)) {
+			writeICSEvent(&out,
+				subscription.UUID+"-trial-end@subhub",
+				trialEnd,
+				fmt.Sprintf("%s trial ends", subscription.Name),
+				fmt.Sprintf("Your %s trial ends. Cancel before this date to avoid being charged.", subscription.Name),
+				"",
+				reminderDays,
+			)
+		}
+	}
+
+	writeICSLine(&out, "END:VCALENDAR")
+	return out.String()
+}
+
+func GetCalendarFeed(ctx context.Context, token string) (string, error) {
+	/*
+		Returns the iCalendar feed of the user owning the given feed token.
+		Params: ctx context.Context
+				token string
+		Return: string, error
+	*/
+	log.Ctx(ctx).Info().Msg("Getting calendar feed")
+	feedToken, err := repository.GetCalendarTokenByToken(ctx, token)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error getting calendar feed")
+		return "", err
+	}
+	subscriptions, err := repository.GetUserSubscriptions(ctx, feedToken.UserName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, feedToken.UserName).Msg("Error getting calendar feed")
+		return "", err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, feedToken.UserName).Int("subscription_count", len(subscriptions)).Msg("Calendar feed retrieved")
+	return buildCalendar(subscriptions, feedToken.ReminderDays, time.Now().UTC()), nil
+}
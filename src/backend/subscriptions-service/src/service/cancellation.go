@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidCancellation = errors.New("invalid cancellation")
+
+func nextCharge(subscription models.SubscriptionDynamodb, from time.Time) (time.Time, bool) {
+	/*
+		Returns the next charge of a subscription on or after the given
+		date: the end of a running free trial, or else its next renewal.
+		Params: subscription models.SubscriptionDynamodb
+				from time.Time
+		Return: time.Time, bool
+	*/
+	if trialEnd, err := time.Parse(config.DATE_FORMAT, subscription.TrialEndDate); err == nil && !trialEnd.Before(from) {
+		return trialEnd, true
+	}
+	return nextRenewal(subscription, from)
+}
+
+func cancellationSteps(subscription models.SubscriptionDynamodb) (models.Vendor, string, []string) {
+	/*
+		Returns the catalog vendor of a subscription with the settings page
+		and the steps to cancel it. Vendors without steps in the catalog,
+		and subscriptions without a vendor, get generic steps.
+		Params: subscription models.SubscriptionDynamodb
+		Return: models.Vendor, string (settings URL), []string
+	*/
+	vendor, _ := subscriptionVendor(subscription)
+	settingsUrl := subscription.SettingsUrl
+	if settingsUrl == "" {
+		settingsUrl = vendor.SettingsUrl
+	}
+	if len(vendor.CancellationSteps) > 0 {
+		return vendor, settingsUrl, vendor.CancellationSteps
+	}
+	steps := []string{}
+	if settingsUrl != "" {
+		steps = append(steps, fmt.Sprintf("Sign in and open the account settings at %s.", settingsUrl))
+	} else {
+		steps = append(steps, fmt.Sprintf("Sign in to %s and open the account or billing settings.", subscription.Name))
+	}
+	steps = append(steps, "Choose to cancel the subscription or to turn off its automatic renewal.", "Keep the confirmation number or email the vendor sends.")
+	return vendor, settingsUrl, steps
+}
+
+func cancellationDetails(ctx context.Context, subscription models.SubscriptionDynamodb, now time.Time) (models.CancellationDetails, error) {
+	/*
+		Returns the cancellation of a subscription with the current catalog
+		instructions and, once confirmed with a screenshot, a download URL
+		of the screenshot.
+		Params: ctx context.Context
+				subscription models.SubscriptionDynamodb
+				now time.Time
+		Return: models.CancellationDetails, error
+	*/
+	if subscription.Cancellation == nil {
+		return models.CancellationDetails{}, errors.New("404")
+	}
+	vendor, settingsUrl, steps := cancellationSteps(subscription)
+	details := models.CancellationDetails{
+		SubscriptionId: subscription.UUID,
+		Name:           subscription.Name,
+		Cancellation:   *subscription.Cancellation,
+		VendorName:     vendor.Name,
+		SettingsUrl:    settingsUrl,
+		Steps:          steps,
+	}
+	if renewal, ok := nextCharge(subscription, now); ok && subscription.Cancellation.Status == models.CancellationPending {
+		details.NextRenewal = renewal.Format(config.DATE_FORMAT)
+	}
+	if subscription.Cancellation.ScreenshotKey != "" {
+		store, err := repository.NewBlobStore()
+		if err != nil {
+			return models.CancellationDetails{}, err
+		}
+		expiry := config.ATTACHMENT_URL_EXPIRY_MINUTES * time.Minute
+		details.ScreenshotUrl, err = store.DownloadURL(ctx, subscription.Cancellation.ScreenshotKey, "cancellation-"+subscription.UUID, expiry)
+		if err != nil {
+			return models.CancellationDetails{}, err
+		}
+		details.ExpiresAt = now.Add(expiry).Format(time.RFC3339)
+	}
+	return details, nil
+}
+
+func writeCancellation(ctx context.Context, before models.SubscriptionDynamodb, after models.SubscriptionDynamodb) error {
+	/*
+		Stores the changed cancellation of a subscription, failing when the
+		subscription was deleted meanwhile.
+		Params: ctx context.Context
+				before models.SubscriptionDynamodb
+				after models.SubscriptionDynamodb
+		Return: error
+	*/
+	reasons, err := repository.TransactSubscriptionWrites(ctx, []models.SubscriptionWrite{{Before: before, After: &after}})
+	if len(reasons) > 0 && reasons[0] == "ConditionalCheckFailed" {
+		return errors.New("404")
+	}
+	return err
+}
+
+func StartCancellation(ctx context.Context, subscriptionId string, input models.CancellationStartInput) (models.CancellationDetails, error) {
+	/*
+		Starts the cancellation of a subscription: records the day it has to
+		be cancelled by, the day before its next charge unless given, and
+		returns the vendor's instructions. The alerter reminds the user of
+		it until the cancellation is confirmed. Starting again moves the
+		cancel-by date of a pending cancellation.
+		Params: ctx context.Context
+				subscriptionId string
+				input models.CancellationStartInput
+		Return: models.CancellationDetails, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, input.UserName).Msg("Starting cancellation")
+	partition, err := subscriptionPartition(ctx, subscriptionId, input.UserName, models.HouseholdEdit)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error starting cancellation")
+		return models.CancellationDetails{}, err
+	}
+	before, err := repository.GetSubscription(ctx, partition, subscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error starting cancellation")
+		return models.CancellationDetails{}, err
+	}
+	if before.Status == models.StatusCancelled || (before.Cancellation != nil && before.Cancellation.Status == models.CancellationConfirmed) {
+		return models.CancellationDetails{}, fmt.Errorf("%w: the subscription is already cancelled", ErrInvalidCancellation)
+	}
+
+	now := time.Now().UTC()
+	today := now.Format(config.DATE_FORMAT)
+	cancelBy := input.CancelBy
+	if cancelBy == "" {
+		cancelBy = today
+		if charge, ok := nextCharge(before, now.Truncate(24*time.Hour)); ok {
+			cancelBy = charge.AddDate(0, 0, -config.CANCELLATION_RENEWAL_MARGIN_DAYS).Format(config.DATE_FORMAT)
+		}
+		if cancelBy < today {
+			cancelBy = today
+		}
+	} else if _, err := time.Parse(config.DATE_FORMAT, cancelBy); err != nil || cancelBy < today {
+		return models.CancellationDetails{}, fmt.Errorf("%w: cancel_by must be a YYYY-MM-DD date from today on", ErrInvalidCancellation)
+	}
+
+	_, settingsUrl, steps := cancellationSteps(before)
+	cancellation := models.SubscriptionCancellation{
+		Status:      models.CancellationPending,
+		CancelBy:    cancelBy,
+		RequestedBy: input.UserName,
+		RequestedAt: now.Format(time.RFC3339),
+		SettingsUrl: settingsUrl,
+		Steps:       steps,
+	}
+	after := before
+	after.Cancellation = &cancellation
+	err = writeCancellation(ctx, before, after)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error starting cancellation")
+		return models.CancellationDetails{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str("cancel_by", cancelBy).Msg("Cancellation started")
+	return cancellationDetails(ctx, after, now)
+}
+
+func GetCancellation(ctx context.Context, subscriptionId string, userName string) (models.CancellationDetails, error) {
+	/*
+		Returns the cancellation of a subscription with the instructions to
+		do it.
+		Params: ctx context.Context
+				subscriptionId string
+				userName string
+		Return: models.CancellationDetails, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Getting cancellation")
+	partition, err := subscriptionPartition(ctx, subscriptionId, userName, models.HouseholdView)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error getting cancellation")
+		return models.CancellationDetails{}, err
+	}
+	subscription, err := repository.GetSubscription(ctx, partition, subscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error getting cancellation")
+		return models.CancellationDetails{}, err
+	}
+	return cancellationDetails(ctx, subscription, time.Now().UTC())
+}
+
+func cancellationScreenshot(content string, contentType string) ([]byte, string, error) {
+	/*
+		Decodes the screenshot of a confirmation, which must be an image of
+		the declared type.
+		Params: content string (base64)
+				contentType string
+		Return: []byte, string (media type), error
+	*/
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return nil, "", fmt.Errorf("%w: screenshot_content_type must be an image type", ErrInvalidCancellation)
+	}
+	screenshot, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: screenshot is not base64 encoded", ErrInvalidCancellation)
+	}
+	if len(screenshot) > config.ATTACHMENT_MAX_SIZE {
+		return nil, "", fmt.Errorf("%w: screenshots are limited to %d MB", ErrInvalidCancellation, config.ATTACHMENT_MAX_SIZE>>20)
+	}
+	if sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(screenshot)); sniffed != mediaType {
+		return nil, "", fmt.Errorf("%w: screenshot is %s, not %s", ErrInvalidCancellation, sniffed, mediaType)
+	}
+	return screenshot, mediaType, nil
+}
+
+func ConfirmCancellation(ctx context.Context, subscriptionId string, input models.CancellationConfirmInput) (models.CancellationDetails, error) {
+	/*
+		Confirms that a subscription was cancelled with the vendor, storing
+		the vendor's confirmation number and an optional screenshot. The
+		subscription becomes cancelled and ends on the given day, by default
+		when its paid period ends, which stops the reminders.
+		Params: ctx context.Context
+				subscriptionId string
+				input models.CancellationConfirmInput
+		Return: models.CancellationDetails, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, input.UserName).Msg("Confirming cancellation")
+	confirmationNumber := strings.TrimSpace(input.ConfirmationNumber)
+	if confirmationNumber == "" || len(confirmationNumber) > config.CANCELLATION_NUMBER_MAX_LENGTH {
+		return models.CancellationDetails{}, fmt.Errorf("%w: confirmation_number must hold 1 to %d characters", ErrInvalidCancellation, config.CANCELLATION_NUMBER_MAX_LENGTH)
+	}
+	if input.EndsOn != "" {
+		if _, err := time.Parse(config.DATE_FORMAT, input.EndsOn); err != nil {
+			return models.CancellationDetails{}, fmt.Errorf("%w: ends_on must be YYYY-MM-DD", ErrInvalidCancellation)
+		}
+	}
+	var screenshot []byte
+	contentType := ""
+	if input.Screenshot != "" {
+		var err error
+		screenshot, contentType, err = cancellationScreenshot(input.Screenshot, input.ScreenshotContentType)
+		if err != nil {
+			return models.CancellationDetails{}, err
+		}
+	}
+
+	partition, err := subscriptionPartition(ctx, subscriptionId, input.UserName, models.HouseholdEdit)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error confirming cancellation")
+		return models.CancellationDetails{}, err
+	}
+	before, err := repository.GetSubscription(ctx, partition, subscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error confirming cancellation")
+		return models.CancellationDetails{}, err
+	}
+	if before.Cancellation == nil || before.Cancellation.Status != models.CancellationPending {
+		return models.CancellationDetails{}, fmt.Errorf("%w: the subscription has no pending cancellation", ErrInvalidCancellation)
+	}
+
+	now := time.Now().UTC()
+	cancellation := *before.Cancellation
+	cancellation.Status = models.CancellationConfirmed
+	cancellation.ConfirmedBy = input.UserName
+	cancellation.ConfirmedAt = now.Format(time.RFC3339)
+	cancellation.ConfirmationNumber = confirmationNumber
+	cancellation.EndsOn = input.EndsOn
+	if cancellation.EndsOn == "" {
+		cancellation.EndsOn = now.Format(config.DATE_FORMAT)
+		if charge, ok := nextCharge(before, now.Truncate(24*time.Hour)); ok {
+			cancellation.EndsOn = charge.Format(config.DATE_FORMAT)
+		}
+	}
+	if screenshot != nil {
+		store, err := repository.NewBlobStore()
+		if err == nil {
+			cancellation.ScreenshotKey = config.CANCELLATION_SCREENSHOT_KEY_PREFIX + subscriptionId + "/" + uuid.New().String()
+			cancellation.ScreenshotContentType = contentType
+			err = store.Put(ctx, cancellation.ScreenshotKey, contentType, screenshot)
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error storing cancellation screenshot")
+			return models.CancellationDetails{}, err
+		}
+	}
+
+	after := before
+	after.Cancellation = &cancellation
+	after.Status = models.StatusCancelled
+	after.CancelAt = cancellation.EndsOn
+	err = writeCancellation(ctx, before, after)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error confirming cancellation")
+		return models.CancellationDetails{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str("ends_on", cancellation.EndsOn).Msg("Cancellation confirmed")
+	return cancellationDetails(ctx, after, now)
+}
+
+func AbandonCancellation(ctx context.Context, subscriptionId string, userName string) error {
+	/*
+		Drops the pending cancellation of a subscription that is kept after
+		all. A confirmed cancellation cannot be dropped.
+		Params: ctx context.Context
+				subscriptionId string
+				userName string
+		Return: error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Abandoning cancellation")
+	partition, err := subscriptionPartition(ctx, subscriptionId, userName, models.HouseholdEdit)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error abandoning cancellation")
+		return err
+	}
+	before, err := repository.GetSubscription(ctx, partition, subscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error abandoning cancellation")
+		return err
+	}
+	if before.Cancellation == nil {
+		return errors.New("404")
+	}
+	if before.Cancellation.Status != models.CancellationPending {
+		return fmt.Errorf("%w: a confirmed cancellation cannot be abandoned", ErrInvalidCancellation)
+	}
+	after := before
+	after.Cancellation = nil
+	err = writeCancellation(ctx, before, after)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error abandoning cancellation")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Msg("Cancellation abandoned")
+	return nil
+}
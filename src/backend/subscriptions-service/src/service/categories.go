@@ -0,0 +1,566 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidCategory = errors.New("invalid category")
+
+// builtInCategories are the default name and color of every built-in category
+var builtInCategories = map[models.SubscriptionCategory]models.Category{
+	models.OTT:       {Name: "Streaming", Color: "#E50914"},
+	models.Music:     {Name: "Music", Color: "#1DB954"},
+	models.Gaming:    {Name: "Gaming", Color: "#107C10"},
+	models.Delivery:  {Name: "Delivery", Color: "#FF8000"},
+	models.Fitness:   {Name: "Fitness", Color: "#00B2A9"},
+	models.Education: {Name: "Education", Color: "#0056D2"},
+	models.Magazine:  {Name: "Magazines", Color: "#8E44AD"},
+	models.Software:  {Name: "Software", Color: "#0078D4"},
+	models.Finance:   {Name: "Finance", Color: "#2E7D32"},
+	models.Fashion:   {Name: "Fashion", Color: "#D81B60"},
+	models.Other:     {Name: "Other", Color: "#9E9E9E"},
+}
+
+// customCategoryColor is the color of a custom category created without one
+const customCategoryColor = "#607D8B"
+
+var colorRegex = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+var tagRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+func normalizeTags(tags []string) ([]string, error) {
+	/*
+		Lower-cases the tags, turns spaces into dashes, drops duplicates and
+		sorts them, failing with ErrInvalidCategory on a malformed tag.
+		Params: tags []string
+		Return: []string, error
+	*/
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > config.TAG_MAX_LENGTH || !tagRegex.MatchString(tag) {
+			return nil, fmt.Errorf("%w: tag %q must be up to %d letters, digits, dashes or underscores", ErrInvalidCategory, tag, config.TAG_MAX_LENGTH)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > config.SUBSCRIPTION_MAX_TAGS {
+		return nil, fmt.Errorf("%w: a subscription can have up to %d tags", ErrInvalidCategory, config.SUBSCRIPTION_MAX_TAGS)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func categoryPartition(ctx context.Context, userName string, householdId string, action models.HouseholdAction) (string, error) {
+	/*
+		Returns the owner of the categories being managed: the user, or the
+		subscriptions partition of a household whose member may perform the action.
+		Params: ctx context.Context
+				userName string
+				householdId string
+				action models.HouseholdAction
+		Return: string, error
+	*/
+	if householdId == "" {
+		return userName, nil
+	}
+	_, err := authorizeHousehold(ctx, householdId, userName, action)
+	if err != nil {
+		return "", err
+	}
+	return householdPartition(householdId), nil
+}
+
+func partitionCategories(ctx context.Context, partition string) ([]models.Category, error) {
+	/*
+		Returns the categories of a partition: the built-in categories, with
+		the name and color the owner gave them, followed by the custom
+		categories sorted by name.
+		Params: ctx context.Context
+				partition string
+		Return: []models.Category, error
+	*/
+	stored, err := repository.GetCategories(ctx, partition)
+	if err != nil {
+		return nil, err
+	}
+	overrides := map[models.SubscriptionCategory]models.Category{}
+	custom := []models.Category{}
+	for _, category := range stored {
+		if category.CategoryId.IsValid() {
+			overrides[category.CategoryId] = category
+			continue
+		}
+		category.BuiltIn = false
+		custom = append(custom, category)
+	}
+	sort.Slice(custom, func(i, j int) bool { return strings.ToLower(custom[i].Name) < strings.ToLower(custom[j].Name) })
+
+	categories := []models.Category{}
+	for _, id := range models.SubscriptionCategories {
+		category := builtInCategories[id]
+		category.UserName = partition
+		category.CategoryId = id
+		category.BuiltIn = true
+		if override, ok := overrides[id]; ok {
+			category.Name = override.Name
+			category.Color = override.Color
+			category.CreatedAt = override.CreatedAt
+		}
+		categories = append(categories, category)
+	}
+	return append(categories, custom...), nil
+}
+
+func findCategory(categories []models.Category, value string) (models.Category, bool) {
+	/*
+		Finds a category by id, by legacy value or by name, ignoring case.
+		Params: categories []models.Category
+				value string
+		Return: models.Category, bool
+	*/
+	id := models.SubscriptionCategory(value).Normalize()
+	for _, category := range categories {
+		if category.CategoryId == id {
+			return category, true
+		}
+	}
+	for _, category := range categories {
+		if strings.EqualFold(category.Name, strings.TrimSpace(value)) {
+			return category, true
+		}
+	}
+	return models.Category{}, false
+}
+
+func resolveCategory(categories []models.Category, value models.SubscriptionCategory) (models.SubscriptionCategory, error) {
+	/*
+		Returns the id of the category a subscription is filed under, given
+		its id or name. An empty value stays empty so that the vendor's
+		category or Other can be filled in.
+		Params: categories []models.Category
+				value models.SubscriptionCategory
+		Return: models.SubscriptionCategory, error
+	*/
+	if strings.TrimSpace(string(value)) == "" {
+		return "", nil
+	}
+	category, ok := findCategory(categories, string(value))
+	if !ok {
+		return "", fmt.Errorf("%w: unknown category %q", ErrInvalidCategory, value)
+	}
+	return category.CategoryId, nil
+}
+
+func categoryIndex(categories []models.Category) map[models.SubscriptionCategory]models.Category {
+	/*
+		Indexes categories by id.
+		Params: categories []models.Category
+		Return: map[models.SubscriptionCategory]models.Category
+	*/
+	index := map[models.SubscriptionCategory]models.Category{}
+	for _, category := range categories {
+		index[category.CategoryId] = category
+	}
+	return index
+}
+
+func subscriptionCategories(ctx context.Context, userName string, subscriptions []models.SubscriptionDynamodb) ([]models.Category, error) {
+	/*
+		Returns the categories the subscriptions of a user's reports are filed
+		under: the user's own, and the custom categories of their households.
+		Params: ctx context.Context
+				userName string
+				subscriptions []models.SubscriptionDynamodb
+		Return: []models.Category, error
+	*/
+	categories, err := partitionCategories(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	loaded := map[string]bool{userName: true}
+	for _, subscription := range subscriptions {
+		if subscription.HouseholdId == "" || loaded[subscription.UserName] {
+			continue
+		}
+		loaded[subscription.UserName] = true
+		householdCategories, err := partitionCategories(ctx, subscription.UserName)
+		if err != nil {
+			return nil, err
+		}
+		for _, category := range householdCategories {
+			if !category.BuiltIn {
+				categories = append(categories, category)
+			}
+		}
+	}
+	return categories, nil
+}
+
+func ListCategories(ctx context.Context, userName string, householdId string) ([]models.Category, error) {
+	/*
+		Returns the categories of a user, or of one of their households.
+		Params: ctx context.Context
+				userName string
+				householdId string (empty for the user's own categories)
+		Return: []models.Category, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str(logging.HouseholdIdField, householdId).Msg("Listing categories")
+	partition, err := categoryPartition(ctx, userName, householdId, models.HouseholdView)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error listing categories")
+		return nil, err
+	}
+	categories, err := partitionCategories(ctx, partition)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error listing categories")
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("category_count", len(categories)).Msg("Categories listed")
+	return categories, nil
+}
+
+func validateCategory(categories []models.Category, category models.Category) error {
+	/*
+		Checks the name and color of a category, and that no other category
+		of the partition has the same name.
+		Params: categories []models.Category
+				category models.Category
+		Return: error
+	*/
+	if category.Name == "" || len(category.Name) > config.CATEGORY_NAME_MAX_LENGTH {
+		return fmt.Errorf("%w: the name must have between 1 and %d characters", ErrInvalidCategory, config.CATEGORY_NAME_MAX_LENGTH)
+	}
+	if !colorRegex.MatchString(category.Color) {
+		return fmt.Errorf("%w: color %q must be a hex color such as #1DB954", ErrInvalidCategory, category.Color)
+	}
+	for _, other := range categories {
+		if other.CategoryId != category.CategoryId && strings.EqualFold(other.Name, category.Name) {
+			return fmt.Errorf("%w: a category named %q already exists", ErrInvalidCategory, other.Name)
+		}
+	}
+	return nil
+}
+
+func CreateCategory(ctx context.Context, input models.CategoryCreateInput) (models.Category, error) {
+	/*
+		Creates a custom category for a user, or for a household they may edit.
+		Params: ctx context.Context
+				input models.CategoryCreateInput
+		Return: models.Category, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str(logging.HouseholdIdField, input.HouseholdId).Msg("Creating category")
+	partition, err := categoryPartition(ctx, input.UserName, input.HouseholdId, models.HouseholdEdit)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error creating category")
+		return models.Category{}, err
+	}
+	categories, err := partitionCategories(ctx, partition)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error creating category")
+		return models.Category{}, err
+	}
+	category := models.Category{
+		UserName:   partition,
+		CategoryId: models.SubscriptionCategory(uuid.New().String()),
+		Name:       strings.TrimSpace(input.Name),
+		Color:      input.Color,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	if category.Color == "" {
+		category.Color = customCategoryColor
+	}
+	err = validateCategory(categories, category)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error creating category")
+		return models.Category{}, err
+	}
+	category, err = repository.PutCategory(ctx, category)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error creating category")
+		return models.Category{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str("category_id", string(category.CategoryId)).Msg("Category created")
+	return category, nil
+}
+
+func UpdateCategory(ctx context.Context, categoryId string, input models.CategoryUpdateInput) (models.Category, error) {
+	/*
+		Renames or recolors a category. Built-in categories can be renamed
+		and recolored too; their id stays the same.
+		Params: ctx context.Context
+				categoryId string
+				input models.CategoryUpdateInput
+		Return: models.Category, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str("category_id", categoryId).Msg("Updating category")
+	partition, err := categoryPartition(ctx, input.UserName, input.HouseholdId, models.HouseholdEdit)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error updating category")
+		return models.Category{}, err
+	}
+	categories, err := partitionCategories(ctx, partition)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error updating category")
+		return models.Category{}, err
+	}
+	category, ok := categoryIndex(categories)[models.SubscriptionCategory(categoryId).Normalize()]
+	if !ok {
+		log.Ctx(ctx).Error().Str(logging.UserNameField, input.UserName).Str("category_id", categoryId).Msg("Error updating category. No category found.")
+		return models.Category{}, errors.New("404")
+	}
+	if input.Name != "" {
+		category.Name = strings.TrimSpace(input.Name)
+	}
+	if input.Color != "" {
+		category.Color = input.Color
+	}
+	err = validateCategory(categories, category)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error updating category")
+		return models.Category{}, err
+	}
+	if category.CreatedAt == "" {
+		category.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	category, err = repository.PutCategory(ctx, category)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error updating category")
+		return models.Category{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str("category_id", categoryId).Msg("Category updated")
+	return category, nil
+}
+
+func MergeCategory(ctx context.Context, categoryId string, input models.CategoryMergeInput) (models.CategoryMergeResult, error) {
+	/*
+		Moves every subscription of a category into another one, then
+		deletes the merged category unless it is built-in.
+		Params: ctx context.Context
+				categoryId string
+				input models.CategoryMergeInput
+		Return: models.CategoryMergeResult, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str("category_id", categoryId).Str("into", string(input.Into)).Msg("Merging category")
+	partition, err := categoryPartition(ctx, input.UserName, input.HouseholdId, models.HouseholdEdit)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error merging category")
+		return models.CategoryMergeResult{}, err
+	}
+	categories, err := partitionCategories(ctx, partition)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error merging category")
+		return models.CategoryMergeResult{}, err
+	}
+	index := categoryIndex(categories)
+	source, ok := index[models.SubscriptionCategory(categoryId).Normalize()]
+	if !ok {
+		log.Ctx(ctx).Error().Str(logging.UserNameField, input.UserName).Str("category_id", categoryId).Msg("Error merging category. No category found.")
+		return models.CategoryMergeResult{}, errors.New("404")
+	}
+	target, ok := findCategory(categories, string(input.Into))
+	if !ok || target.CategoryId == source.CategoryId {
+		return models.CategoryMergeResult{}, fmt.Errorf("%w: %q is not another category to merge into", ErrInvalidCategory, input.Into)
+	}
+
+	subscriptions, err := repository.GetUserSubscriptions(ctx, partition)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error merging category")
+		return models.CategoryMergeResult{}, err
+	}
+	result := models.CategoryMergeResult{Into: target}
+	for _, subscription := range subscriptions {
+		if subscription.Category != source.CategoryId {
+			continue
+		}
+		err = repository.UpdateSubscriptionCategory(ctx, partition, subscription.UUID, target.CategoryId)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error merging category")
+			return models.CategoryMergeResult{}, err
+		}
+		result.MovedSubscriptions++
+	}
+	if !source.BuiltIn {
+		err = repository.DeleteCategory(ctx, partition, source.CategoryId)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error merging category")
+			return models.CategoryMergeResult{}, err
+		}
+		result.Deleted = true
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str("category_id", categoryId).Int("moved_subscriptions", result.MovedSubscriptions).Msg("Category merged")
+	return result, nil
+}
+
+func DeleteCategory(ctx context.Context, categoryId string, userName string, householdId string) error {
+	/*
+		Deletes a custom category, moving its subscriptions to Other.
+		Built-in categories cannot be deleted.
+		Params: ctx context.Context
+				categoryId string
+				userName string
+				householdId string
+		Return: error
+	*/
+	if models.SubscriptionCategory(categoryId).Normalize().IsValid() {
+		return fmt.Errorf("%w: built-in categories cannot be deleted", ErrInvalidCategory)
+	}
+	_, err := MergeCategory(ctx, categoryId, models.CategoryMergeInput{UserName: userName, HouseholdId: householdId, Into: models.Other})
+	return err
+}
+
+func matchesFilter(subscription models.SubscriptionDynamodb, filter models.SubscriptionFilter) bool {
+	/*
+		Tells whether a subscription is in the filtered category and carries
+		all the filtered tags.
+		Params: subscription models.SubscriptionDynamodb
+				filter models.SubscriptionFilter
+		Return: bool
+	*/
+	if filter.Category != "" && subscription.Category != filter.Category.Normalize() {
+		return false
+	}
+	for _, tag := range filter.Tags {
+		found := false
+		for _, subscriptionTag := range subscription.Tags {
+			if subscriptionTag == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func filterSubscriptions(subscriptions []models.SubscriptionDynamodb, filter models.SubscriptionFilter) []models.SubscriptionDynamodb {
+	/*
+		Returns the subscriptions matching a filter.
+		Params: subscriptions []models.SubscriptionDynamodb
+				filter models.SubscriptionFilter
+		Return: []models.SubscriptionDynamodb
+	*/
+	filtered := []models.SubscriptionDynamodb{}
+	for _, subscription := range subscriptions {
+		if matchesFilter(subscription, filter) {
+			filtered = append(filtered, subscription)
+		}
+	}
+	return filtered
+}
+
+func SummarizeSubscriptions(ctx context.Context, userName string, groupBy models.SubscriptionGroupBy, filter models.SubscriptionFilter, includeTax bool) (models.SubscriptionSummary, error) {
+	/*
+		Groups the subscriptions of a user by category or by tag, with the
+		monthly and annual cost of every group, and optionally the tax of
+		the group's payments per quarter. A subscription with several tags
+		counts in each of their groups; the ones without tags are grouped
+		under an empty key.
+		Params: ctx context.Context
+				userName string
+				groupBy models.SubscriptionGroupBy
+				filter models.SubscriptionFilter
+				includeTax bool
+		Return: models.SubscriptionSummary, error
+	*/
+	if groupBy != models.GroupByCategory && groupBy != models.GroupByTag {
+		return models.SubscriptionSummary{}, fmt.Errorf("%w: subscriptions are grouped by category or tag", ErrInvalidCategory)
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("group_by", string(groupBy)).Msg("Summarizing subscriptions")
+	subscriptions, err := GetUserSubscriptions(ctx, userName, filter)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error summarizing subscriptions")
+		return models.SubscriptionSummary{}, err
+	}
+	categories, err := subscriptionCategories(ctx, userName, subscriptions)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error summarizing subscriptions")
+		return models.SubscriptionSummary{}, err
+	}
+	index := categoryIndex(categories)
+
+	groups := map[string]*models.SubscriptionGroup{}
+	groupTaxes := map[string]taxTotals{}
+	keys := []string{}
+	add := func(key string, subscription models.SubscriptionDynamodb, payments []models.PaymentDynamodb) {
+		group, ok := groups[key]
+		if !ok {
+			group = &models.SubscriptionGroup{Key: key, Name: key, SubscriptionIds: []string{}, MonthlyCosts: map[string]float32{}, AnnualCosts: map[string]float32{}}
+			if groupBy == models.GroupByCategory {
+				if category, ok := index[models.SubscriptionCategory(key)]; ok {
+					group.Name = category.Name
+					group.Color = category.Color
+				}
+			} else if key == "" {
+				group.Name = "Untagged"
+			}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		currency := subscription.Currency
+		if currency == "" {
+			currency = config.DEFAULT_CURRENCY
+		}
+		group.SubscriptionCount++
+		group.SubscriptionIds = append(group.SubscriptionIds, subscription.UUID)
+		group.MonthlyCosts[currency] = roundCents(float64(group.MonthlyCosts[currency]) + monthlyCost(subscription))
+		group.AnnualCosts[currency] = roundCents(float64(group.AnnualCosts[currency]) + annualCost(subscription))
+		if includeTax {
+			if groupTaxes[key] == nil {
+				groupTaxes[key] = taxTotals{}
+			}
+			for _, payment := range payments {
+				groupTaxes[key].add(payment, currency, shareFraction(subscription))
+			}
+		}
+	}
+	for _, subscription := range subscriptions {
+		var payments []models.PaymentDynamodb
+		if includeTax {
+			payments, err = repository.GetSubscriptionPayments(ctx, subscription.UUID)
+			if err != nil {
+				log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error summarizing subscriptions")
+				return models.SubscriptionSummary{}, err
+			}
+		}
+		if groupBy == models.GroupByCategory {
+			add(string(subscription.Category), subscription, payments)
+			continue
+		}
+		if len(subscription.Tags) == 0 {
+			add("", subscription, payments)
+		}
+		for _, tag := range subscription.Tags {
+			add(tag, subscription, payments)
+		}
+	}
+
+	sort.Strings(keys)
+	summary := models.SubscriptionSummary{UserName: userName, GroupBy: groupBy, Groups: []models.SubscriptionGroup{}}
+	for _, key := range keys {
+		if includeTax {
+			groups[key].TaxQuarters = groupTaxes[key].sorted()
+		}
+		summary.Groups = append(summary.Groups, *groups[key])
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("group_count", len(summary.Groups)).Msg("Subscriptions summarized")
+	return summary, nil
+}
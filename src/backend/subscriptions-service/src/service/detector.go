@@ -0,0 +1,208 @@
+package service
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/models"
+	"time"
+)
+
+// merchantPrefixes are payment processor prefixes that precede the merchant name
+var merchantPrefixes = []string{"pos ", "debit ", "purchase ", "card ", "recurring ", "sq *", "tst* ", "paypal *", "pp*", "google *", "apple.com/bill"}
+
+// merchantNoise are tokens that carry no information about the merchant
+var merchantNoise = map[string]bool{
+	"inc": true, "llc": true, "ltd": true, "www": true, "com": true, "net": true, "bill": true,
+	"help": true, "payment": true, "subscription": true, "monthly": true, "usa": true,
+}
+
+var nonLetterRegex = regexp.MustCompile(`[^a-z]+`)
+
+// billingCycleWindows are the interval ranges (in days) recognized as each billing cycle
+var billingCycleWindows = []struct {
+	cycle   models.BillingCycle
+	minDays float64
+	maxDays float64
+}{
+	{models.Weekly, 6, 8},
+	{models.Monthly, 26, 34},
+	{models.Quarterly, 84, 97},
+	{models.Yearly, 355, 376},
+}
+
+func NormalizeMerchant(description string) string {
+	/*
+		Reduces a statement description to a stable merchant key,
+		e.g. "POS NETFLIX.COM 866-579-7172 CA" -> "netflix".
+		Params: description string
+		Return: string
+	*/
+	merchant := strings.ToLower(strings.TrimSpace(description))
+	for _, prefix := range merchantPrefixes {
+		merchant = strings.TrimPrefix(merchant, prefix)
+	}
+
+	tokens := []string{}
+	for _, token := range strings.Fields(nonLetterRegex.ReplaceAllString(merchant, " ")) {
+		if len(token) <= 2 || merchantNoise[token] {
+			continue
+		}
+		tokens = append(tokens, token)
+		if len(tokens) == 2 {
+			break
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+func guessCategory(merchant string) models.SubscriptionCategory {
+	/*
+		Guesses the category of a normalized merchant name from the vendor catalog.
+		Params: merchant string
+		Return: models.SubscriptionCategory
+	*/
+	if vendor, ok := MatchVendor(merchant, ""); ok {
+		return vendor.Category
+	}
+	return models.Other
+}
+
+func median(values []float64) float64 {
+	/*
+		Returns the median of the given values.
+		Params: values []float64
+		Return: float64
+	*/
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func classifyInterval(days float64) (models.BillingCycle, float64, float64, bool) {
+	/*
+		Returns the billing cycle whose window contains the given interval.
+		Params: days float64
+		Return: models.BillingCycle, minDays, maxDays, bool
+	*/
+	for _, window := range billingCycleWindows {
+		if days >= window.minDays && days <= window.maxDays {
+			return window.cycle, window.minDays, window.maxDays, true
+		}
+	}
+	return "", 0, 0, false
+}
+
+func detectProposal(merchant string, transactions []models.StatementTransaction) (models.SubscriptionProposal, bool) {
+	/*
+		Checks whether the transactions of one merchant recur at a regular
+		interval with a stable amount and builds a proposal if they do.
+		Params: merchant string
+				transactions []models.StatementTransaction (sorted by date)
+		Return: models.SubscriptionProposal, bool
+	*/
+	if len(transactions) < config.DETECTOR_MIN_OCCURRENCES {
+		return models.SubscriptionProposal{}, false
+	}
+
+	intervals := []float64{}
+	for i := 1; i < len(transactions); i++ {
+		previous, _ := time.Parse(config.DATE_FORMAT, transactions[i-1].Date)
+		current, _ := time.Parse(config.DATE_FORMAT, transactions[i].Date)
+		intervals = append(intervals, current.Sub(previous).Hours()/24)
+	}
+	cycle, minDays, maxDays, ok := classifyInterval(median(intervals))
+	if !ok {
+		return models.SubscriptionProposal{}, false
+	}
+	regular := 0
+	for _, interval := range intervals {
+		if interval >= minDays && interval <= maxDays {
+			regular++
+		}
+	}
+	regularity := float64(regular) / float64(len(intervals))
+	if regularity < 0.75 {
+		return models.SubscriptionProposal{}, false
+	}
+
+	amounts := []float64{}
+	for _, transaction := range transactions {
+		amounts = append(amounts, float64(transaction.Amount))
+	}
+	typicalAmount := median(amounts)
+	stable := 0
+	for _, amount := range amounts {
+		if math.Abs(amount-typicalAmount) <= typicalAmount*config.DETECTOR_AMOUNT_TOLERANCE {
+			stable++
+		}
+	}
+	stability := float64(stable) / float64(len(amounts))
+	if stability < 0.75 {
+		return models.SubscriptionProposal{}, false
+	}
+
+	// more occurrences make a coincidence less likely
+	occurrences := math.Min(float64(len(transactions))/4, 1)
+	confidence := (regularity + stability + occurrences) / 3
+
+	latest := transactions[len(transactions)-1]
+	words := strings.Fields(merchant)
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	name := strings.Join(words, " ")
+	return models.SubscriptionProposal{
+		Merchant:   merchant,
+		Confidence: float32(math.Round(confidence*100) / 100),
+		Subscription: models.SubscriptionCreateInput{
+			Name:         name,
+			Cost:         strconv.FormatFloat(float64(latest.Amount), 'f', 2, 32),
+			Currency:     latest.Currency,
+			BillingCycle: cycle,
+			StartDate:    transactions[0].Date,
+			Category:     guessCategory(merchant),
+		},
+		Transactions: transactions,
+	}, true
+}
+
+func DetectRecurringCharges(transactions []models.StatementTransaction) []models.SubscriptionProposal {
+	/*
+		Groups transactions by normalized merchant and proposes a subscription
+		for every group that recurs regularly, most confident first.
+		Params: transactions []models.StatementTransaction
+		Return: []models.SubscriptionProposal
+	*/
+	groups := map[string][]models.StatementTransaction{}
+	for _, transaction := range transactions {
+		merchant := NormalizeMerchant(transaction.Description)
+		if merchant == "" {
+			continue
+		}
+		groups[merchant] = append(groups[merchant], transaction)
+	}
+
+	proposals := []models.SubscriptionProposal{}
+	for merchant, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].Date < group[j].Date })
+		proposal, ok := detectProposal(merchant, group)
+		if ok {
+			proposals = append(proposals, proposal)
+		}
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		if proposals[i].Confidence == proposals[j].Confidence {
+			return proposals[i].Merchant < proposals[j].Merchant
+		}
+		return proposals[i].Confidence > proposals[j].Confidence
+	})
+	return proposals
+}
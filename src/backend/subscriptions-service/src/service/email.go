@@ -0,0 +1,301 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/models"
+)
+
+// maxEmailPartDepth bounds the nesting of multipart and forwarded messages
+const maxEmailPartDepth = 10
+
+var htmlBlockRegex = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+var htmlBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|tr|li|h[1-6]|table)>`)
+var htmlCellRegex = regexp.MustCompile(`(?i)</t[dh]>`)
+var htmlTagRegex = regexp.MustCompile(`(?s)<[^>]*>`)
+var emailAddressRegex = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// forwardMarkerRegex finds the header block that mail clients put above an
+// inline forwarded message
+var forwardMarkerRegex = regexp.MustCompile(`(?im)^[>\s]*(-+\s*(forwarded message|original message)\s*-+|begin forwarded message:)`)
+var forwardFromRegex = regexp.MustCompile(`(?im)^[>\s*]*from:\s*(.+)$`)
+
+type emailContent struct {
+	plain     []string
+	html      []string
+	forwarded *mail.Address
+}
+
+func decodeCharset(charset string, data []byte) string {
+	/*
+		Converts text in a MIME charset to UTF-8. Latin-1 and Windows-1252
+		are mapped byte by byte; any other charset is read as UTF-8.
+		Params: charset string
+				data []byte
+		Return: string
+	*/
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "iso-8859-1", "iso-8859-15", "latin1", "windows-1252", "cp1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	default:
+		return string(data)
+	}
+}
+
+var emailWordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(decodeCharset(charset, data)), nil
+	},
+}
+
+func parseEmailAddress(value string) (*mail.Address, bool) {
+	/*
+		Parses an address header value, falling back to the first email
+		address found in it for values that are not RFC 5322 compliant,
+		e.g. "Netflix [mailto:info@netflix.com]".
+		Params: value string
+		Return: *mail.Address, bool
+	*/
+	parser := mail.AddressParser{WordDecoder: emailWordDecoder}
+	address, err := parser.Parse(strings.TrimSpace(value))
+	if err == nil {
+		return address, true
+	}
+	found := emailAddressRegex.FindString(value)
+	if found == "" {
+		return nil, false
+	}
+	name := strings.TrimSuffix(strings.SplitN(value, found, 2)[0], "mailto:")
+	return &mail.Address{Name: strings.Trim(name, `"<[( `), Address: found}, true
+}
+
+func htmlToText(body string) string {
+	/*
+		Reduces an HTML email body to its text, one block per line.
+		Params: body string
+		Return: string
+	*/
+	body = htmlBlockRegex.ReplaceAllString(body, "")
+	body = htmlBreakRegex.ReplaceAllString(body, "\n")
+	body = htmlCellRegex.ReplaceAllString(body, " ")
+	body = html.UnescapeString(htmlTagRegex.ReplaceAllString(body, ""))
+	lines := []string{}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	/*
+		Undoes the Content-Transfer-Encoding of a MIME part.
+		Params: encoding string
+				body io.Reader
+		Return: io.Reader
+	*/
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+func readEmailPart(contentType string, encoding string, body io.Reader, content *emailContent, depth int) error {
+	/*
+		Collects the text of a MIME part, walking multipart parts and
+		forwarded messages attached as message/rfc822.
+		Params: contentType string
+				encoding string
+				body io.Reader
+				content *emailContent
+				depth int
+		Return: error
+	*/
+	if depth > maxEmailPartDepth {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	body = decodeTransferEncoding(encoding, body)
+
+	switch {
+	case mediaType == "multipart/alternative":
+		// the parts hold the same text, the plain one is kept when present
+		alternatives := &emailContent{forwarded: content.forwarded}
+		err := readEmailParts(body, params["boundary"], alternatives, depth)
+		if err != nil {
+			return err
+		}
+		content.forwarded = alternatives.forwarded
+		if strings.TrimSpace(strings.Join(alternatives.plain, "")) != "" {
+			content.plain = append(content.plain, alternatives.plain...)
+		} else {
+			content.plain = append(content.plain, alternatives.html...)
+		}
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return readEmailParts(body, params["boundary"], content, depth)
+	case mediaType == "message/rfc822":
+		message, err := mail.ReadMessage(body)
+		if err != nil {
+			return nil
+		}
+		if content.forwarded == nil {
+			if from, ok := parseEmailAddress(message.Header.Get("From")); ok {
+				content.forwarded = from
+			}
+		}
+		return readEmailPart(message.Header.Get("Content-Type"), message.Header.Get("Content-Transfer-Encoding"), message.Body, content, depth+1)
+	case mediaType == "text/plain" || mediaType == "text/html":
+		data, err := io.ReadAll(io.LimitReader(body, config.RECEIPT_EMAIL_MAX_SIZE))
+		if err != nil {
+			return err
+		}
+		text := decodeCharset(params["charset"], data)
+		if mediaType == "text/html" {
+			content.html = append(content.html, htmlToText(text))
+		} else {
+			content.plain = append(content.plain, text)
+		}
+	}
+	// attachments such as PDF invoices are not read
+	return nil
+}
+
+func readEmailParts(body io.Reader, boundary string, content *emailContent, depth int) error {
+	/*
+		Collects the text of the parts of a multipart body.
+		Params: body io.Reader
+				boundary string
+				content *emailContent
+				depth int
+		Return: error
+	*/
+	reader := multipart.NewReader(body, boundary)
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = readEmailPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, content, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func inlineForwardedSender(text string) (*mail.Address, bool) {
+	/*
+		Returns the original sender of a message forwarded inline, read from
+		the From line below the client's forward marker.
+		Params: text string
+		Return: *mail.Address, bool
+	*/
+	marker := forwardMarkerRegex.FindStringIndex(text)
+	if marker == nil {
+		return nil, false
+	}
+	match := forwardFromRegex.FindStringSubmatch(text[marker[1]:])
+	if match == nil {
+		return nil, false
+	}
+	return parseEmailAddress(match[1])
+}
+
+func ParseReceiptEmail(raw []byte) (models.ReceiptEmail, error) {
+	/*
+		Parses a MIME email into its headers and text. The sender is the
+		original sender when the email forwards another one, either attached
+		or inline, and the email's own sender otherwise.
+		Params: raw []byte
+		Return: models.ReceiptEmail, error
+	*/
+	if len(raw) > config.RECEIPT_EMAIL_MAX_SIZE {
+		return models.ReceiptEmail{}, fmt.Errorf("%w: emails are limited to %d MB", ErrInvalidReceipt, config.RECEIPT_EMAIL_MAX_SIZE>>20)
+	}
+	// mbox exports start with a "From " line that is not a header
+	if bytes.HasPrefix(raw, []byte("From ")) {
+		if i := bytes.IndexByte(raw, '\n'); i >= 0 {
+			raw = raw[i+1:]
+		}
+	}
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return models.ReceiptEmail{}, fmt.Errorf("%w: %v", ErrInvalidReceipt, err)
+	}
+
+	email := models.ReceiptEmail{
+		MessageId: strings.Trim(message.Header.Get("Message-Id"), "<> "),
+		To:        []string{},
+	}
+	if from, ok := parseEmailAddress(message.Header.Get("From")); ok {
+		email.From = from.Address
+		email.Sender = from.Address
+		email.SenderName = from.Name
+	}
+	for _, header := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		for _, value := range message.Header[header] {
+			for _, part := range strings.Split(value, ",") {
+				if address, ok := parseEmailAddress(part); ok {
+					email.To = append(email.To, address.Address)
+				}
+			}
+		}
+	}
+	email.Subject, err = emailWordDecoder.DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		email.Subject = message.Header.Get("Subject")
+	}
+	if date, err := message.Header.Date(); err == nil {
+		email.Date = date.UTC().Format(config.DATE_FORMAT)
+	}
+
+	content := &emailContent{}
+	contentType := message.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	err = readEmailPart(contentType, message.Header.Get("Content-Transfer-Encoding"), message.Body, content, 0)
+	if err != nil {
+		return models.ReceiptEmail{}, fmt.Errorf("%w: %v", ErrInvalidReceipt, err)
+	}
+	email.Text = strings.Join(append(content.plain, content.html...), "\n")
+
+	forwarded := content.forwarded
+	if forwarded == nil {
+		forwarded, _ = inlineForwardedSender(email.Text)
+	}
+	if forwarded != nil {
+		email.Sender = forwarded.Address
+		email.SenderName = forwarded.Name
+	}
+	return email, nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/rs/zerolog/log"
+)
+
+func streamTable(eventSourceArn string) string {
+	/*
+		Returns the table name of a DynamoDB Stream ARN
+		("arn:aws:dynamodb:<region>:<account>:table/<name>/stream/<label>").
+		Params: eventSourceArn string
+		Return: string
+	*/
+	_, table, ok := strings.Cut(eventSourceArn, ":table/")
+	if !ok {
+		return ""
+	}
+	table, _, _ = strings.Cut(table, "/")
+	return table
+}
+
+func newDomainEvent(record events.DynamoDBEventRecord, eventType models.DomainEventType, subject string, userName string, data interface{}) models.DomainEvent {
+	/*
+		Wraps the data of an event in the versioned envelope. The id is the
+		stream record's, so that consumers can drop redelivered events.
+		Params: record events.DynamoDBEventRecord
+				eventType models.DomainEventType
+				subject string
+				userName string
+				data interface{}
+		Return: models.DomainEvent
+	*/
+	changedAt := record.Change.ApproximateCreationDateTime.Time
+	if changedAt.IsZero() {
+		changedAt = time.Now()
+	}
+	return models.DomainEvent{
+		Version:  config.EVENT_SCHEMA_VERSION,
+		Id:       record.EventID,
+		Type:     eventType,
+		Source:   config.EVENT_SOURCE,
+		Time:     changedAt.UTC().Format(time.RFC3339),
+		Subject:  subject,
+		UserName: userName,
+		Data:     data,
+	}
+}
+
+func subscriptionEvents(record events.DynamoDBEventRecord) ([]models.DomainEvent, error) {
+	/*
+		Returns the events of a change in the subscriptions table: a new
+		item is created, a changed cost or currency is cost_changed, and an
+		item moving to the cancelled status or removed before it is
+		cancelled. Other changes publish nothing.
+		Params: record events.DynamoDBEventRecord
+		Return: []models.DomainEvent, error
+	*/
+	oldItem := models.SubscriptionDynamodb{}
+	newItem := models.SubscriptionDynamodb{}
+	err := repository.UnmarshalStreamImage(record.Change.OldImage, &oldItem)
+	if err == nil {
+		err = repository.UnmarshalStreamImage(record.Change.NewImage, &newItem)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch events.DynamoDBOperationType(record.EventName) {
+	case events.DynamoDBOperationTypeInsert:
+		data := models.SubscriptionEventData{Subscription: newItem}
+		return []models.DomainEvent{newDomainEvent(record, models.SubscriptionCreated, newItem.UUID, newItem.UserName, data)}, nil
+	case events.DynamoDBOperationTypeModify:
+		domainEvents := []models.DomainEvent{}
+		if oldItem.Cost != newItem.Cost || oldItem.Currency != newItem.Currency {
+			previousCost := oldItem.Cost
+			data := models.SubscriptionEventData{Subscription: newItem, PreviousCost: &previousCost, PreviousCurrency: oldItem.Currency}
+			domainEvents = append(domainEvents, newDomainEvent(record, models.SubscriptionCostChanged, newItem.UUID, newItem.UserName, data))
+		}
+		if newItem.Status == models.StatusCancelled && oldItem.Status != models.StatusCancelled {
+			data := models.SubscriptionEventData{Subscription: newItem}
+			cancelled := newDomainEvent(record, models.SubscriptionCancelled, newItem.UUID, newItem.UserName, data)
+			// a cancellation changing the cost publishes two events of the same record
+			if len(domainEvents) > 0 {
+				cancelled.Id += ":" + string(models.SubscriptionCancelled)
+			}
+			domainEvents = append(domainEvents, cancelled)
+		}
+		return domainEvents, nil
+	case events.DynamoDBOperationTypeRemove:
+		// the cancellation was published when the status changed
+		if oldItem.Status == models.StatusCancelled {
+			return nil, nil
+		}
+		data := models.SubscriptionEventData{Subscription: oldItem}
+		return []models.DomainEvent{newDomainEvent(record, models.SubscriptionCancelled, oldItem.UUID, oldItem.UserName, data)}, nil
+	}
+	return nil, nil
+}
+
+func paymentEvents(ctx context.Context, record events.DynamoDBEventRecord) ([]models.DomainEvent, error) {
+	/*
+		Returns the events of a change in the payments table: a new payment
+		is recorded, and a payment recorded or marked as failed has failed.
+		Other changes publish nothing.
+		Params: ctx context.Context
+				record events.DynamoDBEventRecord
+		Return: []models.DomainEvent, error
+	*/
+	operation := events.DynamoDBOperationType(record.EventName)
+	if operation != events.DynamoDBOperationTypeInsert && operation != events.DynamoDBOperationTypeModify {
+		return nil, nil
+	}
+	oldPayment := models.PaymentDynamodb{}
+	payment := models.PaymentDynamodb{}
+	err := repository.UnmarshalStreamImage(record.Change.OldImage, &oldPayment)
+	if err == nil {
+		err = repository.UnmarshalStreamImage(record.Change.NewImage, &payment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	domainEvents := []models.DomainEvent{}
+	if operation == events.DynamoDBOperationTypeInsert {
+		data := models.PaymentEventData{Payment: payment}
+		domainEvents = append(domainEvents, newDomainEvent(record, models.PaymentRecorded, payment.SubscriptionId, payment.UserName, data))
+	}
+	if payment.Status == models.PaymentStatusFailed && oldPayment.Status != models.PaymentStatusFailed {
+		data := models.PaymentEventData{Payment: payment, SubscriptionName: subscriptionNameOfPayment(ctx, payment)}
+		failed := newDomainEvent(record, models.PaymentFailed, payment.SubscriptionId, payment.UserName, data)
+		// a recorded failed payment publishes two events of the same record
+		if operation == events.DynamoDBOperationTypeInsert {
+			failed.Id += ":" + string(models.PaymentFailed)
+		}
+		domainEvents = append(domainEvents, failed)
+	}
+	return domainEvents, nil
+}
+
+// subscriptionNameOfPayment reads the subscription name of a failed
+// payment, tests replace it to leave out the subscriptions table
+var subscriptionNameOfPayment = paymentSubscriptionName
+
+func paymentSubscriptionName(ctx context.Context, payment models.PaymentDynamodb) string {
+	/*
+		Returns the name of the subscription of a payment, for the failure
+		notification. It is left out when the subscription cannot be read.
+		Params: ctx context.Context
+				payment models.PaymentDynamodb
+		Return: string
+	*/
+	partition, err := subscriptionPartition(ctx, payment.SubscriptionId, payment.UserName, models.HouseholdView)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, payment.SubscriptionId).Msg("Error getting the subscription of a failed payment")
+		return ""
+	}
+	subscription, err := repository.GetSubscription(ctx, partition, payment.SubscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, payment.SubscriptionId).Msg("Error getting the subscription of a failed payment")
+		return ""
+	}
+	return subscription.Name
+}
+
+func DomainEvents(ctx context.Context, record events.DynamoDBEventRecord) ([]models.DomainEvent, error) {
+	/*
+		Turns a DynamoDB Stream record of the subscriptions or payments table
+		into domain events carrying the correlation id of the invocation.
+		Records of other tables publish nothing.
+		Params: ctx context.Context
+				record events.DynamoDBEventRecord
+		Return: []models.DomainEvent, error
+	*/
+	var domainEvents []models.DomainEvent
+	var err error
+	switch streamTable(record.EventSourceArn) {
+	case config.SUBSCRIPTIONS_DYNAMODB_TABLE:
+		domainEvents, err = subscriptionEvents(record)
+	case config.PAYMENTS_DYNAMODB_TABLE:
+		domainEvents, err = paymentEvents(ctx, record)
+	}
+	for i := range domainEvents {
+		domainEvents[i].CorrelationId = logging.CorrelationId(ctx)
+	}
+	return domainEvents, err
+}
+
+func PublishStreamRecords(ctx context.Context, publisher repository.EventPublisher, records []events.DynamoDBEventRecord) (string, error) {
+	/*
+		Publishes the domain events of a batch of stream records in order.
+		On failure, returns the sequence number of the first record not
+		published, from which the batch is retried.
+		Params: ctx context.Context
+				publisher repository.EventPublisher
+				records []events.DynamoDBEventRecord
+		Return: string (sequence number of the failed record), error
+	*/
+	log.Ctx(ctx).Info().Int("record_count", len(records)).Msg("Publishing stream records")
+	published := 0
+	for _, record := range records {
+		domainEvents, err := DomainEvents(ctx, record)
+		if err == nil && len(domainEvents) > 0 {
+			err = publisher.Publish(ctx, domainEvents)
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.EventIdField, record.EventID).Str("sequence_number", record.Change.SequenceNumber).Msg("Error publishing stream record")
+			return record.Change.SequenceNumber, err
+		}
+		published += len(domainEvents)
+	}
+	log.Ctx(ctx).Info().Int("record_count", len(records)).Int("event_count", published).Msg("Stream records published")
+	return "", nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func subscriptionImage(cost string, status string) map[string]events.DynamoDBAttributeValue {
+	image := map[string]events.DynamoDBAttributeValue{
+		"username": events.NewStringAttribute("jane"),
+		"uuid":     events.NewStringAttribute("sub-1"),
+		"name":     events.NewStringAttribute("Netflix"),
+		"cost":     events.NewNumberAttribute(cost),
+		"currency": events.NewStringAttribute("USD"),
+	}
+	if status != "" {
+		image["status"] = events.NewStringAttribute(status)
+	}
+	return image
+}
+
+func paymentImage(status string) map[string]events.DynamoDBAttributeValue {
+	image := map[string]events.DynamoDBAttributeValue{
+		"subscription_id": events.NewStringAttribute("sub-1"),
+		"uuid":            events.NewStringAttribute("pay-1"),
+		"username":        events.NewStringAttribute("jane"),
+		"amount":          events.NewNumberAttribute("15.49"),
+		"payment_date":    events.NewStringAttribute("2026-04-03"),
+	}
+	if status != "" {
+		image["status"] = events.NewStringAttribute(status)
+	}
+	return image
+}
+
+func streamRecord(table string, id string, operation events.DynamoDBOperationType, oldImage map[string]events.DynamoDBAttributeValue, newImage map[string]events.DynamoDBAttributeValue) events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventID:        id,
+		EventName:      string(operation),
+		EventSourceArn: "arn:aws:dynamodb:us-east-1:123456789012:table/" + table + "/stream/2026-01-01T00:00:00.000",
+		Change: events.DynamoDBStreamRecord{
+			SequenceNumber: id,
+			OldImage:       oldImage,
+			NewImage:       newImage,
+		},
+	}
+}
+
+func subscriptionRecord(id string, operation events.DynamoDBOperationType, oldImage map[string]events.DynamoDBAttributeValue, newImage map[string]events.DynamoDBAttributeValue) events.DynamoDBEventRecord {
+	return streamRecord(config.SUBSCRIPTIONS_DYNAMODB_TABLE, id, operation, oldImage, newImage)
+}
+
+func paymentRecord(id string, operation events.DynamoDBOperationType, oldImage map[string]events.DynamoDBAttributeValue, newImage map[string]events.DynamoDBAttributeValue) events.DynamoDBEventRecord {
+	return streamRecord(config.PAYMENTS_DYNAMODB_TABLE, id, operation, oldImage, newImage)
+}
+
+func TestPublishStreamRecords(t *testing.T) {
+	tests := []struct {
+		name   string
+		record events.DynamoDBEventRecord
+		want   []models.DomainEventType
+	}{
+		{"insert", subscriptionRecord("1", events.DynamoDBOperationTypeInsert, nil, subscriptionImage("15.49", "")), []models.DomainEventType{models.SubscriptionCreated}},
+		{"cost change", subscriptionRecord("2", events.DynamoDBOperationTypeModify, subscriptionImage("15.49", ""), subscriptionImage("17.99", "")), []models.DomainEventType{models.SubscriptionCostChanged}},
+		{"other change", subscriptionRecord("3", events.DynamoDBOperationTypeModify, subscriptionImage("15.49", ""), subscriptionImage("15.49", string(models.StatusPaused))), nil},
+		{"cancel", subscriptionRecord("4", events.DynamoDBOperationTypeModify, subscriptionImage("15.49", string(models.StatusActive)), subscriptionImage("15.49", string(models.StatusCancelled))), []models.DomainEventType{models.SubscriptionCancelled}},
+		{"remove cancelled", subscriptionRecord("5", events.DynamoDBOperationTypeRemove, subscriptionImage("15.49", string(models.StatusCancelled)), nil), nil},
+		{"remove", subscriptionRecord("6", events.DynamoDBOperationTypeRemove, subscriptionImage("15.49", ""), nil), []models.DomainEventType{models.SubscriptionCancelled}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := logging.WithRequest(context.Background(), logging.RequestFields{LambdaRequestId: "lambda-1"})
+			publisher := &repository.LocalEventPublisher{}
+			failed, err := PublishStreamRecords(ctx, publisher, []events.DynamoDBEventRecord{test.record})
+			if err != nil || failed != "" {
+				t.Fatalf("PublishStreamRecords = %q, %v", failed, err)
+			}
+			if len(publisher.Published) != len(test.want) {
+				t.Fatalf("published %d events, want %d", len(publisher.Published), len(test.want))
+			}
+			for i, event := range publisher.Published {
+				if event.Type != test.want[i] {
+					t.Errorf("event %d is %s, want %s", i, event.Type, test.want[i])
+				}
+				if event.Id != test.record.EventID || event.Subject != "sub-1" || event.UserName != "jane" {
+					t.Errorf("event %d = %+v, want the id of the record and the subscription of jane", i, event)
+				}
+				if event.CorrelationId != "lambda-1" {
+					t.Errorf("event %d has correlation id %q, want the invocation's", i, event.CorrelationId)
+				}
+			}
+		})
+	}
+}
+
+func TestPublishPaymentStreamRecords(t *testing.T) {
+	subscriptionNameOfPayment = func(ctx context.Context, payment models.PaymentDynamodb) string {
+		return "Netflix"
+	}
+	t.Cleanup(func() { subscriptionNameOfPayment = paymentSubscriptionName })
+
+	failed := string(models.PaymentStatusFailed)
+	tests := []struct {
+		name   string
+		record events.DynamoDBEventRecord
+		want   []models.DomainEventType
+		ids    []string
+	}{
+		{"insert", paymentRecord("1", events.DynamoDBOperationTypeInsert, nil, paymentImage("")), []models.DomainEventType{models.PaymentRecorded}, []string{"1"}},
+		{"insert failed", paymentRecord("2", events.DynamoDBOperationTypeInsert, nil, paymentImage(failed)), []models.DomainEventType{models.PaymentRecorded, models.PaymentFailed}, []string{"2", "2:" + string(models.PaymentFailed)}},
+		{"fail", paymentRecord("3", events.DynamoDBOperationTypeModify, paymentImage(""), paymentImage(failed)), []models.DomainEventType{models.PaymentFailed}, []string{"3"}},
+		{"remove", paymentRecord("4", events.DynamoDBOperationTypeRemove, paymentImage(""), nil), nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := logging.WithRequest(context.Background(), logging.RequestFields{LambdaRequestId: "lambda-1"})
+			publisher := &repository.LocalEventPublisher{}
+			failedSequence, err := PublishStreamRecords(ctx, publisher, []events.DynamoDBEventRecord{test.record})
+			if err != nil || failedSequence != "" {
+				t.Fatalf("PublishStreamRecords = %q, %v", failedSequence, err)
+			}
+			if len(publisher.Published) != len(test.want) {
+				t.Fatalf("published %d events, want %d", len(publisher.Published), len(test.want))
+			}
+			for i, event := range publisher.Published {
+				if event.Type != test.want[i] {
+					t.Errorf("event %d is %s, want %s", i, event.Type, test.want[i])
+				}
+				if event.Id != test.ids[i] || event.Subject != "sub-1" || event.UserName != "jane" {
+					t.Errorf("event %d = %+v, want id %q and the subscription of jane", i, event, test.ids[i])
+				}
+				if event.CorrelationId != "lambda-1" {
+					t.Errorf("event %d has correlation id %q, want the invocation's", i, event.CorrelationId)
+				}
+			}
+		})
+	}
+}
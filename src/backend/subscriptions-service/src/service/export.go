@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrUnsupportedExportFormat = errors.New("unsupported export format")
+
+func formatAmount(amount float32) string {
+	/*
+		Formats an amount with two decimals for the exports.
+		Params: amount float32
+		Return: string
+	*/
+	return strconv.FormatFloat(float64(amount), 'f', 2, 32)
+}
+
+func collectUserExport(ctx context.Context, userName string, filter models.SubscriptionFilter) (models.UserExport, error) {
+	/*
+		Gathers the subscriptions of a user matching the filter along with
+		their payments, sorted by subscription name and payment date. Shared
+		subscriptions and their payments only carry the user's share.
+		Params: ctx context.Context
+				userName string
+				filter models.SubscriptionFilter
+		Return: models.UserExport, error
+	*/
+	subscriptions, err := userSubscriptionShares(ctx, userName)
+	if err != nil {
+		return models.UserExport{}, err
+	}
+	subscriptions = filterSubscriptions(subscriptions, filter)
+	categories, err := partitionCategories(ctx, userName)
+	if err != nil {
+		return models.UserExport{}, err
+	}
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].Name < subscriptions[j].Name })
+
+	export := models.UserExport{
+		UserName:      userName,
+		ExportedAt:    time.Now().UTC().Format(time.RFC3339),
+		Subscriptions: []models.SubscriptionExport{},
+		Categories:    categories,
+	}
+	for _, subscription := range subscriptions {
+		payments, err := repository.GetSubscriptionPayments(ctx, subscription.UUID)
+		if err != nil {
+			return models.UserExport{}, err
+		}
+		sort.Slice(payments, func(i, j int) bool { return payments[i].PaymentDate < payments[j].PaymentDate })
+		fraction := shareFraction(subscription)
+		for i := range payments {
+			payments[i].Amount = roundCents(float64(payments[i].Amount * fraction))
+			payments[i].RefundedAmount = roundCents(float64(payments[i].RefundedAmount * fraction))
+			payments[i].AmountBeforeTax = roundCents(float64(payments[i].AmountBeforeTax * fraction))
+			payments[i].TaxAmount = roundCents(float64(payments[i].TaxAmount * fraction))
+		}
+		export.Subscriptions = append(export.Subscriptions, models.SubscriptionExport{
+			SubscriptionDynamodb: subscription,
+			Payments:             payments,
+		})
+	}
+	return export, nil
+}
+
+func subscriptionExportColumns(subscription models.SubscriptionDynamodb) []string {
+	/*
+		Returns the subscription part of an export row.
+		Params: subscription models.SubscriptionDynamodb
+		Return: []string
+	*/
+	return []string{
+		subscription.UUID,
+		subscription.Name,
+		subscription.Url,
+		subscription.Plan,
+		string(subscription.Category),
+		string(subscription.BillingCycle),
+		subscription.Currency,
+		formatAmount(subscription.Cost),
+		subscription.StartDate,
+		subscription.LastPaymentDate,
+	}
+}
+
+func paymentExportColumns(payment models.PaymentDynamodb) []string {
+	/*
+		Returns the payment part of an export row.
+		Params: payment models.PaymentDynamodb
+		Return: []string
+	*/
+	return []string{
+		payment.UUID,
+		payment.PaymentDate,
+		formatAmount(payment.Amount),
+	}
+}
+
+func paymentStatusExportColumns(payment models.PaymentDynamodb) []string {
+	/*
+		Returns the status part of an export row, appended after the category
+		columns: the status, the refunded amount and the amount net of
+		refunds, which is nothing for a payment that was not charged.
+		Params: payment models.PaymentDynamodb
+		Return: []string
+	*/
+	return []string{
+		string(paymentStatus(payment)),
+		formatAmount(payment.RefundedAmount),
+		formatAmount(netPaymentAmount(payment)),
+	}
+}
+
+func paymentTaxExportColumns(payment models.PaymentDynamodb) []string {
+	/*
+		Returns the tax part of an export row, appended after the status
+		columns. The amounts and rate are empty on a payment without a tax
+		breakdown.
+		Params: payment models.PaymentDynamodb
+		Return: []string
+	*/
+	columns := []string{"", "", "", payment.InvoiceNumber, payment.SellerTaxId}
+	if hasTaxBreakdown(payment) {
+		columns[0] = formatAmount(payment.AmountBeforeTax)
+		columns[1] = formatAmount(payment.TaxAmount)
+		columns[2] = strconv.FormatFloat(float64(payment.TaxRate), 'f', -1, 32)
+	}
+	return columns
+}
+
+func categoryExportColumns(subscription models.SubscriptionDynamodb, categories map[models.SubscriptionCategory]models.Category) []string {
+	/*
+		Returns the category name and tags part of an export row, appended
+		after the payment columns.
+		Params: subscription models.SubscriptionDynamodb
+				categories map[models.SubscriptionCategory]models.Category
+		Return: []string
+	*/
+	name := string(subscription.Category)
+	if category, ok := categories[subscription.Category]; ok {
+		name = category.Name
+	}
+	return []string{name, strings.Join(subscription.Tags, ",")}
+}
+
+func exportRows(export models.UserExport) [][]string {
+	/*
+		Flattens an export into rows following models.ExportColumns: one row per
+		payment, and a single row with empty payment, status and tax columns
+		for a subscription that has no payments.
+		Params: export models.UserExport
+		Return: [][]string
+	*/
+	categories := categoryIndex(export.Categories)
+	rows := [][]string{}
+	for _, subscription := range export.Subscriptions {
+		subscriptionColumns := subscriptionExportColumns(subscription.SubscriptionDynamodb)
+		categoryColumns := categoryExportColumns(subscription.SubscriptionDynamodb, categories)
+		if len(subscription.Payments) == 0 {
+			emptyPayment := make([]string, len(paymentExportColumns(models.PaymentDynamodb{})))
+			emptyStatus := make([]string, len(paymentStatusExportColumns(models.PaymentDynamodb{}))+len(paymentTaxExportColumns(models.PaymentDynamodb{})))
+			rows = append(rows, append(append(append(subscriptionColumns, emptyPayment...), categoryColumns...), emptyStatus...))
+			continue
+		}
+		for _, payment := range subscription.Payments {
+			row := append(append([]string{}, subscriptionColumns...), paymentExportColumns(payment)...)
+			row = append(append(row, categoryColumns...), paymentStatusExportColumns(payment)...)
+			row = append(row, paymentTaxExportColumns(payment)...)
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func writeExportCSV(export models.UserExport) ([]byte, error) {
+	/*
+		Writes the export as CSV with the models.ExportColumns header.
+		Params: export models.UserExport
+		Return: []byte, error
+	*/
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	err := writer.Write(models.ExportColumns)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.WriteAll(exportRows(export))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func ExportUserData(ctx context.Context, userName string, format models.ExportFormat, options models.LedgerOptions, filter models.SubscriptionFilter) ([]byte, string, error) {
+	/*
+		Exports the subscriptions and payments of a user matching the filter
+		in the given format. The ledger options only apply to the plain-text
+		accounting formats.
+		Params: ctx context.Context
+				userName string
+				format models.ExportFormat
+				options models.LedgerOptions
+				filter models.SubscriptionFilter
+		Return: []byte (file contents), string (content type), error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("format", string(format)).Msg("Exporting user data")
+	export, err := collectUserExport(ctx, userName, filter)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error collecting user data")
+		return nil, "", err
+	}
+
+	var body []byte
+	var contentType string
+	switch format {
+	case models.ExportCSV:
+		body, err = writeExportCSV(export)
+		contentType = "text/csv"
+	case models.ExportJSON:
+		body, err = json.Marshal(export)
+		contentType = "application/json"
+	case models.ExportXLSX:
+		body, err = writeExportXLSX(export)
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case models.ExportLedger, models.ExportHledger:
+		body = writeExportLedger(export, options)
+		contentType = "text/plain"
+	case models.ExportBeancount:
+		body = writeExportBeancount(export, options)
+		contentType = "text/plain"
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnsupportedExportFormat, format)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Str("format", string(format)).Msg("Error exporting user data")
+		return nil, "", err
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("format", string(format)).Int("subscription_count", len(export.Subscriptions)).Msg("User data exported")
+	return body, contentType, nil
+}
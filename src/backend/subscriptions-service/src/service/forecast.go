@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidForecast = errors.New("invalid forecast")
+
+func projected(subscription models.SubscriptionDynamodb) bool {
+	/*
+		Tells whether a subscription is expected to keep renewing: paused
+		and cancelled ones are not.
+		Params: subscription models.SubscriptionDynamodb
+		Return: bool
+	*/
+	return subscription.Status != models.StatusPaused && subscription.Status != models.StatusCancelled
+}
+
+func costOn(subscription models.SubscriptionDynamodb, date string) (float32, bool) {
+	/*
+		Returns the cost of a subscription on a date: the latest announced
+		price in effect, reduced to the user's share of a shared subscription.
+		Params: subscription models.SubscriptionDynamodb
+				date string (YYYY-MM-DD)
+		Return: float32, bool (whether an announced price applies)
+	*/
+	cost := subscription.Cost
+	changed := false
+	for _, change := range subscription.PriceChanges {
+		if change.EffectiveDate > date {
+			break
+		}
+		cost = change.Cost * shareFraction(subscription)
+		changed = true
+	}
+	return cost, changed
+}
+
+func forecastCharges(subscription models.SubscriptionDynamodb, from time.Time, to time.Time) []models.ForecastCharge {
+	/*
+		Returns the charges of a subscription between two dates. A running
+		free trial is not charged and billing starts at its end; no charge is
+		made on or after a scheduled cancellation.
+		Params: subscription models.SubscriptionDynamodb
+				from time.Time
+				to time.Time
+		Return: []models.ForecastCharge
+	*/
+	charges := []models.ForecastCharge{}
+	anchor, ok := billingAnchor(subscription)
+	if !ok || !projected(subscription) {
+		return charges
+	}
+	// the anchor itself is charged only when it is still to come
+	first := 1
+	if anchor.After(from) {
+		first = 0
+	}
+	trial := false
+	if trialEnd, err := time.Parse(config.DATE_FORMAT, subscription.TrialEndDate); err == nil && trialEnd.After(anchor) && !trialEnd.Before(from) {
+		anchor, first, trial = trialEnd, 0, true
+	}
+	cancelAt, err := time.Parse(config.DATE_FORMAT, subscription.CancelAt)
+	cancelled := err == nil
+
+	currency := subscription.Currency
+	if currency == "" {
+		currency = config.DEFAULT_CURRENCY
+	}
+	cycle := billingCycleOf(subscription)
+	for n := first; ; n++ {
+		date := addBillingCycles(anchor, cycle, n)
+		if date.After(to) || (cancelled && !date.Before(cancelAt)) {
+			return charges
+		}
+		if date.Before(from) {
+			continue
+		}
+		day := date.Format(config.DATE_FORMAT)
+		cost, changed := costOn(subscription, day)
+		charges = append(charges, models.ForecastCharge{
+			SubscriptionId: subscription.UUID,
+			Name:           subscription.Name,
+			Date:           day,
+			Amount:         roundCents(float64(cost)),
+			Currency:       currency,
+			Category:       subscription.Category,
+			AfterTrial:     trial && n == 0,
+			PriceChanged:   changed,
+		})
+	}
+}
+
+func forecastPriceChanges(subscription models.SubscriptionDynamodb, from string, to string) []models.ForecastPriceChange {
+	/*
+		Returns the announced price changes of a subscription taking effect
+		between two dates, before it is cancelled.
+		Params: subscription models.SubscriptionDynamodb
+				from string
+				to string
+		Return: []models.ForecastPriceChange
+	*/
+	changes := []models.ForecastPriceChange{}
+	if !projected(subscription) {
+		return changes
+	}
+	currency := subscription.Currency
+	if currency == "" {
+		currency = config.DEFAULT_CURRENCY
+	}
+	previous := subscription.Cost
+	for _, change := range subscription.PriceChanges {
+		cost := change.Cost * shareFraction(subscription)
+		inWindow := change.EffectiveDate >= from && change.EffectiveDate <= to
+		beforeCancel := subscription.CancelAt == "" || change.EffectiveDate < subscription.CancelAt
+		if inWindow && beforeCancel && cost != previous {
+			changes = append(changes, models.ForecastPriceChange{
+				SubscriptionId: subscription.UUID,
+				Name:           subscription.Name,
+				EffectiveDate:  change.EffectiveDate,
+				PreviousCost:   roundCents(float64(previous)),
+				Cost:           roundCents(float64(cost)),
+				Currency:       currency,
+			})
+		}
+		previous = cost
+	}
+	return changes
+}
+
+func buildForecast(subscriptions []models.SubscriptionDynamodb, categories []models.Category, from time.Time, months int) models.Forecast {
+	/*
+		Projects the charges of subscriptions month by month, starting with
+		the month of the given date, broken down by category.
+		Params: subscriptions []models.SubscriptionDynamodb
+				categories []models.Category
+				from time.Time (first day projected)
+				months int
+		Return: models.Forecast
+	*/
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(from.Year(), from.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+	forecast := models.Forecast{
+		From:          from.Format(config.DATE_FORMAT),
+		To:            to.Format(config.DATE_FORMAT),
+		Totals:        map[string]float32{},
+		Months:        []models.ForecastMonth{},
+		PriceChanges:  []models.ForecastPriceChange{},
+		Cancellations: []models.ForecastCancellation{},
+	}
+	index := categoryIndex(categories)
+	monthIndex := map[string]int{}
+	for m := 0; m < months; m++ {
+		month := time.Date(from.Year(), from.Month()+time.Month(m), 1, 0, 0, 0, 0, time.UTC).Format("2006-01")
+		monthIndex[month] = m
+		forecast.Months = append(forecast.Months, models.ForecastMonth{Month: month, Totals: map[string]float32{}, Categories: []models.ForecastCategory{}, Charges: []models.ForecastCharge{}})
+	}
+
+	categoryTotals := make([]map[models.SubscriptionCategory]map[string]float32, months)
+	for _, subscription := range subscriptions {
+		for _, charge := range forecastCharges(subscription, from, to) {
+			m := monthIndex[charge.Date[:7]]
+			month := &forecast.Months[m]
+			month.Charges = append(month.Charges, charge)
+			month.Totals[charge.Currency] = roundCents(float64(month.Totals[charge.Currency]) + float64(charge.Amount))
+			forecast.Totals[charge.Currency] = roundCents(float64(forecast.Totals[charge.Currency]) + float64(charge.Amount))
+			if categoryTotals[m] == nil {
+				categoryTotals[m] = map[models.SubscriptionCategory]map[string]float32{}
+			}
+			if categoryTotals[m][charge.Category] == nil {
+				categoryTotals[m][charge.Category] = map[string]float32{}
+			}
+			totals := categoryTotals[m][charge.Category]
+			totals[charge.Currency] = roundCents(float64(totals[charge.Currency]) + float64(charge.Amount))
+		}
+		forecast.PriceChanges = append(forecast.PriceChanges, forecastPriceChanges(subscription, forecast.From, forecast.To)...)
+		if projected(subscription) && subscription.CancelAt >= forecast.From && subscription.CancelAt <= forecast.To {
+			forecast.Cancellations = append(forecast.Cancellations, models.ForecastCancellation{SubscriptionId: subscription.UUID, Name: subscription.Name, CancelAt: subscription.CancelAt})
+		}
+	}
+
+	for m := range forecast.Months {
+		month := &forecast.Months[m]
+		for categoryId, totals := range categoryTotals[m] {
+			category := models.ForecastCategory{CategoryId: categoryId, Name: string(categoryId), Totals: totals}
+			if known, ok := index[categoryId]; ok {
+				category.Name = known.Name
+				category.Color = known.Color
+			}
+			month.Categories = append(month.Categories, category)
+		}
+		sort.Slice(month.Categories, func(i, j int) bool { return month.Categories[i].CategoryId < month.Categories[j].CategoryId })
+		sort.SliceStable(month.Charges, func(i, j int) bool { return month.Charges[i].Date < month.Charges[j].Date })
+	}
+	sort.SliceStable(forecast.PriceChanges, func(i, j int) bool {
+		return forecast.PriceChanges[i].EffectiveDate < forecast.PriceChanges[j].EffectiveDate
+	})
+	sort.SliceStable(forecast.Cancellations, func(i, j int) bool {
+		return forecast.Cancellations[i].CancelAt < forecast.Cancellations[j].CancelAt
+	})
+	return forecast
+}
+
+func ForecastSpend(ctx context.Context, userName string, months int, filter models.SubscriptionFilter) (models.Forecast, error) {
+	/*
+		Projects the spend of a user's subscriptions for the given number of
+		months, starting with the current one, narrowed down to the filtered
+		category and tags.
+		Params: ctx context.Context
+				userName string
+				months int
+				filter models.SubscriptionFilter
+		Return: models.Forecast, error
+	*/
+	if months < 1 || months > config.FORECAST_MAX_MONTHS {
+		return models.Forecast{}, fmt.Errorf("%w: months must be between 1 and %d", ErrInvalidForecast, config.FORECAST_MAX_MONTHS)
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("months", months).Msg("Forecasting spend")
+	subscriptions, err := GetUserSubscriptions(ctx, userName, filter)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error forecasting spend")
+		return models.Forecast{}, err
+	}
+	categories, err := subscriptionCategories(ctx, userName, subscriptions)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error forecasting spend")
+		return models.Forecast{}, err
+	}
+	forecast := buildForecast(subscriptions, categories, time.Now().UTC(), months)
+	forecast.UserName = userName
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("months", months).Msg("Spend forecast")
+	return forecast, nil
+}
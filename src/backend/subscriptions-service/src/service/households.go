@@ -0,0 +1,504 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrForbidden = errors.New("forbidden")
+var ErrInvalidHousehold = errors.New("invalid household")
+
+// householdPermissions lists what each role may do with a household and
+// its subscriptions
+var householdPermissions = map[models.HouseholdRole][]models.HouseholdAction{
+	models.HouseholdOwner:  {models.HouseholdView, models.HouseholdAddPayment, models.HouseholdEdit, models.HouseholdDelete, models.HouseholdManageMembers},
+	models.HouseholdAdmin:  {models.HouseholdView, models.HouseholdAddPayment, models.HouseholdEdit, models.HouseholdDelete, models.HouseholdManageMembers},
+	models.HouseholdMember: {models.HouseholdView, models.HouseholdAddPayment},
+}
+
+func householdPartition(householdId string) string {
+	/*
+		Returns the subscriptions partition key of a household.
+		Params: householdId string
+		Return: string
+	*/
+	return config.HOUSEHOLD_PARTITION_PREFIX + householdId
+}
+
+func canPerform(role models.HouseholdRole, action models.HouseholdAction) bool {
+	/*
+		Tells whether a household role allows an action.
+		Params: role models.HouseholdRole
+				action models.HouseholdAction
+		Return: bool
+	*/
+	for _, allowed := range householdPermissions[role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+func authorizeHousehold(ctx context.Context, householdId string, userName string, action models.HouseholdAction) (models.HouseholdMembership, error) {
+	/*
+		Returns the active membership of a user in a household, failing with
+		ErrForbidden when the user is not a member or their role does not
+		allow the action.
+		Params: ctx context.Context
+				householdId string
+				userName string
+				action models.HouseholdAction
+		Return: models.HouseholdMembership, error
+	*/
+	membership, err := repository.GetHouseholdMember(ctx, householdId, userName)
+	if err != nil && err.Error() == "404" {
+		return models.HouseholdMembership{}, fmt.Errorf("%w: %s is not a member of the household", ErrForbidden, userName)
+	}
+	if err != nil {
+		return models.HouseholdMembership{}, err
+	}
+	if membership.Status != models.MembershipActive || !canPerform(membership.Role, action) {
+		return models.HouseholdMembership{}, fmt.Errorf("%w: %s may not %s in the household", ErrForbidden, userName, strings.ReplaceAll(string(action), "_", " "))
+	}
+	return membership, nil
+}
+
+func subscriptionPartition(ctx context.Context, subscriptionId string, userName string, action models.HouseholdAction) (string, error) {
+	/*
+		Returns the partition key of a subscription the user can reach: their
+		own, or one of the households they are an active member of, in which
+		case their role must allow the action.
+		Params: ctx context.Context
+				subscriptionId string
+				userName string
+				action models.HouseholdAction
+		Return: string, error
+	*/
+	_, err := repository.GetSubscription(ctx, userName, subscriptionId)
+	if err == nil || err.Error() != "404" {
+		return userName, err
+	}
+	memberships, err := repository.GetUserMemberships(ctx, userName)
+	if err != nil {
+		return "", err
+	}
+	for _, membership := range memberships {
+		if membership.Status != models.MembershipActive {
+			continue
+		}
+		partition := householdPartition(membership.HouseholdId)
+		_, err := repository.GetSubscription(ctx, partition, subscriptionId)
+		if err != nil && err.Error() == "404" {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if !canPerform(membership.Role, action) {
+			return "", fmt.Errorf("%w: %s may not %s in the household", ErrForbidden, userName, strings.ReplaceAll(string(action), "_", " "))
+		}
+		return partition, nil
+	}
+	return "", errors.New("404")
+}
+
+func householdSubscriptions(ctx context.Context, userName string) ([]models.SubscriptionDynamodb, error) {
+	/*
+		Returns the subscriptions of the households a user is an active member of.
+		Params: ctx context.Context
+				userName string
+		Return: []models.SubscriptionDynamodb, error
+	*/
+	memberships, err := repository.GetUserMemberships(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions := []models.SubscriptionDynamodb{}
+	for _, membership := range memberships {
+		if membership.Status != models.MembershipActive {
+			continue
+		}
+		items, err := repository.GetUserSubscriptions(ctx, householdPartition(membership.HouseholdId))
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, items...)
+	}
+	return subscriptions, nil
+}
+
+func CreateHousehold(ctx context.Context, input models.HouseholdCreateInput) (models.HouseholdDetails, error) {
+	/*
+		Creates a household owned by input.UserName.
+		Params: ctx context.Context
+				input models.HouseholdCreateInput
+		Return: models.HouseholdDetails, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Msg("Creating household")
+	now := time.Now().UTC().Format(time.RFC3339)
+	household, err := repository.PutHousehold(ctx, models.Household{
+		HouseholdId: uuid.New().String(),
+		Name:        input.Name,
+		CreatedBy:   input.UserName,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error creating household")
+		return models.HouseholdDetails{}, err
+	}
+	owner, err := repository.PutHouseholdMember(ctx, models.HouseholdMembership{
+		HouseholdId: household.HouseholdId,
+		UserName:    input.UserName,
+		Role:        models.HouseholdOwner,
+		Status:      models.MembershipActive,
+		InvitedBy:   input.UserName,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error creating household")
+		return models.HouseholdDetails{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, household.HouseholdId).Str(logging.UserNameField, input.UserName).Msg("Household created")
+	return models.HouseholdDetails{
+		Household: household,
+		Role:      models.HouseholdOwner,
+		Members:   []models.HouseholdMembership{owner},
+	}, nil
+}
+
+func GetUserHouseholds(ctx context.Context, userName string) ([]models.HouseholdDetails, error) {
+	/*
+		Returns the households of a user along with the pending invitations.
+		Params: ctx context.Context
+				userName string
+		Return: []models.HouseholdDetails, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting user households")
+	memberships, err := repository.GetUserMemberships(ctx, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting user households")
+		return nil, err
+	}
+	households := []models.HouseholdDetails{}
+	for _, membership := range memberships {
+		household, err := repository.GetHousehold(ctx, membership.HouseholdId)
+		if err != nil && err.Error() == "404" {
+			continue
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting user households")
+			return nil, err
+		}
+		households = append(households, models.HouseholdDetails{
+			Household: household,
+			Role:      membership.Role,
+			Members:   []models.HouseholdMembership{membership},
+		})
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("household_count", len(households)).Msg("User households retrieved")
+	return households, nil
+}
+
+func GetHousehold(ctx context.Context, householdId string, userName string) (models.HouseholdDetails, error) {
+	/*
+		Returns a household and its members to one of its members.
+		Params: ctx context.Context
+				householdId string
+				userName string
+		Return: models.HouseholdDetails, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Getting household")
+	membership, err := authorizeHousehold(ctx, householdId, userName, models.HouseholdView)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Error getting household")
+		return models.HouseholdDetails{}, err
+	}
+	household, err := repository.GetHousehold(ctx, householdId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error getting household")
+		return models.HouseholdDetails{}, err
+	}
+	members, err := repository.GetHouseholdMembers(ctx, householdId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error getting household")
+		return models.HouseholdDetails{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Household retrieved")
+	return models.HouseholdDetails{Household: household, Role: membership.Role, Members: members}, nil
+}
+
+func DeleteHousehold(ctx context.Context, householdId string, userName string) error {
+	/*
+		Deletes a household. Only its owner can, and only once it no longer
+		holds any subscription.
+		Params: ctx context.Context
+				householdId string
+				userName string
+		Return: error
+	*/
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Deleting household")
+	membership, err := authorizeHousehold(ctx, householdId, userName, models.HouseholdManageMembers)
+	if err == nil && membership.Role != models.HouseholdOwner {
+		err = fmt.Errorf("%w: only the owner can delete the household", ErrForbidden)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Error deleting household")
+		return err
+	}
+	subscriptions, err := repository.GetUserSubscriptions(ctx, householdPartition(householdId))
+	if err == nil && len(subscriptions) > 0 {
+		err = fmt.Errorf("%w: the household still has %d subscriptions", ErrInvalidHousehold, len(subscriptions))
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error deleting household")
+		return err
+	}
+	err = repository.DeleteHousehold(ctx, householdId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error deleting household")
+		return err
+	}
+	// the household's categories are left behind when they cannot be deleted
+	categories, err := repository.GetCategories(ctx, householdPartition(householdId))
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error deleting household categories")
+	}
+	for _, category := range categories {
+		err = repository.DeleteCategory(ctx, category.UserName, category.CategoryId)
+		if err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error deleting household category")
+		}
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Msg("Household deleted")
+	return nil
+}
+
+func InviteHouseholdMember(ctx context.Context, householdId string, input models.HouseholdInviteInput) (models.HouseholdMembership, error) {
+	/*
+		Invites a user, given by username or email, to a household and emails
+		them the invitation. Admins can only invite members; nobody can be
+		invited as owner.
+		Params: ctx context.Context
+				householdId string
+				input models.HouseholdInviteInput
+		Return: models.HouseholdMembership, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, input.UserName).Msg("Inviting household member")
+	inviter, err := authorizeHousehold(ctx, householdId, input.UserName, models.HouseholdManageMembers)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, input.UserName).Msg("Error inviting household member")
+		return models.HouseholdMembership{}, err
+	}
+	if input.Role == "" {
+		input.Role = models.HouseholdMember
+	}
+	if !input.Role.IsValid() || input.Role == models.HouseholdOwner {
+		return models.HouseholdMembership{}, fmt.Errorf("%w: members are invited as admin or member", ErrInvalidHousehold)
+	}
+	if input.Role == models.HouseholdAdmin && inviter.Role != models.HouseholdOwner {
+		return models.HouseholdMembership{}, fmt.Errorf("%w: only the owner can invite admins", ErrForbidden)
+	}
+
+	invitee, err := resolveParticipant(ctx, models.ShareParticipantInput{UserName: input.InviteeUserName, Email: input.InviteeEmail})
+	if errors.Is(err, ErrInvalidShare) {
+		err = fmt.Errorf("%w: %s", ErrInvalidHousehold, strings.TrimPrefix(err.Error(), ErrInvalidShare.Error()+": "))
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error inviting household member")
+		return models.HouseholdMembership{}, err
+	}
+	_, err = repository.GetHouseholdMember(ctx, householdId, invitee)
+	if err == nil {
+		return models.HouseholdMembership{}, fmt.Errorf("%w: %s is already a member or invited", ErrInvalidHousehold, invitee)
+	}
+	if err.Error() != "404" {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error inviting household member")
+		return models.HouseholdMembership{}, err
+	}
+	household, err := repository.GetHousehold(ctx, householdId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error inviting household member")
+		return models.HouseholdMembership{}, err
+	}
+
+	membership, err := repository.PutHouseholdMember(ctx, models.HouseholdMembership{
+		HouseholdId: householdId,
+		UserName:    invitee,
+		Role:        input.Role,
+		Status:      models.MembershipInvited,
+		InvitedBy:   input.UserName,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Msg("Error inviting household member")
+		return models.HouseholdMembership{}, err
+	}
+
+	// the invitation stays visible in GET /v2/households when the email fails
+	email := input.InviteeEmail
+	if email == "" {
+		email, err = repository.GetUserEmail(ctx, invitee)
+	}
+	if err == nil {
+		err = repository.PublishEmail(ctx, email, householdInvitationSubject(household), householdInvitationBody(household, membership))
+	}
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str(logging.HouseholdIdField, householdId).Str("invitee", invitee).Msg("Error emailing household invitation")
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str("invitee", invitee).Msg("Household member invited")
+	return membership, nil
+}
+
+func householdInvitationSubject(household models.Household) string {
+	/*
+		Returns the subject of a household invitation email.
+		Params: household models.Household
+		Return: string
+	*/
+	return fmt.Sprintf("You are invited to join the %s household", household.Name)
+}
+
+func householdInvitationBody(household models.Household, membership models.HouseholdMembership) string {
+	/*
+		Returns the body of a household invitation email.
+		Params: household models.Household
+				membership models.HouseholdMembership
+		Return: string
+	*/
+	return fmt.Sprintf(`Dear %s,
+
+%s has invited you to join the %s household on SUBHUB as %s %s. Household members see and manage the subscriptions the household shares.
+
+Open SUBHUB to accept the invitation.
+
+Sincerely,
+SUBHUB
+`, membership.UserName, membership.InvitedBy, household.Name, article(string(membership.Role)), membership.Role)
+}
+
+func article(word string) string {
+	/*
+		Returns the indefinite article of a word.
+		Params: word string
+		Return: string
+	*/
+	if strings.ContainsAny(word[:1], "aeiou") {
+		return "an"
+	}
+	return "a"
+}
+
+func AcceptHouseholdInvitation(ctx context.Context, householdId string, userName string) (models.HouseholdMembership, error) {
+	/*
+		Turns the pending invitation of a user into an active membership.
+		Params: ctx context.Context
+				householdId string
+				userName string
+		Return: models.HouseholdMembership, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Accepting household invitation")
+	membership, err := repository.GetHouseholdMember(ctx, householdId, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Error accepting household invitation")
+		return models.HouseholdMembership{}, err
+	}
+	if membership.Status == models.MembershipActive {
+		return membership, nil
+	}
+	membership.Status = models.MembershipActive
+	membership, err = repository.PutHouseholdMember(ctx, membership)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Error accepting household invitation")
+		return models.HouseholdMembership{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Household invitation accepted")
+	return membership, nil
+}
+
+func UpdateHouseholdMemberRole(ctx context.Context, householdId string, userName string, member string, role models.HouseholdRole) (models.HouseholdMembership, error) {
+	/*
+		Changes the role of a member. Only the owner can, and the owner role
+		cannot be given or taken away.
+		Params: ctx context.Context
+				householdId string
+				userName string
+				member string
+				role models.HouseholdRole
+		Return: models.HouseholdMembership, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Str("member", member).Msg("Updating household member role")
+	owner, err := authorizeHousehold(ctx, householdId, userName, models.HouseholdManageMembers)
+	if err == nil && owner.Role != models.HouseholdOwner {
+		err = fmt.Errorf("%w: only the owner can change roles", ErrForbidden)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Error updating household member role")
+		return models.HouseholdMembership{}, err
+	}
+	if !role.IsValid() || role == models.HouseholdOwner || member == userName {
+		return models.HouseholdMembership{}, fmt.Errorf("%w: members can only be made admin or member", ErrInvalidHousehold)
+	}
+	membership, err := repository.GetHouseholdMember(ctx, householdId, member)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str("member", member).Msg("Error updating household member role")
+		return models.HouseholdMembership{}, err
+	}
+	membership.Role = role
+	membership, err = repository.PutHouseholdMember(ctx, membership)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str("member", member).Msg("Error updating household member role")
+		return models.HouseholdMembership{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str("member", member).Str("role", string(role)).Msg("Household member role updated")
+	return membership, nil
+}
+
+func RemoveHouseholdMember(ctx context.Context, householdId string, userName string, member string) error {
+	/*
+		Removes a member or a pending invitation from a household. Members
+		can leave (or decline) on their own; otherwise owners can remove
+		anyone and admins can remove members. The owner cannot leave.
+		Params: ctx context.Context
+				householdId string
+				userName string
+				member string
+		Return: error
+	*/
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Str("member", member).Msg("Removing household member")
+	membership, err := repository.GetHouseholdMember(ctx, householdId, member)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str("member", member).Msg("Error removing household member")
+		return err
+	}
+	if membership.Role == models.HouseholdOwner {
+		err = fmt.Errorf("%w: the owner cannot leave the household", ErrInvalidHousehold)
+	} else if member != userName {
+		var remover models.HouseholdMembership
+		remover, err = authorizeHousehold(ctx, householdId, userName, models.HouseholdManageMembers)
+		if err == nil && membership.Role == models.HouseholdAdmin && remover.Role != models.HouseholdOwner {
+			err = fmt.Errorf("%w: only the owner can remove admins", ErrForbidden)
+		}
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str(logging.UserNameField, userName).Msg("Error removing household member")
+		return err
+	}
+	err = repository.DeleteHouseholdMember(ctx, householdId, member)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.HouseholdIdField, householdId).Str("member", member).Msg("Error removing household member")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.HouseholdIdField, householdId).Str("member", member).Msg("Household member removed")
+	return nil
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidImport = errors.New("invalid import")
+
+// importFields are the subscription fields that can be read from an import file
+var importFields = []string{"name", "url", "plan", "cost", "currency", "start_date", "billing_cycle", "category", "settings_url", "trial_end_date", "tags"}
+
+var requiredImportFields = []string{"name", "cost", "start_date"}
+
+func normalizeHeader(header string) string {
+	/*
+		Normalizes a CSV header so that "Start Date", "start-date" and "start_date" match.
+		Params: header string
+		Return: string
+	*/
+	header = strings.ToLower(strings.TrimSpace(header))
+	header = strings.NewReplacer(" ", "_", "-", "_").Replace(header)
+	return header
+}
+
+func resolveImportColumns(headers []string, mapping map[string]string) (map[string]int, error) {
+	/*
+		Resolves the column index of every import field, using the column mapping
+		(field -> CSV header) when provided and the normalized header name otherwise.
+		Params: headers []string
+				mapping map[string]string
+		Return: map[string]int, error
+	*/
+	headerIndex := map[string]int{}
+	for i, header := range headers {
+		headerIndex[normalizeHeader(header)] = i
+	}
+
+	columns := map[string]int{}
+	for _, field := range importFields {
+		header := field
+		if mapped, ok := mapping[field]; ok {
+			header = mapped
+		}
+		if i, ok := headerIndex[normalizeHeader(header)]; ok {
+			columns[field] = i
+		}
+	}
+
+	for _, field := range requiredImportFields {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("%w: missing column for %s", ErrInvalidImport, field)
+		}
+	}
+	return columns, nil
+}
+
+func splitTags(value string) []string {
+	/*
+		Splits the tags of an import cell, separated by commas or semicolons.
+		Params: value string
+		Return: []string
+	*/
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' })
+}
+
+func parseImportRow(ctx context.Context, userName string, record []string, columns map[string]int, categories []models.Category) (models.SubscriptionDynamodb, []string) {
+	/*
+		Validates a single CSV record and converts it into a subscription.
+		The category may be given by id or by name.
+		Params: ctx context.Context
+				userName string
+				record []string
+				columns map[string]int
+				categories []models.Category (of the user)
+		Return: models.SubscriptionDynamodb, []string (validation errors)
+	*/
+	value := func(field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	rowErrors := []string{}
+	input := models.SubscriptionCreateInput{
+		UserName:     userName,
+		Name:         value("name"),
+		Url:          value("url"),
+		SettingsUrl:  value("settings_url"),
+		Plan:         value("plan"),
+		Cost:         strings.TrimLeft(value("cost"), "$€£"),
+		Currency:     value("currency"),
+		StartDate:    value("start_date"),
+		TrialEndDate: value("trial_end_date"),
+		BillingCycle: models.BillingCycle(strings.ToLower(value("billing_cycle"))),
+		Category:     models.SubscriptionCategory(value("category")),
+		Tags:         splitTags(value("tags")),
+	}
+
+	if input.Name == "" {
+		rowErrors = append(rowErrors, "name is required")
+	}
+	if cost, err := strconv.ParseFloat(input.Cost, 32); err != nil || cost < 0 {
+		rowErrors = append(rowErrors, fmt.Sprintf("invalid cost %q", input.Cost))
+	}
+	if input.Currency != "" && len(input.Currency) != 3 {
+		rowErrors = append(rowErrors, fmt.Sprintf("invalid currency %q", input.Currency))
+	}
+	if _, err := time.Parse(config.DATE_FORMAT, input.StartDate); err != nil {
+		rowErrors = append(rowErrors, fmt.Sprintf("invalid start date %q, expected YYYY-MM-DD", input.StartDate))
+	}
+	if _, err := time.Parse(config.DATE_FORMAT, input.TrialEndDate); input.TrialEndDate != "" && err != nil {
+		rowErrors = append(rowErrors, fmt.Sprintf("invalid trial end date %q, expected YYYY-MM-DD", input.TrialEndDate))
+	}
+	if input.BillingCycle != "" && !input.BillingCycle.IsValid() {
+		rowErrors = append(rowErrors, fmt.Sprintf("invalid billing cycle %q", input.BillingCycle))
+	}
+	if _, err := resolveCategory(categories, input.Category); err != nil {
+		rowErrors = append(rowErrors, fmt.Sprintf("invalid category %q", input.Category))
+	}
+	if _, err := normalizeTags(input.Tags); err != nil {
+		rowErrors = append(rowErrors, strings.TrimPrefix(err.Error(), ErrInvalidCategory.Error()+": "))
+	}
+	if len(rowErrors) > 0 {
+		return models.SubscriptionDynamodb{}, rowErrors
+	}
+
+	item, err := newSubscriptionItem(ctx, uuid.New().String(), input, categories)
+	if err != nil {
+		return models.SubscriptionDynamodb{}, []string{err.Error()}
+	}
+	return item, nil
+}
+
+func ImportSubscriptions(ctx context.Context, input models.SubscriptionImportInput) (models.SubscriptionImportResult, error) {
+	/*
+		Validates every row of a CSV file of subscriptions. When input.Commit is
+		set the valid rows are written to the DynamoDB table, otherwise this is a dry run.
+		Params: ctx context.Context
+				input models.SubscriptionImportInput
+		Return: models.SubscriptionImportResult, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Bool("commit", input.Commit).Msg("Importing subscriptions")
+	result := models.SubscriptionImportResult{DryRun: !input.Commit, Rows: []models.ImportRowResult{}}
+
+	reader := csv.NewReader(strings.NewReader(input.Csv))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	headers, err := reader.Read()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error reading import header")
+		return result, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	columns, err := resolveImportColumns(headers, input.ColumnMapping)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error resolving import columns")
+		return result, err
+	}
+	categories, err := partitionCategories(ctx, input.UserName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error getting import categories")
+		return result, err
+	}
+
+	valid := []models.SubscriptionDynamodb{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if row > config.IMPORT_MAX_ROWS {
+			return result, fmt.Errorf("%w: more than %d rows", ErrInvalidImport, config.IMPORT_MAX_ROWS)
+		}
+		result.TotalRows++
+		if err != nil {
+			result.InvalidRows++
+			result.Rows = append(result.Rows, models.ImportRowResult{Row: row, Errors: []string{err.Error()}})
+			continue
+		}
+
+		item, rowErrors := parseImportRow(ctx, input.UserName, record, columns, categories)
+		if len(rowErrors) > 0 {
+			result.InvalidRows++
+			result.Rows = append(result.Rows, models.ImportRowResult{Row: row, Errors: rowErrors})
+			continue
+		}
+		result.ValidRows++
+		valid = append(valid, item)
+		result.Rows = append(result.Rows, models.ImportRowResult{Row: row, Valid: true, Subscription: &item})
+	}
+
+	if input.Commit && len(valid) > 0 {
+		err = repository.BatchAddSubscriptions(ctx, valid)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error committing imported subscriptions")
+			return result, err
+		}
+		result.Imported = len(valid)
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Int("valid_rows", result.ValidRows).Int("invalid_rows", result.InvalidRows).Int("imported", result.Imported).Msg("Subscriptions imported")
+	return result, nil
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/models"
+	"time"
+)
+
+// ledgerAccountNames are the default expense account leaves of each category
+var ledgerAccountNames = map[models.SubscriptionCategory]string{
+	models.OTT:       "Streaming",
+	models.Music:     "Music",
+	models.Gaming:    "Gaming",
+	models.Delivery:  "Delivery",
+	models.Fitness:   "Fitness",
+	models.Education: "Education",
+	models.Magazine:  "Magazines",
+	models.Software:  "Software",
+	models.Finance:   "Finance",
+	models.Fashion:   "Fashion",
+	models.Other:     "Other",
+}
+
+// ledgerPeriods are the period expressions of each billing cycle
+var ledgerPeriods = map[models.BillingCycle]string{
+	models.Weekly:    "weekly",
+	models.Monthly:   "monthly",
+	models.Quarterly: "quarterly",
+	models.Yearly:    "yearly",
+}
+
+var accountComponentRegex = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+func sanitizeAccount(account string) string {
+	/*
+		Makes an account name valid for both Ledger and Beancount: every
+		component starts with a capital letter and holds no spaces or symbols.
+		Params: account string
+		Return: string
+	*/
+	components := []string{}
+	for _, component := range strings.Split(account, ":") {
+		component = accountComponentRegex.ReplaceAllString(strings.TrimSpace(component), "")
+		if component == "" {
+			continue
+		}
+		components = append(components, strings.ToUpper(component[:1])+component[1:])
+	}
+	return strings.Join(components, ":")
+}
+
+func expenseAccount(category models.SubscriptionCategory, categories map[models.SubscriptionCategory]models.Category, options models.LedgerOptions) string {
+	/*
+		Returns the expense account of a category, honouring the configured
+		mapping. Custom categories are booked under their name.
+		Params: category models.SubscriptionCategory
+				categories map[models.SubscriptionCategory]models.Category
+				options models.LedgerOptions
+		Return: string
+	*/
+	if account, ok := options.Accounts[category]; ok && account != "" {
+		return sanitizeAccount(account)
+	}
+	name, ok := ledgerAccountNames[category]
+	if custom, isCustom := categories[category]; !ok && isCustom {
+		name, ok = custom.Name, true
+	}
+	if !ok {
+		name = ledgerAccountNames[models.Other]
+	}
+	return sanitizeAccount(config.LEDGER_EXPENSE_ACCOUNT_PREFIX + ":" + name)
+}
+
+func fundingAccount(options models.LedgerOptions) string {
+	/*
+		Returns the account the payments are drawn from.
+		Params: options models.LedgerOptions
+		Return: string
+	*/
+	if options.FundingAccount != "" {
+		return sanitizeAccount(options.FundingAccount)
+	}
+	return config.LEDGER_FUNDING_ACCOUNT
+}
+
+func ledgerCurrency(subscription models.SubscriptionDynamodb) string {
+	/*
+		Returns the commodity of a subscription's amounts.
+		Params: subscription models.SubscriptionDynamodb
+		Return: string
+	*/
+	if subscription.Currency == "" {
+		return config.DEFAULT_CURRENCY
+	}
+	return subscription.Currency
+}
+
+func ledgerPeriod(subscription models.SubscriptionDynamodb) string {
+	/*
+		Returns the period expression of a subscription's billing cycle.
+		Params: subscription models.SubscriptionDynamodb
+		Return: string
+	*/
+	return ledgerPeriods[billingCycleOf(subscription)]
+}
+
+func ledgerStartDate(subscription models.SubscriptionExport) (string, bool) {
+	/*
+		Returns the date a subscription's entries start on: its start date, or
+		the date of its first payment when it has none.
+		Params: subscription models.SubscriptionExport
+		Return: string, bool (false when neither date is known)
+	*/
+	if _, err := time.Parse(config.DATE_FORMAT, subscription.StartDate); err == nil {
+		return subscription.StartDate, true
+	}
+	first := ""
+	for _, payment := range subscription.Payments {
+		if _, err := time.Parse(config.DATE_FORMAT, payment.PaymentDate); err != nil {
+			continue
+		}
+		if first == "" || payment.PaymentDate < first {
+			first = payment.PaymentDate
+		}
+	}
+	return first, first != ""
+}
+
+func writeExportLedger(export models.UserExport, options models.LedgerOptions) []byte {
+	/*
+		Writes the charged payments as Ledger/hledger transactions, net of
+		their refunds, followed by a periodic transaction (~ monthly) for
+		every active subscription, up to its scheduled end, so that budget
+		reports forecast the recurring spend.
+		Params: export models.UserExport
+				options models.LedgerOptions
+		Return: []byte
+	*/
+	var out strings.Builder
+	funding := fundingAccount(options)
+	categories := categoryIndex(export.Categories)
+	fmt.Fprintf(&out, "; Subscriptions of %s exported on %s\n\n", export.UserName, time.Now().UTC().Format(config.DATE_FORMAT))
+
+	for _, subscription := range export.Subscriptions {
+		account := expenseAccount(subscription.Category, categories, options)
+		currency := ledgerCurrency(subscription.SubscriptionDynamodb)
+		for _, payment := range subscription.Payments {
+			if netPaymentAmount(payment) <= 0 {
+				continue
+			}
+			fmt.Fprintf(&out, "%s * %s\n", payment.PaymentDate, subscription.Name)
+			fmt.Fprintf(&out, "    ; subscription_id: %s\n", subscription.UUID)
+			fmt.Fprintf(&out, "    ; payment_id: %s\n", payment.UUID)
+			if payment.RefundedAmount > 0 {
+				fmt.Fprintf(&out, "    ; refunded: %s %s\n", formatAmount(payment.RefundedAmount), currency)
+			}
+			fmt.Fprintf(&out, "    %-40s  %s %s\n", account, formatAmount(netPaymentAmount(payment)), currency)
+			fmt.Fprintf(&out, "    %s\n\n", funding)
+		}
+	}
+
+	for _, subscription := range export.Subscriptions {
+		startDate, ok := ledgerStartDate(subscription)
+		if !ok || !projected(subscription.SubscriptionDynamodb) {
+			continue
+		}
+		period := ledgerPeriod(subscription.SubscriptionDynamodb) + " from " + startDate
+		if subscription.CancelAt != "" {
+			// the end of a period expression is exclusive, as cancel_at is
+			period += " to " + subscription.CancelAt
+		}
+		fmt.Fprintf(&out, "~ %s  ; %s\n", period, subscription.Name)
+		fmt.Fprintf(&out, "    %-40s  %s %s\n", expenseAccount(subscription.Category, categories, options), formatAmount(subscription.Cost), ledgerCurrency(subscription.SubscriptionDynamodb))
+		fmt.Fprintf(&out, "    %s\n\n", funding)
+	}
+	return []byte(out.String())
+}
+
+func beancountString(value string) string {
+	/*
+		Quotes a value as a Beancount string.
+		Params: value string
+		Return: string
+	*/
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func writeExportBeancount(export models.UserExport, options models.LedgerOptions) []byte {
+	/*
+		Writes the charged payments as Beancount transactions, net of their
+		refunds, opening every account on its first use, followed by custom
+		"budget" entries per expense account so that budgets (e.g. in Fava)
+		forecast the recurring spend of the active subscriptions, up to their
+		scheduled end.
+		Params: export models.UserExport
+				options models.LedgerOptions
+		Return: []byte
+	*/
+	var out strings.Builder
+	funding := fundingAccount(options)
+	categories := categoryIndex(export.Categories)
+	fmt.Fprintf(&out, "; Subscriptions of %s exported on %s\n\n", export.UserName, time.Now().UTC().Format(config.DATE_FORMAT))
+
+	// accounts must be opened on or before their first posting
+	openDates := map[string]string{}
+	open := func(account string, date string) {
+		if current, ok := openDates[account]; !ok || date < current {
+			openDates[account] = date
+		}
+	}
+	for _, subscription := range export.Subscriptions {
+		account := expenseAccount(subscription.Category, categories, options)
+		if startDate, ok := ledgerStartDate(subscription); ok {
+			open(account, startDate)
+			open(funding, startDate)
+		}
+		for _, payment := range subscription.Payments {
+			open(account, payment.PaymentDate)
+			open(funding, payment.PaymentDate)
+		}
+	}
+	accounts := []string{}
+	for account := range openDates {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		fmt.Fprintf(&out, "%s open %s\n", openDates[account], account)
+	}
+	out.WriteString("\n")
+
+	for _, subscription := range export.Subscriptions {
+		account := expenseAccount(subscription.Category, categories, options)
+		currency := ledgerCurrency(subscription.SubscriptionDynamodb)
+		for _, payment := range subscription.Payments {
+			if netPaymentAmount(payment) <= 0 {
+				continue
+			}
+			fmt.Fprintf(&out, "%s * %s %s\n", payment.PaymentDate, beancountString(subscription.Name), beancountString(subscription.Plan))
+			fmt.Fprintf(&out, "  subscription_id: %s\n", beancountString(subscription.UUID))
+			fmt.Fprintf(&out, "  payment_id: %s\n", beancountString(payment.UUID))
+			if payment.RefundedAmount > 0 {
+				fmt.Fprintf(&out, "  refunded: %s\n", beancountString(formatAmount(payment.RefundedAmount)+" "+currency))
+			}
+			fmt.Fprintf(&out, "  %-40s  %s %s\n", account, formatAmount(netPaymentAmount(payment)), currency)
+			fmt.Fprintf(&out, "  %s\n\n", funding)
+		}
+	}
+
+	// a budget entry replaces the previous one of the same account, so each
+	// entry carries the running monthly total of the account's subscriptions,
+	// which drops again on the date a subscription is cancelled at
+	type budgetChange struct {
+		date     string
+		account  string
+		currency string
+		amount   float64
+	}
+	changes := []budgetChange{}
+	for _, subscription := range export.Subscriptions {
+		startDate, ok := ledgerStartDate(subscription)
+		// a subscription without any date cannot be placed in time
+		if !ok || !projected(subscription.SubscriptionDynamodb) {
+			continue
+		}
+		if subscription.CancelAt != "" && subscription.CancelAt <= startDate {
+			continue
+		}
+		change := budgetChange{
+			date:     startDate,
+			account:  expenseAccount(subscription.Category, categories, options),
+			currency: ledgerCurrency(subscription.SubscriptionDynamodb),
+			amount:   monthlyCost(subscription.SubscriptionDynamodb),
+		}
+		changes = append(changes, change)
+		if subscription.CancelAt != "" {
+			change.date, change.amount = subscription.CancelAt, -change.amount
+			changes = append(changes, change)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].date < changes[j].date })
+	budgets := map[string]map[string]float64{}
+	for _, change := range changes {
+		if budgets[change.account] == nil {
+			budgets[change.account] = map[string]float64{}
+		}
+		budgets[change.account][change.currency] += change.amount
+		fmt.Fprintf(&out, "%s custom \"budget\" %s \"monthly\" %.2f %s\n", change.date, change.account, math.Max(budgets[change.account][change.currency], 0), change.currency)
+	}
+	return []byte(out.String())
+}
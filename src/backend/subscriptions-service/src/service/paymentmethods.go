@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidPaymentMethod = errors.New("invalid payment method")
+
+func hasDigitRun(value string, length int) bool {
+	/*
+		Tells whether a value holds a run of digits of at least the given
+		length, such as a pasted card or account number.
+		Params: value string
+				length int
+		Return: bool
+	*/
+	run := 0
+	for _, char := range value {
+		switch {
+		case char >= '0' && char <= '9':
+			run++
+			if run >= length {
+				return true
+			}
+		case char == ' ' || char == '-':
+		default:
+			run = 0
+		}
+	}
+	return false
+}
+
+func checkPaymentMethod(method models.PaymentMethod) error {
+	/*
+		Checks a payment method. Only the last four digits of a number may be
+		stored, so a nickname or brand holding a longer number is rejected.
+		Cards need an expiry, other methods have none.
+		Params: method models.PaymentMethod
+		Return: error
+	*/
+	if !method.Type.IsValid() {
+		return fmt.Errorf("%w: type must be %q, %q or %q", ErrInvalidPaymentMethod, models.CardPaymentMethod, models.BankPaymentMethod, models.WalletPaymentMethod)
+	}
+	if method.Nickname == "" || len(method.Nickname) > config.PAYMENT_METHOD_NICKNAME_MAX_LENGTH {
+		return fmt.Errorf("%w: nickname must be 1 to %d characters", ErrInvalidPaymentMethod, config.PAYMENT_METHOD_NICKNAME_MAX_LENGTH)
+	}
+	if hasDigitRun(method.Nickname, 5) || hasDigitRun(method.Brand, 5) {
+		return fmt.Errorf("%w: only the last four digits of a number may be stored", ErrInvalidPaymentMethod)
+	}
+	if method.LastFour != "" && (len(method.LastFour) != 4 || !hasDigitRun(method.LastFour, 4)) {
+		return fmt.Errorf("%w: last_four must be 4 digits", ErrInvalidPaymentMethod)
+	}
+	if method.Type != models.CardPaymentMethod {
+		if method.ExpiryMonth != 0 || method.ExpiryYear != 0 {
+			return fmt.Errorf("%w: only cards have an expiry", ErrInvalidPaymentMethod)
+		}
+		return nil
+	}
+	if method.ExpiryMonth < 1 || method.ExpiryMonth > 12 {
+		return fmt.Errorf("%w: expiry_month must be 1 to 12", ErrInvalidPaymentMethod)
+	}
+	if method.ExpiryYear < 2000 || method.ExpiryYear > 2099 {
+		return fmt.Errorf("%w: expiry_year must be a four digit year", ErrInvalidPaymentMethod)
+	}
+	return nil
+}
+
+func paymentMethodExpiry(method models.PaymentMethod) (time.Time, bool) {
+	/*
+		Returns the last day a card can be charged: the last day of its
+		expiry month.
+		Params: method models.PaymentMethod
+		Return: time.Time, bool (whether the method expires)
+	*/
+	if method.Type != models.CardPaymentMethod || method.ExpiryMonth == 0 {
+		return time.Time{}, false
+	}
+	return time.Date(method.ExpiryYear, time.Month(method.ExpiryMonth)+1, 0, 0, 0, 0, 0, time.UTC), true
+}
+
+func paymentMethodDetails(method models.PaymentMethod, subscriptions []models.SubscriptionDynamodb, now time.Time) models.PaymentMethodDetails {
+	/*
+		Returns a payment method with its expiry and the subscriptions paid
+		with it.
+		Params: method models.PaymentMethod
+				subscriptions []models.SubscriptionDynamodb (of the user)
+				now time.Time
+		Return: models.PaymentMethodDetails
+	*/
+	details := models.PaymentMethodDetails{PaymentMethod: method, SubscriptionIds: []string{}}
+	if expiresOn, ok := paymentMethodExpiry(method); ok {
+		details.ExpiresOn = expiresOn.Format(config.DATE_FORMAT)
+		details.Expired = expiresOn.Before(now.Truncate(24 * time.Hour))
+	}
+	for _, subscription := range subscriptions {
+		if subscription.PaymentMethodId == method.PaymentMethodId {
+			details.SubscriptionIds = append(details.SubscriptionIds, subscription.UUID)
+		}
+	}
+	return details
+}
+
+func validatePaymentMethodLink(ctx context.Context, userName string, paymentMethodId string) error {
+	/*
+		Checks that a subscription is linked to one of the user's payment
+		methods. An empty id unlinks it.
+		Params: ctx context.Context
+				userName string
+				paymentMethodId string
+		Return: error
+	*/
+	if paymentMethodId == "" {
+		return nil
+	}
+	_, err := repository.GetPaymentMethod(ctx, userName, paymentMethodId)
+	if err != nil && err.Error() == "404" {
+		return fmt.Errorf("%w: unknown payment method %q", ErrInvalidSubscription, paymentMethodId)
+	}
+	return err
+}
+
+func CreatePaymentMethod(ctx context.Context, input models.PaymentMethodInput) (models.PaymentMethodDetails, error) {
+	/*
+		Adds a card or account paying for the subscriptions of a user.
+		Params: ctx context.Context
+				input models.PaymentMethodInput
+		Return: models.PaymentMethodDetails, error
+	*/
+	now := time.Now().UTC()
+	method := models.PaymentMethod{
+		UserName:        input.UserName,
+		PaymentMethodId: uuid.New().String(),
+		Type:            input.Type,
+		Nickname:        strings.TrimSpace(input.Nickname),
+		Brand:           strings.TrimSpace(input.Brand),
+		LastFour:        strings.TrimSpace(input.LastFour),
+		ExpiryMonth:     input.ExpiryMonth,
+		ExpiryYear:      input.ExpiryYear,
+		CreatedAt:       now.Format(time.RFC3339),
+		UpdatedAt:       now.Format(time.RFC3339),
+	}
+	err := checkPaymentMethod(method)
+	if err != nil {
+		return models.PaymentMethodDetails{}, err
+	}
+	methods, err := repository.GetPaymentMethods(ctx, input.UserName)
+	if err != nil {
+		return models.PaymentMethodDetails{}, err
+	}
+	if len(methods) >= config.PAYMENT_METHOD_MAX_PER_USER {
+		return models.PaymentMethodDetails{}, fmt.Errorf("%w: a user can add up to %d payment methods", ErrInvalidPaymentMethod, config.PAYMENT_METHOD_MAX_PER_USER)
+	}
+	method, err = repository.PutPaymentMethod(ctx, method)
+	if err != nil {
+		return models.PaymentMethodDetails{}, err
+	}
+	return paymentMethodDetails(method, nil, now), nil
+}
+
+func GetPaymentMethods(ctx context.Context, userName string) ([]models.PaymentMethodDetails, error) {
+	/*
+		Returns the payment methods of a user with the subscriptions paid
+		with each, oldest first.
+		Params: ctx context.Context
+				userName string
+		Return: []models.PaymentMethodDetails, error
+	*/
+	methods, err := repository.GetPaymentMethods(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := GetUserSubscriptions(ctx, userName, models.SubscriptionFilter{})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].CreatedAt < methods[j].CreatedAt })
+	now := time.Now().UTC()
+	details := make([]models.PaymentMethodDetails, len(methods))
+	for i, method := range methods {
+		details[i] = paymentMethodDetails(method, subscriptions, now)
+	}
+	return details, nil
+}
+
+func GetPaymentMethod(ctx context.Context, paymentMethodId string, userName string) (models.PaymentMethodDetails, error) {
+	/*
+		Returns a payment method of a user with the subscriptions paid with it.
+		Params: ctx context.Context
+				paymentMethodId string
+				userName string
+		Return: models.PaymentMethodDetails, error
+	*/
+	method, err := repository.GetPaymentMethod(ctx, userName, paymentMethodId)
+	if err != nil {
+		return models.PaymentMethodDetails{}, err
+	}
+	subscriptions, err := GetUserSubscriptions(ctx, userName, models.SubscriptionFilter{})
+	if err != nil {
+		return models.PaymentMethodDetails{}, err
+	}
+	return paymentMethodDetails(method, subscriptions, time.Now().UTC()), nil
+}
+
+func UpdatePaymentMethod(ctx context.Context, paymentMethodId string, input models.PaymentMethodInput) (models.PaymentMethodDetails, error) {
+	/*
+		Updates the given fields of a payment method. A renewed card gets its
+		new expiry here, which rearms the expiry alert.
+		Params: ctx context.Context
+				paymentMethodId string
+				input models.PaymentMethodInput
+		Return: models.PaymentMethodDetails, error
+	*/
+	method, err := repository.GetPaymentMethod(ctx, input.UserName, paymentMethodId)
+	if err != nil {
+		return models.PaymentMethodDetails{}, err
+	}
+	if input.Type != "" {
+		method.Type = input.Type
+		if method.Type != models.CardPaymentMethod {
+			method.ExpiryMonth, method.ExpiryYear = 0, 0
+		}
+	}
+	if nickname := strings.TrimSpace(input.Nickname); nickname != "" {
+		method.Nickname = nickname
+	}
+	if brand := strings.TrimSpace(input.Brand); brand != "" {
+		method.Brand = brand
+	}
+	if lastFour := strings.TrimSpace(input.LastFour); lastFour != "" {
+		method.LastFour = lastFour
+	}
+	if input.ExpiryMonth != 0 {
+		method.ExpiryMonth = input.ExpiryMonth
+	}
+	if input.ExpiryYear != 0 {
+		method.ExpiryYear = input.ExpiryYear
+	}
+	err = checkPaymentMethod(method)
+	if err != nil {
+		return models.PaymentMethodDetails{}, err
+	}
+	method.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	method, err = repository.PutPaymentMethod(ctx, method)
+	if err != nil {
+		return models.PaymentMethodDetails{}, err
+	}
+	subscriptions, err := GetUserSubscriptions(ctx, input.UserName, models.SubscriptionFilter{})
+	if err != nil {
+		return models.PaymentMethodDetails{}, err
+	}
+	return paymentMethodDetails(method, subscriptions, time.Now().UTC()), nil
+}
+
+func DeletePaymentMethod(ctx context.Context, paymentMethodId string, userName string) error {
+	/*
+		Deletes a payment method of a user and unlinks the subscriptions
+		paid with it.
+		Params: ctx context.Context
+				paymentMethodId string
+				userName string
+		Return: error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str(logging.PaymentMethodIdField, paymentMethodId).Msg("Deleting payment method")
+	err := repository.DeletePaymentMethod(ctx, userName, paymentMethodId)
+	if err != nil {
+		return err
+	}
+	subscriptions, err := GetUserSubscriptions(ctx, userName, models.SubscriptionFilter{})
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		if subscription.PaymentMethodId != paymentMethodId {
+			continue
+		}
+		// the partition of a household subscription is held in its user name
+		err = repository.UpdateSubscriptionPaymentMethod(ctx, subscription.UserName, subscription.UUID, "")
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscription.UUID).Msg("Error unlinking payment method")
+			return err
+		}
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str(logging.PaymentMethodIdField, paymentMethodId).Msg("Payment method deleted")
+	return nil
+}
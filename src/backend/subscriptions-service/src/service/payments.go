@@ -1,118 +1,408 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
 	"subHandler/src/models"
 	"subHandler/src/repository"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
-func AddPayment(item models.PaymentCreateInput) (models.PaymentDynamodb, error) {
+var ErrInvalidPayment = errors.New("invalid payment")
+
+// ErrPaymentChanged is the error of a refund whose payment was changed or
+// refunded while it was being recorded
+var ErrPaymentChanged = errors.New("the payment was changed concurrently")
+
+func reachablePayment(ctx context.Context, subscriptionId string, paymentId string, userName string, action models.HouseholdAction) (models.PaymentDynamodb, error) {
+	/*
+		Returns a payment of a subscription the user can reach, checking that
+		their household role allows the action on the subscription.
+		Params: ctx context.Context
+				subscriptionId string
+				paymentId string
+				userName string
+				action models.HouseholdAction
+		Return: models.PaymentDynamodb, error
+	*/
+	_, err := subscriptionPartition(ctx, subscriptionId, userName, action)
+	if err != nil {
+		return models.PaymentDynamodb{}, err
+	}
+	payment, err := repository.GetSubscriptionPayment(ctx, subscriptionId, paymentId)
+	if err != nil {
+		return models.PaymentDynamodb{}, err
+	}
+	if payment.UUID == "" {
+		return models.PaymentDynamodb{}, errors.New("404")
+	}
+	return payment, nil
+}
+
+func paymentStatus(payment models.PaymentDynamodb) models.PaymentStatus {
+	/*
+		Returns the status of a payment. Payments recorded before statuses
+		were paid.
+		Params: payment models.PaymentDynamodb
+		Return: models.PaymentStatus
+	*/
+	if payment.Status == "" {
+		return models.PaymentStatusPaid
+	}
+	return payment.Status
+}
+
+func paymentCharged(payment models.PaymentDynamodb) bool {
+	/*
+		Tells whether a payment was charged, refunded or not. Scheduled and
+		failed payments moved no money.
+		Params: payment models.PaymentDynamodb
+		Return: bool
+	*/
+	status := paymentStatus(payment)
+	return status != models.PaymentStatusScheduled && status != models.PaymentStatusFailed
+}
+
+func netPaymentAmount(payment models.PaymentDynamodb) float32 {
+	/*
+		Returns what a payment cost once its refunds are netted out, nothing
+		when it was not charged.
+		Params: payment models.PaymentDynamodb
+		Return: float32
+	*/
+	if !paymentCharged(payment) {
+		return 0
+	}
+	return roundCents(float64(payment.Amount - payment.RefundedAmount))
+}
+
+func checkPaymentStatus(status models.PaymentStatus, failureReason string) error {
+	/*
+		Checks a status set on a payment by hand. The refunded statuses follow
+		from the refunds recorded, and only failed payments have a reason.
+		Params: status models.PaymentStatus
+				failureReason string
+		Return: error
+	*/
+	if status == models.PaymentStatusRefunded || status == models.PaymentStatusPartiallyRefunded {
+		return fmt.Errorf("%w: status %q is set by recording a refund", ErrInvalidPayment, status)
+	}
+	if !status.IsValid() {
+		return fmt.Errorf("%w: status must be %q, %q or %q", ErrInvalidPayment, models.PaymentStatusScheduled, models.PaymentStatusPaid, models.PaymentStatusFailed)
+	}
+	if failureReason != "" && status != models.PaymentStatusFailed {
+		return fmt.Errorf("%w: only failed payments have a failure_reason", ErrInvalidPayment)
+	}
+	if len(failureReason) > config.PAYMENT_REASON_MAX_LENGTH {
+		return fmt.Errorf("%w: failure_reason is longer than %d characters", ErrInvalidPayment, config.PAYMENT_REASON_MAX_LENGTH)
+	}
+	return nil
+}
+
+func AddPayment(ctx context.Context, item models.PaymentCreateInput) (models.PaymentDynamodb, error) {
 	/*
 		Adds a given Item to the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 			    tableName
 				item models.PaymentCreateInput
 		Return: None
 	*/
 	uuid := uuid.New().String()
+	// the subscription must be the user's own or one of a household whose
+	// role lets them add payments
+	_, err := subscriptionPartition(ctx, item.SubscriptionId, item.UserName, models.HouseholdAddPayment)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, item.SubscriptionId).Str(logging.UserNameField, item.UserName).Msg("Error adding payment")
+		return models.PaymentDynamodb{}, err
+	}
 	amountFloat, convErr := strconv.ParseFloat(item.Amount, 32)
 	if convErr != nil {
-		log.Error().Err(convErr).Str("SubscriptionId", uuid).Str("UserName", item.UserName).Msg("Error converting cost to float")
+		log.Ctx(ctx).Error().Err(convErr).Str(logging.PaymentIdField, uuid).Str(logging.UserNameField, item.UserName).Msg("Error converting cost to float")
 		return models.PaymentDynamodb{}, convErr
 	}
+	if item.Status == "" {
+		item.Status = models.PaymentStatusPaid
+	}
+	item.FailureReason = strings.TrimSpace(item.FailureReason)
+	err = checkPaymentStatus(item.Status, item.FailureReason)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, item.SubscriptionId).Str(logging.UserNameField, item.UserName).Msg("Error adding payment")
+		return models.PaymentDynamodb{}, err
+	}
+	tax, err := resolvePaymentTax(float32(amountFloat), item.PaymentTaxInput)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, item.SubscriptionId).Str(logging.UserNameField, item.UserName).Msg("Error adding payment")
+		return models.PaymentDynamodb{}, err
+	}
 	paymentNew := models.PaymentDynamodb{
 		UUID:           uuid,
 		SubscriptionId: item.SubscriptionId,
 		UserName:       item.UserName,
 		Amount:         float32(amountFloat),
 		PaymentDate:    item.PaymentDate,
+		Status:         item.Status,
+		FailureReason:  item.FailureReason,
+		PaymentTax:     tax,
 	}
 
-	log.Info().Str("UUID", uuid).Str("SubscriptionId", item.SubscriptionId).Msg("Adding payment")
-	res, err := repository.AddSubscriptionPayment(paymentNew)
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, uuid).Str(logging.SubscriptionIdField, item.SubscriptionId).Msg("Adding payment")
+	res, err := repository.AddSubscriptionPayment(ctx, paymentNew)
 	if err != nil {
-		log.Error().Err(err).Str("UUID", uuid).Str("SubscriptionId", item.SubscriptionId).Msg("Error adding payment")
+		log.Ctx(ctx).Error().Err(err).Str(logging.PaymentIdField, uuid).Str(logging.SubscriptionIdField, item.SubscriptionId).Msg("Error adding payment")
 		return models.PaymentDynamodb{}, err
 	}
-	log.Info().Str("UUID", uuid).Str("SubscriptionId", item.SubscriptionId).Msg("Payment added")
+	log.Ctx(ctx).Info().Str(logging.PaymentIdField, uuid).Str(logging.SubscriptionIdField, item.SubscriptionId).Msg("Payment added")
 	return res, nil
 }
 
-func GetPayments(subscriptionId string) ([]models.PaymentDynamodb, error) {
+func GetPayments(ctx context.Context, subscriptionId string) ([]models.PaymentDynamodb, error) {
 	/*
 		Returns all the payments for a given subscription.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName
 				partitionKey
 		Return: []models.PaymentDynamodb, error
 	*/
-	log.Info().Str("SubscriptionId", subscriptionId).Msg("Getting payments")
-	res, err := repository.GetSubscriptionPayments(subscriptionId)
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Msg("Getting payments")
+	res, err := repository.GetSubscriptionPayments(ctx, subscriptionId)
 	if err != nil {
-		log.Error().Err(err).Str("SubscriptionId", subscriptionId).Msg("Error getting payments")
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error getting payments")
 		return []models.PaymentDynamodb{}, err
 	}
-	log.Info().Str("SubscriptionId", subscriptionId).Msg("Payments retrieved")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Msg("Payments retrieved")
 	return res, nil
 }
 
-func GetPayment(subscriptionId string, paymentId string) (models.PaymentDynamodb, error) {
+func GetPayment(ctx context.Context, subscriptionId string, paymentId string) (models.PaymentDynamodb, error) {
 	/*
 		Returns a payment for a given subscription.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName
 				partitionKey
 				sortKey
 		Return: models.PaymentDynamodb, error
 	*/
-	log.Info().Str("SubscriptionId", subscriptionId).Str("PaymentId", paymentId).Msg("Getting payment")
-	res, err := repository.GetSubscriptionPayment(subscriptionId, paymentId)
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Getting payment")
+	res, err := repository.GetSubscriptionPayment(ctx, subscriptionId, paymentId)
 	if err != nil {
-		log.Error().Err(err).Str("SubscriptionId", subscriptionId).Str("PaymentId", paymentId).Msg("Error getting payment")
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Error getting payment")
 		return models.PaymentDynamodb{}, err
 	}
-	log.Info().Str("SubscriptionId", subscriptionId).Str("PaymentId", paymentId).Msg("Payment retrieved")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Payment retrieved")
 	return res, nil
 }
 
-func UpdatePayment(subscriptionId string, paymentId string, item models.PaymentUpdate) (models.PaymentDynamodb, error) {
+func UpdatePayment(ctx context.Context, subscriptionId string, paymentId string, userName string, item models.PaymentUpdate) (models.PaymentDynamodb, error) {
 	/*
-		Updates a payment for a given subscription.
-		Params: dynamoClient *dynamodb.DynamoDB
-				tableName
-				partitionKey
-				sortKey
+		Updates a payment for a given subscription, when the user's household
+		role allows editing it. A refunded payment keeps its status and cannot
+		cost less than was refunded.
+		Params: ctx context.Context
+				subscriptionId string
+				paymentId string
+				userName string
 				item models.PaymentUpdate
 		Return: models.PaymentDynamodb, error
 	*/
-	log.Info().Str("SubscriptionId", subscriptionId).Str("PaymentId", paymentId).Msg("Updating payment")
-	res, err := repository.UpdateSubscriptionPayment(subscriptionId, paymentId, item)
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Updating payment")
+	payment, err := reachablePayment(ctx, subscriptionId, paymentId, userName, models.HouseholdEdit)
+	if err == nil {
+		err = checkPaymentUpdate(payment, &item)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Error updating payment")
+		return models.PaymentDynamodb{}, err
+	}
+	res, err := repository.UpdateSubscriptionPayment(ctx, subscriptionId, paymentId, item)
 	if err != nil {
-		log.Error().Err(err).Str("SubscriptionId", subscriptionId).Str("PaymentId", paymentId).Msg("Error updating payment")
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Error updating payment")
 		return models.PaymentDynamodb{}, err
 	}
-	log.Info().Str("SubscriptionId", subscriptionId).Str("PaymentId", paymentId).Msg("Payment updated")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Payment updated")
 	return res, nil
 }
 
-func DeletePayment(subscriptionId string, paymentId string) error {
+func DeletePayment(ctx context.Context, subscriptionId string, paymentId string, userName string) error {
 	/*
-		Deletes a payment for a given subscription.
-		Params: dynamoClient *dynamodb.DynamoDB
-				tableName
-				partitionKey
-				sortKey
+		Deletes a payment for a given subscription, with its attachments
+		and refunds, when the user's household role allows deleting it.
+		Params: ctx context.Context
+				subscriptionId string
+				paymentId string
+				userName string
 		Return: error
 	*/
-	log.Info().Str("SubscriptionId", subscriptionId).Str("PaymentId", paymentId).Msg("Deleting payment")
-	err := repository.DeleteSubscriptionPayment(subscriptionId, paymentId)
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Deleting payment")
+	// the attachments and refunds are keyed by the payment alone, so the
+	// payment must be found under the subscription before they are deleted
+	_, err := reachablePayment(ctx, subscriptionId, paymentId, userName, models.HouseholdDelete)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Error deleting payment")
+		return err
+	}
+	err = deletePaymentAttachments(ctx, paymentId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Error deleting payment attachments")
+		return err
+	}
+	err = repository.DeletePaymentRefunds(ctx, paymentId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Error deleting payment refunds")
+		return err
+	}
+	err = repository.DeleteSubscriptionPayment(ctx, subscriptionId, paymentId)
 	if err != nil {
-		log.Error().Err(err).Str("SubscriptionId", subscriptionId).Str("PaymentId", paymentId).Msg("Error deleting payment")
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Error deleting payment")
 		return err
 	}
-	log.Info().Str("SubscriptionId", subscriptionId).Str("PaymentId", paymentId).Msg("Payment deleted")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Payment deleted")
 	return nil
 }
+
+func checkPaymentUpdate(payment models.PaymentDynamodb, item *models.PaymentUpdate) error {
+	/*
+		Checks an update of a payment and resolves its tax breakdown. An
+		update with only a status or tax details keeps the amount and date of
+		the payment.
+		Params: payment models.PaymentDynamodb
+				item *models.PaymentUpdate
+		Return: error
+	*/
+	item.FailureReason = strings.TrimSpace(item.FailureReason)
+	if item.Status != "" {
+		err := checkPaymentStatus(item.Status, item.FailureReason)
+		if err != nil {
+			return err
+		}
+		if payment.RefundedAmount > 0 && item.Status != paymentStatus(payment) {
+			return fmt.Errorf("%w: the status of a refunded payment cannot change", ErrInvalidPayment)
+		}
+	} else if item.FailureReason != "" {
+		return fmt.Errorf("%w: a failure_reason is given with the failed status", ErrInvalidPayment)
+	}
+	if (item.Status != "" || givesTax(item.PaymentTaxInput)) && item.Amount == 0 && item.PaymentDate == "" {
+		item.Amount = payment.Amount
+		item.PaymentDate = payment.PaymentDate
+	}
+	if item.Amount < payment.RefundedAmount {
+		return fmt.Errorf("%w: the amount cannot be less than the %.2f refunded", ErrInvalidPayment, payment.RefundedAmount)
+	}
+	tax, err := updatedPaymentTax(payment, item.Amount, item.PaymentTaxInput)
+	if err != nil {
+		return err
+	}
+	item.Tax = tax
+	return nil
+}
+
+func RefundPayment(ctx context.Context, subscriptionId string, paymentId string, input models.PaymentRefundInput) (models.PaymentRefundResult, error) {
+	/*
+		Records a refund of a paid payment. The refunds of a payment cannot
+		exceed its amount; the payment is refunded once they reach it and
+		partially refunded until then.
+		Params: ctx context.Context
+				subscriptionId string
+				paymentId string
+				input models.PaymentRefundInput
+		Return: models.PaymentRefundResult, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Refunding payment")
+	payment, err := reachablePayment(ctx, subscriptionId, paymentId, input.UserName, models.HouseholdAddPayment)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Error refunding payment")
+		return models.PaymentRefundResult{}, err
+	}
+	status := paymentStatus(payment)
+	if status != models.PaymentStatusPaid && status != models.PaymentStatusPartiallyRefunded {
+		return models.PaymentRefundResult{}, fmt.Errorf("%w: a %s payment cannot be refunded", ErrInvalidPayment, status)
+	}
+	amount, err := strconv.ParseFloat(strings.TrimSpace(input.Amount), 32)
+	if err != nil || amount <= 0 {
+		return models.PaymentRefundResult{}, fmt.Errorf("%w: amount must be a positive number", ErrInvalidPayment)
+	}
+	remaining := roundCents(float64(payment.Amount - payment.RefundedAmount))
+	if roundCents(amount) > remaining {
+		return models.PaymentRefundResult{}, fmt.Errorf("%w: at most %.2f is left to refund", ErrInvalidPayment, remaining)
+	}
+	now := time.Now().UTC()
+	refundDate := input.RefundDate
+	if refundDate == "" {
+		refundDate = now.Format(config.DATE_FORMAT)
+	}
+	if _, err := time.Parse(config.DATE_FORMAT, refundDate); err != nil {
+		return models.PaymentRefundResult{}, fmt.Errorf("%w: refund_date %q must be YYYY-MM-DD", ErrInvalidPayment, refundDate)
+	}
+	if refundDate < payment.PaymentDate {
+		return models.PaymentRefundResult{}, fmt.Errorf("%w: refund_date is before the payment", ErrInvalidPayment)
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if len(reason) > config.PAYMENT_REASON_MAX_LENGTH {
+		return models.PaymentRefundResult{}, fmt.Errorf("%w: reason is longer than %d characters", ErrInvalidPayment, config.PAYMENT_REASON_MAX_LENGTH)
+	}
+
+	refund := models.PaymentRefund{
+		PaymentId:      paymentId,
+		UUID:           uuid.New().String(),
+		SubscriptionId: subscriptionId,
+		UserName:       input.UserName,
+		Amount:         roundCents(amount),
+		RefundDate:     refundDate,
+		Reason:         reason,
+		CreatedAt:      now.Format(time.RFC3339),
+	}
+	after := payment
+	after.RefundedAmount = roundCents(float64(payment.RefundedAmount + refund.Amount))
+	after.Status = models.PaymentStatusPartiallyRefunded
+	if after.RefundedAmount >= payment.Amount {
+		after.RefundedAmount = payment.Amount
+		after.Status = models.PaymentStatusRefunded
+	}
+	reasons, err := repository.AddPaymentRefund(ctx, refund, payment, after)
+	if len(reasons) == 2 && reasons[1] == "ConditionalCheckFailed" {
+		err = ErrPaymentChanged
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Msg("Error refunding payment")
+		return models.PaymentRefundResult{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.PaymentIdField, paymentId).Str("refund_id", refund.UUID).Msg("Payment refunded")
+	return models.PaymentRefundResult{Payment: after, Refund: refund}, nil
+}
+
+func GetPaymentRefunds(ctx context.Context, subscriptionId string, paymentId string, userName string) ([]models.PaymentRefund, error) {
+	/*
+		Returns the refunds of a payment, oldest first.
+		Params: ctx context.Context
+				subscriptionId string
+				paymentId string
+				userName string
+		Return: []models.PaymentRefund, error
+	*/
+	_, err := reachablePayment(ctx, subscriptionId, paymentId, userName, models.HouseholdView)
+	if err != nil {
+		return nil, err
+	}
+	refunds, err := repository.GetPaymentRefunds(ctx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(refunds, func(i, j int) bool {
+		if refunds[i].RefundDate != refunds[j].RefundDate {
+			return refunds[i].RefundDate < refunds[j].RefundDate
+		}
+		return refunds[i].CreatedAt < refunds[j].CreatedAt
+	})
+	return refunds, nil
+}
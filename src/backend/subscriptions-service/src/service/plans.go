@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+// planPriceTolerance is how far a subscription cost may be from a list
+// price to be recognized as that plan when the plan name does not match
+const planPriceTolerance = 0.01
+
+func roundCents(amount float64) float32 {
+	/*
+		Rounds an amount to cents.
+		Params: amount float64
+		Return: float32
+	*/
+	return float32(math.Round(amount*100) / 100)
+}
+
+func planAnnualCost(plan models.VendorPlan) float64 {
+	/*
+		Returns what a catalog plan costs over a year.
+		Params: plan models.VendorPlan
+		Return: float64
+	*/
+	return float64(plan.Price) * cyclesPerYear[plan.BillingCycle]
+}
+
+func matchVendorPlan(vendor models.Vendor, planName string, cost float32, cycle models.BillingCycle, currency string) (models.VendorPlan, bool) {
+	/*
+		Finds the catalog plan of a subscription. The plan name is matched
+		loosely ("Premium Individual" matches "Individual"), preferring the plan
+		billed on the same cycle and then the exact name; without a name match
+		the plan with the same price and cycle is used.
+		Params: vendor models.Vendor
+				planName string
+				cost float32
+				cycle models.BillingCycle
+				currency string
+		Return: models.VendorPlan, bool
+	*/
+	key := vendorKey(planName)
+	var match models.VendorPlan
+	bestScore := 0
+	for _, plan := range vendor.Plans {
+		if plan.Currency != currency {
+			continue
+		}
+		planKey := vendorKey(plan.Name)
+		score := 0
+		if key != "" && planKey != "" && (strings.Contains(key, planKey) || strings.Contains(planKey, key)) {
+			// the billing cycle outweighs an exact name, which outweighs the
+			// length of the partial match
+			score = 100 + min(len(key), len(planKey))
+			if key == planKey {
+				score += 100
+			}
+			if plan.BillingCycle == cycle {
+				score += 200
+			}
+		} else if plan.BillingCycle == cycle && math.Abs(float64(plan.Price-cost)) < planPriceTolerance {
+			score = 1
+		}
+		if score > bestScore {
+			match = plan
+			bestScore = score
+		}
+	}
+	return match, bestScore > 0
+}
+
+func linkVendorPlan(vendor models.Vendor, item *models.SubscriptionDynamodb) {
+	/*
+		Links a subscription to its catalog vendor and plan.
+		Params: vendor models.Vendor
+				item *models.SubscriptionDynamodb
+		Return: None
+	*/
+	item.VendorId = vendor.Id
+	plan, ok := matchVendorPlan(vendor, item.Plan, item.Cost, billingCycleOf(*item), item.Currency)
+	if !ok {
+		return
+	}
+	item.PlanId = plan.Id
+	if item.Plan == "" {
+		item.Plan = plan.Name
+	}
+}
+
+func subscriptionVendor(subscription models.SubscriptionDynamodb) (models.Vendor, bool) {
+	/*
+		Returns the catalog vendor of a subscription, matching it by name and
+		URL when the subscription was created before it was linked.
+		Params: subscription models.SubscriptionDynamodb
+		Return: models.Vendor, bool
+	*/
+	if subscription.VendorId != "" {
+		return repository.GetVendor(subscription.VendorId)
+	}
+	return MatchVendor(subscription.Name, subscription.Url)
+}
+
+func subscriptionPlan(vendor models.Vendor, subscription models.SubscriptionDynamodb) (models.VendorPlan, bool) {
+	/*
+		Returns the catalog plan of a subscription.
+		Params: vendor models.Vendor
+				subscription models.SubscriptionDynamodb
+		Return: models.VendorPlan, bool
+	*/
+	if subscription.PlanId != "" {
+		for _, plan := range vendor.Plans {
+			if plan.Id == subscription.PlanId {
+				return plan, true
+			}
+		}
+	}
+	return matchVendorPlan(vendor, subscription.Plan, subscription.Cost, billingCycleOf(subscription), subscription.Currency)
+}
+
+func cheapestEquivalentPlan(vendor models.Vendor, tier string, ads bool, seats int, currency string, region string) (models.VendorPlan, bool) {
+	/*
+		Returns the cheapest plan of a vendor giving the same content: same
+		tier, no ads unless ads are already accepted, enough seats and no
+		eligibility restriction.
+		Params: vendor models.Vendor
+				tier string
+				ads bool
+				seats int
+				currency string
+				region string
+		Return: models.VendorPlan, bool
+	*/
+	var cheapest models.VendorPlan
+	found := false
+	for _, plan := range vendor.Plans {
+		if plan.Region != region || plan.Currency != currency || plan.Tier != tier {
+			continue
+		}
+		if plan.Eligibility != "" || plan.Seats < seats || (plan.Ads && !ads) {
+			continue
+		}
+		if !found || planAnnualCost(plan) < planAnnualCost(cheapest) {
+			cheapest = plan
+			found = true
+		}
+	}
+	return cheapest, found
+}
+
+func cheaperPlanSuggestion(userName string, vendor models.Vendor, subscription models.SubscriptionDynamodb, region string) (models.PlanSuggestion, bool) {
+	/*
+		Suggests a cheaper equivalent plan, typically the yearly one, for a
+		single subscription.
+		Params: userName string
+				vendor models.Vendor
+				subscription models.SubscriptionDynamodb
+				region string
+		Return: models.PlanSuggestion, bool
+	*/
+	current, ok := subscriptionPlan(vendor, subscription)
+	if !ok {
+		return models.PlanSuggestion{}, false
+	}
+	candidate, ok := cheapestEquivalentPlan(vendor, current.Tier, current.Ads, current.Seats, subscription.Currency, region)
+	if !ok || candidate.Id == current.Id {
+		return models.PlanSuggestion{}, false
+	}
+	currentCost := annualCost(subscription)
+	suggestedCost := planAnnualCost(candidate)
+	if roundCents(currentCost-suggestedCost) <= 0 {
+		return models.PlanSuggestion{}, false
+	}
+
+	suggestionType := models.CheaperPlanSuggestion
+	if candidate.BillingCycle == models.Yearly && billingCycleOf(subscription) != models.Yearly {
+		suggestionType = models.YearlyPlanSuggestion
+	}
+	return models.PlanSuggestion{
+		Type:                suggestionType,
+		VendorId:            vendor.Id,
+		VendorName:          vendor.Name,
+		SubscriptionIds:     []string{subscription.UUID},
+		UserNames:           []string{userName},
+		CurrentAnnualCost:   roundCents(currentCost),
+		SuggestedPlan:       candidate,
+		SuggestedAnnualCost: roundCents(suggestedCost),
+		AnnualSavings:       roundCents(currentCost - suggestedCost),
+		Currency:            subscription.Currency,
+	}, true
+}
+
+type vendorSubscriber struct {
+	UserName     string
+	Subscription models.SubscriptionDynamodb
+}
+
+func familyPlanSuggestion(vendor models.Vendor, subscribers []vendorSubscriber, region string) (models.PlanSuggestion, bool) {
+	/*
+		Suggests a single multi-seat plan replacing the separate subscriptions
+		of several users to the same vendor.
+		Params: vendor models.Vendor
+				subscribers []vendorSubscriber
+				region string
+		Return: models.PlanSuggestion, bool
+	*/
+	users := map[string]bool{}
+	tier := ""
+	ads := true
+	currency := subscribers[0].Subscription.Currency
+	currentCost := 0.0
+	suggestion := models.PlanSuggestion{
+		Type:            models.FamilyPlanSuggestion,
+		VendorId:        vendor.Id,
+		VendorName:      vendor.Name,
+		SubscriptionIds: []string{},
+		UserNames:       []string{},
+		Currency:        currency,
+	}
+	for _, subscriber := range subscribers {
+		current, ok := subscriptionPlan(vendor, subscriber.Subscription)
+		// plans of different tiers or currencies are not interchangeable
+		if !ok || (tier != "" && current.Tier != tier) || subscriber.Subscription.Currency != currency {
+			return models.PlanSuggestion{}, false
+		}
+		tier = current.Tier
+		ads = ads && current.Ads
+		currentCost += annualCost(subscriber.Subscription)
+		suggestion.SubscriptionIds = append(suggestion.SubscriptionIds, subscriber.Subscription.UUID)
+		if !users[subscriber.UserName] {
+			users[subscriber.UserName] = true
+			suggestion.UserNames = append(suggestion.UserNames, subscriber.UserName)
+		}
+	}
+	if len(users) < 2 {
+		return models.PlanSuggestion{}, false
+	}
+
+	candidate, ok := cheapestEquivalentPlan(vendor, tier, ads, len(users), currency, region)
+	if !ok {
+		return models.PlanSuggestion{}, false
+	}
+	suggestedCost := planAnnualCost(candidate)
+	if roundCents(currentCost-suggestedCost) <= 0 {
+		return models.PlanSuggestion{}, false
+	}
+	suggestion.CurrentAnnualCost = roundCents(currentCost)
+	suggestion.SuggestedPlan = candidate
+	suggestion.SuggestedAnnualCost = roundCents(suggestedCost)
+	suggestion.AnnualSavings = roundCents(currentCost - suggestedCost)
+	return suggestion, true
+}
+
+func planCompanions(ctx context.Context, userName string) (map[string]bool, error) {
+	/*
+		Returns the users whose subscriptions a user may plan a shared family
+		plan with: the active members of the households the user is an active
+		member of, and the users they share subscriptions with.
+		Params: ctx context.Context
+				userName string
+		Return: map[string]bool, error
+	*/
+	companions := map[string]bool{}
+	memberships, err := repository.GetUserMemberships(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		if membership.Status != models.MembershipActive {
+			continue
+		}
+		members, err := repository.GetHouseholdMembers(ctx, membership.HouseholdId)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if member.Status == models.MembershipActive {
+				companions[member.UserName] = true
+			}
+		}
+	}
+	ownedShares, err := repository.GetSharesByOwner(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, share := range ownedShares {
+		companions[share.Participant] = true
+	}
+	participantShares, err := repository.GetSharesByParticipant(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, share := range participantShares {
+		companions[share.Owner] = true
+	}
+	return companions, nil
+}
+
+func SuggestCheaperPlans(ctx context.Context, userName string, members []string, region string) (models.PlanSuggestionResult, error) {
+	/*
+		Suggests cheaper equivalents of the subscriptions of a user: cheaper
+		plans of the same tier (such as yearly billing) and, together with the
+		given members, a shared family plan for vendors they each pay for
+		separately. The members must share a household or a subscription
+		with the user, else ErrForbidden is returned. Alternatives for the
+		same vendor are counted once, by their largest saving, in the total.
+		Params: ctx context.Context
+				userName string
+				members []string
+				region string
+		Return: models.PlanSuggestionResult, error
+	*/
+	if region == "" {
+		region = config.DEFAULT_PLAN_REGION
+	}
+	region = strings.ToUpper(region)
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Strs("members", members).Str("region", region).Msg("Suggesting cheaper plans")
+
+	userNames := []string{userName}
+	for _, member := range members {
+		member = strings.TrimSpace(member)
+		if member != "" && member != userName {
+			userNames = append(userNames, member)
+		}
+	}
+	if len(userNames) > 1 {
+		companions, err := planCompanions(ctx, userName)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error suggesting cheaper plans")
+			return models.PlanSuggestionResult{}, err
+		}
+		for _, member := range userNames[1:] {
+			if !companions[member] {
+				err := fmt.Errorf("%w: %s shares neither a household nor a subscription with %s", ErrForbidden, member, userName)
+				log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error suggesting cheaper plans")
+				return models.PlanSuggestionResult{}, err
+			}
+		}
+	}
+
+	result := models.PlanSuggestionResult{
+		UserName:    userName,
+		Region:      region,
+		Suggestions: []models.PlanSuggestion{},
+	}
+	vendors := map[string]models.Vendor{}
+	subscribers := map[string][]vendorSubscriber{}
+	for _, name := range userNames {
+		subscriptions, err := repository.GetUserSubscriptions(ctx, name)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, name).Msg("Error suggesting cheaper plans")
+			return models.PlanSuggestionResult{}, err
+		}
+		for _, subscription := range subscriptions {
+			if subscription.Currency == "" {
+				subscription.Currency = config.DEFAULT_CURRENCY
+			}
+			vendor, ok := subscriptionVendor(subscription)
+			if !ok {
+				continue
+			}
+			vendors[vendor.Id] = vendor
+			subscribers[vendor.Id] = append(subscribers[vendor.Id], vendorSubscriber{UserName: name, Subscription: subscription})
+			if name != userName {
+				continue
+			}
+			if suggestion, ok := cheaperPlanSuggestion(userName, vendor, subscription, region); ok {
+				result.Suggestions = append(result.Suggestions, suggestion)
+			}
+		}
+	}
+	for vendorId, vendorSubscribers := range subscribers {
+		if vendorSubscribers[0].UserName != userName {
+			continue
+		}
+		if suggestion, ok := familyPlanSuggestion(vendors[vendorId], vendorSubscribers, region); ok {
+			result.Suggestions = append(result.Suggestions, suggestion)
+		}
+	}
+
+	sort.SliceStable(result.Suggestions, func(i, j int) bool {
+		return result.Suggestions[i].AnnualSavings > result.Suggestions[j].AnnualSavings
+	})
+	bestSavings := map[string]float32{}
+	for _, suggestion := range result.Suggestions {
+		if suggestion.AnnualSavings > bestSavings[suggestion.VendorId] {
+			bestSavings[suggestion.VendorId] = suggestion.AnnualSavings
+		}
+	}
+	total := 0.0
+	for _, savings := range bestSavings {
+		total += float64(savings)
+	}
+	result.TotalAnnualSavings = roundCents(total)
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("suggestion_count", len(result.Suggestions)).Msg("Cheaper plans suggested")
+	return result, nil
+}
@@ -0,0 +1,714 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidReceipt = errors.New("invalid receipt")
+
+// receiptCurrencySymbols maps the currency symbols found in receipts to ISO codes
+var receiptCurrencySymbols = map[string]string{
+	"$": "USD", "us$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY", "₹": "INR",
+	"c$": "CAD", "ca$": "CAD", "a$": "AUD", "au$": "AUD",
+}
+
+const receiptCurrencyPattern = `US\$|CA?\$|AU?\$|[$€£¥₹]|\b(?:USD|EUR|GBP|CAD|AUD|NZD|INR|JPY|CHF|SEK|NOK|DKK|BRL|MXN)\b`
+
+var receiptMoneyRegex = regexp.MustCompile(`(?i)(` + receiptCurrencyPattern + `)?\s?(\d{1,3}(?:[,.]\d{3})+(?:[.,]\d{1,2})?|\d+(?:[.,]\d{1,2})?)(?:\s?(` + receiptCurrencyPattern + `))?`)
+
+const receiptMonthPattern = `(?:jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?`
+
+var receiptDateRegex = regexp.MustCompile(`(?i)\b(\d{4}-\d{2}-\d{2}|\d{1,2}[/.]\d{1,2}[/.]\d{4}|` + receiptMonthPattern + `\s+\d{1,2}(?:st|nd|rd|th)?,?\s+\d{4}|\d{1,2}(?:st|nd|rd|th)?\s+` + receiptMonthPattern + `,?\s+\d{4})\b`)
+var receiptOrdinalRegex = regexp.MustCompile(`(?i)(\d)(st|nd|rd|th)\b`)
+var receiptAbbreviationRegex = regexp.MustCompile(`(?i)([a-z])\.`)
+
+// receiptDateLayouts are the date layouts accepted in receipts, after
+// ordinals, commas and abbreviation dots are removed
+var receiptDateLayouts = []string{"2006-01-02", "01/02/2006", "1/2/2006", "02.01.2006", "2.1.2006", "January 2 2006", "Jan 2 2006", "2 January 2006", "2 Jan 2006"}
+
+// receiptSubjectPrefixRegex strips the reply and forward prefixes of a subject
+var receiptSubjectPrefixRegex = regexp.MustCompile(`(?i)^\s*((fwd?|fw|re|aw|wg)\s*:\s*)+`)
+
+// receiptExclusionRegex skips labeled lines that are not the amount charged,
+// e.g. "Total tax" or "Total savings"
+var receiptExclusionRegex = regexp.MustCompile(`(?i)^\W*(tax|vat|discount|savings|before)\b`)
+
+// genericAmountLabels and genericDateLabels are tried in order, so the more
+// specific labels come first
+var genericAmountLabels = []string{"amount charged", "total charged", "amount paid", "total paid", "grand total", "order total", "total amount", "total", "amount due", "amount", "price"}
+var genericDateLabels = []string{"payment date", "billing date", "charged on", "paid on", "order date", "invoice date", "receipt date", "transaction date", "date"}
+
+// receiptDelivery is how a receipt email reached the service
+type receiptDelivery struct {
+	// recipients are the envelope recipients of an email received by SES
+	recipients []string
+	// senderVerified tells whether the From address passed DMARC, so that
+	// the receipt may be tied to the user registered with it
+	senderVerified bool
+}
+
+type receiptFields struct {
+	amount   float64
+	currency string
+	date     string
+}
+
+// receiptExtractor reads the amount, currency and date of a receipt's text
+type receiptExtractor func(text string) receiptFields
+
+// receiptExtractors holds the extractors of the vendors whose receipts the
+// generic extractor reads poorly, by vendor id
+var receiptExtractors = map[string]receiptExtractor{
+	"netflix":              netflixReceipt,
+	"spotify":              labeledReceipt([]string{"total", "amount paid"}, []string{"order date", "date"}),
+	"apple-music":          labeledReceipt([]string{"total", "billed total"}, []string{"invoice date", "date"}),
+	"apple-arcade":         labeledReceipt([]string{"total", "billed total"}, []string{"invoice date", "date"}),
+	"youtube-premium":      labeledReceipt([]string{"total", "total charged"}, []string{"order date", "date"}),
+	"youtube-music":        labeledReceipt([]string{"total", "total charged"}, []string{"order date", "date"}),
+	"microsoft-365":        labeledReceipt([]string{"total", "amount charged"}, []string{"charge date", "billing date", "date"}),
+	"adobe-creative-cloud": labeledReceipt([]string{"total", "total amount"}, []string{"invoice date", "order date"}),
+}
+
+var netflixChargeRegex = regexp.MustCompile(`(?i)(?:charged|payment of)\s+(.{1,20}?)\s+(?:to\s+.{0,60}?\s+)?on\s+([^\n]+)`)
+
+func receiptCurrency(symbol string) string {
+	/*
+		Returns the ISO code of a currency symbol or code found in a receipt.
+		Params: symbol string
+		Return: string
+	*/
+	if code, ok := receiptCurrencySymbols[strings.ToLower(symbol)]; ok {
+		return code
+	}
+	return strings.ToUpper(symbol)
+}
+
+func parseReceiptAmount(number string) (float64, bool) {
+	/*
+		Parses an amount written with either decimal separator: the last
+		separator is the decimal one when one or two digits follow it
+		("1.234,56", "1,234.56", "12,99"), any other is a thousands separator.
+		Params: number string
+		Return: float64, bool
+	*/
+	separator := strings.LastIndexAny(number, ".,")
+	decimals := ""
+	if separator >= 0 && len(number)-separator-1 <= 2 {
+		decimals = number[separator+1:]
+		number = number[:separator]
+	}
+	number = strings.NewReplacer(".", "", ",", "").Replace(number)
+	if decimals != "" {
+		number += "." + decimals
+	}
+	amount, err := strconv.ParseFloat(number, 64)
+	return amount, err == nil && amount > 0
+}
+
+func findReceiptMoney(text string, requireCurrency bool) (receiptFields, bool) {
+	/*
+		Returns the first amount of money in a text. An amount without a
+		currency must have decimals, so that years and counts are skipped.
+		Params: text string
+				requireCurrency bool
+		Return: receiptFields, bool
+	*/
+	for _, match := range receiptMoneyRegex.FindAllStringSubmatch(text, -1) {
+		currency := match[1]
+		if currency == "" {
+			currency = match[3]
+		}
+		if currency == "" && (requireCurrency || !strings.ContainsAny(match[2], ".,")) {
+			continue
+		}
+		amount, ok := parseReceiptAmount(match[2])
+		if !ok {
+			continue
+		}
+		fields := receiptFields{amount: amount}
+		if currency != "" {
+			fields.currency = receiptCurrency(currency)
+		}
+		return fields, true
+	}
+	return receiptFields{}, false
+}
+
+func parseReceiptDate(value string) (string, bool) {
+	/*
+		Parses a date found in a receipt into the DATE_FORMAT.
+		Params: value string
+		Return: string, bool
+	*/
+	value = receiptOrdinalRegex.ReplaceAllString(value, "$1")
+	value = receiptAbbreviationRegex.ReplaceAllString(value, "$1")
+	value = strings.Join(strings.Fields(strings.ReplaceAll(value, ",", " ")), " ")
+	value = strings.Replace(strings.Replace(value, "Sept ", "Sep ", 1), "sept ", "sep ", 1)
+	for _, layout := range receiptDateLayouts {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date.Format(config.DATE_FORMAT), true
+		}
+	}
+	return "", false
+}
+
+func findReceiptDate(text string) (string, bool) {
+	/*
+		Returns the first date in a text.
+		Params: text string
+		Return: string, bool
+	*/
+	for _, match := range receiptDateRegex.FindAllString(text, -1) {
+		if date, ok := parseReceiptDate(match); ok {
+			return date, true
+		}
+	}
+	return "", false
+}
+
+func labeledLines(text string, label string) []string {
+	/*
+		Returns what follows a label on every line containing it, with the
+		next line appended for receipts that put values below their labels.
+		Params: text string
+				label string
+		Return: []string
+	*/
+	re := regexp.MustCompile(`(?i)(?:^|[^a-z])` + regexp.QuoteMeta(label) + `(?:[^a-z]|$)`)
+	lines := strings.Split(text, "\n")
+	values := []string{}
+	for i, line := range lines {
+		loc := re.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		value := line[loc[1]:]
+		if receiptExclusionRegex.MatchString(value) {
+			continue
+		}
+		if i+1 < len(lines) {
+			value += "\n" + lines[i+1]
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func labeledReceipt(amountLabels []string, dateLabels []string) receiptExtractor {
+	/*
+		Returns an extractor reading the amount and date that follow the
+		given labels, trying the labels in order.
+		Params: amountLabels []string
+				dateLabels []string
+		Return: receiptExtractor
+	*/
+	return func(text string) receiptFields {
+		fields := receiptFields{}
+	amounts:
+		for _, label := range amountLabels {
+			for _, value := range labeledLines(text, label) {
+				if money, ok := findReceiptMoney(value, false); ok {
+					fields.amount, fields.currency = money.amount, money.currency
+					break amounts
+				}
+			}
+		}
+	dates:
+		for _, label := range dateLabels {
+			for _, value := range labeledLines(text, label) {
+				if date, ok := findReceiptDate(value); ok {
+					fields.date = date
+					break dates
+				}
+			}
+		}
+		return fields
+	}
+}
+
+func netflixReceipt(text string) receiptFields {
+	/*
+		Reads a Netflix receipt, which states the charge in a sentence
+		("We charged $15.49 to your Visa on April 3, 2026.").
+		Params: text string
+		Return: receiptFields
+	*/
+	for _, match := range netflixChargeRegex.FindAllStringSubmatch(text, -1) {
+		money, ok := findReceiptMoney(match[1], true)
+		if !ok {
+			continue
+		}
+		money.date, _ = findReceiptDate(match[2])
+		return money
+	}
+	return labeledReceipt([]string{"total", "amount"}, []string{"billing date", "date"})(text)
+}
+
+func extractReceipt(vendorId string, email models.ReceiptEmail) receiptFields {
+	/*
+		Reads the amount, currency and date of a receipt with the vendor's
+		extractor, completing what it missed with the generic labels, then
+		with the first amount and date found anywhere in the text, and the
+		date the email was sent.
+		Params: vendorId string
+				email models.ReceiptEmail
+		Return: receiptFields
+	*/
+	fields := receiptFields{}
+	if extractor, ok := receiptExtractors[vendorId]; ok {
+		fields = extractor(email.Text)
+	}
+	generic := labeledReceipt(genericAmountLabels, genericDateLabels)(email.Text)
+	if fields.amount == 0 {
+		fields.amount, fields.currency = generic.amount, generic.currency
+	}
+	if fields.amount == 0 {
+		if money, ok := findReceiptMoney(email.Text, true); ok {
+			fields.amount, fields.currency = money.amount, money.currency
+		}
+	}
+	if fields.date == "" {
+		fields.date = generic.date
+	}
+	if fields.date == "" {
+		fields.date, _ = findReceiptDate(email.Text)
+	}
+	if fields.date == "" {
+		fields.date = email.Date
+	}
+	return fields
+}
+
+func emailDomain(address string) string {
+	/*
+		Returns the lower case domain of an email address.
+		Params: address string
+		Return: string
+	*/
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(address[at+1:])
+}
+
+func baseDomain(host string) string {
+	/*
+		Returns the registered domain of a host ("email.apple.com" ->
+		"apple.com", "info.deliveroo.co.uk" -> "deliveroo.co.uk").
+		Params: host string
+		Return: string
+	*/
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	n := len(labels)
+	if n <= 2 {
+		return host
+	}
+	// second level domains such as co.uk and com.au
+	if len(labels[n-1]) == 2 && len(labels[n-2]) <= 3 {
+		return strings.Join(labels[n-3:], ".")
+	}
+	return strings.Join(labels[n-2:], ".")
+}
+
+func receiptAddress(token string) string {
+	/*
+		Returns the address a user forwards receipts to: the receipts
+		address with their ingest token after a plus.
+		Params: token string
+		Return: string (empty when no receipts address is configured)
+	*/
+	address := os.Getenv(config.RECEIPTS_ADDRESS_ENV)
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	return address[:at] + "+" + token + address[at:]
+}
+
+func receiptAddressToken(address string) (string, bool) {
+	/*
+		Returns the ingest token of a receipts+<token>@ address. Only the
+		configured receipts address is read when one is set.
+		Params: address string
+		Return: string, bool
+	*/
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return "", false
+	}
+	local, domain := address[:at], address[at:]
+	plus := strings.Index(local, "+")
+	if plus < 0 || plus == len(local)-1 {
+		return "", false
+	}
+	if configured := os.Getenv(config.RECEIPTS_ADDRESS_ENV); configured != "" && !strings.EqualFold(local[:plus]+domain, configured) {
+		return "", false
+	}
+	// mail systems may change the case of an address, tokens are lower case
+	return strings.ToLower(local[plus+1:]), true
+}
+
+func receiptUser(ctx context.Context, email models.ReceiptEmail, delivery receiptDelivery) (string, error) {
+	/*
+		Returns the user a receipt belongs to: the owner of the ingest token
+		of the receipts+<token>@ address it was sent to, else the user who
+		forwarded it from their registered email when the sender is verified.
+		Params: ctx context.Context
+				email models.ReceiptEmail
+				delivery receiptDelivery
+		Return: string, error
+	*/
+	for _, to := range append(append([]string{}, delivery.recipients...), email.To...) {
+		token, ok := receiptAddressToken(to)
+		if !ok {
+			continue
+		}
+		ingestToken, err := repository.GetReceiptTokenByToken(ctx, token)
+		if err == nil {
+			return ingestToken.UserName, nil
+		}
+		if err.Error() != "404" {
+			return "", err
+		}
+	}
+	if !delivery.senderVerified {
+		return "", fmt.Errorf("%w: the receipt was not sent to an ingest address and its sender %s is not verified", ErrInvalidReceipt, email.From)
+	}
+	userName, err := repository.GetUserNameByEmail(ctx, email.From)
+	if err != nil && err.Error() == "404" {
+		return "", fmt.Errorf("%w: %s is not the email address of a user", ErrInvalidReceipt, email.From)
+	}
+	return userName, err
+}
+
+func receiptVendor(email models.ReceiptEmail) (models.Vendor, bool) {
+	/*
+		Identifies the vendor of a receipt by the domain of its sender, then
+		by the sender's name and then by a vendor named in the subject.
+		Params: email models.ReceiptEmail
+		Return: models.Vendor, bool
+	*/
+	if domain := emailDomain(email.Sender); domain != "" {
+		if vendor, ok := matchVendorByDomain(domain); ok {
+			return vendor, true
+		}
+	}
+	if vendor, ok := matchVendorByName(email.SenderName); ok {
+		return vendor, true
+	}
+	subject := vendorKey(receiptSubjectPrefixRegex.ReplaceAllString(email.Subject, ""))
+	var match models.Vendor
+	matchLength := 0
+	for _, vendor := range repository.GetVendors() {
+		for _, candidate := range append([]string{vendor.Name}, vendor.Aliases...) {
+			key := vendorKey(candidate)
+			if len(key) >= minVendorPrefixLength && len(key) > matchLength && strings.Contains(subject, key) {
+				match = vendor
+				matchLength = len(key)
+			}
+		}
+	}
+	return match, matchLength > 0
+}
+
+func receiptSubscription(ctx context.Context, userName string, vendor models.Vendor, email models.ReceiptEmail, fields receiptFields) (models.SubscriptionDynamodb, bool, error) {
+	/*
+		Finds the subscription a receipt pays for among the subscriptions of
+		the user. Subscriptions of the receipt's vendor rank first, then the
+		ones of another vendor of the sender's domain (Apple Music for an
+		apple.com receipt) and custom subscriptions named in the subject;
+		a matching cost and currency break ties.
+		Params: ctx context.Context
+				userName string
+				vendor models.Vendor
+				email models.ReceiptEmail
+				fields receiptFields
+		Return: models.SubscriptionDynamodb, bool, error
+	*/
+	subscriptions, err := GetUserSubscriptions(ctx, userName, models.SubscriptionFilter{})
+	if err != nil {
+		return models.SubscriptionDynamodb{}, false, err
+	}
+	senderDomain := baseDomain(emailDomain(email.Sender))
+	subjectKey := vendorKey(email.SenderName + " " + email.Subject)
+	textKey := vendorKey(email.Subject + " " + email.Text)
+
+	var best models.SubscriptionDynamodb
+	bestScore := 0
+	for _, subscription := range subscriptions {
+		// the owner of a shared subscription records its payments
+		if subscription.SharedBy != "" {
+			continue
+		}
+		score := 0
+		if subVendor, ok := subscriptionVendor(subscription); ok {
+			if subVendor.Id == vendor.Id {
+				score = 4
+			} else {
+				for _, domain := range subVendor.Domains {
+					if domainHost, _ := splitDomain(domain); senderDomain != "" && baseDomain(domainHost) == senderDomain {
+						score = 2
+					}
+				}
+			}
+			if score > 0 && strings.Contains(textKey, vendorKey(subVendor.Name)) {
+				score++
+			}
+		} else if key := vendorKey(subscription.Name); len(key) >= minVendorPrefixLength && strings.Contains(subjectKey, key) {
+			score = 3
+		}
+		if score == 0 {
+			continue
+		}
+		if math.Abs(float64(subscription.Cost)-fields.amount) <= config.RECEIPT_AMOUNT_TOLERANCE {
+			score += 2
+		}
+		if fields.currency != "" && subscription.Currency == fields.currency {
+			score++
+		}
+		if score > bestScore {
+			best = subscription
+			bestScore = score
+		}
+	}
+	return best, bestScore > 0, nil
+}
+
+func recordReceiptPayment(ctx context.Context, userName string, subscription models.SubscriptionDynamodb, amount float32, paymentDate string) (models.PaymentDynamodb, bool, error) {
+	/*
+		Returns the payment of the subscription recorded within
+		RECEIPT_MATCH_WINDOW_DAYS of the receipt for the same amount, or
+		records a new one and moves the subscription's last payment date.
+		Params: ctx context.Context
+				userName string
+				subscription models.SubscriptionDynamodb
+				amount float32
+				paymentDate string
+		Return: models.PaymentDynamodb, bool (true when an existing payment matched), error
+	*/
+	partition, err := subscriptionPartition(ctx, subscription.UUID, userName, models.HouseholdAddPayment)
+	if err != nil {
+		return models.PaymentDynamodb{}, false, err
+	}
+	date, err := time.Parse(config.DATE_FORMAT, paymentDate)
+	if err != nil {
+		return models.PaymentDynamodb{}, false, fmt.Errorf("%w: invalid payment date %q", ErrInvalidReceipt, paymentDate)
+	}
+	payments, err := repository.GetSubscriptionPayments(ctx, subscription.UUID)
+	if err != nil {
+		return models.PaymentDynamodb{}, false, err
+	}
+	window := config.RECEIPT_MATCH_WINDOW_DAYS * 24 * time.Hour
+	for _, payment := range payments {
+		recorded, err := time.Parse(config.DATE_FORMAT, payment.PaymentDate)
+		if err != nil {
+			continue
+		}
+		gap := recorded.Sub(date)
+		if gap >= -window && gap <= window && math.Abs(float64(payment.Amount-amount)) <= config.RECEIPT_AMOUNT_TOLERANCE {
+			return payment, true, nil
+		}
+	}
+
+	payment, err := repository.AddSubscriptionPayment(ctx, models.PaymentDynamodb{
+		SubscriptionId: subscription.UUID,
+		UUID:           uuid.New().String(),
+		UserName:       userName,
+		Amount:         amount,
+		PaymentDate:    paymentDate,
+		Status:         models.PaymentStatusPaid,
+	})
+	if err != nil {
+		return models.PaymentDynamodb{}, false, err
+	}
+	err = repository.UpdateSubscriptionLastPayment(ctx, partition, subscription.UUID, paymentDate)
+	if err != nil {
+		// the payment is recorded either way
+		log.Ctx(ctx).Warn().Err(err).Str(logging.SubscriptionIdField, subscription.UUID).Msg("Error updating last payment date from receipt")
+	}
+	return payment, false, nil
+}
+
+func IngestReceiptEmail(ctx context.Context, raw []byte, userName string) (models.ReceiptIngestResult, error) {
+	/*
+		Records the payment of a receipt email posted to the API. The user is
+		read from the ingest address the email was sent to unless given; the
+		sender of a posted email is never trusted.
+		Params: ctx context.Context
+				raw []byte
+				userName string (optional)
+		Return: models.ReceiptIngestResult, error
+	*/
+	return ingestReceipt(ctx, raw, userName, receiptDelivery{})
+}
+
+func ingestReceipt(ctx context.Context, raw []byte, userName string, delivery receiptDelivery) (models.ReceiptIngestResult, error) {
+	/*
+		Records the payment of a receipt email: identifies the user and the
+		vendor, extracts the amount, currency and date, and creates the
+		payment on the matching subscription unless it was already recorded.
+		A receipt that cannot be tied to a payment is returned as unmatched
+		with the reason. The user is read from the email unless given.
+		Params: ctx context.Context
+				raw []byte
+				userName string (optional)
+				delivery receiptDelivery
+		Return: models.ReceiptIngestResult, error
+	*/
+	email, err := ParseReceiptEmail(raw)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error parsing receipt email")
+		return models.ReceiptIngestResult{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.MessageIdField, email.MessageId).Str("sender", email.Sender).Msg("Ingesting receipt email")
+	if userName == "" {
+		userName, err = receiptUser(ctx, email, delivery)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.MessageIdField, email.MessageId).Msg("Error ingesting receipt email")
+			return models.ReceiptIngestResult{}, err
+		}
+	}
+	result := models.ReceiptIngestResult{
+		MessageId: email.MessageId,
+		UserName:  userName,
+		Sender:    email.Sender,
+		Subject:   email.Subject,
+		Status:    models.ReceiptUnmatched,
+	}
+
+	vendor, ok := receiptVendor(email)
+	if ok {
+		result.VendorId = vendor.Id
+		result.VendorName = vendor.Name
+	}
+	fields := extractReceipt(vendor.Id, email)
+	result.Amount = float32(math.Round(fields.amount*100) / 100)
+	result.Currency = fields.currency
+	result.PaymentDate = fields.date
+	if result.Amount == 0 || result.PaymentDate == "" {
+		result.Reason = "no amount or date found in the receipt"
+		log.Ctx(ctx).Warn().Str(logging.MessageIdField, email.MessageId).Msg(result.Reason)
+		return result, nil
+	}
+
+	subscription, ok, err := receiptSubscription(ctx, userName, vendor, email, fields)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.MessageIdField, email.MessageId).Msg("Error ingesting receipt email")
+		return models.ReceiptIngestResult{}, err
+	}
+	if !ok {
+		result.Reason = fmt.Sprintf("no subscription of %s matches the receipt from %s", userName, email.Sender)
+		log.Ctx(ctx).Warn().Str(logging.MessageIdField, email.MessageId).Msg(result.Reason)
+		return result, nil
+	}
+	result.SubscriptionId = subscription.UUID
+	if result.Currency == "" {
+		result.Currency = subscription.Currency
+	}
+	if subscription.Currency != "" && result.Currency != subscription.Currency {
+		result.Reason = fmt.Sprintf("the receipt is in %s but %s is billed in %s", result.Currency, subscription.Name, subscription.Currency)
+		log.Ctx(ctx).Warn().Str(logging.MessageIdField, email.MessageId).Msg(result.Reason)
+		return result, nil
+	}
+
+	payment, matched, err := recordReceiptPayment(ctx, userName, subscription, result.Amount, result.PaymentDate)
+	if errors.Is(err, ErrForbidden) {
+		result.Reason = err.Error()
+		log.Ctx(ctx).Warn().Str(logging.MessageIdField, email.MessageId).Msg(result.Reason)
+		return result, nil
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.MessageIdField, email.MessageId).Msg("Error ingesting receipt email")
+		return models.ReceiptIngestResult{}, err
+	}
+	result.Payment = &payment
+	result.Status = models.ReceiptCreated
+	if matched {
+		result.Status = models.ReceiptMatched
+	}
+	log.Ctx(ctx).Info().Str(logging.MessageIdField, email.MessageId).Str(logging.SubscriptionIdField, subscription.UUID).Str(logging.PaymentIdField, payment.UUID).Str("status", string(result.Status)).Msg("Receipt email ingested")
+	return result, nil
+}
+
+func IngestInboundEmail(ctx context.Context, messageId string, recipients []string, senderVerified bool) (models.ReceiptIngestResult, error) {
+	/*
+		Ingests a receipt email received by SES and stored in S3.
+		Params: ctx context.Context
+				messageId string
+				recipients []string (the envelope recipients)
+				senderVerified bool (whether the From address passed DMARC)
+		Return: models.ReceiptIngestResult, error
+	*/
+	raw, err := repository.GetInboundEmail(ctx, messageId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.MessageIdField, messageId).Msg("Error ingesting inbound email")
+		return models.ReceiptIngestResult{}, err
+	}
+	return ingestReceipt(ctx, raw, "", receiptDelivery{recipients: recipients, senderVerified: senderVerified})
+}
+
+func CreateReceiptToken(ctx context.Context, input models.ReceiptTokenInput) (models.ReceiptIngestToken, error) {
+	/*
+		Generates a new secret receipt ingest token for a user. The previous
+		token of the user, if any, stops working.
+		Params: ctx context.Context
+				input models.ReceiptTokenInput
+		Return: models.ReceiptIngestToken, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Msg("Creating receipt token")
+	secret := make([]byte, 16)
+	_, err := rand.Read(secret)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error generating receipt token")
+		return models.ReceiptIngestToken{}, err
+	}
+	token := models.ReceiptIngestToken{
+		UserName:  input.UserName,
+		Token:     hex.EncodeToString(secret),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	res, err := repository.PutReceiptToken(ctx, token)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error creating receipt token")
+		return models.ReceiptIngestToken{}, err
+	}
+	res.Address = receiptAddress(res.Token)
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Msg("Receipt token created")
+	return res, nil
+}
+
+func RevokeReceiptToken(ctx context.Context, userName string) error {
+	/*
+		Revokes the receipt ingest token of a user.
+		Params: ctx context.Context
+				userName string
+		Return: error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Revoking receipt token")
+	err := repository.DeleteReceiptToken(ctx, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error revoking receipt token")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Receipt token revoked")
+	return nil
+}
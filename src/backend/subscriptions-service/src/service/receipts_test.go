@@ -0,0 +1,64 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractReceiptFixtures(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		vendorId string
+		amount   float64
+		currency string
+		date     string
+		token    string
+	}{
+		// no vendor claims apple.com, the Apple subscription of the receipt
+		// is found by its sender's domain
+		{"apple-attached.eml", "", 10.99, "USD", "2026-04-05", ""},
+		{"generic-custom-vendor.eml", "", 9.99, "EUR", "2026-04-01", "5f0c7e2a9b4d4e81a6c3d2b1f0e9a8c7"},
+		{"netflix-auto-forward.eml", "netflix", 15.49, "USD", "2026-04-03", "5f0c7e2a9b4d4e81a6c3d2b1f0e9a8c7"},
+		{"spotify-forwarded-inline.eml", "spotify", 11.99, "GBP", "2026-04-02", ""},
+	}
+	t.Setenv("receipts_address", "receipts@subhub.example")
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("..", "..", "testdata", "receipts", test.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			email, err := ParseReceiptEmail(raw)
+			if err != nil {
+				t.Fatalf("ParseReceiptEmail: %v", err)
+			}
+
+			// an unknown vendor is read with the generic extractor
+			vendor, _ := receiptVendor(email)
+			if vendor.Id != test.vendorId {
+				t.Errorf("vendor = %q, want %q", vendor.Id, test.vendorId)
+			}
+			fields := extractReceipt(vendor.Id, email)
+			if fields.amount != test.amount {
+				t.Errorf("amount = %v, want %v", fields.amount, test.amount)
+			}
+			if fields.currency != test.currency {
+				t.Errorf("currency = %q, want %q", fields.currency, test.currency)
+			}
+			if fields.date != test.date {
+				t.Errorf("date = %q, want %q", fields.date, test.date)
+			}
+
+			token := ""
+			for _, to := range email.To {
+				if found, ok := receiptAddressToken(to); ok {
+					token = found
+				}
+			}
+			if token != test.token {
+				t.Errorf("ingest token = %q, want %q", token, test.token)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidReconciliation = errors.New("invalid reconciliation")
+
+func reconciliationPeriod(from string, to string, today time.Time) (time.Time, time.Time, error) {
+	/*
+		Parses the first and last days to reconcile, which default to the
+		lookback period ending today.
+		Params: from string (YYYY-MM-DD, optional)
+				to string (YYYY-MM-DD, optional)
+				today time.Time
+		Return: time.Time, time.Time, error
+	*/
+	end := today
+	if to != "" {
+		parsed, err := time.Parse(config.DATE_FORMAT, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: to must be a YYYY-MM-DD date", ErrInvalidReconciliation)
+		}
+		end = parsed
+	}
+	start := end.AddDate(0, 0, -config.RECONCILIATION_LOOKBACK_DAYS)
+	if from != "" {
+		parsed, err := time.Parse(config.DATE_FORMAT, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: from must be a YYYY-MM-DD date", ErrInvalidReconciliation)
+		}
+		start = parsed
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from must not be after to", ErrInvalidReconciliation)
+	}
+	if end.Sub(start) > config.RECONCILIATION_MAX_DAYS*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: at most %d days can be reconciled", ErrInvalidReconciliation, config.RECONCILIATION_MAX_DAYS)
+	}
+	return start, end, nil
+}
+
+func amountMatches(expected float32, amount float32) bool {
+	/*
+		Tells whether a charged amount is within the reconciliation tolerance
+		of the expected one.
+		Params: expected float32
+				amount float32
+		Return: bool
+	*/
+	tolerance := math.Max(0.01, math.Abs(float64(expected))*config.RECONCILIATION_AMOUNT_TOLERANCE)
+	return math.Abs(float64(roundCents(float64(amount))-roundCents(float64(expected)))) <= tolerance
+}
+
+type chargedPayment struct {
+	payment models.PaymentDynamodb
+	date    time.Time
+	matched bool
+}
+
+func chargedPayments(payments []models.PaymentDynamodb) []*chargedPayment {
+	/*
+		Returns the charged payments with a valid date, oldest first.
+		Params: payments []models.PaymentDynamodb
+		Return: []*chargedPayment
+	*/
+	charged := []*chargedPayment{}
+	for _, payment := range payments {
+		date, err := time.Parse(config.DATE_FORMAT, payment.PaymentDate)
+		if err != nil || !paymentCharged(payment) {
+			continue
+		}
+		charged = append(charged, &chargedPayment{payment: payment, date: date})
+	}
+	sort.SliceStable(charged, func(i, j int) bool {
+		return charged[i].date.Before(charged[j].date)
+	})
+	return charged
+}
+
+func closestPayment(charged []*chargedPayment, expected time.Time) *chargedPayment {
+	/*
+		Returns the unmatched payment closest to an expected charge within the
+		match window, if any.
+		Params: charged []*chargedPayment
+				expected time.Time
+		Return: *chargedPayment
+	*/
+	window := time.Duration(config.RECONCILIATION_MATCH_WINDOW_DAYS) * 24 * time.Hour
+	var closest *chargedPayment
+	for _, payment := range charged {
+		distance := absDuration(payment.date.Sub(expected))
+		if payment.matched || distance > window {
+			continue
+		}
+		if closest == nil || distance < absDuration(closest.date.Sub(expected)) {
+			closest = payment
+		}
+	}
+	return closest
+}
+
+func absDuration(duration time.Duration) time.Duration {
+	/*
+		Returns the absolute value of a duration.
+		Params: duration time.Duration
+		Return: time.Duration
+	*/
+	if duration < 0 {
+		return -duration
+	}
+	return duration
+}
+
+func reconcileSubscription(subscription models.SubscriptionDynamodb, payments []models.PaymentDynamodb, from time.Time, to time.Time, today time.Time) ([]models.PaymentDiscrepancy, int) {
+	/*
+		Compares the charges a subscription's billing cycle calls for with the
+		payments recorded for it. Charges are expected from the first charged
+		payment on, so subscriptions whose payments are not tracked are not
+		flagged, and each renewal is counted from the payment matching the
+		previous one. An expected charge is missing once its match window has
+		passed without a payment; a payment matching no expected charge is a
+		duplicate when another payment of about the same amount was made
+		within the window.
+		Params: subscription models.SubscriptionDynamodb (at its full cost)
+				payments []models.PaymentDynamodb
+				from time.Time
+				to time.Time
+				today time.Time
+		Return: []models.PaymentDiscrepancy, int (expected charges between from and to)
+	*/
+	discrepancies := []models.PaymentDiscrepancy{}
+	charged := chargedPayments(payments)
+	if len(charged) == 0 {
+		return discrepancies, 0
+	}
+	currency := ledgerCurrency(subscription)
+	cycle := billingCycleOf(subscription)
+	cancelAt, cancelErr := time.Parse(config.DATE_FORMAT, subscription.CancelAt)
+	expectedCharges := 0
+	if projected(subscription) {
+		expected := charged[0].date
+		for !expected.After(to) {
+			if cancelErr == nil && !expected.Before(cancelAt) {
+				break
+			}
+			date := expected.Format(config.DATE_FORMAT)
+			amount, _ := costOn(subscription, date)
+			inPeriod := !expected.Before(from)
+			if inPeriod {
+				expectedCharges++
+			}
+			next := expected
+			if payment := closestPayment(charged, expected); payment != nil {
+				payment.matched = true
+				next = payment.date
+				if inPeriod && !amountMatches(amount, payment.payment.Amount) {
+					discrepancies = append(discrepancies, models.PaymentDiscrepancy{
+						Id:             fmt.Sprintf("%s#%s", models.DiscrepancyAmount, payment.payment.UUID),
+						Type:           models.DiscrepancyAmount,
+						SubscriptionId: subscription.UUID,
+						Name:           subscription.Name,
+						Currency:       currency,
+						ExpectedDate:   date,
+						ExpectedAmount: roundCents(float64(amount)),
+						PaymentIds:     []string{payment.payment.UUID},
+						PaymentDate:    payment.payment.PaymentDate,
+						Amount:         payment.payment.Amount,
+					})
+				}
+			} else if inPeriod && expected.AddDate(0, 0, config.RECONCILIATION_MATCH_WINDOW_DAYS).Before(today) {
+				discrepancies = append(discrepancies, models.PaymentDiscrepancy{
+					Id:             fmt.Sprintf("%s#%s#%s", models.DiscrepancyMissing, subscription.UUID, date),
+					Type:           models.DiscrepancyMissing,
+					SubscriptionId: subscription.UUID,
+					Name:           subscription.Name,
+					Currency:       currency,
+					ExpectedDate:   date,
+					ExpectedAmount: roundCents(float64(amount)),
+				})
+			}
+			expected = addBillingCycles(next, cycle, 1)
+		}
+	}
+	window := time.Duration(config.RECONCILIATION_MATCH_WINDOW_DAYS) * 24 * time.Hour
+	for i, payment := range charged {
+		if payment.matched || payment.date.Before(from) || payment.date.After(to) {
+			continue
+		}
+		// the earlier payment of a pair, or the one matching a renewal, is the genuine charge
+		for j, other := range charged {
+			if j == i || (j > i && !other.matched) || absDuration(payment.date.Sub(other.date)) > window || !amountMatches(other.payment.Amount, payment.payment.Amount) {
+				continue
+			}
+			discrepancies = append(discrepancies, models.PaymentDiscrepancy{
+				Id:             fmt.Sprintf("%s#%s", models.DiscrepancyDuplicate, payment.payment.UUID),
+				Type:           models.DiscrepancyDuplicate,
+				SubscriptionId: subscription.UUID,
+				Name:           subscription.Name,
+				Currency:       currency,
+				PaymentIds:     []string{other.payment.UUID, payment.payment.UUID},
+				PaymentDate:    payment.payment.PaymentDate,
+				Amount:         payment.payment.Amount,
+			})
+			break
+		}
+	}
+	return discrepancies, expectedCharges
+}
+
+func discrepancyDate(discrepancy models.PaymentDiscrepancy) string {
+	/*
+		Returns the date a discrepancy is sorted by: the expected charge, or
+		the payment of a duplicate.
+		Params: discrepancy models.PaymentDiscrepancy
+		Return: string
+	*/
+	if discrepancy.ExpectedDate != "" {
+		return discrepancy.ExpectedDate
+	}
+	return discrepancy.PaymentDate
+}
+
+func ReconcilePayments(ctx context.Context, userName string, from string, to string) (models.ReconciliationReport, error) {
+	/*
+		Reconciles the payments recorded for the subscriptions a user pays
+		for, their own and their households', against the charges expected
+		between two dates. Subscriptions shared with the user are reconciled
+		for their owner.
+		Params: ctx context.Context
+				userName string
+				from string (YYYY-MM-DD, optional)
+				to string (YYYY-MM-DD, optional)
+		Return: models.ReconciliationReport, error
+	*/
+	today, _ := time.Parse(config.DATE_FORMAT, time.Now().UTC().Format(config.DATE_FORMAT))
+	start, end, err := reconciliationPeriod(from, to, today)
+	if err != nil {
+		return models.ReconciliationReport{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Str("from", start.Format(config.DATE_FORMAT)).Str("to", end.Format(config.DATE_FORMAT)).Msg("Reconciling payments")
+	subscriptions, err := GetUserSubscriptions(ctx, userName, models.SubscriptionFilter{})
+	if err != nil {
+		return models.ReconciliationReport{}, err
+	}
+	report := models.ReconciliationReport{
+		UserName:      userName,
+		From:          start.Format(config.DATE_FORMAT),
+		To:            end.Format(config.DATE_FORMAT),
+		Discrepancies: []models.PaymentDiscrepancy{},
+	}
+	for _, subscription := range subscriptions {
+		if subscription.SharedBy != "" {
+			continue
+		}
+		if subscription.FullCost > 0 {
+			subscription.Cost, subscription.FullCost = subscription.FullCost, 0
+		}
+		payments, err := repository.GetSubscriptionPayments(ctx, subscription.UUID)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscription.UUID).Msg("Error reconciling payments")
+			return models.ReconciliationReport{}, err
+		}
+		discrepancies, expected := reconcileSubscription(subscription, payments, start, end, today)
+		report.SubscriptionsChecked++
+		report.ExpectedCharges += expected
+		report.Discrepancies = append(report.Discrepancies, discrepancies...)
+	}
+	sort.SliceStable(report.Discrepancies, func(i, j int) bool {
+		a, b := report.Discrepancies[i], report.Discrepancies[j]
+		if discrepancyDate(a) != discrepancyDate(b) {
+			return discrepancyDate(a) < discrepancyDate(b)
+		}
+		return a.Name < b.Name
+	})
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("discrepancies", len(report.Discrepancies)).Msg("Payments reconciled")
+	return report, nil
+}
+
+func reconciliationEmailSubject(discrepancies []models.PaymentDiscrepancy) string {
+	/*
+		Returns the subject of a reconciliation alert email.
+		Params: discrepancies []models.PaymentDiscrepancy
+		Return: string
+	*/
+	if len(discrepancies) == 1 {
+		return "SUBHUB found a payment discrepancy"
+	}
+	return fmt.Sprintf("SUBHUB found %d payment discrepancies", len(discrepancies))
+}
+
+func discrepancyLine(discrepancy models.PaymentDiscrepancy) string {
+	/*
+		Describes a discrepancy on one line of an alert email.
+		Params: discrepancy models.PaymentDiscrepancy
+		Return: string
+	*/
+	switch discrepancy.Type {
+	case models.DiscrepancyMissing:
+		return fmt.Sprintf("- %s: no payment of %.2f %s recorded for the renewal of %s", discrepancy.Name, discrepancy.ExpectedAmount, discrepancy.Currency, discrepancy.ExpectedDate)
+	case models.DiscrepancyDuplicate:
+		return fmt.Sprintf("- %s: the payment of %.2f %s on %s looks like a duplicate charge", discrepancy.Name, discrepancy.Amount, discrepancy.Currency, discrepancy.PaymentDate)
+	default:
+		return fmt.Sprintf("- %s: %.2f %s was paid on %s where %.2f %s was expected", discrepancy.Name, discrepancy.Amount, discrepancy.Currency, discrepancy.PaymentDate, discrepancy.ExpectedAmount, discrepancy.Currency)
+	}
+}
+
+func reconciliationEmailBody(userName string, discrepancies []models.PaymentDiscrepancy) string {
+	/*
+		Returns the body of a reconciliation alert email.
+		Params: userName string
+				discrepancies []models.PaymentDiscrepancy
+		Return: string
+	*/
+	lines := make([]string, 0, len(discrepancies))
+	for _, discrepancy := range discrepancies {
+		lines = append(lines, discrepancyLine(discrepancy))
+	}
+	return fmt.Sprintf(`Dear %s,
+
+The payments recorded for your subscriptions do not match their renewals:
+
+%s
+
+Check your statements and update the payments in SUBHUB.
+
+Sincerely,
+SUBHUB
+`, userName, strings.Join(lines, "\n"))
+}
+
+func RunReconciliation(ctx context.Context) (models.ReconciliationRunResult, error) {
+	/*
+		Reconciles the payments of every user and emails each user the
+		discrepancies they have not been alerted of yet.
+		Params: ctx context.Context
+		Return: models.ReconciliationRunResult, error
+	*/
+	log.Ctx(ctx).Info().Msg("Running payment reconciliation")
+	result := models.ReconciliationRunResult{}
+	userNames, err := repository.GetUserNames(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error running payment reconciliation")
+		return result, err
+	}
+	for _, userName := range userNames {
+		report, err := ReconcilePayments(ctx, userName, "", "")
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error reconciling payments")
+			continue
+		}
+		result.UsersChecked++
+		result.Discrepancies += len(report.Discrepancies)
+		if len(report.Discrepancies) == 0 {
+			continue
+		}
+		alerts, err := repository.GetReconciliationAlerts(ctx, userName)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error reconciling payments")
+			continue
+		}
+		alerted := map[string]bool{}
+		for _, alert := range alerts {
+			alerted[alert.DiscrepancyId] = true
+		}
+		fresh := []models.PaymentDiscrepancy{}
+		for _, discrepancy := range report.Discrepancies {
+			if !alerted[discrepancy.Id] {
+				fresh = append(fresh, discrepancy)
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		email, err := repository.GetUserEmail(ctx, userName)
+		if err == nil {
+			err = repository.PublishEmail(ctx, email, reconciliationEmailSubject(fresh), reconciliationEmailBody(userName, fresh))
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error sending reconciliation alert")
+			continue
+		}
+		now := time.Now().UTC()
+		items := make([]models.ReconciliationAlert, 0, len(fresh))
+		for _, discrepancy := range fresh {
+			items = append(items, models.ReconciliationAlert{
+				UserName:      userName,
+				DiscrepancyId: discrepancy.Id,
+				AlertedAt:     now.Format(time.RFC3339),
+				ExpiresAt:     now.AddDate(0, 0, config.RECONCILIATION_ALERT_RETENTION_DAYS).Unix(),
+			})
+		}
+		if err := repository.AddReconciliationAlerts(ctx, items); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error recording reconciliation alerts")
+			continue
+		}
+		result.UsersAlerted++
+	}
+	log.Ctx(ctx).Info().Int("users_checked", result.UsersChecked).Int("users_alerted", result.UsersAlerted).Msg("Payment reconciliation done")
+	return result, nil
+}
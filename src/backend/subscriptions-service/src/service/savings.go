@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// savingsEvaluator is a rule of the savings recommendations. A new rule is
+// added by implementing it and listing it in savingsEvaluators.
+type savingsEvaluator interface {
+	Rule() models.SavingsRule
+	Evaluate(ctx context.Context, input *savingsInput) ([]models.SavingsRecommendation, error)
+}
+
+// savingsEvaluators are run in order; recommendations of equal savings keep
+// this order in the ranking
+var savingsEvaluators = []savingsEvaluator{
+	overlapEvaluator{},
+	yearlyPlanEvaluator{},
+	unusedEvaluator{},
+	priceIncreaseEvaluator{},
+}
+
+// overlappingCategories are the categories in which paying for several
+// services usually means paying twice for the same thing
+var overlappingCategories = map[models.SubscriptionCategory]string{
+	models.Music:    "music",
+	models.OTT:      "video streaming",
+	models.Delivery: "delivery",
+	models.Fitness:  "fitness",
+	models.Magazine: "magazine",
+}
+
+type savingsInput struct {
+	UserName string
+	// Subscriptions are the ones still renewing, with their currency set
+	Subscriptions []models.SubscriptionDynamodb
+	Today         time.Time
+	payments      map[string][]models.PaymentDynamodb
+}
+
+func (input *savingsInput) Payments(ctx context.Context, subscriptionId string) ([]models.PaymentDynamodb, error) {
+	/*
+		Returns the charged payments of a subscription, sorted by date,
+		loading them once for all the evaluators.
+		Params: ctx context.Context
+				subscriptionId string
+		Return: []models.PaymentDynamodb, error
+	*/
+	if payments, ok := input.payments[subscriptionId]; ok {
+		return payments, nil
+	}
+	stored, err := repository.GetSubscriptionPayments(ctx, subscriptionId)
+	if err != nil {
+		return nil, err
+	}
+	payments := []models.PaymentDynamodb{}
+	for _, payment := range stored {
+		if paymentCharged(payment) {
+			payments = append(payments, payment)
+		}
+	}
+	sort.SliceStable(payments, func(i, j int) bool { return payments[i].PaymentDate < payments[j].PaymentDate })
+	input.payments[subscriptionId] = payments
+	return payments, nil
+}
+
+func subscriptionNames(subscriptions []models.SubscriptionDynamodb) string {
+	/*
+		Lists the names of subscriptions in a sentence ("A, B and C").
+		Params: subscriptions []models.SubscriptionDynamodb
+		Return: string
+	*/
+	names := []string{}
+	for _, subscription := range subscriptions {
+		names = append(names, subscription.Name)
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+type overlapEvaluator struct{}
+
+func (overlapEvaluator) Rule() models.SavingsRule {
+	return models.OverlapRule
+}
+
+func (e overlapEvaluator) Evaluate(ctx context.Context, input *savingsInput) ([]models.SavingsRecommendation, error) {
+	/*
+		Flags several services paid for in a category where one is usually
+		enough, such as two music services. Keeping the most expensive one
+		is assumed, so the estimate is what the others cost.
+		Params: ctx context.Context
+				input *savingsInput
+		Return: []models.SavingsRecommendation, error
+	*/
+	groups := map[string][]models.SubscriptionDynamodb{}
+	keys := []string{}
+	for _, subscription := range input.Subscriptions {
+		if _, ok := overlappingCategories[subscription.Category]; !ok {
+			continue
+		}
+		key := string(subscription.Category) + "/" + subscription.Currency
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], subscription)
+	}
+
+	recommendations := []models.SavingsRecommendation{}
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool { return annualCost(group[i]) > annualCost(group[j]) })
+		savings := 0.0
+		ids := []string{}
+		for _, subscription := range group {
+			ids = append(ids, subscription.UUID)
+			savings += annualCost(subscription)
+		}
+		savings -= annualCost(group[0])
+		categoryName := overlappingCategories[group[0].Category]
+		recommendations = append(recommendations, models.SavingsRecommendation{
+			Rule:                   e.Rule(),
+			Title:                  fmt.Sprintf("%d %s services", len(group), categoryName),
+			Description:            fmt.Sprintf("You pay for %s. Keeping only %s would save the cost of the others.", subscriptionNames(group), group[0].Name),
+			SubscriptionIds:        ids,
+			EstimatedAnnualSavings: roundCents(savings),
+			Currency:               group[0].Currency,
+		})
+	}
+	return recommendations, nil
+}
+
+type yearlyPlanEvaluator struct{}
+
+func (yearlyPlanEvaluator) Rule() models.SavingsRule {
+	return models.YearlyPlanRule
+}
+
+func (e yearlyPlanEvaluator) Evaluate(ctx context.Context, input *savingsInput) ([]models.SavingsRecommendation, error) {
+	/*
+		Flags the subscriptions billed more often than yearly whose catalog
+		vendor sells the same plan cheaper on a yearly bill. Only the plans
+		the user pays in full can be switched.
+		Params: ctx context.Context
+				input *savingsInput
+		Return: []models.SavingsRecommendation, error
+	*/
+	recommendations := []models.SavingsRecommendation{}
+	for _, subscription := range input.Subscriptions {
+		if subscription.UserName != input.UserName || subscription.FullCost > 0 || billingCycleOf(subscription) == models.Yearly {
+			continue
+		}
+		vendor, ok := subscriptionVendor(subscription)
+		if !ok {
+			continue
+		}
+		suggestion, ok := cheaperPlanSuggestion(input.UserName, vendor, subscription, config.DEFAULT_PLAN_REGION)
+		if !ok || suggestion.Type != models.YearlyPlanSuggestion {
+			continue
+		}
+		recommendations = append(recommendations, models.SavingsRecommendation{
+			Rule:                   e.Rule(),
+			Title:                  fmt.Sprintf("Switch %s to yearly billing", subscription.Name),
+			Description:            fmt.Sprintf("The %s plan costs %.2f %s a year instead of %.2f %s.", suggestion.SuggestedPlan.Name, suggestion.SuggestedAnnualCost, suggestion.Currency, suggestion.CurrentAnnualCost, suggestion.Currency),
+			SubscriptionIds:        []string{subscription.UUID},
+			EstimatedAnnualSavings: suggestion.AnnualSavings,
+			Currency:               suggestion.Currency,
+		})
+	}
+	return recommendations, nil
+}
+
+type unusedEvaluator struct{}
+
+func (unusedEvaluator) Rule() models.SavingsRule {
+	return models.UnusedRule
+}
+
+func (e unusedEvaluator) Evaluate(ctx context.Context, input *savingsInput) ([]models.SavingsRecommendation, error) {
+	/*
+		Flags the subscriptions not used for SAVINGS_UNUSED_DAYS days, or
+		never used since they started that long ago. Nothing is flagged
+		until usage is recorded for at least one subscription of the user,
+		as no usage would otherwise only mean it is not tracked.
+		Params: ctx context.Context
+				input *savingsInput
+		Return: []models.SavingsRecommendation, error
+	*/
+	recommendations := []models.SavingsRecommendation{}
+	tracked := false
+	for _, subscription := range input.Subscriptions {
+		tracked = tracked || subscription.LastUsedDate != ""
+	}
+	if !tracked {
+		return recommendations, nil
+	}
+	cutoff := input.Today.AddDate(0, 0, -config.SAVINGS_UNUSED_DAYS).Format(config.DATE_FORMAT)
+	for _, subscription := range input.Subscriptions {
+		description := fmt.Sprintf("%s was last used on %s.", subscription.Name, subscription.LastUsedDate)
+		since := subscription.LastUsedDate
+		if since == "" {
+			description = fmt.Sprintf("No use of %s was recorded since it started on %s.", subscription.Name, subscription.StartDate)
+			since = subscription.StartDate
+		}
+		if _, err := time.Parse(config.DATE_FORMAT, since); err != nil || since > cutoff {
+			continue
+		}
+		recommendations = append(recommendations, models.SavingsRecommendation{
+			Rule:                   e.Rule(),
+			Title:                  fmt.Sprintf("Cancel %s", subscription.Name),
+			Description:            description,
+			SubscriptionIds:        []string{subscription.UUID},
+			EstimatedAnnualSavings: roundCents(annualCost(subscription)),
+			Currency:               subscription.Currency,
+		})
+	}
+	return recommendations, nil
+}
+
+type priceIncreaseEvaluator struct{}
+
+func (priceIncreaseEvaluator) Rule() models.SavingsRule {
+	return models.PriceIncreaseRule
+}
+
+func (e priceIncreaseEvaluator) Evaluate(ctx context.Context, input *savingsInput) ([]models.SavingsRecommendation, error) {
+	/*
+		Flags the subscriptions whose price rises by more than
+		SAVINGS_PRICE_INCREASE_THRESHOLD: an announced increase still to
+		come or, failing that, a rise between the last two different
+		amounts paid in the past year. The estimate is the yearly cost of
+		the increase, avoided by switching plans or services.
+		Params: ctx context.Context
+				input *savingsInput
+		Return: []models.SavingsRecommendation, error
+	*/
+	recommendations := []models.SavingsRecommendation{}
+	today := input.Today.Format(config.DATE_FORMAT)
+	yearAgo := input.Today.AddDate(-1, 0, 0).Format(config.DATE_FORMAT)
+	for _, subscription := range input.Subscriptions {
+		recommendation := models.SavingsRecommendation{
+			Rule:            e.Rule(),
+			Title:           fmt.Sprintf("%s is getting more expensive", subscription.Name),
+			SubscriptionIds: []string{subscription.UUID},
+			Currency:        subscription.Currency,
+		}
+
+		upcoming := subscription.Cost
+		effectiveDate := ""
+		for _, change := range subscription.PriceChanges {
+			if change.EffectiveDate > today && (subscription.CancelAt == "" || change.EffectiveDate < subscription.CancelAt) {
+				upcoming = change.Cost * shareFraction(subscription)
+				effectiveDate = change.EffectiveDate
+			}
+		}
+		if subscription.Cost > 0 && float64(upcoming-subscription.Cost)/float64(subscription.Cost) > config.SAVINGS_PRICE_INCREASE_THRESHOLD {
+			recommendation.Description = fmt.Sprintf("The price rises from %.2f to %.2f %s on %s.", subscription.Cost, upcoming, subscription.Currency, effectiveDate)
+			recommendation.EstimatedAnnualSavings = roundCents(float64(upcoming-subscription.Cost) * cyclesPerYear[billingCycleOf(subscription)])
+			recommendations = append(recommendations, recommendation)
+			continue
+		}
+
+		payments, err := input.Payments(ctx, subscription.UUID)
+		if err != nil {
+			return nil, err
+		}
+		if len(payments) < 2 || payments[len(payments)-1].PaymentDate < yearAgo {
+			continue
+		}
+		latest := payments[len(payments)-1]
+		for i := len(payments) - 2; i >= 0; i-- {
+			previous := payments[i]
+			if previous.Amount == latest.Amount {
+				continue
+			}
+			if previous.Amount > 0 && latest.Amount > 0 && float64(latest.Amount-previous.Amount)/float64(previous.Amount) > config.SAVINGS_PRICE_INCREASE_THRESHOLD {
+				recommendation.Description = fmt.Sprintf("The amount paid rose from %.2f to %.2f %s on %s.", previous.Amount, latest.Amount, subscription.Currency, latest.PaymentDate)
+				// the payments may be of the full cost of a shared subscription
+				recommendation.EstimatedAnnualSavings = roundCents(annualCost(subscription) * float64(latest.Amount-previous.Amount) / float64(latest.Amount))
+				recommendations = append(recommendations, recommendation)
+			}
+			break
+		}
+	}
+	return recommendations, nil
+}
+
+func rankSavings(recommendations []models.SavingsRecommendation) models.SavingsReport {
+	/*
+		Ranks recommendations by their estimated savings and totals them
+		per currency. A recommendation about a subscription already counted
+		by a better one is listed but left out of the totals.
+		Params: recommendations []models.SavingsRecommendation
+		Return: models.SavingsReport
+	*/
+	report := models.SavingsReport{Recommendations: []models.SavingsRecommendation{}, TotalAnnualSavings: map[string]float32{}}
+	for _, recommendation := range recommendations {
+		if recommendation.EstimatedAnnualSavings > 0 {
+			report.Recommendations = append(report.Recommendations, recommendation)
+		}
+	}
+	sort.SliceStable(report.Recommendations, func(i, j int) bool {
+		return report.Recommendations[i].EstimatedAnnualSavings > report.Recommendations[j].EstimatedAnnualSavings
+	})
+	counted := map[string]bool{}
+	for _, recommendation := range report.Recommendations {
+		overlaps := false
+		for _, id := range recommendation.SubscriptionIds {
+			overlaps = overlaps || counted[id]
+		}
+		if overlaps {
+			continue
+		}
+		for _, id := range recommendation.SubscriptionIds {
+			counted[id] = true
+		}
+		total := float64(report.TotalAnnualSavings[recommendation.Currency]) + float64(recommendation.EstimatedAnnualSavings)
+		report.TotalAnnualSavings[recommendation.Currency] = roundCents(total)
+	}
+	return report
+}
+
+func GetSavingsRecommendations(ctx context.Context, userName string) (models.SavingsReport, error) {
+	/*
+		Runs the savings evaluators on the subscriptions of a user that are
+		still renewing and returns their recommendations, ranked by the
+		estimated annual savings.
+		Params: ctx context.Context
+				userName string
+		Return: models.SavingsReport, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting savings recommendations")
+	subscriptions, err := GetUserSubscriptions(ctx, userName, models.SubscriptionFilter{})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting savings recommendations")
+		return models.SavingsReport{}, err
+	}
+	input := &savingsInput{
+		UserName:      userName,
+		Subscriptions: []models.SubscriptionDynamodb{},
+		Today:         time.Now().UTC(),
+		payments:      map[string][]models.PaymentDynamodb{},
+	}
+	for _, subscription := range subscriptions {
+		if !projected(subscription) {
+			continue
+		}
+		if subscription.Currency == "" {
+			subscription.Currency = config.DEFAULT_CURRENCY
+		}
+		input.Subscriptions = append(input.Subscriptions, subscription)
+	}
+
+	recommendations := []models.SavingsRecommendation{}
+	for _, evaluator := range savingsEvaluators {
+		found, err := evaluator.Evaluate(ctx, input)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Str("rule", string(evaluator.Rule())).Msg("Error getting savings recommendations")
+			return models.SavingsReport{}, err
+		}
+		recommendations = append(recommendations, found...)
+	}
+	report := rankSavings(recommendations)
+	report.UserName = userName
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("recommendation_count", len(report.Recommendations)).Msg("Savings recommendations retrieved")
+	return report, nil
+}
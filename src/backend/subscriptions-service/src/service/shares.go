@@ -0,0 +1,582 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidShare = errors.New("invalid share")
+
+func resolveParticipant(ctx context.Context, participant models.ShareParticipantInput) (string, error) {
+	/*
+		Returns the username of a participant given by username or by email.
+		Params: ctx context.Context
+				participant models.ShareParticipantInput
+		Return: string, error
+	*/
+	if participant.UserName != "" {
+		return participant.UserName, nil
+	}
+	if participant.Email == "" {
+		return "", fmt.Errorf("%w: a participant needs a username or an email", ErrInvalidShare)
+	}
+	userName, err := repository.GetUserNameByEmail(ctx, participant.Email)
+	if err != nil && err.Error() == "404" {
+		return "", fmt.Errorf("%w: no user is registered with %s", ErrInvalidShare, participant.Email)
+	}
+	return userName, err
+}
+
+func validateSplit(subscription models.SubscriptionDynamodb, method models.SplitMethod, participants []models.ShareParticipantInput) error {
+	/*
+		Checks that the participants' percentages or fixed amounts leave a
+		non-negative share to the owner.
+		Params: subscription models.SubscriptionDynamodb
+				method models.SplitMethod
+				participants []models.ShareParticipantInput
+		Return: error
+	*/
+	if !method.IsValid() {
+		return fmt.Errorf("%w: split method must be equal, percentage or fixed", ErrInvalidShare)
+	}
+	total := 0.0
+	for _, participant := range participants {
+		switch method {
+		case models.SplitPercentage:
+			if participant.Percentage <= 0 {
+				return fmt.Errorf("%w: percentages must be positive", ErrInvalidShare)
+			}
+			total += float64(participant.Percentage)
+		case models.SplitFixed:
+			if participant.Amount <= 0 {
+				return fmt.Errorf("%w: amounts must be positive", ErrInvalidShare)
+			}
+			total += float64(participant.Amount)
+		}
+	}
+	if method == models.SplitPercentage && roundCents(total) > 100 {
+		return fmt.Errorf("%w: percentages add up to more than 100", ErrInvalidShare)
+	}
+	if method == models.SplitFixed && roundCents(total) > subscription.Cost {
+		return fmt.Errorf("%w: amounts add up to more than the cost of %s", ErrInvalidShare, formatAmount(subscription.Cost))
+	}
+	return nil
+}
+
+func computeSplit(subscription models.SubscriptionDynamodb, shares []models.SubscriptionShare) models.SubscriptionSplit {
+	/*
+		Splits the cost of a subscription between its owner and participants.
+		The owner pays whatever the participants do not, including the
+		rounding remainder of an equal split. Fixed amounts are scaled down
+		when the cost drops below their total.
+		Params: subscription models.SubscriptionDynamodb
+				shares []models.SubscriptionShare
+		Return: models.SubscriptionSplit
+	*/
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Participant < shares[j].Participant })
+	split := models.SubscriptionSplit{
+		SubscriptionId: subscription.UUID,
+		Name:           subscription.Name,
+		Owner:          subscription.UserName,
+		Cost:           subscription.Cost,
+		Currency:       subscription.Currency,
+		BillingCycle:   billingCycleOf(subscription),
+		SplitMethod:    models.SplitEqual,
+		Shares:         []models.ParticipantShare{},
+	}
+	if split.Currency == "" {
+		split.Currency = config.DEFAULT_CURRENCY
+	}
+	if len(shares) > 0 {
+		split.SplitMethod = shares[0].SplitMethod
+	}
+
+	cost := float64(subscription.Cost)
+	amounts := make([]float64, len(shares))
+	fixedTotal := 0.0
+	for i, share := range shares {
+		switch share.SplitMethod {
+		case models.SplitPercentage:
+			amounts[i] = cost * float64(share.Percentage) / 100
+		case models.SplitFixed:
+			amounts[i] = float64(share.Amount)
+			fixedTotal += amounts[i]
+		default:
+			amounts[i] = cost / float64(len(shares)+1)
+		}
+	}
+	participantsTotal := 0.0
+	for i := range amounts {
+		if fixedTotal > cost && fixedTotal > 0 {
+			amounts[i] = amounts[i] * cost / fixedTotal
+		}
+		amounts[i] = float64(roundCents(amounts[i]))
+		participantsTotal += amounts[i]
+	}
+
+	ownerAmount := math.Max(0, cost-participantsTotal)
+	split.Shares = append(split.Shares, models.ParticipantShare{
+		UserName:   subscription.UserName,
+		Owner:      true,
+		Amount:     roundCents(ownerAmount),
+		Percentage: sharePercentage(ownerAmount, cost),
+	})
+	for i, share := range shares {
+		split.Shares = append(split.Shares, models.ParticipantShare{
+			UserName:   share.Participant,
+			Amount:     roundCents(amounts[i]),
+			Percentage: sharePercentage(amounts[i], cost),
+			Since:      share.CreatedAt,
+		})
+	}
+	return split
+}
+
+func sharePercentage(amount float64, cost float64) float32 {
+	/*
+		Returns the percentage of the cost an amount represents.
+		Params: amount float64
+				cost float64
+		Return: float32
+	*/
+	if cost <= 0 {
+		return 0
+	}
+	return roundCents(amount / cost * 100)
+}
+
+func userShare(split models.SubscriptionSplit, userName string) (models.ParticipantShare, bool) {
+	/*
+		Returns the share of a user in a split.
+		Params: split models.SubscriptionSplit
+				userName string
+		Return: models.ParticipantShare, bool
+	*/
+	for _, share := range split.Shares {
+		if share.UserName == userName {
+			return share, true
+		}
+	}
+	return models.ParticipantShare{}, false
+}
+
+func ShareSubscription(ctx context.Context, subscriptionId string, input models.SubscriptionShareInput) (models.SubscriptionSplit, error) {
+	/*
+		Shares a subscription of input.UserName with the given participants,
+		replacing any previous split. Participants who were already sharing
+		keep the date they joined so their balances carry over.
+		Params: ctx context.Context
+				subscriptionId string
+				input models.SubscriptionShareInput
+		Return: models.SubscriptionSplit, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, input.UserName).Int("participant_count", len(input.Participants)).Msg("Sharing subscription")
+	subscription, err := repository.GetSubscription(ctx, input.UserName, subscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error sharing subscription")
+		return models.SubscriptionSplit{}, err
+	}
+	if input.SplitMethod == "" {
+		input.SplitMethod = models.SplitEqual
+	}
+	err = validateSplit(subscription, input.SplitMethod, input.Participants)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error sharing subscription")
+		return models.SubscriptionSplit{}, err
+	}
+
+	existing, err := repository.GetSubscriptionShares(ctx, subscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error sharing subscription")
+		return models.SubscriptionSplit{}, err
+	}
+	joined := map[string]string{}
+	for _, share := range existing {
+		joined[share.Participant] = share.CreatedAt
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	shares := []models.SubscriptionShare{}
+	seen := map[string]bool{}
+	for _, participant := range input.Participants {
+		userName, err := resolveParticipant(ctx, participant)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error sharing subscription")
+			return models.SubscriptionSplit{}, err
+		}
+		if userName == input.UserName || seen[userName] {
+			err = fmt.Errorf("%w: %s is listed twice or owns the subscription", ErrInvalidShare, userName)
+			log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error sharing subscription")
+			return models.SubscriptionSplit{}, err
+		}
+		seen[userName] = true
+		createdAt := joined[userName]
+		if createdAt == "" {
+			createdAt = now
+		}
+		shares = append(shares, models.SubscriptionShare{
+			SubscriptionId: subscriptionId,
+			Participant:    userName,
+			Owner:          input.UserName,
+			SplitMethod:    input.SplitMethod,
+			Percentage:     participant.Percentage,
+			Amount:         participant.Amount,
+			CreatedAt:      createdAt,
+		})
+	}
+
+	err = repository.PutSubscriptionShares(ctx, subscriptionId, shares)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Msg("Error sharing subscription")
+		return models.SubscriptionSplit{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, input.UserName).Msg("Subscription shared")
+	return computeSplit(subscription, shares), nil
+}
+
+func sharedSubscription(ctx context.Context, subscriptionId string, userName string) (models.SubscriptionDynamodb, []models.SubscriptionShare, error) {
+	/*
+		Returns a subscription and its shares when the user owns it or is
+		one of its participants.
+		Params: ctx context.Context
+				subscriptionId string
+				userName string
+		Return: models.SubscriptionDynamodb, []models.SubscriptionShare, error
+	*/
+	shares, err := repository.GetSubscriptionShares(ctx, subscriptionId)
+	if err != nil {
+		return models.SubscriptionDynamodb{}, nil, err
+	}
+	owner := userName
+	for _, share := range shares {
+		if share.Participant == userName {
+			owner = share.Owner
+		}
+	}
+	subscription, err := repository.GetSubscription(ctx, owner, subscriptionId)
+	if err != nil {
+		return models.SubscriptionDynamodb{}, nil, err
+	}
+	return subscription, shares, nil
+}
+
+func GetSubscriptionSplit(ctx context.Context, subscriptionId string, userName string) (models.SubscriptionSplit, error) {
+	/*
+		Returns how the cost of a subscription is split. Both the owner and
+		the participants can see it.
+		Params: ctx context.Context
+				subscriptionId string
+				userName string
+		Return: models.SubscriptionSplit, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Getting subscription split")
+	subscription, shares, err := sharedSubscription(ctx, subscriptionId, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error getting subscription split")
+		return models.SubscriptionSplit{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Subscription split retrieved")
+	return computeSplit(subscription, shares), nil
+}
+
+func UnshareSubscription(ctx context.Context, subscriptionId string, userName string, participant string) error {
+	/*
+		Removes a participant from a shared subscription. The owner can
+		remove anyone; a participant can only leave.
+		Params: ctx context.Context
+				subscriptionId string
+				userName string
+				participant string
+		Return: error
+	*/
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Str("participant", participant).Msg("Unsharing subscription")
+	if participant != userName {
+		_, err := repository.GetSubscription(ctx, userName, subscriptionId)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error unsharing subscription")
+			return err
+		}
+	}
+	err := repository.DeleteSubscriptionShare(ctx, subscriptionId, participant)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str("participant", participant).Msg("Error unsharing subscription")
+		return err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str("participant", participant).Msg("Subscription unshared")
+	return nil
+}
+
+func userSubscriptionShares(ctx context.Context, userName string) ([]models.SubscriptionDynamodb, error) {
+	/*
+		Returns the subscriptions of a user as seen in their reports: their
+		own subscriptions and the ones shared with them, each with the cost
+		reduced to the user's share. FullCost keeps the cost of a shared
+		subscription and SharedBy its owner.
+		Params: ctx context.Context
+				userName string
+		Return: []models.SubscriptionDynamodb, error
+	*/
+	owned, err := repository.GetUserSubscriptions(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	ownedShares, err := repository.GetSharesByOwner(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	sharesBySubscription := map[string][]models.SubscriptionShare{}
+	for _, share := range ownedShares {
+		sharesBySubscription[share.SubscriptionId] = append(sharesBySubscription[share.SubscriptionId], share)
+	}
+
+	subscriptions := []models.SubscriptionDynamodb{}
+	for _, subscription := range owned {
+		if shares, ok := sharesBySubscription[subscription.UUID]; ok {
+			share, _ := userShare(computeSplit(subscription, shares), userName)
+			subscription.FullCost = subscription.Cost
+			subscription.Cost = share.Amount
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	participantShares, err := repository.GetSharesByParticipant(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, participantShare := range participantShares {
+		subscription, shares, err := sharedSubscription(ctx, participantShare.SubscriptionId, userName)
+		if err != nil && err.Error() == "404" {
+			// the owner deleted the subscription
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		share, _ := userShare(computeSplit(subscription, shares), userName)
+		subscription.SharedBy = subscription.UserName
+		subscription.FullCost = subscription.Cost
+		subscription.Cost = share.Amount
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+func shareFraction(subscription models.SubscriptionDynamodb) float32 {
+	/*
+		Returns the fraction of the full cost a report subscription carries.
+		Params: subscription models.SubscriptionDynamodb
+		Return: float32
+	*/
+	if subscription.FullCost <= 0 {
+		return 1
+	}
+	return subscription.Cost / subscription.FullCost
+}
+
+func GetBalances(ctx context.Context, userName string) (models.UserBalances, error) {
+	/*
+		Returns who owes whom for the subscriptions a user shares. Owners pay
+		the whole subscription, so every payment made since a participant
+		joined adds the participant's share to what they owe the owner, net
+		of its refunds. Recorded settlements are deducted.
+		Params: ctx context.Context
+				userName string
+		Return: models.UserBalances, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting balances")
+	// net amounts keyed by counterparty and currency; positive when the
+	// counterparty owes the user
+	type balanceKey struct{ counterparty, currency string }
+	net := map[balanceKey]float64{}
+
+	addPayments := func(subscription models.SubscriptionDynamodb, shares []models.SubscriptionShare) error {
+		payments, err := repository.GetSubscriptionPayments(ctx, subscription.UUID)
+		if err != nil {
+			return err
+		}
+		split := computeSplit(subscription, shares)
+		for _, share := range split.Shares {
+			if share.Owner || (subscription.UserName != userName && share.UserName != userName) {
+				continue
+			}
+			since := share.Since
+			if len(since) > len(config.DATE_FORMAT) {
+				since = since[:len(config.DATE_FORMAT)]
+			}
+			if split.Cost <= 0 {
+				continue
+			}
+			owed := 0.0
+			for _, payment := range payments {
+				if payment.PaymentDate >= since {
+					owed += float64(netPaymentAmount(payment)) * float64(share.Amount) / float64(split.Cost)
+				}
+			}
+			if subscription.UserName == userName {
+				net[balanceKey{share.UserName, split.Currency}] += owed
+			} else {
+				net[balanceKey{subscription.UserName, split.Currency}] -= owed
+			}
+		}
+		return nil
+	}
+
+	ownedShares, err := repository.GetSharesByOwner(ctx, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting balances")
+		return models.UserBalances{}, err
+	}
+	participantShares, err := repository.GetSharesByParticipant(ctx, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting balances")
+		return models.UserBalances{}, err
+	}
+	subscriptionIds := map[string]bool{}
+	for _, share := range append(ownedShares, participantShares...) {
+		if subscriptionIds[share.SubscriptionId] {
+			continue
+		}
+		subscriptionIds[share.SubscriptionId] = true
+		subscription, shares, err := sharedSubscription(ctx, share.SubscriptionId, userName)
+		if err != nil && err.Error() == "404" {
+			continue
+		}
+		if err == nil {
+			err = addPayments(subscription, shares)
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting balances")
+			return models.UserBalances{}, err
+		}
+	}
+
+	settlements, err := repository.GetUserSettlements(ctx, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting balances")
+		return models.UserBalances{}, err
+	}
+	for _, settlement := range settlements {
+		if settlement.From == userName {
+			net[balanceKey{settlement.To, settlement.Currency}] += float64(settlement.Amount)
+		} else {
+			net[balanceKey{settlement.From, settlement.Currency}] -= float64(settlement.Amount)
+		}
+	}
+
+	balances := models.UserBalances{UserName: userName, Balances: []models.Balance{}}
+	for key, amount := range net {
+		rounded := roundCents(amount)
+		switch {
+		case rounded > 0:
+			balances.Balances = append(balances.Balances, models.Balance{From: key.counterparty, To: userName, Amount: rounded, Currency: key.currency})
+		case rounded < 0:
+			balances.Balances = append(balances.Balances, models.Balance{From: userName, To: key.counterparty, Amount: -rounded, Currency: key.currency})
+		}
+	}
+	sort.Slice(balances.Balances, func(i, j int) bool {
+		return balances.Balances[i].Amount > balances.Balances[j].Amount
+	})
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Int("balance_count", len(balances.Balances)).Msg("Balances retrieved")
+	return balances, nil
+}
+
+func sharesSubscriptionWith(ctx context.Context, userName string, counterparty string) (bool, error) {
+	/*
+		Tells whether a user shares a subscription with another, either way.
+		Params: ctx context.Context
+				userName string
+				counterparty string
+		Return: bool, error
+	*/
+	ownedShares, err := repository.GetSharesByOwner(ctx, userName)
+	if err != nil {
+		return false, err
+	}
+	for _, share := range ownedShares {
+		if share.Participant == counterparty {
+			return true, nil
+		}
+	}
+	participantShares, err := repository.GetSharesByParticipant(ctx, userName)
+	if err != nil {
+		return false, err
+	}
+	for _, share := range participantShares {
+		if share.Owner == counterparty {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func SettleBalance(ctx context.Context, input models.SettlementInput) (models.Settlement, error) {
+	/*
+		Records a payment from one user to another that settles (part of)
+		their balance. Only the payee records it, so that a payer cannot
+		clear a debt on their own, and only between users sharing a
+		subscription.
+		Params: ctx context.Context
+				input models.SettlementInput
+		Return: models.Settlement, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str("from", input.From).Str("to", input.To).Msg("Settling balance")
+	if input.From == "" || input.To == "" || input.From == input.To {
+		return models.Settlement{}, fmt.Errorf("%w: a settlement is between two different users", ErrInvalidShare)
+	}
+	if input.UserName != input.To {
+		return models.Settlement{}, fmt.Errorf("%w: a settlement is recorded by its payee", ErrForbidden)
+	}
+	amount, err := strconv.ParseFloat(input.Amount, 32)
+	if err != nil || amount <= 0 {
+		return models.Settlement{}, fmt.Errorf("%w: amount must be a positive number", ErrInvalidShare)
+	}
+	date := input.Date
+	if date == "" {
+		date = time.Now().UTC().Format(config.DATE_FORMAT)
+	} else if _, err := time.Parse(config.DATE_FORMAT, date); err != nil {
+		return models.Settlement{}, fmt.Errorf("%w: date must be formatted as %s", ErrInvalidShare, config.DATE_FORMAT)
+	}
+	currency := strings.ToUpper(input.Currency)
+	if currency == "" {
+		currency = config.DEFAULT_CURRENCY
+	}
+
+	shared, err := sharesSubscriptionWith(ctx, input.To, input.From)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error settling balance")
+		return models.Settlement{}, err
+	}
+	if !shared {
+		return models.Settlement{}, fmt.Errorf("%w: %s shares no subscription with %s", ErrForbidden, input.From, input.To)
+	}
+
+	settlement := models.Settlement{
+		SettlementId: uuid.New().String(),
+		From:         input.From,
+		To:           input.To,
+		Amount:       float32(amount),
+		Currency:     currency,
+		Date:         date,
+	}
+	err = repository.AddSettlement(ctx, settlement)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error settling balance")
+		return models.Settlement{}, err
+	}
+	settlement.UserName = input.UserName
+	log.Ctx(ctx).Info().Str("settlement_id", settlement.SettlementId).Msg("Balance settled")
+	return settlement, nil
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidStatement = errors.New("invalid statement")
+
+var ofxTransactionRegex = regexp.MustCompile(`(?i)<STMTTRN>`)
+var ofxTransactionEndRegex = regexp.MustCompile(`(?i)</STMTTRN>|</BANKTRANLIST>`)
+var ofxCurrencyRegex = regexp.MustCompile(`(?i)<CURDEF>\s*([A-Z]{3})`)
+
+// statementDateFormats are the date layouts accepted in CSV statements
+var statementDateFormats = []string{"2006-01-02", "01/02/2006", "1/2/2006", "02.01.2006", "2006/01/02", "Jan 2, 2006", "02 Jan 2006"}
+
+func ofxTag(block string, tag string) string {
+	/*
+		Returns the value of an OFX element. OFX 1.x (SGML) leaves elements
+		unclosed, so the value runs until the next tag or line break.
+		Params: block string
+				tag string
+		Return: string
+	*/
+	re := regexp.MustCompile(`(?i)<` + tag + `>([^<\r\n]*)`)
+	match := re.FindStringSubmatch(block)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimSpace(match[1])
+}
+
+func parseOFX(content string) ([]models.StatementTransaction, error) {
+	/*
+		Parses the debit transactions of an OFX/QFX statement.
+		Params: content string
+		Return: []models.StatementTransaction, error
+	*/
+	currency := config.DEFAULT_CURRENCY
+	if match := ofxCurrencyRegex.FindStringSubmatch(content); match != nil {
+		currency = strings.ToUpper(match[1])
+	}
+
+	// STMTTRN may be unclosed, so each block runs until the next STMTTRN
+	starts := ofxTransactionRegex.FindAllStringIndex(content, -1)
+	if len(starts) == 0 {
+		return nil, fmt.Errorf("%w: no STMTTRN elements found", ErrInvalidStatement)
+	}
+	blocks := []string{}
+	for i, start := range starts {
+		end := len(content)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		block := content[start[1]:end]
+		if loc := ofxTransactionEndRegex.FindStringIndex(block); loc != nil {
+			block = block[:loc[0]]
+		}
+		blocks = append(blocks, block)
+	}
+
+	transactions := []models.StatementTransaction{}
+	for _, block := range blocks {
+		amount, err := strconv.ParseFloat(ofxTag(block, "TRNAMT"), 32)
+		if err != nil || amount >= 0 {
+			// credits and unreadable amounts are never subscription charges
+			continue
+		}
+		posted := ofxTag(block, "DTPOSTED")
+		if len(posted) < 8 {
+			continue
+		}
+		date, err := time.Parse("20060102", posted[:8])
+		if err != nil {
+			continue
+		}
+		description := ofxTag(block, "NAME")
+		if description == "" {
+			description = ofxTag(block, "MEMO")
+		}
+		transactions = append(transactions, models.StatementTransaction{
+			Date:        date.Format(config.DATE_FORMAT),
+			Description: description,
+			Amount:      float32(math.Abs(amount)),
+			Currency:    currency,
+		})
+	}
+	return transactions, nil
+}
+
+func parseStatementDate(value string) (time.Time, error) {
+	/*
+		Parses a statement date using the first matching layout.
+		Params: value string
+		Return: time.Time, error
+	*/
+	for _, layout := range statementDateFormats {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+func parseStatementCSV(content string, mapping map[string]string) ([]models.StatementTransaction, error) {
+	/*
+		Parses a generic CSV statement with date, description and amount columns
+		(and an optional currency column). Column names can be remapped.
+		Params: content string
+				mapping map[string]string
+		Return: []models.StatementTransaction, error
+	*/
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidStatement, err)
+	}
+	headerIndex := map[string]int{}
+	for i, header := range headers {
+		headerIndex[normalizeHeader(header)] = i
+	}
+	columns := map[string]int{}
+	for _, field := range []string{"date", "description", "amount", "currency"} {
+		header := field
+		if mapped, ok := mapping[field]; ok {
+			header = mapped
+		}
+		if i, ok := headerIndex[normalizeHeader(header)]; ok {
+			columns[field] = i
+		} else if field != "currency" {
+			return nil, fmt.Errorf("%w: missing column for %s", ErrInvalidStatement, field)
+		}
+	}
+
+	type row struct {
+		date        time.Time
+		description string
+		amount      float64
+		currency    string
+	}
+	rows := []row{}
+	hasNegative := false
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		value := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		date, err := parseStatementDate(value("date"))
+		if err != nil {
+			continue
+		}
+		amount, err := strconv.ParseFloat(strings.NewReplacer(",", "", "$", "", "€", "", "£", "").Replace(value("amount")), 64)
+		if err != nil || amount == 0 {
+			continue
+		}
+		if amount < 0 {
+			hasNegative = true
+		}
+		currency := strings.ToUpper(value("currency"))
+		if currency == "" {
+			currency = config.DEFAULT_CURRENCY
+		}
+		rows = append(rows, row{date: date, description: value("description"), amount: amount, currency: currency})
+	}
+
+	// when the statement is signed, only the debits are charges
+	transactions := []models.StatementTransaction{}
+	for _, r := range rows {
+		if hasNegative && r.amount > 0 {
+			continue
+		}
+		transactions = append(transactions, models.StatementTransaction{
+			Date:        r.date.Format(config.DATE_FORMAT),
+			Description: r.description,
+			Amount:      float32(math.Abs(r.amount)),
+			Currency:    r.currency,
+		})
+	}
+	return transactions, nil
+}
+
+func ImportStatement(ctx context.Context, input models.StatementImportInput) (models.StatementImportResult, error) {
+	/*
+		Parses a bank or card statement and proposes subscriptions for the
+		recurring charges found in it. Nothing is written to DynamoDB.
+		Params: ctx context.Context
+				input models.StatementImportInput
+		Return: models.StatementImportResult, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Str("format", string(input.Format)).Msg("Importing statement")
+
+	var transactions []models.StatementTransaction
+	var err error
+	switch input.Format {
+	case models.StatementOFX, models.StatementQFX:
+		transactions, err = parseOFX(input.Content)
+	case models.StatementCSV:
+		transactions, err = parseStatementCSV(input.Content, input.ColumnMapping)
+	default:
+		err = fmt.Errorf("%w: unsupported format %q", ErrInvalidStatement, input.Format)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error parsing statement")
+		return models.StatementImportResult{}, err
+	}
+	if len(transactions) > config.STATEMENT_MAX_TRANSACTIONS {
+		return models.StatementImportResult{}, fmt.Errorf("%w: more than %d transactions", ErrInvalidStatement, config.STATEMENT_MAX_TRANSACTIONS)
+	}
+
+	proposals := DetectRecurringCharges(transactions)
+	for i := range proposals {
+		proposals[i].Subscription.UserName = input.UserName
+	}
+
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Int("transaction_count", len(transactions)).Int("proposal_count", len(proposals)).Msg("Statement imported")
+	return models.StatementImportResult{TransactionCount: len(transactions), Proposals: proposals}, nil
+}
+
+func proposalPayments(ctx context.Context, proposal models.SubscriptionProposal, userName string, categories []models.Category, today string) (models.SubscriptionDynamodb, []models.PaymentDynamodb, error) {
+	/*
+		Checks an accepted proposal and returns the subscription it creates
+		and the payments backfilled from its transactions, which must be
+		positive and dated no later than today.
+		Params: ctx context.Context
+				proposal models.SubscriptionProposal
+				userName string
+				categories []models.Category
+				today string
+		Return: models.SubscriptionDynamodb, []models.PaymentDynamodb, error
+	*/
+	subInput := proposal.Subscription
+	subInput.UserName = userName
+	sub, err := newSubscriptionItem(ctx, uuid.New().String(), subInput, categories)
+	if err != nil {
+		return models.SubscriptionDynamodb{}, nil, fmt.Errorf("%w: %v", ErrInvalidStatement, err)
+	}
+	payments := []models.PaymentDynamodb{}
+	for _, transaction := range proposal.Transactions {
+		if _, err := time.Parse(config.DATE_FORMAT, transaction.Date); err != nil || transaction.Date > today {
+			return models.SubscriptionDynamodb{}, nil, fmt.Errorf("%w: transaction date %q must be a past date formatted as %s", ErrInvalidStatement, transaction.Date, config.DATE_FORMAT)
+		}
+		if transaction.Amount <= 0 {
+			return models.SubscriptionDynamodb{}, nil, fmt.Errorf("%w: transaction amount must be positive", ErrInvalidStatement)
+		}
+		payments = append(payments, models.PaymentDynamodb{
+			SubscriptionId: sub.UUID,
+			UUID:           uuid.New().String(),
+			UserName:       userName,
+			Amount:         transaction.Amount,
+			PaymentDate:    transaction.Date,
+			Status:         models.PaymentStatusPaid,
+		})
+		if transaction.Date > sub.LastPaymentDate {
+			sub.LastPaymentDate = transaction.Date
+		}
+	}
+	return sub, payments, nil
+}
+
+func AcceptProposals(ctx context.Context, input models.ProposalAcceptInput) ([]models.ProposalAcceptResult, error) {
+	/*
+		Creates a subscription for every accepted proposal and backfills its
+		payment history from the statement transactions. Every proposal is
+		checked before any is written, and the outcome of each is returned,
+		so that a failed one does not lose the ones already created.
+		Params: ctx context.Context
+				input models.ProposalAcceptInput
+		Return: []models.ProposalAcceptResult, error
+	*/
+	if len(input.Proposals) > config.STATEMENT_MAX_PROPOSALS {
+		return nil, fmt.Errorf("%w: more than %d proposals", ErrInvalidStatement, config.STATEMENT_MAX_PROPOSALS)
+	}
+	transactionCount := 0
+	for _, proposal := range input.Proposals {
+		transactionCount += len(proposal.Transactions)
+	}
+	if transactionCount > config.STATEMENT_MAX_TRANSACTIONS {
+		return nil, fmt.Errorf("%w: more than %d transactions", ErrInvalidStatement, config.STATEMENT_MAX_TRANSACTIONS)
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Int("proposal_count", len(input.Proposals)).Msg("Accepting proposals")
+	categories, err := partitionCategories(ctx, input.UserName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error accepting proposals")
+		return nil, err
+	}
+
+	today := time.Now().UTC().Format(config.DATE_FORMAT)
+	results := make([]models.ProposalAcceptResult, len(input.Proposals))
+	subscriptions := make([]models.SubscriptionDynamodb, len(input.Proposals))
+	payments := make([][]models.PaymentDynamodb, len(input.Proposals))
+	for i, proposal := range input.Proposals {
+		results[i] = models.ProposalAcceptResult{Index: i, Merchant: proposal.Merchant, Status: models.BatchSucceeded, StatusCode: 201}
+		subscriptions[i], payments[i], err = proposalPayments(ctx, proposal, input.UserName, categories, today)
+		if err != nil {
+			results[i].Status, results[i].StatusCode, results[i].Error = models.BatchFailed, 400, err.Error()
+		}
+	}
+
+	created := 0
+	for i := range results {
+		result := &results[i]
+		if result.Status == models.BatchFailed {
+			continue
+		}
+		sub, err := repository.AddSubscription(ctx, subscriptions[i])
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Str("merchant", result.Merchant).Msg("Error accepting proposal")
+			result.Status, result.StatusCode, result.Error = models.BatchFailed, 500, "internal error"
+			continue
+		}
+		result.Subscription = &sub
+		err = repository.BatchAddSubscriptionPayments(ctx, payments[i])
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Str(logging.SubscriptionIdField, sub.UUID).Msg("Error backfilling payments")
+			result.Status, result.StatusCode, result.Error = models.BatchFailed, 500, "the subscription was created but its payments were not backfilled"
+			continue
+		}
+		result.Payments = payments[i]
+		created++
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Int("subscription_count", created).Int("failed", len(results)-created).Msg("Proposals accepted")
+	return results, nil
+}
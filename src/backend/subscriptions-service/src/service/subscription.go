@@ -1,31 +1,98 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
 	"subHandler/src/models"
 	"subHandler/src/repository"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/rs/zerolog/log"
 )
 
-func AddSubscription(item models.SubscriptionCreateInput) (models.SubscriptionDynamodb, error) {
+var ErrInvalidSubscription = errors.New("invalid subscription")
+
+func normalizePriceChanges(changes []models.PriceChange) ([]models.PriceChange, error) {
 	/*
-		Adds a given Item to the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
-			    tableName
-				item models.SubscriptionCreateInput
-		Return: None
+		Checks the announced price changes of a subscription and sorts them
+		by effective date.
+		Params: changes []models.PriceChange
+		Return: []models.PriceChange, error
 	*/
+	seen := map[string]bool{}
+	normalized := []models.PriceChange{}
+	for _, change := range changes {
+		if _, err := time.Parse(config.DATE_FORMAT, change.EffectiveDate); err != nil {
+			return nil, fmt.Errorf("%w: price change date %q must be YYYY-MM-DD", ErrInvalidSubscription, change.EffectiveDate)
+		}
+		if change.Cost < 0 {
+			return nil, fmt.Errorf("%w: price change cost cannot be negative", ErrInvalidSubscription)
+		}
+		if seen[change.EffectiveDate] {
+			return nil, fmt.Errorf("%w: several price changes on %s", ErrInvalidSubscription, change.EffectiveDate)
+		}
+		seen[change.EffectiveDate] = true
+		normalized = append(normalized, change)
+	}
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].EffectiveDate < normalized[j].EffectiveDate })
+	return normalized, nil
+}
 
-	uuid := uuid.New().String()
+func validateCancelAt(cancelAt string) error {
+	/*
+		Checks the date a subscription is scheduled to end.
+		Params: cancelAt string (empty when none is scheduled)
+		Return: error
+	*/
+	if cancelAt == "" {
+		return nil
+	}
+	if _, err := time.Parse(config.DATE_FORMAT, cancelAt); err != nil {
+		return fmt.Errorf("%w: cancel_at %q must be YYYY-MM-DD", ErrInvalidSubscription, cancelAt)
+	}
+	return nil
+}
 
+func newSubscriptionItem(ctx context.Context, uuid string, item models.SubscriptionCreateInput, categories []models.Category) (models.SubscriptionDynamodb, error) {
+	/*
+		Builds the DynamoDB item for a new subscription, filling in the defaults
+		and the missing vendor details from the vendor catalog. The category
+		must be one of the given categories, by id or by name.
+		Params: ctx context.Context
+				uuid string
+				item models.SubscriptionCreateInput
+				categories []models.Category
+		Return: models.SubscriptionDynamodb, error
+	*/
 	costFloat, convErr := strconv.ParseFloat(item.Cost, 32)
 	if convErr != nil {
-		log.Error().Err(convErr).Str("SubscriptionId", uuid).Str("UserName", item.UserName).Str("Name", item.Name).Str("Url", item.Url).Msg("Error converting cost to float")
 		return models.SubscriptionDynamodb{}, convErr
 	}
+	category, err := resolveCategory(categories, item.Category)
+	if err != nil {
+		return models.SubscriptionDynamodb{}, err
+	}
+	tags, err := normalizeTags(item.Tags)
+	if err != nil {
+		return models.SubscriptionDynamodb{}, err
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(item.Currency))
+	if currency == "" {
+		currency = config.DEFAULT_CURRENCY
+	}
+	billingCycle := item.BillingCycle
+	if billingCycle == "" {
+		billingCycle = models.Monthly
+	}
 
 	subNew := models.SubscriptionDynamodb{
 		UUID:            uuid,
@@ -35,94 +102,310 @@ func AddSubscription(item models.SubscriptionCreateInput) (models.SubscriptionDy
 		SettingsUrl:     item.SettingsUrl,
 		Plan:            item.Plan,
 		Cost:            float32(costFloat),
+		Currency:        currency,
+		BillingCycle:    billingCycle,
 		StartDate:       item.StartDate,
-		Icon:            "https://via.placeholder.com/150",
+		Icon:            item.Icon,
 		LastPaymentDate: item.StartDate,
-		Category:        item.Category,
+		TrialEndDate:    item.TrialEndDate,
+		Category:        category,
+		Tags:            tags,
+		PaymentMethodId: item.PaymentMethodId,
+	}
+	applyVendorDefaults(ctx, &subNew)
+	if subNew.Icon == "" {
+		subNew.Icon = config.DEFAULT_ICON_URL
+	}
+	if subNew.Category == "" {
+		subNew.Category = models.Other
+	}
+	return subNew, nil
+}
+
+func AddSubscription(ctx context.Context, item models.SubscriptionCreateInput) (models.SubscriptionDynamodb, error) {
+	/*
+		Adds a given Item to the DynamoDB table. A subscription with a
+		household id is added to the household when the user may edit it.
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
+			    tableName
+				item models.SubscriptionCreateInput
+		Return: None
+	*/
+
+	uuid := uuid.New().String()
+
+	partition, err := categoryPartition(ctx, item.UserName, item.HouseholdId, models.HouseholdEdit)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, uuid).Str(logging.UserNameField, item.UserName).Str(logging.HouseholdIdField, item.HouseholdId).Msg("Error adding subscription")
+		return models.SubscriptionDynamodb{}, err
+	}
+	categories, err := partitionCategories(ctx, partition)
+	if err == nil {
+		err = validatePaymentMethodLink(ctx, item.UserName, item.PaymentMethodId)
 	}
-	log.Info().Str("SubscriptionId", uuid).Str("UserName", item.UserName).Str("Name", item.Name).Str("Url", item.Url).Msg("Adding subscription")
-	res, err := repository.AddSubscription(subNew)
 	if err != nil {
-		log.Error().Err(err).Str("SubscriptionId", uuid).Str("UserName", item.UserName).Str("Name", item.Name).Str("Url", item.Url).Msg("Error adding subscription")
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, uuid).Str(logging.UserNameField, item.UserName).Msg("Error adding subscription")
 		return models.SubscriptionDynamodb{}, err
 	}
-	log.Info().Str("SubscriptionId", uuid).Str("UserName", item.UserName).Str("Name", item.Name).Str("Url", item.Url).Msg("Subscription added")
+	subNew, convErr := newSubscriptionItem(ctx, uuid, item, categories)
+	if convErr != nil {
+		log.Ctx(ctx).Error().Err(convErr).Str(logging.SubscriptionIdField, uuid).Str(logging.UserNameField, item.UserName).Str("name", item.Name).Str("url", item.Url).Msg("Error building subscription")
+		return models.SubscriptionDynamodb{}, convErr
+	}
+	if item.HouseholdId != "" {
+		subNew.UserName = partition
+		subNew.HouseholdId = item.HouseholdId
+	}
+
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, uuid).Str(logging.UserNameField, item.UserName).Str("name", item.Name).Str("url", item.Url).Msg("Adding subscription")
+	res, err := repository.AddSubscription(ctx, subNew)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, uuid).Str(logging.UserNameField, item.UserName).Str("name", item.Name).Str("url", item.Url).Msg("Error adding subscription")
+		return models.SubscriptionDynamodb{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, uuid).Str(logging.UserNameField, item.UserName).Str("name", item.Name).Str("url", item.Url).Msg("Subscription added")
 	return res, nil
 }
 
-func GetSubscription(subscriptionId string, userName string) (models.SubscriptionDynamodb, error) {
+func GetSubscription(ctx context.Context, subscriptionId string, userName string) (models.SubscriptionDynamodb, error) {
 	/*
 		Gets a given Item from the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 			    tableName
 				subscriptionId
 				userName
 		Return: models.SubscriptionDynamodb, error
 	*/
 
-	log.Info().Str("SubscriptionId", subscriptionId).Str("UserName", userName).Msg("Getting subscription")
-	item, err := repository.GetSubscription(userName, subscriptionId)
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Getting subscription")
+	partition, err := subscriptionPartition(ctx, subscriptionId, userName, models.HouseholdView)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error getting subscription")
+		return models.SubscriptionDynamodb{}, err
+	}
+	item, err := repository.GetSubscription(ctx, partition, subscriptionId)
 	if err != nil {
-		log.Error().Err(err).Str("SubscriptionId", subscriptionId).Str("UserName", userName).Msg("Error getting subscription")
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error getting subscription")
 		return models.SubscriptionDynamodb{}, err
 	}
-	log.Info().Str("SubscriptionId", subscriptionId).Str("UserName", userName).Msg("Subscription retrieved")
-	return item, nil
+	items := []models.SubscriptionDynamodb{item}
+	addUsageMetrics(ctx, userName, items, time.Now().UTC())
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Subscription retrieved")
+	return items[0], nil
 }
 
-func DeleteSubscription(subscriptionId string, userName string) error {
+func DeleteSubscription(ctx context.Context, subscriptionId string, userName string) error {
 	/*
-		Deletes a given Subscription from the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Deletes a given Subscription from the DynamoDB table, along with
+		its shares and the screenshot of its cancellation.
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName string
 				subscriptionId string
 				userName string
 		Return: error
 	*/
-	log.Info().Str("SubscriptionId", subscriptionId).Str("UserName", userName).Msg("Deleting subscription")
-	err := repository.DeleteSubscription(userName, subscriptionId)
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Deleting subscription")
+	partition, err := subscriptionPartition(ctx, subscriptionId, userName, models.HouseholdDelete)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error deleting subscription")
+		return err
+	}
+	item, err := repository.GetSubscription(ctx, partition, subscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error deleting subscription")
+		return err
+	}
+	err = repository.DeleteSubscription(ctx, partition, subscriptionId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error deleting subscription")
+		return err
+	}
+	err = deleteSubscriptionData(ctx, item)
 	if err != nil {
-		log.Error().Err(err).Str("SubscriptionId", subscriptionId).Str("UserName", userName).Msg("Error deleting subscription")
 		return err
 	}
-	log.Info().Str("SubscriptionId", subscriptionId).Str("UserName", userName).Msg("Subscription deleted")
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Subscription deleted")
 	return nil
 }
 
-func UpdateSubscription(subscriptionId string, userName string, updateItem models.SubscriptionUpdate) (models.SubscriptionDynamodb, error) {
+func deleteSubscriptionData(ctx context.Context, item models.SubscriptionDynamodb) error {
+	/*
+		Deletes what is stored along with a deleted subscription: the
+		screenshot of its cancellation and its shares.
+		Params: ctx context.Context
+				item models.SubscriptionDynamodb (as it was before the delete)
+		Return: error
+	*/
+	if item.Cancellation != nil && item.Cancellation.ScreenshotKey != "" {
+		store, err := repository.NewBlobStore()
+		if err == nil {
+			err = store.Delete(ctx, item.Cancellation.ScreenshotKey)
+		}
+		if err != nil {
+			// the subscription is gone; an orphaned screenshot is only logged
+			log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, item.UUID).Msg("Error deleting cancellation screenshot")
+		}
+	}
+	err := repository.PutSubscriptionShares(ctx, item.UUID, nil)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, item.UUID).Msg("Error deleting subscription shares")
+		return err
+	}
+	return nil
+}
+
+func UpdateSubscription(ctx context.Context, subscriptionId string, userName string, updateItem models.SubscriptionUpdate) (models.SubscriptionDynamodb, error) {
 	/*
 		Updates a given Subscription in the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
+		Params: ctx context.Context
+				dynamoClient *dynamodb.DynamoDB
 				tableName
 				subscriptionId
 				userName
 				updateItem models.SubscriptionUpdateInput
 		Return: models.SubscriptionDynamodb, error
 	*/
-	log.Info().Str("SubscriptionId", subscriptionId).Str("UserName", userName).Msg("Updating subscription")
-	updatedSubscription, err := repository.UpdateSubscription(userName, subscriptionId, updateItem)
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Updating subscription")
+	partition, err := subscriptionPartition(ctx, subscriptionId, userName, models.HouseholdEdit)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error updating subscription")
+		return models.SubscriptionDynamodb{}, err
+	}
+	err = resolveUpdatedCategory(ctx, partition, &updateItem)
+	if err == nil && updateItem.CancelAt != nil {
+		err = validateCancelAt(*updateItem.CancelAt)
+	}
+	if err == nil && updateItem.PriceChanges != nil {
+		updateItem.PriceChanges, err = normalizePriceChanges(updateItem.PriceChanges)
+	}
+	if err == nil && updateItem.PaymentMethodId != nil {
+		err = validatePaymentMethodLink(ctx, userName, *updateItem.PaymentMethodId)
+	}
 	if err != nil {
-		log.Error().Err(err).Str("SubscriptionId", subscriptionId).Str("UserName", userName).Msg("Error updating subscription")
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error updating subscription")
 		return models.SubscriptionDynamodb{}, err
 	}
-	log.Info().Str("SubscriptionId", subscriptionId).Str("UserName", userName).Msg("Subscription updated")
+	linkUpdatedPlan(ctx, subscriptionId, partition, &updateItem)
+	updatedSubscription, err := repository.UpdateSubscription(ctx, partition, subscriptionId, updateItem)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Error updating subscription")
+		return models.SubscriptionDynamodb{}, err
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, subscriptionId).Str(logging.UserNameField, userName).Msg("Subscription updated")
 	return updatedSubscription, nil
 }
 
-func GetUserSubscriptions(userName string) ([]models.SubscriptionDynamodb, error) {
+func resolveUpdatedCategory(ctx context.Context, partition string, updateItem *models.SubscriptionUpdate) error {
 	/*
-		Gets all Subscriptions from the DynamoDB table.
-		Params: dynamoClient *dynamodb.DynamoDB
-				tableName
-				userName
+		Replaces the category of an update, given by id or name, with its id
+		and normalizes the updated tags.
+		Params: ctx context.Context
+				partition string (owner of the subscription)
+				updateItem *models.SubscriptionUpdate
+		Return: error
+	*/
+	if updateItem.Tags != nil {
+		tags, err := normalizeTags(updateItem.Tags)
+		if err != nil {
+			return err
+		}
+		updateItem.Tags = tags
+	}
+	if updateItem.Category == "" {
+		return nil
+	}
+	categories, err := partitionCategories(ctx, partition)
+	if err != nil {
+		return err
+	}
+	category, err := resolveCategory(categories, models.SubscriptionCategory(updateItem.Category))
+	if err != nil {
+		return err
+	}
+	updateItem.Category = string(category)
+	return nil
+}
+
+func ListUserSubscriptions(ctx context.Context, userName string, filter models.SubscriptionFilter) ([]models.SubscriptionDynamodb, error) {
+	/*
+		Lists the subscriptions of a user as GetUserSubscriptions does, with
+		the user's usage metrics.
+		Params: ctx context.Context
+				userName string
+				filter models.SubscriptionFilter
 		Return: []models.SubscriptionDynamodb, error
 	*/
-	log.Info().Str("UserName", userName).Msg("Getting all subscriptions")
-	items, err := repository.GetUserSubscriptions(userName)
+	items, err := GetUserSubscriptions(ctx, userName, filter)
 	if err != nil {
-		log.Error().Err(err).Str("UserName", userName).Msg("Error getting all subscriptions")
 		return nil, err
 	}
-	log.Info().Str("UserName", userName).Msg("All subscriptions retrieved")
+	addUsageMetrics(ctx, userName, items, time.Now().UTC())
 	return items, nil
 }
+
+func GetUserSubscriptions(ctx context.Context, userName string, filter models.SubscriptionFilter) ([]models.SubscriptionDynamodb, error) {
+	/*
+		Gets all Subscriptions of a user, including the ones shared with
+		them, with the cost of shared subscriptions reduced to the user's
+		share, and the subscriptions of their households, narrowed down to
+		the filtered category and tags.
+		Params: ctx context.Context
+				userName string
+				filter models.SubscriptionFilter
+		Return: []models.SubscriptionDynamodb, error
+	*/
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("Getting all subscriptions")
+	items, err := userSubscriptionShares(ctx, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting all subscriptions")
+		return nil, err
+	}
+	householdItems, err := householdSubscriptions(ctx, userName)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting all subscriptions")
+		return nil, err
+	}
+	items = filterSubscriptions(append(items, householdItems...), filter)
+	log.Ctx(ctx).Info().Str(logging.UserNameField, userName).Msg("All subscriptions retrieved")
+	return items, nil
+}
+
+func linkUpdatedPlan(ctx context.Context, subscriptionId string, partition string, updateItem *models.SubscriptionUpdate) {
+	/*
+		Links an updated subscription to the catalog plan matching its new
+		plan name and cost, unless a catalog plan id was given.
+		Params: ctx context.Context
+				subscriptionId string
+				partition string (owner of the subscription)
+				updateItem *models.SubscriptionUpdate
+		Return: None
+	*/
+	subscription, err := repository.GetSubscription(ctx, partition, subscriptionId)
+	if err != nil {
+		return
+	}
+	vendor, ok := subscriptionVendor(subscription)
+	if !ok {
+		return
+	}
+	for _, plan := range vendor.Plans {
+		if plan.Id == updateItem.PlanId {
+			return
+		}
+	}
+	updateItem.PlanId = ""
+	currency := subscription.Currency
+	if updateItem.Currency != "" {
+		currency = updateItem.Currency
+	}
+	cycle := billingCycleOf(subscription)
+	if models.BillingCycle(updateItem.BillingCycle).IsValid() {
+		cycle = models.BillingCycle(updateItem.BillingCycle)
+	}
+	if plan, ok := matchVendorPlan(vendor, updateItem.Plan, updateItem.Cost, cycle, currency); ok {
+		updateItem.PlanId = plan.Id
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/models"
+	"time"
+)
+
+func parseTaxAmount(field string, value string) (float64, bool, error) {
+	/*
+		Parses an optional non-negative amount of a tax breakdown.
+		Params: field string (name of the field, for the error)
+				value string
+		Return: float64, bool (whether it was given), error
+	*/
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false, nil
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil || amount < 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, false, fmt.Errorf("%w: %s must be a non-negative number", ErrInvalidPayment, field)
+	}
+	return amount, true, nil
+}
+
+func hasTaxBreakdown(payment models.PaymentDynamodb) bool {
+	/*
+		Tells whether a payment was recorded with a tax breakdown.
+		Params: payment models.PaymentDynamodb
+		Return: bool
+	*/
+	return payment.AmountBeforeTax > 0 || payment.TaxAmount > 0
+}
+
+func resolvePaymentTax(amount float32, input models.PaymentTaxInput) (models.PaymentTax, error) {
+	/*
+		Resolves the tax breakdown of a payment amount. The amount before
+		tax, else the tax amount, else the tax rate splits the amount; the
+		other values given must agree with the split to the cent, and the rate
+		is derived when it is not given. No breakdown is recorded when none of
+		them is.
+		Params: amount float32
+				input models.PaymentTaxInput
+		Return: models.PaymentTax, error
+	*/
+	tax := models.PaymentTax{
+		InvoiceNumber: strings.TrimSpace(input.InvoiceNumber),
+		SellerTaxId:   strings.TrimSpace(input.SellerTaxId),
+	}
+	if len(tax.InvoiceNumber) > config.PAYMENT_TAX_REFERENCE_MAX_LENGTH || len(tax.SellerTaxId) > config.PAYMENT_TAX_REFERENCE_MAX_LENGTH {
+		return models.PaymentTax{}, fmt.Errorf("%w: invoice_number and seller_tax_id are at most %d characters", ErrInvalidPayment, config.PAYMENT_TAX_REFERENCE_MAX_LENGTH)
+	}
+	beforeTax, hasBeforeTax, err := parseTaxAmount("amount_before_tax", input.AmountBeforeTax)
+	if err != nil {
+		return models.PaymentTax{}, err
+	}
+	taxAmount, hasTax, err := parseTaxAmount("tax_amount", input.TaxAmount)
+	if err != nil {
+		return models.PaymentTax{}, err
+	}
+	rate, hasRate, err := parseTaxAmount("tax_rate", input.TaxRate)
+	if err != nil {
+		return models.PaymentTax{}, err
+	}
+	if rate > 100 {
+		return models.PaymentTax{}, fmt.Errorf("%w: tax_rate is a percentage of at most 100", ErrInvalidPayment)
+	}
+	if !hasBeforeTax && !hasTax && !hasRate {
+		return tax, nil
+	}
+
+	gross := float64(roundCents(float64(amount)))
+	switch {
+	case hasBeforeTax:
+		tax.AmountBeforeTax = roundCents(beforeTax)
+		tax.TaxAmount = roundCents(gross - float64(tax.AmountBeforeTax))
+	case hasTax:
+		tax.TaxAmount = roundCents(taxAmount)
+		tax.AmountBeforeTax = roundCents(gross - float64(tax.TaxAmount))
+	default:
+		tax.AmountBeforeTax = roundCents(gross / (1 + rate/100))
+		tax.TaxAmount = roundCents(gross - float64(tax.AmountBeforeTax))
+	}
+	if tax.AmountBeforeTax < 0 || tax.TaxAmount < 0 {
+		return models.PaymentTax{}, fmt.Errorf("%w: the amount before tax and tax amount exceed the amount of %.2f", ErrInvalidPayment, gross)
+	}
+	if hasTax && math.Abs(float64(tax.TaxAmount)-taxAmount) > 0.005 {
+		return models.PaymentTax{}, fmt.Errorf("%w: amount_before_tax and tax_amount do not add up to the amount of %.2f", ErrInvalidPayment, gross)
+	}
+	if hasRate {
+		if math.Abs(float64(tax.AmountBeforeTax)*rate/100-float64(tax.TaxAmount)) > 0.01 {
+			return models.PaymentTax{}, fmt.Errorf("%w: tax_amount is not %.2f%% of amount_before_tax", ErrInvalidPayment, rate)
+		}
+		tax.TaxRate = float32(math.Round(rate*100) / 100)
+	} else if tax.AmountBeforeTax > 0 {
+		tax.TaxRate = float32(math.Round(float64(tax.TaxAmount)/float64(tax.AmountBeforeTax)*10000) / 100)
+	}
+	return tax, nil
+}
+
+func givesTax(input models.PaymentTaxInput) bool {
+	/*
+		Tells whether any tax field was given.
+		Params: input models.PaymentTaxInput
+		Return: bool
+	*/
+	return strings.TrimSpace(input.AmountBeforeTax+input.TaxAmount+input.TaxRate+input.InvoiceNumber+input.SellerTaxId) != ""
+}
+
+func updatedPaymentTax(payment models.PaymentDynamodb, amount float32, input models.PaymentTaxInput) (*models.PaymentTax, error) {
+	/*
+		Resolves the tax breakdown of an updated payment. Without a new amount
+		before tax, tax amount or rate, a payment with a breakdown is split
+		again at its tax rate; the invoice number and seller tax id are kept
+		unless given.
+		Params: payment models.PaymentDynamodb
+				amount float32 (the updated amount)
+				input models.PaymentTaxInput
+		Return: *models.PaymentTax (nil when nothing changes), error
+	*/
+	splitGiven := strings.TrimSpace(input.AmountBeforeTax+input.TaxAmount+input.TaxRate) != ""
+	if !givesTax(input) && (!hasTaxBreakdown(payment) || amount == payment.Amount) {
+		return nil, nil
+	}
+	if !splitGiven && hasTaxBreakdown(payment) {
+		input.TaxRate = strconv.FormatFloat(float64(payment.TaxRate), 'f', -1, 32)
+	}
+	if strings.TrimSpace(input.InvoiceNumber) == "" {
+		input.InvoiceNumber = payment.InvoiceNumber
+	}
+	if strings.TrimSpace(input.SellerTaxId) == "" {
+		input.SellerTaxId = payment.SellerTaxId
+	}
+	tax, err := resolvePaymentTax(amount, input)
+	if err != nil {
+		return nil, err
+	}
+	return &tax, nil
+}
+
+func paymentQuarter(date time.Time) string {
+	/*
+		Returns the calendar quarter of a date, written YYYY-Qn.
+		Params: date time.Time
+		Return: string
+	*/
+	return fmt.Sprintf("%d-Q%d", date.Year(), (int(date.Month())-1)/3+1)
+}
+
+// taxTotals accumulates the tax of payments per quarter and currency
+type taxTotals map[string]*models.TaxQuarterTotal
+
+func (t taxTotals) add(payment models.PaymentDynamodb, currency string, fraction float32) {
+	/*
+		Adds the charged part of a payment, net of refunds and reduced to the
+		user's share, to the totals of its quarter.
+		Params: payment models.PaymentDynamodb
+				currency string
+				fraction float32 (the user's share)
+		Return: None
+	*/
+	date, err := time.Parse(config.DATE_FORMAT, payment.PaymentDate)
+	gross := netPaymentAmount(payment)
+	if err != nil || gross <= 0 || payment.Amount <= 0 {
+		return
+	}
+	// refunds return the tax in proportion
+	scale := float64(gross / payment.Amount * fraction)
+	quarter := paymentQuarter(date)
+	key := quarter + "#" + currency
+	total, ok := t[key]
+	if !ok {
+		total = &models.TaxQuarterTotal{Quarter: quarter, Currency: currency}
+		t[key] = total
+	}
+	total.PaymentCount++
+	total.GrossAmount = roundCents(float64(total.GrossAmount) + float64(payment.Amount)*scale)
+	if !hasTaxBreakdown(payment) {
+		total.UntrackedAmount = roundCents(float64(total.UntrackedAmount) + float64(payment.Amount)*scale)
+		return
+	}
+	total.AmountBeforeTax = roundCents(float64(total.AmountBeforeTax) + float64(payment.AmountBeforeTax)*scale)
+	total.TaxAmount = roundCents(float64(total.TaxAmount) + float64(payment.TaxAmount)*scale)
+}
+
+func (t taxTotals) sorted() []models.TaxQuarterTotal {
+	/*
+		Returns the totals by quarter, then currency.
+		Params: None
+		Return: []models.TaxQuarterTotal
+	*/
+	totals := make([]models.TaxQuarterTotal, 0, len(t))
+	for _, total := range t {
+		totals = append(totals, *total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Quarter != totals[j].Quarter {
+			return totals[i].Quarter < totals[j].Quarter
+		}
+		return totals[i].Currency < totals[j].Currency
+	})
+	return totals
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidUsage = errors.New("invalid usage")
+
+type usageDomain struct {
+	Domain       string
+	Subscription models.SubscriptionDynamodb
+}
+
+func usageDomains(subscriptions []models.SubscriptionDynamodb) []usageDomain {
+	/*
+		Returns the domains on which each subscription is used: the host of
+		its URL and the domains of its catalog vendor. The host of the URL
+		is left out when the vendor is scoped to a path of it, so that a
+		shared host (apple.com for Apple Arcade) is not claimed whole.
+		Params: subscriptions []models.SubscriptionDynamodb
+		Return: []usageDomain
+	*/
+	domains := []usageDomain{}
+	for _, subscription := range subscriptions {
+		vendorDomains := []string{}
+		if subscription.VendorId != "" {
+			if vendor, ok := repository.GetVendor(subscription.VendorId); ok {
+				vendorDomains = vendor.Domains
+			}
+		}
+		if host := urlHost(subscription.Url); host != "" && !sharedVendorHost(host, vendorDomains) {
+			domains = append(domains, usageDomain{Domain: host, Subscription: subscription})
+		}
+		for _, domain := range vendorDomains {
+			domains = append(domains, usageDomain{Domain: domain, Subscription: subscription})
+		}
+	}
+	return domains
+}
+
+func sharedVendorHost(host string, vendorDomains []string) bool {
+	/*
+		Tells whether a host is one the vendor only has a path of.
+		Params: host string
+				vendorDomains []string
+		Return: bool
+	*/
+	for _, domain := range vendorDomains {
+		if domainHost, domainPath := splitDomain(domain); domainPath != "" && domainMatches(host, "", domainHost) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchUsageDomain(domains []usageDomain, rawDomain string) (models.SubscriptionDynamodb, bool) {
+	/*
+		Finds the subscription used on a visited domain, preferring the most
+		specific domain and then the first subscription listed.
+		Params: domains []usageDomain
+				rawDomain string (domain or URL)
+		Return: models.SubscriptionDynamodb, bool
+	*/
+	host := urlHost(rawDomain)
+	if host == "" {
+		return models.SubscriptionDynamodb{}, false
+	}
+	path := urlPath(rawDomain)
+	var match models.SubscriptionDynamodb
+	matchLength := 0
+	for _, domain := range domains {
+		if domainMatches(host, path, domain.Domain) && len(domain.Domain) > matchLength {
+			match = domain.Subscription
+			matchLength = len(domain.Domain)
+		}
+	}
+	return match, matchLength > 0
+}
+
+func usageEvent(userName string, event models.UsageEventInput, subscription models.SubscriptionDynamodb, occurredAt time.Time) models.UsageDynamodb {
+	/*
+		Returns the stored usage event of an input event. Visits are keyed by
+		the start of their USAGE_VISIT_WINDOW_MINUTES window.
+		Params: userName string
+				event models.UsageEventInput
+				subscription models.SubscriptionDynamodb
+				occurredAt time.Time
+		Return: models.UsageDynamodb
+	*/
+	item := models.UsageDynamodb{
+		UserName:        userName,
+		SubscriptionId:  subscription.UUID,
+		Source:          event.Source,
+		Domain:          urlHost(event.Domain),
+		OccurredAt:      occurredAt.Format(time.RFC3339),
+		DurationMinutes: event.DurationMinutes,
+		ExpiresAt:       occurredAt.AddDate(0, 0, config.USAGE_RETENTION_DAYS).Unix(),
+	}
+	if event.Source == models.UsageVisit {
+		window := occurredAt.Truncate(config.USAGE_VISIT_WINDOW_MINUTES * time.Minute)
+		item.Id = window.Format(time.RFC3339) + "#" + subscription.UUID
+	} else {
+		item.Id = item.OccurredAt + "#" + subscription.UUID + "#" + uuid.New().String()
+	}
+	return item
+}
+
+func checkUsageEvent(event models.UsageEventInput, now time.Time) (time.Time, error) {
+	/*
+		Checks a usage event and returns when it occurred.
+		Params: event models.UsageEventInput
+				now time.Time
+		Return: time.Time, error
+	*/
+	if event.Source != models.UsageVisit && event.Source != models.UsageSession {
+		return time.Time{}, fmt.Errorf("%w: source must be %q or %q", ErrInvalidUsage, models.UsageVisit, models.UsageSession)
+	}
+	if event.SubscriptionId == "" && event.Domain == "" {
+		return time.Time{}, fmt.Errorf("%w: subscription_id or domain is required", ErrInvalidUsage)
+	}
+	if event.DurationMinutes < 0 || event.DurationMinutes > config.USAGE_MAX_SESSION_MINUTES {
+		return time.Time{}, fmt.Errorf("%w: duration_minutes must be between 0 and %d", ErrInvalidUsage, config.USAGE_MAX_SESSION_MINUTES)
+	}
+	if event.OccurredAt == "" {
+		return now, nil
+	}
+	occurredAt, err := time.Parse(time.RFC3339, event.OccurredAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: occurred_at must be an RFC 3339 time", ErrInvalidUsage)
+	}
+	occurredAt = occurredAt.UTC()
+	if occurredAt.After(now.Add(time.Minute*config.USAGE_VISIT_WINDOW_MINUTES)) || occurredAt.Before(now.AddDate(0, 0, -config.USAGE_RETENTION_DAYS)) {
+		return time.Time{}, fmt.Errorf("%w: occurred_at is out of range", ErrInvalidUsage)
+	}
+	return occurredAt, nil
+}
+
+func RecordUsage(ctx context.Context, input models.UsageInput) (models.UsageResult, error) {
+	/*
+		Records the usage events of a user against the subscriptions they can
+		reach. A visit without a subscription is matched by its domain and
+		ignored when no subscription is on it. Writes are rate limited: a
+		subscription is visited at most once per USAGE_VISIT_WINDOW_MINUTES
+		window, later visits of the window are throttled, and the remaining
+		events are batch written before the last used dates move forward.
+		Params: ctx context.Context
+				input models.UsageInput
+		Return: models.UsageResult, error
+	*/
+	if len(input.Events) == 0 || len(input.Events) > config.USAGE_MAX_EVENTS {
+		return models.UsageResult{}, fmt.Errorf("%w: a request holds 1 to %d events", ErrInvalidUsage, config.USAGE_MAX_EVENTS)
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Int("event_count", len(input.Events)).Msg("Recording usage")
+	subscriptions, err := GetUserSubscriptions(ctx, input.UserName, models.SubscriptionFilter{})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error recording usage")
+		return models.UsageResult{}, err
+	}
+	byId := map[string]models.SubscriptionDynamodb{}
+	for _, subscription := range subscriptions {
+		byId[subscription.UUID] = subscription
+	}
+	var domains []usageDomain
+
+	now := time.Now().UTC()
+	result := models.UsageResult{Results: make([]models.UsageEventResult, len(input.Events))}
+	items := make([]*models.UsageDynamodb, len(input.Events))
+	since := ""
+	for i, event := range input.Events {
+		eventResult := &result.Results[i]
+		*eventResult = models.UsageEventResult{Index: i, Status: models.UsageRejected, SubscriptionId: event.SubscriptionId}
+		occurredAt, err := checkUsageEvent(event, now)
+		if err != nil {
+			eventResult.Error = err.Error()
+			continue
+		}
+		subscription, ok := byId[event.SubscriptionId]
+		if event.SubscriptionId != "" && !ok {
+			eventResult.Error = "subscription not found"
+			continue
+		}
+		if !ok {
+			if domains == nil {
+				domains = usageDomains(subscriptions)
+			}
+			if subscription, ok = matchUsageDomain(domains, event.Domain); !ok {
+				eventResult.Status = models.UsageIgnored
+				continue
+			}
+		}
+		item := usageEvent(input.UserName, event, subscription, occurredAt)
+		eventResult.Status = models.UsageRecorded
+		eventResult.SubscriptionId = subscription.UUID
+		items[i] = &item
+		if event.Source == models.UsageVisit && (since == "" || item.Id < since) {
+			since = item.Id
+		}
+	}
+
+	// the visit windows already stored, by this or an earlier request
+	stored := map[string]bool{}
+	if since != "" {
+		existing, err := repository.GetUserUsage(ctx, input.UserName, since)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error recording usage")
+			return models.UsageResult{}, err
+		}
+		for _, item := range existing {
+			stored[item.Id] = true
+		}
+	}
+	writes := []models.UsageDynamodb{}
+	lastUsed := map[string]string{}
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+		if item.Source == models.UsageVisit && stored[item.Id] {
+			result.Results[i].Status = models.UsageThrottled
+			continue
+		}
+		stored[item.Id] = true
+		writes = append(writes, *item)
+		if date := item.OccurredAt[:len(config.DATE_FORMAT)]; date > lastUsed[item.SubscriptionId] {
+			lastUsed[item.SubscriptionId] = date
+		}
+	}
+	if len(writes) > 0 {
+		err = repository.AddUsageEvents(ctx, writes)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error recording usage")
+			return models.UsageResult{}, err
+		}
+	}
+	for subscriptionId, date := range lastUsed {
+		// the partition of a household or shared subscription is its owner's
+		err = repository.UpdateSubscriptionLastUsed(ctx, byId[subscriptionId].UserName, subscriptionId, date)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, input.UserName).Msg("Error recording usage")
+			return models.UsageResult{}, err
+		}
+	}
+
+	for _, eventResult := range result.Results {
+		switch eventResult.Status {
+		case models.UsageRecorded:
+			result.Recorded++
+		case models.UsageThrottled:
+			result.Throttled++
+		case models.UsageIgnored:
+			result.Ignored++
+		default:
+			result.Rejected++
+		}
+	}
+	log.Ctx(ctx).Info().Str(logging.UserNameField, input.UserName).Int("recorded", result.Recorded).Int("throttled", result.Throttled).Int("ignored", result.Ignored).Int("rejected", result.Rejected).Msg("Usage recorded")
+	return result, nil
+}
+
+func addUsageMetrics(ctx context.Context, userName string, subscriptions []models.SubscriptionDynamodb, now time.Time) {
+	/*
+		Sets the usage metrics of subscriptions read by a user: the uses
+		they recorded in the last USAGE_METRICS_DAYS days, what each of them
+		cost over that period and the days since the last use. The metrics
+		are left out when the usage cannot be read.
+		Params: ctx context.Context
+				userName string
+				subscriptions []models.SubscriptionDynamodb
+				now time.Time
+		Return: None
+	*/
+	since := now.AddDate(0, 0, -config.USAGE_METRICS_DAYS).Format(time.RFC3339)
+	usage, err := repository.GetUserUsage(ctx, userName, since)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str(logging.UserNameField, userName).Msg("Error getting usage metrics")
+		return
+	}
+	uses := map[string]int{}
+	for _, item := range usage {
+		uses[item.SubscriptionId]++
+	}
+	today := now.Truncate(24 * time.Hour)
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		recentUses := uses[subscription.UUID]
+		subscription.RecentUses = &recentUses
+		if recentUses > 0 {
+			costPerUse := roundCents(annualCost(*subscription) * config.USAGE_METRICS_DAYS / 365 / float64(recentUses))
+			subscription.CostPerUse = &costPerUse
+		}
+		if lastUsed, err := time.Parse(config.DATE_FORMAT, subscription.LastUsedDate); err == nil {
+			days := int(today.Sub(lastUsed).Hours() / 24)
+			if days < 0 {
+				days = 0
+			}
+			subscription.DaysSinceLastUse = &days
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/logging"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+var nonAlphanumericRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// minVendorPrefixLength keeps short vendor names ("time", "calm") from
+// matching unrelated names that merely start with them
+const minVendorPrefixLength = 5
+
+func vendorKey(name string) string {
+	/*
+		Normalizes a name for vendor matching ("Disney+" -> "disney").
+		Params: name string
+		Return: string
+	*/
+	return nonAlphanumericRegex.ReplaceAllString(strings.ToLower(name), "")
+}
+
+func resolveVendorIcon(vendor models.Vendor) models.Vendor {
+	/*
+		Turns the logo file name of a vendor into an icon URL.
+		Params: vendor models.Vendor
+		Return: models.Vendor
+	*/
+	if vendor.Icon == "" {
+		vendor.Icon = config.DEFAULT_ICON_URL
+	} else if !strings.Contains(vendor.Icon, "/") {
+		vendor.Icon = config.VENDOR_ICON_BASE_URL + vendor.Icon
+	}
+	return vendor
+}
+
+func ListVendors(ctx context.Context, query string, category string) []models.Vendor {
+	/*
+		Returns the vendors of the catalog, optionally filtered by a name
+		query and a category.
+		Params: ctx context.Context
+				query string
+				category string
+		Return: []models.Vendor
+	*/
+	log.Ctx(ctx).Info().Str("query", query).Str("category", category).Msg("Listing vendors")
+	queryKey := vendorKey(query)
+	vendors := []models.Vendor{}
+	for _, vendor := range repository.GetVendors() {
+		if category != "" && vendor.Category != models.SubscriptionCategory(category).Normalize() {
+			continue
+		}
+		if queryKey != "" && !strings.Contains(vendorKey(vendor.Name), queryKey) {
+			continue
+		}
+		vendors = append(vendors, resolveVendorIcon(vendor))
+	}
+	log.Ctx(ctx).Info().Int("vendor_count", len(vendors)).Msg("Vendors listed")
+	return vendors
+}
+
+func GetVendor(ctx context.Context, id string) (models.Vendor, error) {
+	/*
+		Returns the vendor with the given id.
+		Params: ctx context.Context
+				id string
+		Return: models.Vendor, error
+	*/
+	log.Ctx(ctx).Info().Str("vendor_id", id).Msg("Getting vendor")
+	vendor, ok := repository.GetVendor(id)
+	if !ok {
+		log.Ctx(ctx).Error().Str("vendor_id", id).Msg("Error getting vendor. No vendor found.")
+		return models.Vendor{}, errors.New("404")
+	}
+	return resolveVendorIcon(vendor), nil
+}
+
+func urlHost(rawUrl string) string {
+	/*
+		Returns the lower case host of a URL or bare domain, without "www.".
+		Params: rawUrl string
+		Return: string (empty when there is no host)
+	*/
+	rawUrl = strings.TrimSpace(rawUrl)
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+func urlPath(rawUrl string) string {
+	/*
+		Returns the lower case path of a URL or bare domain, without a
+		trailing "/".
+		Params: rawUrl string
+		Return: string (empty when there is no path)
+	*/
+	rawUrl = strings.TrimSpace(rawUrl)
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(parsed.Path), "/")
+}
+
+func splitDomain(domain string) (string, string) {
+	/*
+		Splits a vendor domain into its host and the path it is scoped to
+		("apple.com/apple-arcade" -> "apple.com", "/apple-arcade").
+		Params: domain string
+		Return: string (host), string (path, empty for the whole host)
+	*/
+	host, path, found := strings.Cut(domain, "/")
+	if !found {
+		return host, ""
+	}
+	return host, "/" + strings.Trim(path, "/")
+}
+
+func domainMatches(host string, path string, domain string) bool {
+	/*
+		Tells whether a host and path are on a domain or one of its
+		subdomains, under the path the domain is scoped to if any. A bare
+		host, such as the domain of an email sender, never matches a
+		domain scoped to a path.
+		Params: host string
+				path string
+				domain string
+		Return: bool
+	*/
+	domainHost, domainPath := splitDomain(domain)
+	if host != domainHost && !strings.HasSuffix(host, "."+domainHost) {
+		return false
+	}
+	return domainPath == "" || path == domainPath || strings.HasPrefix(path, domainPath+"/")
+}
+
+func matchVendorByDomain(rawUrl string) (models.Vendor, bool) {
+	/*
+		Matches the host and path of a URL against the vendor domains,
+		preferring the most specific domain (music.apple.com over apple.com).
+		Params: rawUrl string
+		Return: models.Vendor, bool
+	*/
+	host := urlHost(rawUrl)
+	if host == "" {
+		return models.Vendor{}, false
+	}
+	path := urlPath(rawUrl)
+
+	var match models.Vendor
+	matchLength := 0
+	for _, vendor := range repository.GetVendors() {
+		for _, domain := range vendor.Domains {
+			if domainMatches(host, path, domain) && len(domain) > matchLength {
+				match = vendor
+				matchLength = len(domain)
+			}
+		}
+	}
+	return match, matchLength > 0
+}
+
+func matchVendorByName(name string) (models.Vendor, bool) {
+	/*
+		Matches a subscription or merchant name against the vendor names and
+		aliases, exactly first and then by the longest vendor name it starts with.
+		Params: name string
+		Return: models.Vendor, bool
+	*/
+	key := vendorKey(name)
+	if key == "" {
+		return models.Vendor{}, false
+	}
+
+	var match models.Vendor
+	matchLength := 0
+	for _, vendor := range repository.GetVendors() {
+		for _, candidate := range append([]string{vendor.Name}, vendor.Aliases...) {
+			candidateKey := vendorKey(candidate)
+			if candidateKey == key {
+				return vendor, true
+			}
+			if len(candidateKey) >= minVendorPrefixLength && strings.HasPrefix(key, candidateKey) && len(candidateKey) > matchLength {
+				match = vendor
+				matchLength = len(candidateKey)
+			}
+		}
+	}
+	return match, matchLength > 0
+}
+
+func MatchVendor(name string, rawUrl string) (models.Vendor, bool) {
+	/*
+		Finds the catalog vendor of a subscription by its URL domain or its name.
+		Params: name string
+				rawUrl string
+		Return: models.Vendor, bool
+	*/
+	if rawUrl != "" {
+		if vendor, ok := matchVendorByDomain(rawUrl); ok {
+			return resolveVendorIcon(vendor), true
+		}
+	}
+	if vendor, ok := matchVendorByName(name); ok {
+		return resolveVendorIcon(vendor), true
+	}
+	return models.Vendor{}, false
+}
+
+func applyVendorDefaults(ctx context.Context, item *models.SubscriptionDynamodb) {
+	/*
+		Links a subscription to its catalog vendor and plan, and fills in the
+		URL, settings URL, icon and category from the vendor when they are missing.
+		Params: ctx context.Context
+				item *models.SubscriptionDynamodb
+		Return: None
+	*/
+	vendor, ok := MatchVendor(item.Name, item.Url)
+	if !ok {
+		return
+	}
+	log.Ctx(ctx).Info().Str(logging.SubscriptionIdField, item.UUID).Str("vendor_id", vendor.Id).Msg("Matched subscription vendor")
+	linkVendorPlan(vendor, item)
+	if item.Url == "" {
+		item.Url = vendor.Url
+	}
+	if item.SettingsUrl == "" {
+		item.SettingsUrl = vendor.SettingsUrl
+	}
+	if item.Icon == "" {
+		item.Icon = vendor.Icon
+	}
+	if item.Category == "" {
+		item.Category = vendor.Category
+	}
+}
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"subHandler/src/config"
+	"subHandler/src/models"
+	"subHandler/src/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// Headers of a webhook delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret. Receivers reject
+// deliveries with an old timestamp and delivery ids they have already seen.
+const (
+	webhookIdHeader        = "X-Subhub-Webhook-Id"
+	webhookDeliveryHeader  = "X-Subhub-Delivery-Id"
+	webhookEventTypeHeader = "X-Subhub-Event-Type"
+	webhookTimestampHeader = "X-Subhub-Timestamp"
+	webhookSignatureHeader = "X-Subhub-Signature"
+	webhookSignatureScheme = "v1"
+	webhookUserAgent       = "SubHub-Webhooks/1.0"
+)
+
+func validateWebhookUrl(rawUrl string) (string, error) {
+	/*
+		Checks that a webhook endpoint is a public HTTPS URL.
+		Params: rawUrl string
+		Return: string (trimmed URL), error
+	*/
+	rawUrl = strings.TrimSpace(rawUrl)
+	endpoint, err := url.Parse(rawUrl)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Hostname() == "" {
+		return "", fmt.Errorf("%w: url must be an https URL", ErrInvalidWebhook)
+	}
+	host := strings.ToLower(endpoint.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") {
+		return "", fmt.Errorf("%w: url must be publicly reachable", ErrInvalidWebhook)
+	}
+	// addresses resolved from a name are checked again when connecting
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || !ip.IsGlobalUnicast()) {
+		return "", fmt.Errorf("%w: url must be publicly reachable", ErrInvalidWebhook)
+	}
+	return rawUrl, nil
+}
+
+func normalizeEventTypes(eventTypes []models.DomainEventType) ([]models.DomainEventType, error) {
+	/*
+		Drops duplicate event types and sorts them, failing with
+		ErrInvalidWebhook on an unknown type.
+		Params: eventTypes []models.DomainEventType
+		Return: []models.DomainEventType, error
+	*/
+	seen := map[models.DomainEventType]bool{}
+	normalized := []models.DomainEventType{}
+	for _, eventType := range eventTypes {
+		if !eventType.IsValid() {
+			return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			normalized = append(normalized, eventType)
+		}
+	}
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i] < normalized[j] })
+	return normalized, nil
+}
+
+func newWebhookSecret() (string, error) {
+	/*
+		Generates the secret signing the deliveries of a webhook.
+		Params: None
+		Return: string, error
+	*/
+	secret := make([]byte, config.WEBHOOK_SECRET_BYTES)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+func redactWebhook(webhook models.Webhook) models.Webhook {
+	/*
+		Removes the secret of a webhook before it is returned.
+		Params: webhook models.Webhook
+		Return: models.Webhook
+	*/
+	webhook.Secret = ""
+	return webhook
+}
+
+func CreateWebhook(ctx context.Context, input models.WebhookCreateInput) (models.Webhook, error) {
+	/*
+		Registers a webhook endpoint of a user. The secret signing its
+		deliveries is returned this once.
+		Params: ctx context.Context
+				input models.WebhookCreateInput
+		Return: models.Webhook, error
+	*/
+	endpoint, err := validateWebhookUrl(input.Url)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	eventTypes, err := normalizeEventTypes(input.EventTypes)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	webhooks, err := repository.GetWebhooks(ctx, input.UserName)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if len(webhooks) >= config.WEBHOOK_MAX_PER_USER {
+		return models.Webhook{}, fmt.Errorf("%w: a user can register up to %d webhooks", ErrInvalidWebhook, config.WEBHOOK_MAX_PER_USER)
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	return repository.PutWebhook(ctx, models.Webhook{
+		UserName:    input.UserName,
+		WebhookId:   uuid.New().String(),
+		Url:         endpoint,
+		Description: strings.TrimSpace(input.Description),
+		EventTypes:  eventTypes,
+		Secret:      secret,
+		Enabled:     true,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func GetWebhooks(ctx context.Context, userName string) ([]models.Webhook, error) {
+	/*
+		Returns the webhooks of a user, without their secrets.
+		Params: ctx context.Context
+				userName string
+		Return: []models.Webhook, error
+	*/
+	webhooks, err := repository.GetWebhooks(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i] = redactWebhook(webhooks[i])
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].CreatedAt < webhooks[j].CreatedAt })
+	return webhooks, nil
+}
+
+func GetWebhook(ctx context.Context, webhookId string, userName string) (models.Webhook, error) {
+	/*
+		Returns a webhook of a user, without its secret.
+		Params: ctx context.Context
+				webhookId string
+				userName string
+		Return: models.Webhook, error
+	*/
+	webhook, err := repository.GetWebhook(ctx, userName, webhookId)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	return redactWebhook(webhook), nil
+}
+
+func UpdateWebhook(ctx context.Context, webhookId string, input models.WebhookUpdateInput) (models.Webhook, error) {
+	/*
+		Updates the endpoint, description or event filter of a webhook,
+		enables or disables it, or rotates its secret. The new secret is
+		returned this once.
+		Params: ctx context.Context
+				webhookId string
+				input models.WebhookUpdateInput
+		Return: models.Webhook, error
+	*/
+	webhook, err := repository.GetWebhook(ctx, input.UserName, webhookId)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if input.Url != "" {
+		webhook.Url, err = validateWebhookUrl(input.Url)
+		if err != nil {
+			return models.Webhook{}, err
+		}
+	}
+	if input.Description != nil {
+		webhook.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.EventTypes != nil {
+		webhook.EventTypes, err = normalizeEventTypes(*input.EventTypes)
+		if err != nil {
+			return models.Webhook{}, err
+		}
+	}
+	if input.Enabled != nil {
+		webhook.Enabled = *input.Enabled
+		webhook.DisabledReason = ""
+		if webhook.Enabled {
+			webhook.ConsecutiveFailures = 0
+		}
+	}
+	if input.RotateSecret {
+		webhook.Secret, err = newWebhookSecret()
+		if err != nil {
+			return models.Webhook{}, err
+		}
+	}
+	webhook.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	webhook, err = repository.PutWebhook(ctx, webhook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if !input.RotateSecret {
+		webhook = redactWebhook(webhook)
+	}
+	return webhook, nil
+}
+
+func DeleteWebhook(ctx context.Context, webhookId string, userName string) error {
+	/*
+		Deletes a webhook of a user with its delivery log.
+		Params: ctx context.Context
+				webhookId string
+				userName string
+		Return: error
+	*/
+	return repository.DeleteWebhook(ctx, userName, webhookId)
+}
+
+func GetWebhookDeliveries(ctx context.Context, webhookId string, userName string, status models.WebhookDeliveryStatus) ([]models.WebhookDelivery, error) {
+	/*
+		Returns the latest deliveries of a webhook of a user, newest first.
+		Params: ctx context.Context
+				webhookId string
+				userName string
+				status models.WebhookDeliveryStatus (empty for all)
+		Return: []models.WebhookDelivery, error
+	*/
+	_, err := repository.GetWebhook(ctx, userName, webhookId)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := repository.GetWebhookDeliveries(ctx, webhookId)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []models.WebhookDelivery{}
+	for _, delivery := range deliveries {
+		if status == "" || delivery.Status == status {
+			delivery.Pending = ""
+			filtered = append(filtered, delivery)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].CreatedAt > filtered[j].CreatedAt })
+	if len(filtered) > config.WEBHOOK_DELIVERY_LOG_LIMIT {
+		filtered = filtered[:config.WEBHOOK_DELIVERY_LOG_LIMIT]
+	}
+	return filtered, nil
+}
+
+func signWebhookPayload(secret string, timestamp string, payload string) string {
+	/*
+		Returns the signature header value of a delivery.
+		Params: secret string
+				timestamp string (Unix seconds)
+				payload string
+		Return: string
+	*/
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return webhookSignatureScheme + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookRetryDelay(attempts int) time.Duration {
+	/*
+		Returns the wait before the next attempt of a delivery, doubling
+		after each failed attempt.
+		Params: attempts int (attempts made so far)
+		Return: time.Duration
+	*/
+	return time.Duration(config.WEBHOOK_RETRY_BASE_SECONDS<<(attempts-1)) * time.Second
+}
+
+func attemptWebhookDelivery(ctx context.Context, webhook models.Webhook, delivery *models.WebhookDelivery, now time.Time) bool {
+	/*
+		Posts a delivery to its webhook and records the outcome of the
+		attempt. A failed delivery is scheduled for another attempt until
+		WEBHOOK_MAX_ATTEMPTS is reached.
+		Params: ctx context.Context
+				webhook models.Webhook
+				delivery *models.WebhookDelivery
+				now time.Time
+		Return: bool (whether the endpoint accepted the delivery)
+	*/
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	headers := map[string]string{
+		"Content-Type":         "application/json",
+		"User-Agent":           webhookUserAgent,
+		webhookIdHeader:        webhook.WebhookId,
+		webhookDeliveryHeader:  delivery.DeliveryId,
+		webhookEventTypeHeader: string(delivery.EventType),
+		webhookTimestampHeader: timestamp,
+		webhookSignatureHeader: signWebhookPayload(webhook.Secret, timestamp, delivery.Payload),
+	}
+	delivery.Attempts++
+	delivery.LastAttemptAt = now.UTC().Format(time.RFC3339)
+	statusCode, response, err := repository.PostWebhook(ctx, webhook.Url, headers, []byte(delivery.Payload))
+	delivery.LastDurationMillis = time.Since(now).Milliseconds()
+	delivery.LastStatusCode = statusCode
+	delivery.LastResponse = response
+	delivery.LastError = ""
+	if err != nil {
+		delivery.LastError = err.Error()
+	} else if statusCode < 200 || statusCode > 299 {
+		delivery.LastError = fmt.Sprintf("endpoint responded with status %d", statusCode)
+	}
+
+	if delivery.LastError == "" {
+		delivery.Status = models.DeliverySucceeded
+		delivery.DeliveredAt = delivery.LastAttemptAt
+		return true
+	}
+	if delivery.Attempts >= config.WEBHOOK_MAX_ATTEMPTS {
+		delivery.Status = models.DeliveryFailed
+	} else {
+		delivery.NextAttemptAt = now.Add(webhookRetryDelay(delivery.Attempts)).UTC().Format(time.RFC3339)
+	}
+	log.Ctx(ctx).Warn().Str("webhook_id", webhook.WebhookId).Str("delivery_id", delivery.DeliveryId).Int("attempts", delivery.Attempts).Str("last_error", delivery.LastError).Msg("Webhook delivery attempt failed")
+	return false
+}
+
+func deliverWebhook(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery) (bool, error) {
+	/*
+		Attempts a delivery and stores its outcome. A webhook is disabled
+		after WEBHOOK_DISABLE_AFTER_FAILURES consecutive failed attempts.
+		Params: ctx context.Context
+				webhook models.Webhook
+				delivery models.WebhookDelivery
+		Return: bool (whether the endpoint accepted the delivery), error
+	*/
+	now := time.Now()
+	succeeded := attemptWebhookDelivery(ctx, webhook, &delivery, now)
+	err := repository.PutWebhookDelivery(ctx, delivery)
+	if err != nil {
+		return succeeded, err
+	}
+	updated, err := repository.RecordWebhookAttempt(ctx, webhook.UserName, webhook.WebhookId, succeeded)
+	if err != nil {
+		if err.Error() == "404" {
+			return succeeded, nil
+		}
+		return succeeded, err
+	}
+	if !succeeded && updated.Enabled && updated.ConsecutiveFailures >= config.WEBHOOK_DISABLE_AFTER_FAILURES {
+		reason := fmt.Sprintf("disabled after %d consecutive failed deliveries", updated.ConsecutiveFailures)
+		err = repository.DisableWebhook(ctx, webhook.UserName, webhook.WebhookId, reason, now.UTC().Format(time.RFC3339))
+		if err != nil && err.Error() != "404" {
+			return succeeded, err
+		}
+	}
+	return succeeded, nil
+}
+
+func eventRecipients(ctx context.Context, userName string) ([]string, error) {
+	/*
+		Returns the users whose webhooks receive the events of a
+		subscriptions partition: the user, or the active members of a household.
+		Params: ctx context.Context
+				userName string
+		Return: []string, error
+	*/
+	householdId, ok := strings.CutPrefix(userName, config.HOUSEHOLD_PARTITION_PREFIX)
+	if !ok {
+		return []string{userName}, nil
+	}
+	members, err := repository.GetHouseholdMembers(ctx, householdId)
+	if err != nil {
+		return nil, err
+	}
+	recipients := []string{}
+	for _, member := range members {
+		if member.Status == models.MembershipActive {
+			recipients = append(recipients, member.UserName)
+		}
+	}
+	return recipients, nil
+}
+
+func webhookAccepts(webhook models.Webhook, eventType models.DomainEventType) bool {
+	/*
+		Tells whether an enabled webhook's filter lets an event type through.
+		Params: webhook models.Webhook
+				eventType models.DomainEventType
+		Return: bool
+	*/
+	if !webhook.Enabled {
+		return false
+	}
+	if len(webhook.EventTypes) == 0 {
+		return true
+	}
+	for _, accepted := range webhook.EventTypes {
+		if accepted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookPublisher delivers the events it publishes to the users' webhooks.
+type WebhookPublisher struct{}
+
+func (WebhookPublisher) Publish(ctx context.Context, domainEvents []models.DomainEvent) error {
+	return QueueWebhookDeliveries(ctx, domainEvents)
+}
+
+func QueueWebhookDeliveries(ctx context.Context, domainEvents []models.DomainEvent) error {
+	/*
+		Delivers events to the webhooks of their users whose filter accepts
+		them. Each event is stored once per webhook and attempted right away;
+		failed attempts are left to RetryWebhookDeliveries.
+		Params: ctx context.Context
+				domainEvents []models.DomainEvent
+		Return: error
+	*/
+	webhooksByUser := map[string][]models.Webhook{}
+	for _, event := range domainEvents {
+		recipients, err := eventRecipients(ctx, event.UserName)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		for _, userName := range recipients {
+			webhooks, ok := webhooksByUser[userName]
+			if !ok {
+				webhooks, err = repository.GetWebhooks(ctx, userName)
+				if err != nil {
+					return err
+				}
+				webhooksByUser[userName] = webhooks
+			}
+			for _, webhook := range webhooks {
+				if !webhookAccepts(webhook, event.Type) {
+					continue
+				}
+				now := time.Now().UTC().Format(time.RFC3339)
+				delivery := models.WebhookDelivery{
+					WebhookId:     webhook.WebhookId,
+					DeliveryId:    event.Id,
+					UserName:      userName,
+					EventType:     event.Type,
+					Payload:       string(payload),
+					Status:        models.DeliveryPending,
+					NextAttemptAt: now,
+					CreatedAt:     now,
+				}
+				created, err := repository.AddWebhookDelivery(ctx, delivery)
+				if err != nil {
+					return err
+				}
+				if !created {
+					continue
+				}
+				// the stored delivery is pending, so a failure here is retried
+				_, err = deliverWebhook(ctx, webhook, delivery)
+				if err != nil {
+					log.Ctx(ctx).Error().Err(err).Str("webhook_id", webhook.WebhookId).Str("delivery_id", delivery.DeliveryId).Msg("Error delivering webhook")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func RetryWebhookDeliveries(ctx context.Context) (models.WebhookRetryResult, error) {
+	/*
+		Attempts the pending deliveries whose next attempt is due. The
+		deliveries of a disabled webhook fail without being attempted.
+		Params: ctx context.Context
+		Return: models.WebhookRetryResult, error
+	*/
+	result := models.WebhookRetryResult{}
+	due, err := repository.GetDueWebhookDeliveries(ctx, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return result, err
+	}
+	for _, delivery := range due {
+		webhook, err := repository.GetWebhook(ctx, delivery.UserName, delivery.WebhookId)
+		if err != nil && err.Error() != "404" {
+			return result, err
+		}
+		if err != nil || !webhook.Enabled {
+			delivery.Status = models.DeliveryFailed
+			delivery.LastError = "webhook is disabled"
+			if err != nil {
+				delivery.LastError = "webhook was deleted"
+			}
+			err = repository.PutWebhookDelivery(ctx, delivery)
+			if err != nil {
+				return result, err
+			}
+			result.Failed++
+			continue
+		}
+		result.Attempted++
+		succeeded, err := deliverWebhook(ctx, webhook, delivery)
+		if err != nil {
+			return result, err
+		}
+		if succeeded {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+	}
+	log.Ctx(ctx).Info().Int("attempted", result.Attempted).Int("succeeded", result.Succeeded).Int("failed", result.Failed).Msg("Webhook deliveries retried")
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"subHandler/src/models"
+)
+
+// xlsxNumericColumns are the export columns written as numbers instead of text
+var xlsxNumericColumns = map[string]bool{"cost": true, "payment_amount": true, "refunded_amount": true, "net_amount": true, "amount_before_tax": true, "tax_amount": true, "tax_rate": true}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Subscriptions" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+
+func xlsxColumnName(index int) string {
+	/*
+		Converts a zero based column index to its spreadsheet name (0 -> A, 26 -> AA).
+		Params: index int
+		Return: string
+	*/
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func xlsxSheet(header []string, rows [][]string) string {
+	/*
+		Builds the worksheet XML for the given header and rows.
+		Params: header []string
+				rows [][]string
+		Return: string
+	*/
+	var sheet strings.Builder
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range append([][]string{header}, rows...) {
+		sheet.WriteString(`<row r="` + strconv.Itoa(r+1) + `">`)
+		for c, value := range row {
+			ref := xlsxColumnName(c) + strconv.Itoa(r+1)
+			if _, err := strconv.ParseFloat(value, 64); err == nil && r > 0 && xlsxNumericColumns[header[c]] {
+				sheet.WriteString(`<c r="` + ref + `"><v>` + value + `</v></c>`)
+				continue
+			}
+			var escaped bytes.Buffer
+			xml.EscapeText(&escaped, []byte(value))
+			sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t>` + escaped.String() + `</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+	return sheet.String()
+}
+
+func writeExportXLSX(export models.UserExport) ([]byte, error) {
+	/*
+		Writes the export as a single sheet XLSX workbook using the same
+		columns as the CSV export.
+		Params: export models.UserExport
+		Return: []byte, error
+	*/
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/worksheets/sheet1.xml", xlsxSheet(models.ExportColumns, exportRows(export))},
+	}
+	for _, part := range parts {
+		writer, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = writer.Write([]byte(part.content))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}